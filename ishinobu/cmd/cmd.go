@@ -20,13 +20,31 @@ const (
 )
 
 func Execute() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "timeline":
+			Timeline(os.Args[2:])
+			return
+		case "package":
+			Package(os.Args[2:])
+			return
+		}
+	}
+
 	// Command-line flags
 	modulesFlag := flag.String("m", "all", "Modules to run (comma-separated or 'all')")
-	exportFormat := flag.String("e", "json", "Export format (json or csv)")
+	exportFormat := flag.String("e", "json", "Export format (json, jsonl.gz, csv, bodyfile or sqlite)")
 	parallelism := flag.Int("p", 4, "Number of modules to run in parallel")
 	verbosity := flag.Int("v", 1, "Verbosity level (0=Error, 1=Info, 2=Debug)")
+	ecs := flag.Bool("ecs", false, "Map the fields of the JSON output to the Elastic Common Schema")
+	archiveFormat := flag.String("archive", "tar.gz", "Format of the collection archive (tar.gz or zip)")
+	sinkFlags := registerSinkFlags()
+	uploadFlags := registerUploadFlags()
 	flag.Parse()
 
+	utils.SetECSOutput(*ecs)
+
 	// Initialize logger
 	logger := utils.NewLogger()
 	logger.SetVerbosity(*verbosity)
@@ -44,6 +62,12 @@ func Execute() {
 		return
 	}
 
+	// Sinks forwarding the records to remote collectors
+	sinkFlags.openSinks(hostname, logsDir, logger)
+
+	// Uploads of the collection archive
+	uploaders := uploadFlags.openUploaders(hostname, logsDir, logger)
+
 	// Collection timestamp
 	collectionTimestamp := utils.Now()
 
@@ -70,8 +94,25 @@ func Execute() {
 		Verbosity:           *verbosity,
 	}
 
+	// Run manifest stored with the collected logs
+	manifest := utils.RunManifest{
+		Hostname:            hostname,
+		CollectionTimestamp: collectionTimestamp,
+		ExportFormat:        *exportFormat,
+		Modules:             make(map[string]string),
+	}
+	manifest.SerialNumber, err = utils.GetSerialNumber()
+	if err != nil {
+		logger.Debug("Failed to get serial number: %v", err)
+	}
+	manifest.MacOSVersion, err = utils.GetMacOSVersion()
+	if err != nil {
+		logger.Debug("Failed to get macOS version: %v", err)
+	}
+
 	// Run modules
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	sem := make(chan struct{}, *parallelism)
 
 	for _, moduleName := range selectedModules {
@@ -83,11 +124,15 @@ func Execute() {
 			logger.Info("Starting module: %s", moduleName)
 
 			err := mod.RunModule(moduleName, params)
+			mu.Lock()
 			if err != nil {
 				logger.Error("Module %s failed: %v", moduleName, err)
+				manifest.Modules[moduleName] = fmt.Sprintf("failed: %v", err)
 			} else {
 				logger.Info("Module %s completed", moduleName)
+				manifest.Modules[moduleName] = "completed"
 			}
+			mu.Unlock()
 
 			<-sem
 		}(moduleName)
@@ -95,14 +140,40 @@ func Execute() {
 
 	wg.Wait()
 
+	// Undo the changes made to the host by the modules
+	mod.RunCleanups()
+
+	if err := utils.CloseSQLiteOutputs(); err != nil {
+		logger.Error("Failed to close the SQLite output: %v", err)
+	}
+
+	manifest.Sinks = utils.CloseSinks()
+	for sink, status := range manifest.Sinks {
+		logger.Info("Sink %s: %s", sink, status)
+	}
+
+	manifest.EndTimestamp = utils.Now()
+	err = utils.WriteManifest(logsDir, manifest)
+	if err != nil {
+		logger.Error("Failed to write run manifest: %v", err)
+	}
+
 	// Compress output
 	outputName := fmt.Sprintf("%s.%s.tar.gz", hostname, collectionTimestamp)
+	if *archiveFormat == "zip" {
+		outputName = fmt.Sprintf("%s.%s.zip", hostname, collectionTimestamp)
+	}
 	outputFilename := filepath.Join(outputDir, outputName)
-	err = utils.CompressOutput(logsDir, outputFilename)
+	if *archiveFormat == "zip" {
+		err = utils.CompressOutputZip(logsDir, outputFilename)
+	} else {
+		err = utils.CompressOutput(logsDir, outputFilename)
+	}
 	if err != nil {
 		logger.Error("Failed to compress output: %v", err)
 	} else {
 		logger.Info("Output compressed to %s", outputName)
+		uploadArchive(outputFilename, uploaders, logger)
 	}
 
 	// Remove temporary folder to store collected logs
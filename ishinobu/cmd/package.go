@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+// Package compresses a finished collection folder into a single archive with the run manifest and the SHA-256 of
+// its files, optionally split into parts of a maximum size for constrained transfer channels. The SHA-256 of the
+// archive and of its parts are written to <archive>.sha256.
+func Package(args []string) {
+	flags := flag.NewFlagSet("package", flag.ExitOnError)
+	input := flags.String("i", "", "Collection folder to package")
+	output := flags.String("o", "", "Archive to write (defaults to <hostname>.<timestamp>.<format> from the run manifest)")
+	format := flags.String("f", "tar.gz", "Archive format (tar.gz or zip)")
+	split := flags.String("split", "", "Split the archive into parts of at most this size (e.g. 100M, 2G)")
+	flags.Parse(args)
+
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, "Usage: ishinobu package -i <collection folder> [-o archive] [-f tar.gz|zip] [-split size]")
+		os.Exit(2)
+	}
+	if info, err := os.Stat(*input); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Invalid collection folder: %s\n", *input)
+		os.Exit(2)
+	}
+	if *format != "tar.gz" && *format != "zip" {
+		fmt.Fprintf(os.Stderr, "Invalid format: %s\n", *format)
+		os.Exit(2)
+	}
+	var partSize int64
+	if *split != "" {
+		size, err := utils.ParseSize(*split)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -split size: %v\n", err)
+			os.Exit(2)
+		}
+		partSize = size
+	}
+
+	archive := *output
+	if archive == "" {
+		archive = filepath.Base(filepath.Clean(*input)) + "." + *format
+		if manifest, err := utils.ReadManifest(*input); err == nil && manifest.Hostname != "" {
+			archive = fmt.Sprintf("%s.%s.%s", manifest.Hostname, manifest.CollectionTimestamp, *format)
+		}
+	}
+
+	count, err := utils.PackageOutput(*input, archive, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error packaging %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+	checksum, err := utils.FileSHA256(archive)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error hashing %s: %v\n", archive, err)
+		os.Exit(1)
+	}
+	hashes := []string{fmt.Sprintf("%s  %s", checksum, filepath.Base(archive))}
+	fmt.Printf("Packaged %d files into %s (SHA-256 %s)\n", count, archive, checksum)
+
+	if partSize > 0 {
+		parts, err := utils.SplitFile(archive, partSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error splitting %s: %v\n", archive, err)
+			os.Exit(1)
+		}
+		for _, part := range parts {
+			partChecksum, err := utils.FileSHA256(part)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error hashing %s: %v\n", part, err)
+				os.Exit(1)
+			}
+			hashes = append(hashes, fmt.Sprintf("%s  %s", partChecksum, filepath.Base(part)))
+		}
+		// The parts are joined back with cat and verified with the hash of the archive
+		if err := os.Remove(archive); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing %s: %v\n", archive, err)
+		}
+		fmt.Printf("Split into %d parts of at most %s: %s.001 to %s.%03d\n", len(parts), *split, archive, archive, len(parts))
+	}
+
+	if err := os.WriteFile(archive+".sha256", []byte(strings.Join(hashes, "\n")+"\n"), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s.sha256: %v\n", archive, err)
+		os.Exit(1)
+	}
+}
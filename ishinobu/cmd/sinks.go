@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"flag"
+	"os"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+// sinkFlags holds the command-line flags of the sinks forwarding the records to remote collectors
+type sinkFlags struct {
+	splunkURL      *string
+	splunkToken    *string
+	splunkIndex    *string
+	splunkInsecure *bool
+	esURL          *string
+	esIndex        *string
+	esUser         *string
+	esPassword     *string
+	esAPIKey       *string
+	esInsecure     *bool
+	syslogAddress  *string
+	syslogProtocol *string
+	syslogFormat   *string
+	syslogInsecure *bool
+	kafkaBrokers   *string
+	kafkaTopic     *string
+	kafkaPerModule *bool
+	kafkaTLS       *bool
+	kafkaInsecure  *bool
+	kafkaUser      *string
+	kafkaPassword  *string
+}
+
+// registerSinkFlags defines the flags of the sinks. Secrets can also be given through environment variables to
+// keep them out of the process list.
+func registerSinkFlags() *sinkFlags {
+	return &sinkFlags{
+		splunkURL:      flag.String("splunk-url", "", "Splunk HTTP Event Collector URL (https://splunk:8088)"),
+		splunkToken:    flag.String("splunk-token", "", "Splunk HEC token (or ISHINOBU_SPLUNK_TOKEN)"),
+		splunkIndex:    flag.String("splunk-index", "", "Splunk index (defaults to the index of the token)"),
+		splunkInsecure: flag.Bool("splunk-insecure", false, "Skip the verification of the Splunk certificate"),
+		esURL:          flag.String("es-url", "", "Elasticsearch or OpenSearch URL (https://elastic:9200)"),
+		esIndex:        flag.String("es-index", "ishinobu", "Prefix of the Elasticsearch indexes (<prefix>-<module>)"),
+		esUser:         flag.String("es-user", "", "Elasticsearch user"),
+		esPassword:     flag.String("es-password", "", "Elasticsearch password (or ISHINOBU_ES_PASSWORD)"),
+		esAPIKey:       flag.String("es-api-key", "", "Elasticsearch API key (or ISHINOBU_ES_API_KEY)"),
+		esInsecure:     flag.Bool("es-insecure", false, "Skip the verification of the Elasticsearch certificate"),
+		syslogAddress:  flag.String("syslog-address", "", "Syslog collector address (host:port)"),
+		syslogProtocol: flag.String("syslog-protocol", "tls", "Syslog transport (tcp or tls)"),
+		syslogFormat:   flag.String("syslog-format", "rfc5424", "Syslog message format (rfc5424 or cef)"),
+		syslogInsecure: flag.Bool("syslog-insecure", false, "Skip the verification of the syslog collector certificate"),
+		kafkaBrokers:   flag.String("kafka-brokers", "", "Kafka bootstrap brokers (host:port, comma separated)"),
+		kafkaTopic:     flag.String("kafka-topic", "ishinobu", "Kafka topic, or prefix of the topics with -kafka-topic-per-module"),
+		kafkaPerModule: flag.Bool("kafka-topic-per-module", false, "Produce the records of each module to <topic>-<module>"),
+		kafkaTLS:       flag.Bool("kafka-tls", false, "Connect to the Kafka brokers with TLS"),
+		kafkaInsecure:  flag.Bool("kafka-insecure", false, "Skip the verification of the Kafka certificates"),
+		kafkaUser:      flag.String("kafka-user", "", "Kafka SASL PLAIN user"),
+		kafkaPassword:  flag.String("kafka-password", "", "Kafka SASL PLAIN password (or ISHINOBU_KAFKA_PASSWORD)"),
+	}
+}
+
+// openSinks registers the configured sinks. The batches that cannot be delivered are spilled to spillDir.
+func (f *sinkFlags) openSinks(hostname, spillDir string, logger *utils.Logger) {
+	options := utils.DefaultSinkOptions(spillDir)
+
+	if *f.splunkURL != "" {
+		token := *f.splunkToken
+		if token == "" {
+			token = os.Getenv("ISHINOBU_SPLUNK_TOKEN")
+		}
+		sink, err := utils.NewSplunkSink(*f.splunkURL, token, *f.splunkIndex, hostname, *f.splunkInsecure)
+		if err != nil {
+			logger.Error("Failed to configure the Splunk sink: %v", err)
+		} else {
+			utils.AddSink(sink, options)
+			logger.Info("Forwarding records to Splunk HEC %s", *f.splunkURL)
+		}
+	}
+
+	if *f.esURL != "" {
+		password := *f.esPassword
+		if password == "" {
+			password = os.Getenv("ISHINOBU_ES_PASSWORD")
+		}
+		apiKey := *f.esAPIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("ISHINOBU_ES_API_KEY")
+		}
+		sink, err := utils.NewElasticsearchSink(*f.esURL, *f.esIndex, *f.esUser, password, apiKey, *f.esInsecure)
+		if err != nil {
+			logger.Error("Failed to configure the Elasticsearch sink: %v", err)
+		} else {
+			utils.AddSink(sink, options)
+			logger.Info("Forwarding records to Elasticsearch %s", *f.esURL)
+		}
+	}
+
+	if *f.syslogAddress != "" {
+		sink, err := utils.NewSyslogSink(*f.syslogAddress, *f.syslogProtocol, *f.syslogFormat, hostname, *f.syslogInsecure)
+		if err != nil {
+			logger.Error("Failed to configure the syslog sink: %v", err)
+		} else {
+			utils.AddSink(sink, options)
+			logger.Info("Forwarding records to syslog %s://%s (%s)", *f.syslogProtocol, *f.syslogAddress, *f.syslogFormat)
+		}
+	}
+
+	if *f.kafkaBrokers != "" {
+		password := *f.kafkaPassword
+		if password == "" {
+			password = os.Getenv("ISHINOBU_KAFKA_PASSWORD")
+		}
+		var tlsConfig *tls.Config
+		if *f.kafkaTLS {
+			tlsConfig = &tls.Config{InsecureSkipVerify: *f.kafkaInsecure}
+		}
+		sink, err := utils.NewKafkaSink(*f.kafkaBrokers, *f.kafkaTopic, *f.kafkaPerModule, hostname, tlsConfig, *f.kafkaUser, password)
+		if err != nil {
+			logger.Error("Failed to configure the Kafka sink: %v", err)
+		} else {
+			utils.AddSink(sink, options)
+			logger.Info("Forwarding records to Kafka %s", *f.kafkaBrokers)
+		}
+	}
+}
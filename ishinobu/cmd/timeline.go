@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+// Timeline builds a single super-timeline from the module outputs of a collection folder or archive, sorted by
+// the event timestamps and tagged with the module of each record, in the ndjson, CSV and body file formats.
+func Timeline(args []string) {
+	flags := flag.NewFlagSet("timeline", flag.ExitOnError)
+	input := flags.String("i", "", "Collection folder or archive (.tar.gz or .zip) to read")
+	output := flags.String("o", "timeline", "Output files prefix (<prefix>.<format>)")
+	formats := flags.String("f", "ndjson,csv", "Output formats (comma-separated: ndjson, csv, bodyfile)")
+	from := flags.String("from", "", "Keep the events at or after this time (RFC 3339 or YYYY-MM-DD)")
+	to := flags.String("to", "", "Keep the events before this time (RFC 3339 or YYYY-MM-DD, the whole day included)")
+	flags.Parse(args)
+
+	if *input == "" {
+		fmt.Fprintln(os.Stderr, "Usage: ishinobu timeline -i <collection folder or archive> [-o prefix] [-from time] [-to time]")
+		os.Exit(2)
+	}
+
+	var start, end time.Time
+	if *from != "" {
+		t, ok := utils.NormalizeTimestamp(*from)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid -from time: %s\n", *from)
+			os.Exit(2)
+		}
+		start = t
+	}
+	if *to != "" {
+		t, ok := utils.NormalizeTimestamp(*to)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid -to time: %s\n", *to)
+			os.Exit(2)
+		}
+		if len(strings.TrimSpace(*to)) == len("2006-01-02") {
+			t = t.Add(24 * time.Hour)
+		}
+		end = t
+	}
+	filtered := !start.IsZero() || !end.IsZero()
+
+	selectedFormats := strings.Split(*formats, ",")
+	for _, format := range selectedFormats {
+		if format != "ndjson" && format != "csv" && format != "bodyfile" {
+			fmt.Fprintf(os.Stderr, "Invalid format: %s\n", format)
+			os.Exit(2)
+		}
+	}
+
+	var events []utils.TimelineEvent
+	undated := 0
+	err := utils.ReadCollection(*input, func(module, format string, r io.Reader) error {
+		records, err := utils.ReadModuleOutput(r, format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", module, err)
+		}
+		for _, record := range records {
+			eventTimestamp, _ := record["event_timestamp"].(string)
+			if eventTimestamp == "" {
+				// Outputs mapped to the Elastic Common Schema (-ecs)
+				eventTimestamp, _ = record["@timestamp"].(string)
+			}
+			timestamp, ok := utils.NormalizeTimestamp(eventTimestamp)
+			if !ok {
+				undated++
+				if filtered {
+					continue
+				}
+			} else if (!start.IsZero() && timestamp.Before(start)) || (!end.IsZero() && !timestamp.Before(end)) {
+				continue
+			}
+			events = append(events, utils.TimelineEvent{Timestamp: timestamp, Module: module, Record: record})
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", *input, err)
+		os.Exit(1)
+	}
+	utils.SortTimeline(events)
+
+	for _, format := range selectedFormats {
+		if err := writeTimeline(*output+"."+format, format, events); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the timeline: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Timeline of %d events written to %s.{%s} (%d records without a valid timestamp)\n",
+		len(events), *output, *formats, undated)
+}
+
+// writeTimeline writes the events to a file in the ndjson, CSV or body file format. The CSV holds the timestamp,
+// the module, the source file and the other fields of the record as a JSON object.
+func writeTimeline(path, format string, events []utils.TimelineEvent) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	csvWriter := csv.NewWriter(file)
+	defer csvWriter.Flush()
+	if format == "csv" {
+		if err := csvWriter.Write([]string{"timestamp", "module", "source_file", "event_timestamp", "data"}); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		timestamp := ""
+		if !event.Timestamp.IsZero() {
+			timestamp = event.Timestamp.Format(utils.TimeFormat)
+		}
+		sourceFile, _ := event.Record["source_file"].(string)
+		eventTimestamp, _ := event.Record["event_timestamp"].(string)
+		collectionTimestamp, _ := event.Record["collection_timestamp"].(string)
+
+		line := make(map[string]interface{})
+		data := make(map[string]interface{})
+		for key, value := range event.Record {
+			line[key] = value
+			switch key {
+			case "event_timestamp", "source_file":
+			case "collection_timestamp":
+				if format == "csv" {
+					data[key] = value
+				}
+			default:
+				data[key] = value
+			}
+		}
+		line["timestamp"] = timestamp
+		line["module"] = event.Module
+
+		switch format {
+		case "ndjson":
+			err = encoder.Encode(line)
+		case "csv":
+			var dataJSON []byte
+			dataJSON, err = json.Marshal(data)
+			if err == nil {
+				err = csvWriter.Write([]string{timestamp, event.Module, sourceFile, eventTimestamp, string(dataJSON)})
+			}
+		case "bodyfile":
+			record := utils.Record{
+				CollectionTimestamp: collectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				SourceFile:          sourceFile,
+				Data:                data,
+			}
+			_, err = fmt.Fprintln(file, utils.BodyfileLine(event.Module, record))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+// uploadFlags holds the command-line flags of the uploads of the collection archive
+type uploadFlags struct {
+	s3Bucket   *string
+	s3Prefix   *string
+	s3Region   *string
+	s3Endpoint *string
+	s3Access   *string
+	s3Secret   *string
+	s3Insecure *bool
+	azureURL   *string
+	azurePfx   *string
+	azureSAS   *string
+	azureKey   *string
+	gcsBucket  *string
+	gcsPrefix  *string
+	gcsCreds   *string
+	gcsToken   *string
+	sftpHost   *string
+	sftpPort   *int
+	sftpUser   *string
+	sftpKey    *string
+	sftpDest   *string
+	sftpHosts  *string
+	sftpNewKey *bool
+	httpsURL   *string
+	httpsDone  *string
+	httpsCert  *string
+	httpsKey   *string
+	httpsCA    *string
+	httpsNoTLS *bool
+	httpsFlow  *bool
+}
+
+// registerUploadFlags defines the flags of the uploads. Credentials can also be given through the usual environment
+// variables of each storage.
+func registerUploadFlags() *uploadFlags {
+	return &uploadFlags{
+		s3Bucket:   flag.String("s3-bucket", "", "S3 bucket receiving the collection archive"),
+		s3Prefix:   flag.String("s3-prefix", "", "Prefix of the key of the collection archive in the bucket"),
+		s3Region:   flag.String("s3-region", "", "S3 region (or AWS_REGION, defaults to us-east-1)"),
+		s3Endpoint: flag.String("s3-endpoint", "", "Endpoint of S3-compatible storage (https://minio:9000)"),
+		s3Access:   flag.String("s3-access-key", "", "S3 access key (or AWS_ACCESS_KEY_ID)"),
+		s3Secret:   flag.String("s3-secret-key", "", "S3 secret key (or AWS_SECRET_ACCESS_KEY)"),
+		s3Insecure: flag.Bool("s3-insecure", false, "Skip the verification of the S3 endpoint certificate"),
+		azureURL:   flag.String("azure-url", "", "Azure Blob Storage container URL (https://<account>.blob.core.windows.net/<container>)"),
+		azurePfx:   flag.String("azure-prefix", "", "Prefix of the name of the collection archive in the container"),
+		azureSAS:   flag.String("azure-sas", "", "Azure SAS token of the container (or AZURE_STORAGE_SAS_TOKEN)"),
+		azureKey:   flag.String("azure-key", "", "Azure storage account key (or AZURE_STORAGE_KEY)"),
+		gcsBucket:  flag.String("gcs-bucket", "", "Google Cloud Storage bucket receiving the collection archive"),
+		gcsPrefix:  flag.String("gcs-prefix", "", "Prefix of the name of the collection archive in the bucket"),
+		gcsCreds:   flag.String("gcs-credentials", "", "Service account key file (or GOOGLE_APPLICATION_CREDENTIALS)"),
+		gcsToken:   flag.String("gcs-token", "", "OAuth access token (or GOOGLE_OAUTH_ACCESS_TOKEN)"),
+		sftpHost:   flag.String("sftp-host", "", "SFTP server receiving the collection archive"),
+		sftpPort:   flag.Int("sftp-port", 22, "SFTP server port"),
+		sftpUser:   flag.String("sftp-user", "", "SFTP user"),
+		sftpKey:    flag.String("sftp-key", "", "Private key of the SFTP user (defaults to the SSH agent and configuration)"),
+		sftpDest:   flag.String("sftp-dest", ".", "Remote folder receiving the collection archive"),
+		sftpHosts:  flag.String("sftp-known-hosts", "", "Known hosts file verifying the key of the SFTP server"),
+		sftpNewKey: flag.Bool("sftp-accept-new", false, "Trust the key of an SFTP server missing from the known hosts"),
+		httpsURL:   flag.String("https-url", "", "Collection server URL receiving the collection archive"),
+		httpsDone:  flag.String("https-manifest-url", "", "URL receiving the completion manifests (defaults to <https-url>/complete)"),
+		httpsCert:  flag.String("https-cert", "", "Client certificate authenticating to the collection server"),
+		httpsKey:   flag.String("https-key", "", "Private key of the client certificate"),
+		httpsCA:    flag.String("https-ca", "", "CA certificate verifying the collection server"),
+		httpsNoTLS: flag.Bool("https-insecure", false, "Skip the verification of the collection server certificate"),
+		httpsFlow:  flag.Bool("https-stream", false, "Stream the records to <https-url>/records while they are collected"),
+	}
+}
+
+// openUploaders returns the configured uploaders, before the modules run so that configuration errors are reported
+// right away. The record stream to the collection server is registered as a sink spilling to spillDir.
+func (f *uploadFlags) openUploaders(hostname, spillDir string, logger *utils.Logger) []utils.Uploader {
+	var uploaders []utils.Uploader
+
+	if *f.s3Bucket != "" {
+		region := *f.s3Region
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if region == "" {
+			region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		options := utils.S3Options{
+			Endpoint:     *f.s3Endpoint,
+			Region:       region,
+			Bucket:       *f.s3Bucket,
+			Prefix:       *f.s3Prefix,
+			AccessKey:    envDefault(*f.s3Access, "AWS_ACCESS_KEY_ID"),
+			SecretKey:    envDefault(*f.s3Secret, "AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			Insecure:     *f.s3Insecure,
+		}
+		uploader, err := utils.NewS3Uploader(options)
+		if err != nil {
+			logger.Error("Failed to configure the S3 upload: %v", err)
+		} else {
+			uploaders = append(uploaders, uploader)
+		}
+	}
+
+	if *f.azureURL != "" {
+		uploader, err := utils.NewAzureUploader(utils.AzureOptions{
+			ContainerURL: *f.azureURL,
+			Prefix:       *f.azurePfx,
+			SASToken:     envDefault(*f.azureSAS, "AZURE_STORAGE_SAS_TOKEN"),
+			AccountKey:   envDefault(*f.azureKey, "AZURE_STORAGE_KEY"),
+		})
+		if err != nil {
+			logger.Error("Failed to configure the Azure upload: %v", err)
+		} else {
+			uploaders = append(uploaders, uploader)
+		}
+	}
+
+	if *f.gcsBucket != "" {
+		uploader, err := utils.NewGCSUploader(utils.GCSOptions{
+			Bucket:          *f.gcsBucket,
+			Prefix:          *f.gcsPrefix,
+			CredentialsFile: envDefault(*f.gcsCreds, "GOOGLE_APPLICATION_CREDENTIALS"),
+			AccessToken:     envDefault(*f.gcsToken, "GOOGLE_OAUTH_ACCESS_TOKEN"),
+		})
+		if err != nil {
+			logger.Error("Failed to configure the GCS upload: %v", err)
+		} else {
+			uploaders = append(uploaders, uploader)
+		}
+	}
+
+	if *f.sftpHost != "" {
+		uploader, err := utils.NewSFTPUploader(utils.SFTPOptions{
+			Host:             *f.sftpHost,
+			Port:             *f.sftpPort,
+			User:             *f.sftpUser,
+			KeyFile:          *f.sftpKey,
+			Destination:      *f.sftpDest,
+			KnownHostsFile:   *f.sftpHosts,
+			AcceptNewHostKey: *f.sftpNewKey,
+		})
+		if err != nil {
+			logger.Error("Failed to configure the SFTP upload: %v", err)
+		} else {
+			uploaders = append(uploaders, uploader)
+		}
+	}
+
+	if *f.httpsURL != "" {
+		options := utils.HTTPSOptions{
+			URL:         *f.httpsURL,
+			ManifestURL: *f.httpsDone,
+			CertFile:    *f.httpsCert,
+			KeyFile:     *f.httpsKey,
+			CAFile:      *f.httpsCA,
+			Insecure:    *f.httpsNoTLS,
+			Hostname:    hostname,
+		}
+		uploader, err := utils.NewHTTPSUploader(options)
+		if err != nil {
+			logger.Error("Failed to configure the collection server upload: %v", err)
+		} else {
+			uploaders = append(uploaders, uploader)
+		}
+		if *f.httpsFlow {
+			sink, err := utils.NewHTTPSSink(options)
+			if err != nil {
+				logger.Error("Failed to configure the collection server stream: %v", err)
+			} else {
+				utils.AddSink(sink, utils.DefaultSinkOptions(spillDir))
+				logger.Info("Streaming records to %s/records", strings.TrimSuffix(*f.httpsURL, "/"))
+			}
+		}
+	}
+
+	return uploaders
+}
+
+// uploadArchive uploads the collection archive with every uploader
+func uploadArchive(path string, uploaders []utils.Uploader, logger *utils.Logger) {
+	if len(uploaders) == 0 {
+		return
+	}
+	checksum, err := utils.FileSHA256(path)
+	if err != nil {
+		logger.Error("Failed to hash %s: %v", path, err)
+		return
+	}
+	logger.Info("Archive SHA-256: %s", checksum)
+
+	for _, uploader := range uploaders {
+		location, err := uploader.Upload(path)
+		if err != nil {
+			logger.Error("Failed to upload the archive to %s: %v", uploader.Name(), err)
+			continue
+		}
+		logger.Info("Archive uploaded to %s", location)
+	}
+}
+
+// envDefault returns value, or the environment variable name when value is empty
+func envDefault(value, name string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(name)
+}
@@ -0,0 +1,28 @@
+package mod
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LoadModuleConfig reads the optional configuration file of a module from the input directory
+// (<InputDir>/<module name>.json) and decodes it into config.
+// If the file does not exist, config is left untouched so modules can keep their defaults.
+func LoadModuleConfig(params ModuleParams, moduleName string, config interface{}) error {
+	configPath := filepath.Join(params.InputDir, moduleName+".json")
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read module configuration %s: %v", configPath, err)
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("failed to parse module configuration %s: %v", configPath, err)
+	}
+
+	return nil
+}
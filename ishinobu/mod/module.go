@@ -2,12 +2,18 @@ package mod
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
 )
 
 var moduleRegistry = make(map[string]Module)
 
+var (
+	cleanups   []func()
+	cleanupsMu sync.Mutex
+)
+
 type Module interface {
 	GetName() string // Name of the module
 	Run(params ModuleParams) error
@@ -42,3 +48,21 @@ func RunModule(name string, params ModuleParams) error {
 	}
 	return module.Run(params)
 }
+
+// RegisterCleanup registers a function undoing a change made to the host by a module, such as a mount.
+// The cleanups are run by RunCleanups once every module has completed.
+func RegisterCleanup(cleanup func()) {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+	cleanups = append(cleanups, cleanup)
+}
+
+// RunCleanups runs the registered cleanups in the reverse order of their registration.
+func RunCleanups() {
+	cleanupsMu.Lock()
+	defer cleanupsMu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
+}
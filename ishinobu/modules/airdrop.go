@@ -0,0 +1,180 @@
+// This module collects AirDrop settings and activity:
+//   - Discoverability: DiscoverableMode of /Users/*/Library/Preferences/com.apple.sharingd.plist
+//     (Off, Contacts Only, Everyone) and the AirDrop restrictions of the system preferences.
+//   - Unified logs: AirDrop messages of sharingd (subsystem com.apple.sharing, category AirDrop) over the
+//     configured window. The direction, peer device name and file names are extracted from the messages when logged.
+//
+// The window defaults to the last 7 days and can be changed in <InputDir>/airdrop.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type AirDropModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &AirDropModule{
+		Name:        "airdrop",
+		Description: "Collects AirDrop discoverability and send/receive events"}
+	mod.RegisterModule(module)
+}
+
+func (m *AirDropModule) GetName() string {
+	return m.Name
+}
+
+func (m *AirDropModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	airDropSenderRegex   = regexp.MustCompile(`(?i)sender(?:ComputerName|Name)?\s*[:=]\s*"?([^",;}\n]+)"?`)
+	airDropReceiverRegex = regexp.MustCompile(`(?i)(?:receiver|recipient)(?:ComputerName|Name)?\s*[:=]\s*"?([^",;}\n]+)"?`)
+	airDropFilesRegex    = regexp.MustCompile(`(?i)(?:files?(?:names?)?|items?)\s*[:=]\s*\(?\s*"?([^")\n]+)`)
+)
+
+func (m *AirDropModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	err = collectAirDropSettings(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error collecting AirDrop settings: %v", err)
+	}
+
+	err = collectAirDropEvents(m.GetName()+"-events", config.Days, params)
+	if err != nil {
+		params.Logger.Debug("Error collecting AirDrop events: %v", err)
+	}
+
+	return nil
+}
+
+func collectAirDropSettings(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeSetting := func(sourceFile string, recordData map[string]interface{}) {
+		eventTimestamp := fileModTime(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.sharingd.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		mode, _ := preferences["DiscoverableMode"].(string)
+		writeSetting(path, map[string]interface{}{
+			"username":          utils.GetUsernameFromPath(path),
+			"discoverable_mode": mode,
+			"everyone":          strings.EqualFold(mode, "Everyone"),
+			"disabled":          preferences["DisableAirDrop"],
+		})
+	}
+
+	// AirDrop restriction set by configuration profiles or defaults
+	networkBrowserPath := "/Library/Preferences/com.apple.NetworkBrowser.plist"
+	var networkBrowser map[string]interface{}
+	if err := utils.ParsePlistFile(networkBrowserPath, &networkBrowser); err == nil {
+		writeSetting(networkBrowserPath, map[string]interface{}{
+			"username":          "",
+			"discoverable_mode": "",
+			"everyone":          false,
+			"disabled":          networkBrowser["DisableAirDrop"],
+		})
+	}
+
+	return nil
+}
+
+func collectAirDropEvents(moduleName string, days int, params mod.ModuleParams) error {
+	startTime, endTime := unifiedLogsTimeRange(days)
+	query := LogCommand{
+		Predicate: `subsystem == "com.apple.sharing" AND (category == "AirDrop" OR eventMessage CONTAINS[c] "airdrop")`,
+		Info:      true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+
+		message, _ := recordData["message"].(string)
+		recordData["direction"] = airDropDirection(message)
+		recordData["peer"] = ""
+		if match := airDropSenderRegex.FindStringSubmatch(message); match != nil {
+			recordData["peer"] = strings.TrimSpace(match[1])
+		} else if match := airDropReceiverRegex.FindStringSubmatch(message); match != nil {
+			recordData["peer"] = strings.TrimSpace(match[1])
+		}
+		recordData["files"] = ""
+		if match := airDropFilesRegex.FindStringSubmatch(message); match != nil {
+			recordData["files"] = strings.TrimSpace(match[1])
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// airDropDirection infers whether an AirDrop message is about a transfer sent or received by the host
+func airDropDirection(message string) string {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "receiv") || strings.Contains(message, "incoming") || strings.Contains(message, "ask request"):
+		return "received"
+	case strings.Contains(message, "send") || strings.Contains(message, "sent") || strings.Contains(message, "outgoing"):
+		return "sent"
+	}
+	return ""
+}
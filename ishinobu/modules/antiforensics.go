@@ -0,0 +1,247 @@
+// This module looks for evidence of covering tracks across artifacts and emits one finding per evidence, with a
+// severity (high, medium, low):
+//   - Shell histories: history files of zero length, recently truncated (modified within the window with a few
+//     lines left) or linked to /dev/null.
+//   - Disabled history: unset HISTFILE, HISTFILE=/dev/null, HISTSIZE=0, SAVEHIST=0 or set +o history in the
+//     shell startup files.
+//   - Cleanup commands in the histories: log erase, history -c, shred, srm, rm of histories or logs, ...
+//   - Unified logs: sudo and log commands erasing the logs or changing the log configuration within the window,
+//     the logging preferences (/Library/Preferences/Logging) and the age of the oldest log file.
+//   - System logs of zero length in /private/var/log.
+//   - Browsers: History databases deleted while their journal or write-ahead log files are left (Chrome, Edge,
+//     Brave, Safari, Firefox).
+//
+// The window defaults to the last 30 days and can be changed in <InputDir>/antiforensics.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type AntiForensicsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &AntiForensicsModule{
+		Name:        "antiforensics",
+		Description: "Detects cleared or disabled shell histories, erased logs and deleted browser histories"}
+	mod.RegisterModule(module)
+}
+
+func (m *AntiForensicsModule) GetName() string {
+	return m.Name
+}
+
+func (m *AntiForensicsModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	antiForensicsHistoryPaths = []string{
+		"/Users/*/.zsh_history",
+		"/Users/*/.bash_history",
+		"/Users/*/.sh_history",
+		"/Users/*/.zhistory",
+		"/Users/*/.local/share/fish/fish_history",
+		"/private/var/root/.zsh_history",
+		"/private/var/root/.bash_history",
+	}
+	antiForensicsSystemLogs = []string{
+		"/private/var/log/system.log",
+		"/private/var/log/install.log",
+		"/private/var/log/wifi.log",
+		"/private/var/log/fsck_apfs.log",
+		"/private/var/log/jamf.log",
+	}
+	// Browser history databases and the files left when they are deleted
+	browserHistoryFiles = map[string][]string{
+		"/Users/*/Library/Application Support/Google/Chrome/*/History":               {"-journal", "-wal"},
+		"/Users/*/Library/Application Support/Microsoft Edge/*/History":              {"-journal", "-wal"},
+		"/Users/*/Library/Application Support/BraveSoftware/Brave-Browser/*/History": {"-journal", "-wal"},
+		"/Users/*/Library/Safari/History.db":                                         {"-wal", "-shm"},
+		"/Users/*/Library/Application Support/Firefox/Profiles/*/places.sqlite":      {"-wal", "-shm"},
+	}
+	historyDisabledRegex = regexp.MustCompile(`^\s*(?:export\s+)?(?:unset\s+HISTFILE\b|HISTFILE=["']?/dev/null|HISTSIZE=["']?0["']?\s*$|SAVEHIST=["']?0["']?\s*$|HISTFILESIZE=["']?0["']?\s*$|set\s+\+o\s+history\b|setopt\s+.*\bno_?hist)`)
+	cleanupCommandRegex  = regexp.MustCompile(`(?i)(\blog\s+erase\b|\blog\s+config\b.*--mode|\bhistory\s+-c\b|\bshred\b|\bsrm\b|\brm\b.*(?:_history|\.bash_sessions|/var/log|/var/db/diagnostics|/var/audit|QuarantineEvents|knowledgeC)|\btouch\s+(?:-\w+\s+)*-\w*[dt]\b|\bSetFile\s+.*-[dm]\b|\bunset\s+HISTFILE\b)`)
+)
+
+func (m *AntiForensicsModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+	windowStart := time.Now().AddDate(0, 0, -config.Days)
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeFinding := func(sourceFile, eventTimestamp, check, severity, detail string) {
+		username := utils.GetUsernameFromPath(sourceFile)
+		if username == "" && strings.HasPrefix(sourceFile, "/private/var/root") {
+			username = "root"
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data: map[string]interface{}{
+				"check":    check,
+				"severity": severity,
+				"path":     sourceFile,
+				"detail":   detail,
+				"username": username,
+			},
+			SourceFile: sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Shell histories
+	for _, path := range utils.GlobPaths(antiForensicsHistoryPaths...) {
+		if target, err := os.Readlink(path); err == nil {
+			severity := "medium"
+			if target == "/dev/null" {
+				severity = "high"
+			}
+			writeFinding(path, fileModTime(path), "history_link", severity, "history file is a link to "+target)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		modified := info.ModTime().UTC().Format(utils.TimeFormat)
+		recent := info.ModTime().After(windowStart)
+		if info.Size() == 0 {
+			severity := "medium"
+			if recent {
+				severity = "high"
+			}
+			writeFinding(path, modified, "empty_history", severity, "history file has zero length")
+			continue
+		}
+
+		var entries []historyEntry
+		if historyShell(path) == "fish" {
+			entries, err = readFishHistory(path)
+		} else {
+			entries, err = readShellHistory(path)
+		}
+		if err != nil {
+			params.Logger.Debug("Error reading history file %s: %v", path, err)
+			continue
+		}
+		if recent && len(entries) < 5 {
+			writeFinding(path, modified, "truncated_history", "medium",
+				fmt.Sprintf("history file modified within the window with %d commands left", len(entries)))
+		}
+		for _, entry := range entries {
+			if cleanupCommandRegex.MatchString(entry.Command) {
+				writeFinding(path, entry.Timestamp, "cleanup_command", "medium", entry.Command)
+			}
+		}
+	}
+
+	// History disabled in the shell startup files
+	for _, path := range utils.GlobPaths(shellStartupPaths...) {
+		lines, modified, err := readConfigLines(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range lines {
+			if historyDisabledRegex.MatchString(line) {
+				writeFinding(path, modified, "history_disabled", "high", line)
+			}
+		}
+	}
+
+	// System logs of zero length
+	for _, path := range antiForensicsSystemLogs {
+		if info, err := os.Stat(path); err == nil && info.Size() == 0 {
+			writeFinding(path, fileModTime(path), "empty_log", "medium", "log file has zero length")
+		}
+	}
+
+	// Deleted browser histories
+	patterns := make([]string, 0, len(browserHistoryFiles))
+	for pattern := range browserHistoryFiles {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		for _, suffix := range browserHistoryFiles[pattern] {
+			for _, leftover := range utils.GlobPaths(pattern + suffix) {
+				database := strings.TrimSuffix(leftover, suffix)
+				if _, err := os.Stat(database); os.IsNotExist(err) {
+					writeFinding(leftover, fileModTime(leftover), "browser_history_deleted", "high",
+						fmt.Sprintf("%s is missing while %s is present", filepath.Base(database), filepath.Base(leftover)))
+				}
+			}
+		}
+	}
+
+	// Logging preferences changed with log config
+	for _, path := range utils.GlobPaths("/Library/Preferences/Logging/*.plist", "/Library/Preferences/Logging/Subsystems/*.plist") {
+		modified := fileModTime(path)
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(windowStart) {
+			writeFinding(path, modified, "log_config_changed", "low", "logging preferences modified within the window")
+		}
+	}
+
+	// Oldest unified log file
+	oldest := time.Time{}
+	for _, path := range utils.GlobPaths("/private/var/db/diagnostics/Persist/*.tracev3", "/private/var/db/diagnostics/Special/*.tracev3") {
+		if info, err := os.Stat(path); err == nil && (oldest.IsZero() || info.ModTime().Before(oldest)) {
+			oldest = info.ModTime()
+		}
+	}
+	if !oldest.IsZero() && time.Since(oldest) < 24*time.Hour {
+		writeFinding("/private/var/db/diagnostics", oldest.UTC().Format(utils.TimeFormat), "unified_log_recent", "medium",
+			"the oldest unified log file was written in the last 24 hours")
+	}
+
+	// Log erase and log config commands
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `(process == "sudo" AND (eventMessage CONTAINS[c] "log erase" OR eventMessage CONTAINS[c] "log config")) OR ` +
+			`(process == "log" AND eventMessage CONTAINS[c] "erase") OR ` +
+			`(process == "logd" AND eventMessage CONTAINS[c] "erase")`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error querying unified logs: %v", err)
+		return nil
+	}
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := recordData["message"].(string)
+		check, severity := "log_config_command", "medium"
+		if strings.Contains(strings.ToLower(message), "erase") {
+			check, severity = "log_erase", "high"
+		}
+		writeFinding("unifiedlogs", timestamp, check, severity, message)
+	}
+
+	return nil
+}
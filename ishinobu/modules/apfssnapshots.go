@@ -0,0 +1,226 @@
+// This module lists the local APFS snapshots of the system and data volumes:
+// - diskutil apfs listSnapshots <volume> -plist: name, UUID, XID and purgeable state of each snapshot.
+// - tmutil listlocalsnapshots /: Time Machine local snapshots, whose names contain their creation date.
+// The creation time of every snapshot is read from the volume (fs_snapshot_list), the date in the name of Time
+// Machine snapshots being used when it is not available.
+// A snapshot can be mounted read-only (nobrowse) so its content, including files deleted after the snapshot was
+// taken, can be examined in dead-disk style. The snapshot and mount point are set in <InputDir>/apfssnapshots.json:
+//
+//	{
+//	  "mount": "com.apple.TimeMachine.2024-05-01-101500.local",
+//	  "volume": "/System/Volumes/Data",
+//	  "mount_point": "/tmp/ishinobu-snapshot",
+//	  "keep_mounted": false
+//	}
+//
+// The mount point is reported in the record of the snapshot. The snapshot is unmounted at the end of the
+// collection so that the host is left unchanged, unless keep_mounted is set for an analysis after the collection.
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type APFSSnapshotsModule struct {
+	Name        string
+	Description string
+}
+
+// APFSSnapshotsConfig is the configuration of the apfssnapshots module.
+type APFSSnapshotsConfig struct {
+	Mount       string `json:"mount"`
+	Volume      string `json:"volume"`
+	MountPoint  string `json:"mount_point"`
+	KeepMounted bool   `json:"keep_mounted"`
+}
+
+func init() {
+	module := &APFSSnapshotsModule{
+		Name:        "apfssnapshots",
+		Description: "Lists local APFS snapshots and optionally mounts one read-only"}
+	mod.RegisterModule(module)
+}
+
+func (m *APFSSnapshotsModule) GetName() string {
+	return m.Name
+}
+
+func (m *APFSSnapshotsModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	apfsSnapshotVolumes   = []string{"/", "/System/Volumes/Data"}
+	timeMachineDateRegex  = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}-\d{6})`)
+	timeMachineDateLayout = "2006-01-02-150405"
+)
+
+// apfsSnapshotList is the output of `diskutil apfs listSnapshots -plist`
+type apfsSnapshotList struct {
+	Snapshots []struct {
+		SnapshotName string `plist:"SnapshotName"`
+		SnapshotUUID string `plist:"SnapshotUUID"`
+		SnapshotXID  uint64 `plist:"SnapshotXID"`
+		Purgeable    bool   `plist:"Purgeable"`
+	} `plist:"Snapshots"`
+}
+
+func (m *APFSSnapshotsModule) Run(params mod.ModuleParams) error {
+	config := APFSSnapshotsConfig{
+		Volume:     "/System/Volumes/Data",
+		MountPoint: "/tmp/ishinobu-snapshot",
+	}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	mountedPoint := ""
+	if config.Mount != "" {
+		mountedPoint, err = mountAPFSSnapshot(config)
+		if err != nil {
+			params.Logger.Debug("Failed to mount snapshot %s: %v", config.Mount, err)
+		} else if !config.KeepMounted {
+			mod.RegisterCleanup(func() {
+				if err := unmountAPFSSnapshot(mountedPoint); err != nil {
+					params.Logger.Error("Failed to unmount snapshot %s: %v", mountedPoint, err)
+				}
+			})
+		}
+	}
+
+	// Creation times by snapshot name, read from the volumes
+	creationTimes := make(map[string]string)
+	for _, volume := range apfsSnapshotVolumes {
+		times, err := utils.APFSSnapshotCreationTimes(volume)
+		if err != nil {
+			params.Logger.Debug("Error reading the snapshot creation times of %s: %v", volume, err)
+		}
+		for name, creationTime := range times {
+			creationTimes[name] = creationTime
+		}
+	}
+
+	listed := make(map[string]bool)
+	for _, volume := range apfsSnapshotVolumes {
+		output, err := exec.Command("diskutil", "apfs", "listSnapshots", volume, "-plist").Output()
+		if err != nil {
+			params.Logger.Debug("Error listing snapshots of %s: %v", volume, err)
+			continue
+		}
+
+		var snapshots apfsSnapshotList
+		if err := plist.NewDecoder(bytes.NewReader(output)).Decode(&snapshots); err != nil {
+			params.Logger.Debug("Error parsing snapshots of %s: %v", volume, err)
+			continue
+		}
+
+		for _, snapshot := range snapshots.Snapshots {
+			listed[snapshot.SnapshotName] = true
+			recordData := map[string]interface{}{
+				"volume":    volume,
+				"name":      snapshot.SnapshotName,
+				"uuid":      snapshot.SnapshotUUID,
+				"xid":       snapshot.SnapshotXID,
+				"purgeable": snapshot.Purgeable,
+			}
+			writeAPFSSnapshot(writer, params, "diskutil apfs listSnapshots", recordData, config, mountedPoint, creationTimes)
+		}
+	}
+
+	// Time Machine local snapshots not reported by diskutil
+	output, err := exec.Command("tmutil", "listlocalsnapshots", "/").Output()
+	if err != nil {
+		params.Logger.Debug("Error running tmutil: %v", err)
+		return nil
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		name := strings.TrimSpace(line)
+		if !strings.HasPrefix(name, "com.apple.") || listed[name] {
+			continue
+		}
+		recordData := map[string]interface{}{
+			"volume": "/",
+			"name":   name,
+		}
+		writeAPFSSnapshot(writer, params, "tmutil listlocalsnapshots", recordData, config, mountedPoint, creationTimes)
+	}
+
+	return nil
+}
+
+func writeAPFSSnapshot(writer *utils.DataWriter, params mod.ModuleParams, sourceFile string, recordData map[string]interface{},
+	config APFSSnapshotsConfig, mountedPoint string, creationTimes map[string]string) {
+	name := recordData["name"].(string)
+
+	// Time Machine snapshot names contain their creation date in local time
+	creationTime := creationTimes[name]
+	if match := timeMachineDateRegex.FindStringSubmatch(name); match != nil && creationTime == "" {
+		if t, err := time.ParseInLocation(timeMachineDateLayout, match[1], time.Local); err == nil {
+			creationTime = t.UTC().Format(utils.TimeFormat)
+		}
+	}
+	recordData["creation_time"] = creationTime
+
+	recordData["mount_point"] = ""
+	if mountedPoint != "" && name == config.Mount {
+		recordData["mount_point"] = mountedPoint
+	}
+
+	eventTimestamp := creationTime
+	if eventTimestamp == "" {
+		eventTimestamp = params.CollectionTimestamp
+	}
+
+	record := utils.Record{
+		CollectionTimestamp: params.CollectionTimestamp,
+		EventTimestamp:      eventTimestamp,
+		Data:                recordData,
+		SourceFile:          sourceFile,
+	}
+
+	err := writer.WriteRecord(record)
+	if err != nil {
+		params.Logger.Debug("Failed to write record: %v", err)
+	}
+}
+
+// mountAPFSSnapshot mounts the configured snapshot read-only and returns its mount point
+func mountAPFSSnapshot(config APFSSnapshotsConfig) (string, error) {
+	if err := os.MkdirAll(config.MountPoint, 0755); err != nil {
+		return "", err
+	}
+
+	output, err := exec.Command("mount_apfs", "-o", "ro,nobrowse", "-s", config.Mount, config.Volume, config.MountPoint).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return config.MountPoint, nil
+}
+
+// unmountAPFSSnapshot unmounts a snapshot mounted by mountAPFSSnapshot
+func unmountAPFSSnapshot(mountPoint string) error {
+	output, err := exec.Command("umount", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// This module audits the code signature of the applications of /Applications and of the Applications folder of
+// each user, one record per bundle:
+//   - Signature: status (apple, app_store, developer_id, adhoc, unsigned, invalid), identifier, team ID,
+//     authorities and signing time (codesign -dv).
+//   - Integrity: codesign --verify --strict, reporting the files modified, added or removed after signing.
+//   - Notarization: Gatekeeper assessment (spctl) and the notarization ticket stapled to the bundle (stapler).
+//
+// The verdict summarizes the checks: ok, unsigned, adhoc, modified, invalid, not_notarized or rejected.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type AppSigningModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &AppSigningModule{
+		Name:        "appsigning",
+		Description: "Audits the code signature, notarization and integrity of the installed applications"}
+	mod.RegisterModule(module)
+}
+
+func (m *AppSigningModule) GetName() string {
+	return m.Name
+}
+
+func (m *AppSigningModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	applicationPaths = []string{
+		"/Applications/*.app",
+		"/Applications/*/*.app",
+		"/Users/*/Applications/*.app",
+		"/Users/*/Applications/*/*.app",
+	}
+	// codesign --verify messages of bundles changed after signing
+	modifiedSignatureMessages = []string{
+		"a sealed resource is missing or invalid",
+		"file modified",
+		"file added",
+		"file missing",
+		"main executable failed strict validation",
+		"invalid Info.plist",
+		"code object is not signed at all",
+		"nested code is modified or invalid",
+	}
+)
+
+// Layout of the signing time printed by codesign
+const codesignTimeLayout = "Jan 2, 2006 at 3:04:05 PM"
+
+func (m *AppSigningModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, path := range utils.GlobPaths(applicationPaths...) {
+		var info map[string]interface{}
+		infoPath := filepath.Join(path, "Contents", "Info.plist")
+		if err := utils.ParsePlistFile(infoPath, &info); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", infoPath, err)
+		}
+
+		signature := utils.GetCodeSignature(path)
+		modified := signature.Status == "invalid" && isModifiedSignature(signature.VerifyError)
+
+		// stapler validate succeeds when a notarization ticket is stapled to the bundle
+		stapled := exec.Command("stapler", "validate", "-q", path).Run() == nil
+
+		signingTime := ""
+		if t, err := time.ParseInLocation(codesignTimeLayout, signature.Timestamp, time.Local); err == nil {
+			signingTime = t.UTC().Format(utils.TimeFormat)
+		}
+
+		recordData := map[string]interface{}{
+			"username":     utils.GetUsernameFromPath(path),
+			"name":         strings.TrimSuffix(filepath.Base(path), ".app"),
+			"path":         path,
+			"bundle_id":    valueOrEmpty(info["CFBundleIdentifier"]),
+			"version":      valueOrEmpty(info["CFBundleShortVersionString"]),
+			"status":       signature.Status,
+			"valid":        signature.Valid,
+			"identifier":   signature.Identifier,
+			"team_id":      signature.TeamID,
+			"authorities":  strings.Join(signature.Authorities, ", "),
+			"flags":        signature.Flags,
+			"signing_time": signingTime,
+			"notarized":    signature.Notarized,
+			"stapled":      stapled,
+			"assessment":   signature.Assessment,
+			"modified":     modified,
+			"verify_error": signature.VerifyError,
+			"verdict":      appSigningVerdict(signature, modified),
+		}
+
+		eventTimestamp := fileModTime(path)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// isModifiedSignature reports whether a codesign verification error shows the bundle was changed after signing
+func isModifiedSignature(verifyError string) bool {
+	for _, message := range modifiedSignatureMessages {
+		if strings.Contains(verifyError, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// appSigningVerdict summarizes the signature checks of an application
+func appSigningVerdict(signature utils.CodeSignature, modified bool) string {
+	switch {
+	case signature.Status == "unsigned" || signature.Status == "adhoc":
+		return signature.Status
+	case modified:
+		return "modified"
+	case !signature.Valid:
+		return "invalid"
+	case strings.Contains(signature.Assessment, "rejected"):
+		return "rejected"
+	case signature.Status == "developer_id" && !signature.Notarized:
+		return "not_notarized"
+	}
+	return "ok"
+}
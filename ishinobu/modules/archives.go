@@ -0,0 +1,411 @@
+// This module collects the evidence of archive creation and extraction, used to spot the staging of data before
+// exfiltration:
+//   - Settings: the Archive Utility preferences (com.apple.archiveutility), such as the archive format and the
+//     destination of the archives and of the expanded files.
+//   - Recent archives: the recent documents of Archive Utility, Keka and The Unarchiver, and the archives of the
+//     RecentDocuments shared file list.
+//   - Archives: the archives (.zip, .7z, .rar, .tar, .gz, .aar, ...) and the bill of materials files (.bom) of
+//     the user directories created or modified within the window, with their size.
+//   - .DS_Store references: the archives named in the .DS_Store files of these directories, with the size and
+//     modification date recorded by Finder, including archives that were deleted since.
+//
+// The window, the locations, the depth of the walk and the smallest archive reported are configured in
+// <InputDir>/archives.json:
+//
+//	{
+//	  "days": 30,
+//	  "paths": ["/Users/*/Desktop", "/Users/*/Documents", "/Users/*/Downloads"],
+//	  "max_depth": 4,
+//	  "min_size": 10485760
+//	}
+package modules
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ArchivesModule struct {
+	Name        string
+	Description string
+}
+
+// ArchivesConfig is the configuration of the archives module.
+type ArchivesConfig struct {
+	Days     int      `json:"days"`
+	Paths    []string `json:"paths"`
+	MaxDepth int      `json:"max_depth"`
+	MinSize  int64    `json:"min_size"`
+}
+
+func init() {
+	module := &ArchivesModule{
+		Name:        "archives",
+		Description: "Collects Archive Utility settings, recent archives and the archives, BOM files and .DS_Store references of user directories"}
+	mod.RegisterModule(module)
+}
+
+func (m *ArchivesModule) GetName() string {
+	return m.Name
+}
+
+func (m *ArchivesModule) GetDescription() string {
+	return m.Description
+}
+
+// dsStoreEntry holds the Finder information of a file named in a .DS_Store file
+type dsStoreEntry struct {
+	Size     int64
+	Modified string
+}
+
+// Seconds between the Mac epoch (1904-01-01) and the Unix epoch
+const macEpochOffset = 2082844800
+
+var (
+	archivesPaths = []string{
+		"/Users/*/Desktop",
+		"/Users/*/Documents",
+		"/Users/*/Downloads",
+		"/Users/Shared",
+		"/private/tmp",
+		"/private/var/tmp",
+	}
+	archivesRecentPaths = []string{
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/com.apple.archiveutility.sfl*",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/com.aone.keka.sfl*",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/cx.c3.theunarchiver.sfl*",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/com.macpaw.site.theunarchiver.sfl*",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.RecentDocuments.sfl*",
+	}
+	archiveExtensions = []string{".zip", ".zipx", ".7z", ".rar", ".tar", ".tgz", ".gz", ".tbz", ".tbz2", ".bz2", ".txz", ".xz",
+		".lz", ".lzma", ".zst", ".cpgz", ".cpio", ".xar", ".aar", ".yaa"}
+	// Structure types of the .DS_Store records and the size of their fixed length values
+	dsStoreValueSizes = map[string]int{"long": 4, "shor": 4, "type": 4, "bool": 1, "comp": 8, "dutc": 8}
+)
+
+func (m *ArchivesModule) Run(params mod.ModuleParams) error {
+	config := ArchivesConfig{Days: 30, Paths: archivesPaths, MaxDepth: 4, MinSize: 10 * 1024 * 1024}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().AddDate(0, 0, -config.Days)
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeRecord := func(sourceFile, eventTimestamp string, recordData map[string]interface{}) {
+		for _, key := range []string{"path", "name", "created", "modified", "application", "key", "value"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		if _, ok := recordData["size"]; !ok {
+			recordData["size"] = 0
+		}
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Archive Utility settings
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.archiveutility.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		keys := make([]string, 0, len(preferences))
+		for key := range preferences {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var value string
+			switch v := preferences[key].(type) {
+			case map[string]interface{}, []interface{}, []byte:
+				continue
+			case time.Time:
+				value = utils.FormatPlistDate(v)
+			default:
+				value = fmt.Sprintf("%v", v)
+			}
+			writeRecord(path, fileModTime(path), map[string]interface{}{
+				"type":  "setting",
+				"key":   key,
+				"value": value,
+			})
+		}
+	}
+
+	// Recent archives
+	for _, path := range utils.GlobPaths(archivesRecentPaths...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+		archive, _ := root.(map[string]interface{})
+		items, _ := archive["items"].([]interface{})
+		_, application := sharedFileListName(path)
+		for index, value := range items {
+			item, _ := value.(map[string]interface{})
+			bookmarkData, ok := item["Bookmark"].([]byte)
+			if !ok {
+				continue
+			}
+			bookmark, err := utils.ParseBookmark(bookmarkData)
+			if err != nil || bookmark.Path == "" {
+				continue
+			}
+			// The RecentDocuments list holds every kind of document
+			if application == "" && !isArchivePath(bookmark.Path) {
+				continue
+			}
+			writeRecord(path, fileModTime(path), map[string]interface{}{
+				"type":        "recent",
+				"path":        bookmark.Path,
+				"name":        filepath.Base(bookmark.Path),
+				"created":     bookmark.CreationDate,
+				"application": application,
+				"key":         "order",
+				"value":       fmt.Sprintf("%d", index+1),
+			})
+		}
+	}
+
+	// Archives, BOM files and .DS_Store references of the user directories
+	inWindow := func(info os.FileInfo) (string, string, bool) {
+		modified := info.ModTime().UTC().Format(utils.TimeFormat)
+		created := utils.FileBirthTime(info)
+		if !info.ModTime().Before(cutoff) {
+			return created, modified, true
+		}
+		if birth, err := time.Parse(utils.TimeFormat, created); err == nil && !birth.Before(cutoff) {
+			return created, modified, true
+		}
+		return created, modified, false
+	}
+
+	for _, root := range utils.GlobPaths(config.Paths...) {
+		depth := strings.Count(filepath.Clean(root), string(os.PathSeparator))
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				params.Logger.Debug("Error walking %s: %v", path, err)
+				return nil
+			}
+			if entry.IsDir() {
+				if path != root && strings.HasSuffix(path, ".app") {
+					return filepath.SkipDir
+				}
+				if strings.Count(path, string(os.PathSeparator))-depth >= config.MaxDepth {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !entry.Type().IsRegular() {
+				return nil
+			}
+
+			if entry.Name() == ".DS_Store" {
+				info, err := entry.Info()
+				if err != nil {
+					return nil
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					params.Logger.Debug("Error reading %s: %v", path, err)
+					return nil
+				}
+				_, storeModified, storeInWindow := inWindow(info)
+				entries := parseDSStore(data)
+				names := make([]string, 0, len(entries))
+				for name := range entries {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					if !isArchivePath(name) {
+						continue
+					}
+					finder := entries[name]
+					if finder.Size > 0 && finder.Size < config.MinSize {
+						continue
+					}
+					eventTimestamp := finder.Modified
+					if eventTimestamp == "" {
+						if !storeInWindow {
+							continue
+						}
+						eventTimestamp = storeModified
+					} else if modified, err := time.Parse(utils.TimeFormat, eventTimestamp); err != nil || modified.Before(cutoff) {
+						continue
+					}
+					target := filepath.Join(filepath.Dir(path), name)
+					_, statErr := os.Stat(target)
+					writeRecord(path, eventTimestamp, map[string]interface{}{
+						"type":     "ds_store",
+						"path":     target,
+						"name":     name,
+						"size":     finder.Size,
+						"modified": finder.Modified,
+						"key":      "exists",
+						"value":    fmt.Sprintf("%t", statErr == nil),
+					})
+				}
+				return nil
+			}
+
+			isBOM := strings.EqualFold(filepath.Ext(path), ".bom")
+			if !isBOM && !isArchivePath(path) {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				return nil
+			}
+			created, modified, ok := inWindow(info)
+			if !ok || (!isBOM && info.Size() < config.MinSize) {
+				return nil
+			}
+			recordType := "archive"
+			if isBOM {
+				recordType = "bom"
+			}
+			eventTimestamp := created
+			if eventTimestamp == "" {
+				eventTimestamp = modified
+			}
+			writeRecord(path, eventTimestamp, map[string]interface{}{
+				"type":     recordType,
+				"path":     path,
+				"name":     entry.Name(),
+				"size":     info.Size(),
+				"created":  created,
+				"modified": modified,
+			})
+			return nil
+		})
+		if err != nil {
+			params.Logger.Debug("Error walking %s: %v", root, err)
+		}
+	}
+
+	return nil
+}
+
+// isArchivePath reports whether a path has the extension of an archive
+func isArchivePath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, archiveExt := range archiveExtensions {
+		if ext == archiveExt {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDSStore returns the files named in the records of a .DS_Store file with their logical or physical size
+// (lg1S, logS, ph1S, phyS) and modification date (modD, moDD). Each record is the length of the file name in
+// UTF-16 code units, the UTF-16BE name, a 4-byte structure ID, a 4-byte type and the value. The records are found
+// by scanning the B-tree blocks, which avoids walking the buddy allocator.
+func parseDSStore(data []byte) map[string]dsStoreEntry {
+	entries := make(map[string]dsStoreEntry)
+	for i := 0; i+4 <= len(data); i++ {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		if length == 0 || length > 1024 {
+			continue
+		}
+		nameEnd := i + 4 + 2*length
+		if nameEnd+8 > len(data) {
+			continue
+		}
+		name, ok := dsStoreName(data[i+4 : nameEnd])
+		if !ok {
+			continue
+		}
+		structureID := string(data[nameEnd : nameEnd+4])
+		dataType := string(data[nameEnd+4 : nameEnd+8])
+		valueStart := nameEnd + 8
+		valueSize, fixed := dsStoreValueSizes[dataType]
+		if !fixed {
+			if dataType != "blob" && dataType != "ustr" {
+				continue
+			}
+			if valueStart+4 > len(data) {
+				continue
+			}
+			valueSize = int(binary.BigEndian.Uint32(data[valueStart : valueStart+4]))
+			if dataType == "ustr" {
+				valueSize *= 2
+			}
+			valueStart += 4
+		}
+		if valueSize < 0 || valueStart+valueSize > len(data) {
+			continue
+		}
+		value := data[valueStart : valueStart+valueSize]
+
+		if name != "." {
+			entry := entries[name]
+			switch {
+			case dataType == "comp" && (structureID == "lg1S" || structureID == "logS" || structureID == "ph1S" || structureID == "phyS"):
+				if size := int64(binary.BigEndian.Uint64(value)); entry.Size == 0 || structureID == "lg1S" || structureID == "logS" {
+					entry.Size = size
+				}
+			case dataType == "dutc" && (structureID == "modD" || structureID == "moDD"):
+				// 1/65536 seconds since the Mac epoch
+				seconds := int64(binary.BigEndian.Uint64(value)/65536) - macEpochOffset
+				if seconds > 0 {
+					entry.Modified = utils.ConvertUnixTimestamp(seconds)
+				}
+			}
+			entries[name] = entry
+		}
+		i = valueStart + valueSize - 1
+	}
+	return entries
+}
+
+// dsStoreName decodes the UTF-16BE file name of a .DS_Store record, rejecting control characters
+func dsStoreName(data []byte) (string, bool) {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[2*i:])
+		if units[i] < 0x20 {
+			return "", false
+		}
+	}
+	return string(utf16.Decode(units)), true
+}
@@ -0,0 +1,158 @@
+// This module collects volatile network tables:
+// - ARP cache: arp -an (IP, MAC, interface, expiration)
+// - Routing table: netstat -rn (destination, gateway, flags, interface) for IPv4 and IPv6
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ArpModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &ArpModule{
+		Name:        "arp",
+		Description: "Collects the ARP cache and routing table"}
+	mod.RegisterModule(module)
+}
+
+func (m *ArpModule) GetName() string {
+	return m.Name
+}
+
+func (m *ArpModule) GetDescription() string {
+	return m.Description
+}
+
+// Example: ? (192.168.1.1) at aa:bb:cc:dd:ee:ff on en0 ifscope [ethernet]
+var arpEntryRegex = regexp.MustCompile(`^(\S+) \(([^)]+)\) at (\S+) on (\S+)(.*)$`)
+
+func (m *ArpModule) Run(params mod.ModuleParams) error {
+	err := collectArpCache(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting ARP cache: %v", err)
+	}
+
+	err = collectRoutingTable(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting routing table: %v", err)
+	}
+
+	return nil
+}
+
+func collectArpCache(moduleName string, params mod.ModuleParams) error {
+	output, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return fmt.Errorf("error running command: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, line := range strings.Split(string(output), "\n") {
+		match := arpEntryRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+
+		flags := strings.TrimSpace(match[5])
+		recordData := make(map[string]interface{})
+		recordData["hostname"] = match[1]
+		recordData["ip"] = match[2]
+		recordData["mac"] = match[3]
+		recordData["interface"] = match[4]
+		recordData["permanent"] = strings.Contains(flags, "permanent")
+		recordData["flags"] = flags
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          "arp -an",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func collectRoutingTable(moduleName string, params mod.ModuleParams) error {
+	output, err := exec.Command("netstat", "-rn").Output()
+	if err != nil {
+		return fmt.Errorf("error running command: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-routes", params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// The output contains one table per address family, each one preceded by its name and a header line
+	family := ""
+	var fields []string
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case line == "Routing tables":
+			continue
+		case strings.HasSuffix(line, ":"):
+			family = strings.TrimSuffix(line, ":")
+			fields = nil
+			continue
+		case strings.HasPrefix(line, "Destination"):
+			fields = strings.Fields(line)
+			continue
+		}
+
+		if fields == nil {
+			continue
+		}
+
+		cols := strings.Fields(line)
+		recordData := make(map[string]interface{})
+		recordData["family"] = family
+		for i, field := range fields {
+			if i < len(cols) {
+				recordData[strings.ToLower(field)] = cols[i]
+			} else {
+				recordData[strings.ToLower(field)] = ""
+			}
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          "netstat -rn",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
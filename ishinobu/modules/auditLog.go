@@ -1,11 +1,18 @@
-// This module collects and parses audit logs using praudit command over the files in /private/var/audit directory.
+// This module collects and parses the OpenBSM audit trails in /private/var/audit directory.
+// Trails are decoded natively so they can also be parsed from a mounted disk image. If a trail cannot be
+// decoded, the module falls back to the praudit command.
+// Each record is classified as authentication, process_exec, file or other based on the event classes
+// defined in /etc/security/audit_event.
 package modules
 
 import (
 	"bufio"
 	"encoding/xml"
+	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
 	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
@@ -19,7 +26,7 @@ type AuditLogModule struct {
 func init() {
 	module := &AuditLogModule{
 		Name:        "auditlog",
-		Description: "Collects and parses audit logs using praudit",
+		Description: "Collects and parses OpenBSM audit logs",
 	}
 	mod.RegisterModule(module)
 }
@@ -44,7 +51,36 @@ func (m *AuditLogModule) Run(params mod.ModuleParams) error {
 	}
 	defer writer.Close()
 
+	auditEvents := utils.LoadAuditEvents("/etc/security/audit_event")
+
 	for _, file := range files {
+		// current is a symbolic link to the trail being written
+		info, err := os.Lstat(file)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 || info.IsDir() {
+			continue
+		}
+
+		parsedRecords := 0
+		err = utils.ParseBSMFile(file, func(bsmRecord utils.BSMRecord) error {
+			parsedRecords++
+			record := bsmRecordToRecord(bsmRecord, auditEvents)
+			record.CollectionTimestamp = params.CollectionTimestamp
+			record.SourceFile = file
+
+			err := writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+			return nil
+		})
+		if err == nil || parsedRecords > 0 {
+			if err != nil {
+				params.Logger.Debug("Error decoding audit trail %s: %v", file, err)
+			}
+			continue
+		}
+		params.Logger.Debug("Falling back to praudit for %s: %v", file, err)
+
 		cmd := exec.Command("praudit", "-x", "-l", file)
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
@@ -162,3 +198,59 @@ func parsePrauditXMLLine(line string) (utils.Record, error) {
 	}
 	return record, nil
 }
+
+func bsmRecordToRecord(bsmRecord utils.BSMRecord, auditEvents map[uint16]utils.AuditEvent) utils.Record {
+	event, ok := auditEvents[bsmRecord.EventType]
+	if !ok {
+		event = utils.AuditEvent{Name: fmt.Sprintf("%d", bsmRecord.EventType)}
+	}
+
+	recordData := make(map[string]interface{})
+	recordData["event"] = event.Name
+	recordData["event_id"] = bsmRecord.EventType
+	recordData["description"] = event.Description
+	recordData["category"] = event.Category()
+	recordData["modifier"] = bsmRecord.EventModifier
+	recordData["time"] = bsmRecord.Time.Format(utils.TimeFormat)
+	recordData["msec"] = bsmRecord.Time.Nanosecond() / 1000000
+	for num, value := range bsmRecord.Arguments {
+		recordData[num] = value
+	}
+
+	subject := bsmRecord.Subject
+	if subject == nil {
+		subject = bsmRecord.Process
+	}
+	if subject != nil {
+		recordData["audit-uid"] = subject.AuditUID
+		recordData["uid"] = subject.EUID
+		recordData["gid"] = subject.EGID
+		recordData["ruid"] = subject.RUID
+		recordData["rgid"] = subject.RGID
+		recordData["pid"] = subject.PID
+		recordData["sid"] = subject.SID
+		recordData["tid"] = fmt.Sprintf("%d %s", subject.TerminalPort, subject.TerminalAddress)
+	}
+
+	if bsmRecord.HasReturn {
+		if bsmRecord.ReturnStatus == 0 {
+			recordData["errval"] = "success"
+		} else {
+			recordData["errval"] = fmt.Sprintf("failure : %d", bsmRecord.ReturnStatus)
+		}
+		recordData["retval"] = bsmRecord.ReturnValue
+	}
+
+	recordData["path"] = strings.Join(bsmRecord.Paths, ",")
+	recordData["exec_args"] = strings.Join(bsmRecord.ExecArgs, " ")
+	recordData["text"] = strings.Join(bsmRecord.Texts, ",")
+	recordData["socket"] = strings.Join(bsmRecord.Sockets, ",")
+	recordData["signing_id"] = bsmRecord.SigningID
+	recordData["team_id"] = bsmRecord.TeamID
+	recordData["truncated"] = bsmRecord.Truncated
+
+	return utils.Record{
+		EventTimestamp: bsmRecord.Time.Format(utils.TimeFormat),
+		Data:           recordData,
+	}
+}
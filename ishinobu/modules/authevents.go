@@ -0,0 +1,253 @@
+// This module extracts privilege escalation and authentication events over the configured window from:
+// - Unified logs: sudo, su and login processes, and authorization prompts from authd (com.apple.Authorization).
+// - /var/log/system.log and its rotated copies, when present (legacy syslog). Syslog timestamps have no year,
+// which is taken from the modification time of the file: entries dated after it belong to the previous year.
+// Each record is normalized with the user, tty, target user, command and result (success or failure).
+// The window defaults to the last 7 days and can be changed in <InputDir>/authevents.json ({"days": N}).
+package modules
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type AuthEventsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &AuthEventsModule{
+		Name:        "authevents",
+		Description: "Collects sudo invocations, authorization prompts and su/login failures"}
+	mod.RegisterModule(module)
+}
+
+func (m *AuthEventsModule) GetName() string {
+	return m.Name
+}
+
+func (m *AuthEventsModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	// user : TTY=ttys000 ; PWD=/Users/user ; USER=root ; COMMAND=/bin/ls
+	// user : 3 incorrect password attempts ; TTY=ttys000 ; PWD=/Users/user ; USER=root ; COMMAND=/bin/ls
+	sudoMessageRegex = regexp.MustCompile(`^\s*(\S+) : (?:(.*?) ; )?TTY=(\S+) ; PWD=(.*?) ; USER=(\S+) ;(?: .*?)? COMMAND=(.*)$`)
+	// BAD SU user to root on /dev/ttys000
+	suMessageRegex = regexp.MustCompile(`^(BAD SU )?(\S+) to (\S+) on (\S+)`)
+	// Succeeded authorizing right 'system.preferences' by client '/System/Applications/System Settings.app' [123] for authorization created by ...
+	authorizationRegex = regexp.MustCompile(`^(Succeeded|Failed) (?:to )?authoriz\w* right '([^']+)' by client '([^']+)'`)
+	// Jan  1 10:00:00 host sudo[123]: message
+	syslogLineRegex = regexp.MustCompile(`^(\w{3}\s+\d+ \d{2}:\d{2}:\d{2}) (\S+) ([^\[:]+)(?:\[(\d+)\])?: (.*)$`)
+)
+
+func (m *AuthEventsModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `process == "sudo" OR process == "su" OR process == "login" OR (process == "authd" AND (eventMessage BEGINSWITH "Succeeded authorizing" OR eventMessage BEGINSWITH "Failed to authorize"))`,
+		Info:      true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error collecting authentication events: %v", err)
+	}
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		parseAuthMessage(fmt.Sprintf("%v", recordData["process"]), fmt.Sprintf("%v", recordData["message"]), recordData)
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for _, logFile := range utils.GlobPaths("/var/log/system.log", "/var/log/system.log.*.gz") {
+		err = parseSystemLogAuthEvents(logFile, startTime, endTime, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing %s: %v", logFile, err)
+		}
+	}
+
+	return nil
+}
+
+// parseSystemLogAuthEvents writes the authentication events of a syslog file logged between startTime and endTime
+func parseSystemLogAuthEvents(path string, startTime, endTime string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	start, err := time.Parse(logShowTimeFormat, startTime)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(logShowTimeFormat, endTime)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	modTime := info.ModTime()
+	if modTime.Before(start) {
+		// Every entry of the file was logged before the window
+		return nil
+	}
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		match := syslogLineRegex.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		process := match[3]
+		if process != "sudo" && process != "su" && process != "login" && process != "authd" {
+			continue
+		}
+
+		eventTime, err := syslogTime(strings.Join(strings.Fields(match[1]), " "), modTime)
+		if err != nil {
+			params.Logger.Debug("Error parsing timestamp: %v", err)
+			continue
+		}
+		if eventTime.Before(start) || eventTime.After(end) {
+			continue
+		}
+		timestamp := eventTime.UTC().Format(utils.TimeFormat)
+
+		recordData := make(map[string]interface{})
+		recordData["process"] = process
+		recordData["pid"] = match[4]
+		recordData["host"] = match[2]
+		recordData["message"] = match[5]
+		parseAuthMessage(process, match[5], recordData)
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// syslogTime converts a syslog timestamp without year, in local time, using the year of the modification time
+// of the log file. Entries are written before the file is modified, so an entry dated after the modification time
+// was logged in the previous year.
+func syslogTime(stamp string, modTime time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation("Jan 2 15:04:05 2006", fmt.Sprintf("%s %d", stamp, modTime.Year()), time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Allow for the clock skew between the entry and the file system
+	if t.After(modTime.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+// parseAuthMessage adds the normalized user, tty, target user, command and result fields of a message
+func parseAuthMessage(process string, message string, recordData map[string]interface{}) {
+	recordData["event"] = process
+	recordData["result"] = ""
+
+	switch process {
+	case "sudo":
+		if match := sudoMessageRegex.FindStringSubmatch(message); match != nil {
+			recordData["user"] = match[1]
+			recordData["tty"] = match[3]
+			recordData["pwd"] = match[4]
+			recordData["target_user"] = match[5]
+			recordData["command"] = match[6]
+			recordData["reason"] = match[2]
+			if match[2] != "" {
+				recordData["result"] = "failure"
+			} else {
+				recordData["result"] = "success"
+			}
+		} else if strings.Contains(message, "incorrect password") || strings.Contains(message, "authentication failure") {
+			recordData["result"] = "failure"
+		}
+	case "su":
+		if match := suMessageRegex.FindStringSubmatch(message); match != nil {
+			recordData["user"] = match[2]
+			recordData["target_user"] = match[3]
+			recordData["tty"] = match[4]
+			if match[1] != "" {
+				recordData["result"] = "failure"
+			} else {
+				recordData["result"] = "success"
+			}
+		}
+	case "login":
+		lowerMessage := strings.ToLower(message)
+		if strings.Contains(lowerMessage, "fail") || strings.Contains(lowerMessage, "incorrect") {
+			recordData["result"] = "failure"
+		}
+	case "authd":
+		recordData["event"] = "authorization"
+		if match := authorizationRegex.FindStringSubmatch(message); match != nil {
+			recordData["right"] = match[2]
+			recordData["client"] = match[3]
+			if match[1] == "Succeeded" {
+				recordData["result"] = "success"
+			} else {
+				recordData["result"] = "failure"
+			}
+		}
+	}
+}
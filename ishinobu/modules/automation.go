@@ -0,0 +1,336 @@
+// This module collects the automation workflows that can be abused for persistence or execution:
+//   - Automator: the workflows and applications (Contents/document.wflow) of the Services, Workflows and
+//     Applications folders, including Folder Action workflows, with their actions.
+//   - Shortcuts: the shortcuts of each user (Library/Shortcuts/Shortcuts.sqlite) with the actions of the
+//     workflow (binary plist of WFWorkflowActionIdentifier and parameters).
+//   - osascript login items: launch agents and daemons running osascript or a compiled script, and login items
+//     (backgrounditems.btm) that are AppleScript applets or scripts.
+//
+// The actions of each workflow are summarized and the workflows running shell scripts (runs_shell), other
+// scripts (runs_script) or downloading content (downloads) are flagged, with the commands found.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type AutomationModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &AutomationModule{
+		Name:        "automation",
+		Description: "Collects Automator workflows, Shortcuts and osascript login items, flagging shell scripts and downloads"}
+	mod.RegisterModule(module)
+}
+
+func (m *AutomationModule) GetName() string {
+	return m.Name
+}
+
+func (m *AutomationModule) GetDescription() string {
+	return m.Description
+}
+
+// automationSummary is the summary of the actions of a workflow
+type automationSummary struct {
+	Actions    []string
+	Commands   []string
+	RunsShell  bool
+	RunsScript bool
+	Downloads  bool
+}
+
+var (
+	automatorWorkflowPaths = []string{
+		"/Library/Services/*.workflow/Contents/document.wflow",
+		"/Users/*/Library/Services/*.workflow/Contents/document.wflow",
+		"/Users/*/Library/Workflows/Applications/*/*.workflow/Contents/document.wflow",
+		"/Users/*/Library/Workflows/Applications/*/*.app/Contents/document.wflow",
+		"/Library/Workflows/Applications/*/*.workflow/Contents/document.wflow",
+		"/Applications/*.app/Contents/document.wflow",
+		"/Users/*/Applications/*.app/Contents/document.wflow",
+		"/Users/*/Desktop/*.workflow/Contents/document.wflow",
+		"/Users/*/Desktop/*.app/Contents/document.wflow",
+		"/Users/*/Documents/*.workflow/Contents/document.wflow",
+	}
+	// Actions of Automator and Shortcuts by the behavior they are flagged for
+	automationShellActions = map[string]bool{
+		"com.apple.RunShellScript":           true,
+		"is.workflow.actions.runshellscript": true,
+		"is.workflow.actions.runsshscript":   true,
+	}
+	automationScriptActions = map[string]bool{
+		"com.apple.Automator.RunScript":                  true,
+		"com.apple.Automator.RunJavaScript":              true,
+		"is.workflow.actions.runapplescript":             true,
+		"is.workflow.actions.runjavascriptforautomation": true,
+		"is.workflow.actions.runjavascriptonwebpage":     true,
+	}
+	automationDownloadActions = map[string]bool{
+		"com.apple.Automator.DownloadURLs":     true,
+		"is.workflow.actions.downloadurl":      true,
+		"is.workflow.actions.getcontentsofurl": true,
+	}
+	// Parameters holding the script of an action
+	automationScriptParameters = []string{"COMMAND_STRING", "source", "Script", "WFShellScript", "WFAppleScript", "WFJavaScript", "WFURL"}
+
+	shortcutsQuery = `SELECT s.ZNAME AS name, s.ZCREATIONDATE AS created, s.ZMODIFICATIONDATE AS modified, a.ZDATA AS actions
+FROM ZSHORTCUT s LEFT JOIN ZSHORTCUTACTIONS a ON a.ZSHORTCUT = s.Z_PK`
+)
+
+func (m *AutomationModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeAutomation := func(sourceFile, eventTimestamp, kind, name, path string, summary automationSummary, recordData map[string]interface{}) {
+		if recordData == nil {
+			recordData = make(map[string]interface{})
+		}
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		recordData["type"] = kind
+		recordData["name"] = name
+		recordData["path"] = path
+		recordData["actions"] = strings.Join(summary.Actions, ", ")
+		recordData["runs_shell"] = summary.RunsShell
+		recordData["runs_script"] = summary.RunsScript
+		recordData["downloads"] = summary.Downloads
+		recordData["commands"] = strings.Join(summary.Commands, " ; ")
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Automator workflows and applications
+	for _, path := range utils.GlobPaths(automatorWorkflowPaths...) {
+		var document map[string]interface{}
+		if err := utils.ParsePlistFile(path, &document); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		bundle := filepath.Dir(filepath.Dir(path))
+		var actions []map[string]interface{}
+		items, _ := document["actions"].([]interface{})
+		for _, value := range items {
+			item, _ := value.(map[string]interface{})
+			if action, ok := item["action"].(map[string]interface{}); ok {
+				actions = append(actions, map[string]interface{}{
+					"identifier": valueOrEmpty(action["BundleIdentifier"]),
+					"name":       valueOrEmpty(action["ActionName"]),
+					"parameters": action["ActionParameters"],
+				})
+			}
+		}
+		kind := "automator_workflow"
+		if strings.HasSuffix(bundle, ".app") {
+			kind = "automator_application"
+		}
+		if strings.Contains(bundle, "/Folder Actions/") {
+			kind = "automator_folder_action"
+		}
+		created := ""
+		if info, err := os.Stat(bundle); err == nil {
+			created = utils.FileBirthTime(info)
+		}
+		writeAutomation(path, fileModTime(path), kind, strings.TrimSuffix(filepath.Base(bundle), filepath.Ext(bundle)), bundle,
+			summarizeAutomationActions(actions), map[string]interface{}{"created": created, "modified": fileModTime(path)})
+	}
+
+	// Shortcuts
+	tmpDir, err := os.MkdirTemp("", "ishinobu-automation")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range utils.GlobPaths("/Users/*/Library/Shortcuts/Shortcuts.sqlite") {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+		rows, err := utils.QuerySQLiteMaps(dst, shortcutsQuery)
+		if err != nil {
+			params.Logger.Debug("Error querying Shortcuts %s: %v", dbPath, err)
+			continue
+		}
+		for _, row := range rows {
+			var actions []map[string]interface{}
+			if data, ok := row["actions"].(string); ok && data != "" {
+				var workflow []map[string]interface{}
+				if _, err := plist.Unmarshal([]byte(data), &workflow); err != nil {
+					params.Logger.Debug("Error decoding the actions of a shortcut in %s: %v", dbPath, err)
+				}
+				for _, action := range workflow {
+					actions = append(actions, map[string]interface{}{
+						"identifier": valueOrEmpty(action["WFWorkflowActionIdentifier"]),
+						"name":       "",
+						"parameters": action["WFWorkflowActionParameters"],
+					})
+				}
+			}
+			created := clipboardTime(row["created"])
+			modified := clipboardTime(row["modified"])
+			eventTimestamp := modified
+			if eventTimestamp == "" {
+				eventTimestamp = created
+			}
+			writeAutomation(dbPath, eventTimestamp, "shortcut", fmt.Sprintf("%v", valueOrEmpty(row["name"])), dbPath,
+				summarizeAutomationActions(actions), map[string]interface{}{"created": created, "modified": modified})
+		}
+	}
+
+	// Launch agents and daemons running osascript
+	for _, path := range utils.GlobPaths(launchdPlistPaths...) {
+		if strings.HasPrefix(path, "/System/") {
+			continue
+		}
+		var content map[string]interface{}
+		if err := utils.ParsePlistFile(path, &content); err != nil {
+			continue
+		}
+		var arguments []string
+		if program, ok := content["Program"].(string); ok {
+			arguments = append(arguments, program)
+		}
+		if args, ok := content["ProgramArguments"].([]interface{}); ok {
+			for _, arg := range args {
+				arguments = append(arguments, fmt.Sprintf("%v", arg))
+			}
+		}
+		commandLine := strings.Join(arguments, " ")
+		if !strings.Contains(commandLine, "osascript") && !isAppleScriptPath(commandLine) {
+			continue
+		}
+		summary := automationSummary{Actions: []string{"osascript"}, RunsScript: true, Commands: []string{commandLine}}
+		writeAutomation(path, fileModTime(path), "osascript_launchd", fmt.Sprintf("%v", valueOrEmpty(content["Label"])), path, summary, nil)
+	}
+
+	// Login items that are AppleScript applets or scripts
+	for _, path := range utils.GlobPaths(
+		"/Users/*/Library/Application Support/com.apple.backgroundtaskmanagementagent/backgrounditems.btm",
+		"/private/var/db/com.apple.backgroundtaskmanagement/BackgroundItems-v*.btm") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+		seen := make(map[string]bool)
+		walkPlist(root, func(item map[string]interface{}) {
+			for _, value := range item {
+				bookmarkData, ok := value.([]byte)
+				if !ok {
+					continue
+				}
+				bookmark, err := utils.ParseBookmark(bookmarkData)
+				if err != nil || seen[bookmark.Path] || !isAppleScriptPath(bookmark.Path) {
+					continue
+				}
+				seen[bookmark.Path] = true
+				summary := automationSummary{Actions: []string{"applescript"}, RunsScript: true}
+				writeAutomation(path, fileModTime(path), "osascript_login_item",
+					strings.TrimSuffix(filepath.Base(bookmark.Path), filepath.Ext(bookmark.Path)), bookmark.Path, summary, nil)
+			}
+		})
+	}
+
+	return nil
+}
+
+// summarizeAutomationActions summarizes the actions of a workflow, given as maps of identifier, name and
+// parameters
+func summarizeAutomationActions(actions []map[string]interface{}) automationSummary {
+	var summary automationSummary
+	for _, action := range actions {
+		identifier := fmt.Sprintf("%v", action["identifier"])
+		name := fmt.Sprintf("%v", action["name"])
+		if name == "" {
+			name = strings.TrimPrefix(identifier, "is.workflow.actions.")
+		}
+		summary.Actions = append(summary.Actions, name)
+
+		flagged := true
+		switch {
+		case automationShellActions[identifier]:
+			summary.RunsShell = true
+		case automationScriptActions[identifier]:
+			summary.RunsScript = true
+		case automationDownloadActions[identifier]:
+			summary.Downloads = true
+		default:
+			flagged = false
+		}
+		if !flagged {
+			continue
+		}
+		parameters, _ := action["parameters"].(map[string]interface{})
+		for _, key := range automationScriptParameters {
+			if command := automationParameterText(parameters[key]); command != "" {
+				summary.Commands = append(summary.Commands, command)
+			}
+		}
+	}
+	return summary
+}
+
+// automationParameterText returns the text of an action parameter, which Shortcuts stores either as a string
+// or as a text token (WFTextTokenString) with its string in Value.string
+func automationParameterText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		if inner, ok := v["Value"].(map[string]interface{}); ok {
+			if text, ok := inner["string"].(string); ok {
+				return strings.TrimSpace(text)
+			}
+		}
+	}
+	return ""
+}
+
+// isAppleScriptPath reports whether a path is a compiled script, an AppleScript source or an applet
+func isAppleScriptPath(path string) bool {
+	for _, ext := range []string{".scpt", ".scptd", ".applescript"} {
+		if strings.Contains(path, ext) {
+			return true
+		}
+	}
+	if strings.HasSuffix(path, ".app") || strings.HasSuffix(path, ".app/") {
+		_, err := os.Stat(filepath.Join(path, "Contents", "Resources", "Scripts", "main.scpt"))
+		return err == nil
+	}
+	return false
+}
@@ -0,0 +1,575 @@
+// This module collects persistence mechanisms that are not covered by the launchd module:
+//   - at jobs: /private/var/at/jobs/* (the command of the job and its scheduled time).
+//   - cron jobs: the user crontabs of /private/var/at/tabs, /etc/crontab and the periodic scripts, with the user of
+//     each job, its schedule split into fields, the binary resolved to an absolute path and whether the binary
+//     can be written by a non-root user.
+//   - emond rules: /etc/emond.d/rules/*.plist (RunCommand actions) and the clients in /private/var/db/emondClients
+//     that make emond run.
+//   - Folder Actions: /Users/*/Library/Preferences/com.apple.FolderActionsDispatcher.plist and the scripts in
+//     the Folder Action Scripts folders.
+//   - Login and logout hooks: LoginHook and LogoutHook of com.apple.loginwindow (system, root and users).
+//   - Persistent environment variables: launchctl config system/user (/private/var/db/com.apple.xpc.launchd/config/*.plist)
+//     and the legacy /etc/launchd.conf and /etc/launchd-user.conf.
+//   - Shell startup files: /etc/profile, /etc/zshenv, /etc/zshrc, /etc/bashrc, ... and the rc files of each user.
+//     One record is emitted per line, flagged as recent when the file was modified within the window.
+//
+// The window defaults to the last 30 days and can be changed in <InputDir>/autostart.json ({"days": N}).
+//
+// Every item is emitted with the same fields: src_name (mechanism), src_file, prog_name, program, args,
+// username, trigger and modification_time.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type AutostartModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &AutostartModule{
+		Name:        "autostart",
+		Description: "Collects at jobs, cron jobs, emond rules, Folder Actions and other autostart items"}
+	mod.RegisterModule(module)
+}
+
+func (m *AutostartModule) GetName() string {
+	return m.Name
+}
+
+func (m *AutostartModule) GetDescription() string {
+	return m.Description
+}
+
+// AutostartConfig is the configuration of the autostart module
+type AutostartConfig struct {
+	Days int `json:"days"`
+}
+
+var (
+	// Schedules of the cron macros as minute, hour, day of month, month and day of week
+	cronMacros = map[string][]string{
+		"@reboot":   nil,
+		"@yearly":   {"0", "0", "1", "1", "*"},
+		"@annually": {"0", "0", "1", "1", "*"},
+		"@monthly":  {"0", "0", "1", "*", "*"},
+		"@weekly":   {"0", "0", "*", "*", "0"},
+		"@daily":    {"0", "0", "*", "*", "*"},
+		"@midnight": {"0", "0", "*", "*", "*"},
+		"@hourly":   {"0", "*", "*", "*", "*"},
+	}
+	loginWindowPaths = []string{
+		"/Library/Preferences/com.apple.loginwindow.plist",
+		"/private/var/root/Library/Preferences/com.apple.loginwindow.plist",
+		"/Users/*/Library/Preferences/com.apple.loginwindow.plist",
+	}
+	shellStartupPaths = []string{
+		"/etc/profile",
+		"/etc/zshenv",
+		"/etc/zprofile",
+		"/etc/zshrc",
+		"/etc/zlogin",
+		"/etc/bashrc",
+		"/Users/*/.zshenv",
+		"/Users/*/.zprofile",
+		"/Users/*/.zshrc",
+		"/Users/*/.zlogin",
+		"/Users/*/.bash_profile",
+		"/Users/*/.bash_login",
+		"/Users/*/.bashrc",
+		"/Users/*/.profile",
+		"/Users/*/.config/fish/config.fish",
+		"/private/var/root/.zshrc",
+		"/private/var/root/.bash_profile",
+		"/private/var/root/.profile",
+	}
+)
+
+func (m *AutostartModule) Run(params mod.ModuleParams) error {
+	config := AutostartConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	collectors := []func(mod.ModuleParams) []map[string]interface{}{
+		collectAtJobs,
+		collectCronJobs,
+		collectEmondRules,
+		collectFolderActions,
+		collectLoginHooks,
+		collectLaunchdEnvironment,
+		func(params mod.ModuleParams) []map[string]interface{} {
+			return collectShellStartupFiles(params, config.Days)
+		},
+	}
+
+	for _, collector := range collectors {
+		for _, item := range collector(params) {
+			eventTimestamp, _ := item["modification_time"].(string)
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
+			}
+			sourceFile, _ := item["src_file"].(string)
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                item,
+				SourceFile:          sourceFile,
+			}
+
+			err := writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// autostartItem returns the fields shared by every autostart record
+func autostartItem(srcName string, srcFile string, program string, args string) map[string]interface{} {
+	progName := ""
+	if program != "" {
+		progName = filepath.Base(program)
+	}
+	return map[string]interface{}{
+		"src_name":          srcName,
+		"src_file":          srcFile,
+		"prog_name":         progName,
+		"program":           program,
+		"args":              args,
+		"username":          fileOwner(srcFile),
+		"trigger":           "",
+		"modification_time": fileModTime(srcFile),
+	}
+}
+
+// collectAtJobs parses the at jobs spool. The job file name encodes the queue, the job number
+// and the scheduled time in minutes since the Unix epoch (e.g. a0000101a2b3c4).
+func collectAtJobs(params mod.ModuleParams) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, path := range utils.GlobPaths("/private/var/at/jobs/*") {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".") || len(name) != 14 {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading at job %s: %v", path, err)
+			continue
+		}
+
+		// at writes the environment and a "cd <dir> || { ... }" block before the commands of the job
+		var commands []string
+		inCommands := false
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if !inCommands {
+				inCommands = line == "}"
+				continue
+			}
+			if line != "" {
+				commands = append(commands, line)
+			}
+		}
+
+		item := autostartItem("at_job", path, "", "")
+		item["program"] = strings.Join(commands, "; ")
+		if len(commands) > 0 {
+			item["prog_name"] = strings.Fields(commands[0])[0]
+		}
+		item["trigger"] = "queue " + name[:1]
+		if minutes, err := strconv.ParseInt(name[6:], 16, 64); err == nil {
+			item["trigger"] = "scheduled " + time.Unix(minutes*60, 0).UTC().Format(utils.TimeFormat)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// collectCronJobs returns the jobs of the user crontabs (/private/var/at/tabs, named after their owner), of the
+// system crontab and the scripts run by periodic
+func collectCronJobs(params mod.ModuleParams) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, path := range utils.GlobPaths("/private/var/at/tabs/*") {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		jobs, err := parseCronJobs(path, name)
+		if err != nil {
+			params.Logger.Debug("Error reading crontab %s: %v", path, err)
+			continue
+		}
+		items = append(items, jobs...)
+	}
+
+	// The system crontab has the user of each job after the schedule
+	jobs, err := parseCronJobs("/etc/crontab", "")
+	if err != nil && !os.IsNotExist(err) {
+		params.Logger.Debug("Error reading crontab /etc/crontab: %v", err)
+	}
+	items = append(items, jobs...)
+
+	for _, path := range utils.GlobPaths("/etc/periodic/*/*", "/usr/local/etc/periodic/*/*") {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		item := autostartItem("periodic", path, path, "")
+		item["trigger"] = "periodic " + filepath.Base(filepath.Dir(path))
+		item["cron_user"] = "root"
+		item["binary_path"] = path
+		item["binary_user_writable"] = isUserWritable(path)
+		items = append(items, item)
+	}
+	return items
+}
+
+// parseCronJobs parses the jobs of a crontab. The owner of a user crontab is its file name; the jobs of
+// the system crontab (empty owner) carry their user after the schedule. The schedule is split into its
+// fields, and the binary of the command is resolved with the PATH of the crontab.
+func parseCronJobs(path string, owner string) ([]map[string]interface{}, error) {
+	lines, _, err := readConfigLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	searchPath := "/usr/bin:/bin"
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// Environment settings such as PATH=/usr/local/bin:/usr/bin
+		if name, value, ok := strings.Cut(line, "="); ok && !strings.ContainsAny(name, " \t") {
+			if name == "PATH" {
+				searchPath = strings.Trim(strings.TrimSpace(value), `"'`)
+			}
+			continue
+		}
+
+		var schedule []string
+		if strings.HasPrefix(fields[0], "@") {
+			schedule = cronMacros[fields[0]]
+			fields = fields[1:]
+		} else if len(fields) > 5 {
+			schedule = fields[:5]
+			fields = fields[5:]
+		} else {
+			continue
+		}
+		trigger := strings.Join(strings.Fields(line)[:len(strings.Fields(line))-len(fields)], " ")
+		jobUser := owner
+		if owner == "" && len(fields) > 1 {
+			jobUser = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		command := strings.Join(fields, " ")
+		binary := cronBinary(fields[0], searchPath)
+		item := autostartItem("cron", path, binary, strings.Join(fields[1:], " "))
+		item["command"] = command
+		item["cron_user"] = jobUser
+		item["trigger"] = trigger
+		for i, name := range []string{"minute", "hour", "day_of_month", "month", "day_of_week"} {
+			item[name] = ""
+			if i < len(schedule) {
+				item[name] = schedule[i]
+			}
+		}
+		item["binary_path"] = binary
+		item["binary_user_writable"] = binary != "" && isUserWritable(binary)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// cronBinary resolves the program of a cron command to an absolute path using the PATH of the crontab
+func cronBinary(program string, searchPath string) string {
+	program = strings.Trim(program, `"'`)
+	if filepath.IsAbs(program) {
+		return filepath.Clean(program)
+	}
+	if strings.Contains(program, "/") {
+		return program
+	}
+	for _, dir := range filepath.SplitList(searchPath) {
+		candidate := filepath.Join(dir, program)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return program
+}
+
+// isUserWritable reports whether a file, or the folder holding it, can be written by a user other than root:
+// writable by its group or by everyone, or owned and writable by a non-root user
+func isUserWritable(path string) bool {
+	for _, target := range []string{path, filepath.Dir(path)} {
+		info, err := os.Stat(target)
+		if err != nil {
+			continue
+		}
+		mode := info.Mode().Perm()
+		if mode&0o022 != 0 {
+			return true
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 && mode&0o200 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// collectEmondRules returns the RunCommand actions of the emond rules. emond only runs when
+// a client file exists in /private/var/db/emondClients.
+func collectEmondRules(params mod.ModuleParams) []map[string]interface{} {
+	var items []map[string]interface{}
+	clients := utils.GlobPaths("/private/var/db/emondClients/*")
+
+	for _, path := range utils.GlobPaths("/etc/emond.d/rules/*.plist") {
+		var rules []map[string]interface{}
+		if err := utils.ParsePlistFile(path, &rules); err != nil {
+			params.Logger.Debug("Error parsing emond rules %s: %v", path, err)
+			continue
+		}
+
+		for _, rule := range rules {
+			eventTypes, _ := rule["eventTypes"].([]interface{})
+			actions, _ := rule["actions"].([]interface{})
+			for _, value := range actions {
+				action, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				command, _ := action["command"].(string)
+				if command == "" {
+					continue
+				}
+				var args []string
+				if arguments, ok := action["arguments"].([]interface{}); ok {
+					for _, argument := range arguments {
+						args = append(args, fmt.Sprintf("%v", argument))
+					}
+				}
+
+				item := autostartItem("emond_rule", path, command, strings.Join(args, " "))
+				item["rule_name"] = rule["name"]
+				item["enabled"] = rule["enabled"]
+				item["trigger"] = fmt.Sprintf("%v", eventTypes)
+				item["emond_clients"] = len(clients)
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// collectFolderActions returns the folders with attached scripts of the Folder Actions dispatcher
+// and the scripts stored in the Folder Action Scripts folders.
+func collectFolderActions(params mod.ModuleParams) []map[string]interface{} {
+	var items []map[string]interface{}
+
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.FolderActionsDispatcher.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		enabled := preferences["folderActionsEnabled"]
+
+		// The folder actions are stored as an archived object in recent versions
+		var actions interface{} = preferences["folderActions"]
+		if data, ok := actions.([]byte); ok {
+			decoded, err := utils.DecodeKeyedArchive(data)
+			if err != nil {
+				params.Logger.Debug("Error decoding folder actions of %s: %v", path, err)
+				continue
+			}
+			actions = decoded
+		}
+
+		walkPlist(actions, func(action map[string]interface{}) {
+			folder, _ := action["folderPath"].(string)
+			if folder == "" {
+				return
+			}
+			var scripts []string
+			walkPlist(action["scripts"], func(script map[string]interface{}) {
+				if scriptPath, ok := script["path"].(string); ok {
+					scripts = append(scripts, scriptPath)
+				}
+			})
+			if list, ok := action["scripts"].([]interface{}); ok {
+				for _, value := range list {
+					if scriptPath, ok := value.(string); ok {
+						scripts = append(scripts, scriptPath)
+					}
+				}
+			}
+
+			for _, script := range scripts {
+				item := autostartItem("folder_action", path, script, "")
+				item["enabled"] = enabled
+				item["trigger"] = "folder " + folder
+				items = append(items, item)
+			}
+		})
+	}
+
+	for _, path := range utils.GlobPaths("/Users/*/Library/Scripts/Folder Action Scripts/*",
+		"/Library/Scripts/Folder Action Scripts/*") {
+		item := autostartItem("folder_action_script", path, path, "")
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// collectLoginHooks returns the LoginHook and LogoutHook scripts of the login window
+func collectLoginHooks(params mod.ModuleParams) []map[string]interface{} {
+	var items []map[string]interface{}
+	for _, path := range utils.GlobPaths(loginWindowPaths...) {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for _, hook := range []string{"LoginHook", "LogoutHook"} {
+			program, _ := preferences[hook].(string)
+			if program == "" {
+				continue
+			}
+			item := autostartItem("login_hook", path, program, "")
+			item["trigger"] = hook
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// collectLaunchdEnvironment returns the environment variables set persistently for launchd jobs
+func collectLaunchdEnvironment(params mod.ModuleParams) []map[string]interface{} {
+	var items []map[string]interface{}
+
+	for _, path := range utils.GlobPaths("/private/var/db/com.apple.xpc.launchd/config/*.plist") {
+		var configuration map[string]interface{}
+		if err := utils.ParsePlistFile(path, &configuration); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		domain := strings.TrimSuffix(filepath.Base(path), ".plist")
+		if value, ok := configuration["PathEnvironmentVariable"].(string); ok {
+			item := autostartItem("launchctl_setenv", path, "", value)
+			item["variable"] = "PATH"
+			item["trigger"] = "launchctl config " + domain
+			items = append(items, item)
+		}
+		if variables, ok := configuration["EnvironmentVariables"].(map[string]interface{}); ok {
+			for name, value := range variables {
+				item := autostartItem("launchctl_setenv", path, "", fmt.Sprintf("%v", value))
+				item["variable"] = name
+				item["trigger"] = "launchctl config " + domain
+				items = append(items, item)
+			}
+		}
+	}
+
+	for _, path := range []string{"/etc/launchd.conf", "/etc/launchd-user.conf"} {
+		lines, _, err := readConfigLines(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			item := autostartItem("launchd_conf", path, "launchctl", line)
+			if len(fields) >= 2 && fields[0] == "setenv" {
+				item["src_name"] = "launchctl_setenv"
+				item["variable"] = fields[1]
+				item["args"] = strings.Join(fields[2:], " ")
+			}
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// collectShellStartupFiles returns the lines of the shell startup files, flagged as recent when
+// the file was modified within the last days
+func collectShellStartupFiles(params mod.ModuleParams, days int) []map[string]interface{} {
+	var items []map[string]interface{}
+	windowStart := time.Now().AddDate(0, 0, -days)
+
+	for _, path := range utils.GlobPaths(shellStartupPaths...) {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		recent := info.ModTime().After(windowStart)
+
+		for number, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			item := autostartItem("shell_startup", path, "", line)
+			item["prog_name"] = filepath.Base(path)
+			item["program"] = path
+			item["line_number"] = number + 1
+			item["recently_modified"] = recent
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// fileOwner returns the name of the owner of a file, or its UID when the user is unknown
+func fileOwner(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return utils.GetUsernameFromPath(path)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return utils.GetUsernameFromPath(path)
+	}
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	if owner, err := user.LookupId(uid); err == nil {
+		return owner.Username
+	}
+	return uid
+}
@@ -0,0 +1,189 @@
+// This module parses the Biome SEGB stream files, which replace several knowledgeC streams on modern macOS:
+//   - /private/var/db/biome/streams/{public,restricted}/<stream>/local/*
+//   - /Users/*/Library/Biome/streams/{public,restricted}/<stream>/local/*
+//
+// Records of the application focus and launch, application intent (including Safari history intents)
+// and notification streams are emitted with their stream, state and timestamp. The payloads are protocol
+// buffer messages without a published schema, the bundle identifier, URL, title and all the readable
+// strings they contain are extracted.
+// The streams collected are selected by name in <InputDir>/biome.json:
+//
+//	{
+//	  "streams": ["App.InFocus", "App.Intent", "Safari", "Notification"]
+//	}
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type BiomeModule struct {
+	Name        string
+	Description string
+}
+
+// BiomeConfig is the configuration of the biome module.
+type BiomeConfig struct {
+	Streams []string `json:"streams"`
+}
+
+func init() {
+	module := &BiomeModule{
+		Name:        "biome",
+		Description: "Collects app launches, intents, Safari history and notifications from Biome streams"}
+	mod.RegisterModule(module)
+}
+
+func (m *BiomeModule) GetName() string {
+	return m.Name
+}
+
+func (m *BiomeModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	biomeStreamPaths = []string{
+		"/private/var/db/biome/streams/*/*/local/*",
+		"/Users/*/Library/Biome/streams/*/*/local/*",
+	}
+	biomeBundleIDRegex = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+){2,}$`)
+)
+
+func (m *BiomeModule) Run(params mod.ModuleParams) error {
+	config := BiomeConfig{Streams: []string{"App.InFocus", "App.Launch", "App.Intent", "Safari", "Notification"}}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, path := range utils.GlobPaths(biomeStreamPaths...) {
+		// <stream>/local/<file>
+		stream := filepath.Base(filepath.Dir(filepath.Dir(path)))
+		if !biomeStreamSelected(stream, config.Streams) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		records, err := utils.ParseSEGB(data)
+		if err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+
+		username := "system"
+		if utils.GetUsernameFromPath(path) != "" {
+			username = utils.GetUsernameFromPath(path)
+		}
+
+		for _, segbRecord := range records {
+			strs := biomeStrings(segbRecord.Data, 0)
+			recordData := map[string]interface{}{
+				"username":  username,
+				"stream":    stream,
+				"scope":     filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(path)))),
+				"state":     segbRecord.State,
+				"offset":    segbRecord.Offset,
+				"timestamp": "",
+				"bundle_id": "",
+				"url":       "",
+				"title":     "",
+				"strings":   strings.Join(strs, " | "),
+			}
+			if segbRecord.Timestamp > 0 {
+				recordData["timestamp"] = utils.ConvertCFAbsoluteTime(segbRecord.Timestamp)
+			}
+			for _, str := range strs {
+				switch {
+				case recordData["url"] == "" && strings.Contains(str, "://"):
+					recordData["url"] = str
+				case recordData["bundle_id"] == "" && biomeBundleIDRegex.MatchString(str):
+					recordData["bundle_id"] = str
+				case recordData["title"] == "" && strings.Contains(str, " "):
+					recordData["title"] = str
+				}
+			}
+
+			eventTimestamp := recordData["timestamp"].(string)
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          path,
+			}
+
+			err = writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// biomeStreamSelected reports whether a stream name contains one of the configured names
+func biomeStreamSelected(stream string, streams []string) bool {
+	for _, name := range streams {
+		if strings.Contains(strings.ToLower(stream), strings.ToLower(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// biomeStrings returns the readable strings of a protocol buffer message and of its nested messages
+func biomeStrings(data []byte, depth int) []string {
+	fields, _ := utils.ParseProtobuf(data)
+	var strs []string
+	for _, field := range fields {
+		if field.Bytes == nil {
+			continue
+		}
+		if biomeReadable(field.Bytes) {
+			strs = append(strs, string(field.Bytes))
+		} else if depth < 8 {
+			strs = append(strs, biomeStrings(field.Bytes, depth+1)...)
+		}
+	}
+	return strs
+}
+
+// biomeReadable reports whether bytes are a printable UTF-8 string
+func biomeReadable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if r < 0x20 && r != '\t' && r != '\n' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+// This module collects the Bluetooth paired device history from:
+// - /Library/Preferences/com.apple.Bluetooth.plist: DeviceCache and PairedDevices.
+// - /Library/Bluetooth/com.apple.MobileBluetooth.devices.plist: Device cache used on macOS 12 and later.
+// The last_seen time of a device is the latest update of its cached name, inquiry or services (or its LastSeenTime),
+// which the device caches do not tie to a connection; connections are found in the unified log events.
+// - Unified logs: Pairing and connection events from the bluetoothd process over the configured window.
+// The window defaults to the last 7 days and can be changed in <InputDir>/bluetooth.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type BluetoothModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &BluetoothModule{
+		Name:        "bluetooth",
+		Description: "Collects Bluetooth paired devices and pairing events"}
+	mod.RegisterModule(module)
+}
+
+func (m *BluetoothModule) GetName() string {
+	return m.Name
+}
+
+func (m *BluetoothModule) GetDescription() string {
+	return m.Description
+}
+
+// Major device classes from the Bluetooth Class of Device field (bits 8-12)
+var bluetoothDeviceClasses = map[int64]string{
+	0:  "miscellaneous",
+	1:  "computer",
+	2:  "phone",
+	3:  "network_access_point",
+	4:  "audio_video",
+	5:  "peripheral",
+	6:  "imaging",
+	7:  "wearable",
+	8:  "toy",
+	9:  "health",
+	31: "uncategorized",
+}
+
+func (m *BluetoothModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	err = parseBluetoothDevices(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting Bluetooth devices: %v", err)
+	}
+
+	err = collectBluetoothEvents(m.GetName(), config.Days, params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting Bluetooth events: %v", err)
+	}
+
+	return nil
+}
+
+func parseBluetoothDevices(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	bluetoothPlist := "/Library/Preferences/com.apple.Bluetooth.plist"
+	var preferences map[string]interface{}
+	if err := utils.ParsePlistFile(bluetoothPlist, &preferences); err != nil {
+		params.Logger.Debug("Error reading %s: %v", bluetoothPlist, err)
+	}
+
+	paired := make(map[string]bool)
+	if pairedDevices, ok := preferences["PairedDevices"].([]interface{}); ok {
+		for _, address := range pairedDevices {
+			paired[normalizeBluetoothAddress(fmt.Sprintf("%v", address))] = true
+		}
+	}
+
+	if deviceCache, ok := preferences["DeviceCache"].(map[string]interface{}); ok {
+		for address, value := range deviceCache {
+			device, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			address = normalizeBluetoothAddress(address)
+
+			recordData := make(map[string]interface{})
+			recordData["address"] = address
+			recordData["name"] = device["Name"]
+			recordData["display_name"] = device["displayName"]
+			recordData["vendor_id"] = device["VendorID"]
+			recordData["product_id"] = device["ProductID"]
+			recordData["paired"] = paired[address]
+			if classOfDevice, ok := device["ClassOfDevice"].(uint64); ok {
+				recordData["device_type"] = bluetoothDeviceClasses[int64(classOfDevice>>8)&0x1F]
+			}
+			recordData["last_name_update"] = utils.FormatPlistDate(device["LastNameUpdate"])
+			recordData["last_inquiry_update"] = utils.FormatPlistDate(device["LastInquiryUpdate"])
+			recordData["last_services_update"] = utils.FormatPlistDate(device["LastServicesUpdate"])
+
+			lastSeen := utils.LatestTimestamp(recordData["last_inquiry_update"].(string), recordData["last_services_update"].(string), recordData["last_name_update"].(string))
+			recordData["last_seen"] = lastSeen
+			if lastSeen == "" {
+				lastSeen = params.CollectionTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      lastSeen,
+				Data:                recordData,
+				SourceFile:          bluetoothPlist,
+			}
+
+			err = writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	mobileBluetoothPlist := "/Library/Bluetooth/com.apple.MobileBluetooth.devices.plist"
+	var mobileDevices map[string]interface{}
+	if err := utils.ParsePlistFile(mobileBluetoothPlist, &mobileDevices); err != nil {
+		params.Logger.Debug("Error reading %s: %v", mobileBluetoothPlist, err)
+		return nil
+	}
+
+	for address, value := range mobileDevices {
+		device, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["address"] = normalizeBluetoothAddress(address)
+		recordData["name"] = device["Name"]
+		recordData["display_name"] = device["DefaultName"]
+		recordData["vendor_id"] = device["VendorID"]
+		recordData["product_id"] = device["ProductID"]
+		recordData["device_type"] = device["DeviceIdProduct"]
+		recordData["paired"] = true
+
+		lastSeen := ""
+		if lastSeenTime, ok := device["LastSeenTime"].(uint64); ok {
+			lastSeen = utils.ConvertUnixTimestamp(int64(lastSeenTime))
+		}
+		recordData["last_seen"] = lastSeen
+		if lastSeen == "" {
+			lastSeen = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      lastSeen,
+			Data:                recordData,
+			SourceFile:          mobileBluetoothPlist,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func collectBluetoothEvents(moduleName string, days int, params mod.ModuleParams) error {
+	startTime, endTime := unifiedLogsTimeRange(days)
+	query := LogCommand{
+		Predicate: `process == "bluetoothd" AND (eventMessage CONTAINS[c] "pair" OR eventMessage CONTAINS[c] "connected")`,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-events", params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeBluetoothAddress converts addresses like 00-11-22-aa-bb-cc to 00:11:22:AA:BB:CC
+func normalizeBluetoothAddress(address string) string {
+	return strings.ToUpper(strings.ReplaceAll(address, "-", ":"))
+}
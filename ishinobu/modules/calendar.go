@@ -0,0 +1,326 @@
+// This module collects calendar events and reminders of each user:
+// - /Users/*/Library/Group Containers/group.com.apple.calendar/Calendar.sqlitedb (macOS 13+)
+// - /Users/*/Library/Calendars/Calendar.sqlitedb (older versions)
+// - /Users/*/Library/Group Containers/group.com.apple.reminders/Container_v1/Stores/Data-*.sqlite
+// Events include the calendar, title, location, times, organizer and attendees. Invitations sent by organizers
+// from domains other than the user's own (derived from the accounts of the database and the internal_domains
+// setting) are flagged as external, as meeting invites are a common phishing vector.
+// The databases are copied to a temporary folder before being queried.
+// The window (events starting in the last N days and future events) is configured in <InputDir>/calendar.json:
+//
+//	{
+//	  "days": 90,
+//	  "internal_domains": ["example.com"]
+//	}
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type CalendarModule struct {
+	Name        string
+	Description string
+}
+
+// CalendarConfig is the configuration of the calendar module.
+type CalendarConfig struct {
+	Days            int      `json:"days"`
+	InternalDomains []string `json:"internal_domains"`
+}
+
+func init() {
+	module := &CalendarModule{
+		Name:        "calendar",
+		Description: "Collects calendar events, organizers, attendees and reminders, flagging external invites"}
+	mod.RegisterModule(module)
+}
+
+func (m *CalendarModule) GetName() string {
+	return m.Name
+}
+
+func (m *CalendarModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *CalendarModule) Run(params mod.ModuleParams) error {
+	config := CalendarConfig{Days: 90}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	windowStart := utils.CFAbsoluteTime(time.Now().AddDate(0, 0, -config.Days))
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-calendar")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	calendarPaths := utils.GlobPaths("/Users/*/Library/Group Containers/group.com.apple.calendar/Calendar.sqlitedb",
+		"/Users/*/Library/Calendars/Calendar.sqlitedb")
+	err = collectCalendarDatabases(m.GetName(), calendarPaths, tmpDir, params, func(dbPath, sourceFile string, writer *utils.DataWriter) error {
+		return parseCalendarEvents(dbPath, sourceFile, windowStart, config.InternalDomains, writer, params)
+	})
+	if err != nil {
+		params.Logger.Debug("Error collecting calendar events: %v", err)
+	}
+
+	reminderPaths := utils.GlobPaths("/Users/*/Library/Group Containers/group.com.apple.reminders/Container_v1/Stores/Data-*.sqlite")
+	err = collectCalendarDatabases(m.GetName()+"-reminders", reminderPaths, tmpDir, params, func(dbPath, sourceFile string, writer *utils.DataWriter) error {
+		return parseReminders(dbPath, sourceFile, windowStart, writer, params)
+	})
+	if err != nil {
+		params.Logger.Debug("Error collecting reminders: %v", err)
+	}
+
+	return nil
+}
+
+// collectCalendarDatabases copies each database to the temporary folder and parses it into the output of moduleName
+func collectCalendarDatabases(moduleName string, dbPaths []string, tmpDir string, params mod.ModuleParams,
+	parse func(dbPath, sourceFile string, writer *utils.DataWriter) error) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%s-%d", moduleName, i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		if err := parse(dst, dbPath, writer); err != nil {
+			params.Logger.Debug("Error parsing database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseCalendarEvents(dbPath string, sourceFile string, windowStart float64, internalDomains []string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	username := utils.GetUsernameFromPath(sourceFile)
+
+	domains := make(map[string]bool)
+	for _, domain := range internalDomains {
+		domains[strings.ToLower(domain)] = true
+	}
+	selfRows, err := utils.QuerySQLite(dbPath, `SELECT DISTINCT email FROM Participant WHERE is_self = 1 AND email IS NOT NULL`)
+	if err == nil {
+		for selfRows.Next() {
+			var email sql.NullString
+			if selfRows.Scan(&email) == nil {
+				domains[calendarEmailDomain(email.String)] = true
+			}
+		}
+		selfRows.Close()
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			CalendarItem.summary,
+			CalendarItem.start_date,
+			CalendarItem.end_date,
+			CalendarItem.all_day,
+			CalendarItem.creation_date,
+			CalendarItem.last_modified,
+			Calendar.title,
+			Store.name,
+			Location.title,
+			CalendarItem.url,
+			Organizer.email,
+			Identity.display_name,
+			(SELECT group_concat(Participant.email, ', ') FROM Participant
+				WHERE Participant.owner_id = CalendarItem.ROWID AND Participant.ROWID IS NOT CalendarItem.organizer_id)
+		FROM CalendarItem
+			LEFT JOIN Calendar ON CalendarItem.calendar_id = Calendar.ROWID
+			LEFT JOIN Store ON Calendar.store_id = Store.ROWID
+			LEFT JOIN Location ON CalendarItem.location_id = Location.ROWID
+			LEFT JOIN Participant AS Organizer ON CalendarItem.organizer_id = Organizer.ROWID
+			LEFT JOIN Identity ON Organizer.identity_id = Identity.ROWID
+		WHERE CalendarItem.start_date >= %f
+		ORDER BY CalendarItem.start_date`, windowStart)
+	baseQuery := fmt.Sprintf(`
+		SELECT
+			CalendarItem.summary,
+			CalendarItem.start_date,
+			CalendarItem.end_date,
+			CalendarItem.all_day,
+			NULL,
+			CalendarItem.last_modified,
+			Calendar.title,
+			NULL,
+			NULL,
+			NULL,
+			Organizer.email,
+			NULL,
+			(SELECT group_concat(Participant.email, ', ') FROM Participant
+				WHERE Participant.owner_id = CalendarItem.ROWID AND Participant.ROWID IS NOT CalendarItem.organizer_id)
+		FROM CalendarItem
+			LEFT JOIN Calendar ON CalendarItem.calendar_id = Calendar.ROWID
+			LEFT JOIN Participant AS Organizer ON CalendarItem.organizer_id = Organizer.ROWID
+		WHERE CalendarItem.start_date >= %f
+		ORDER BY CalendarItem.start_date`, windowStart)
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to base calendar query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, baseQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var summary, calendarTitle, storeName, location, url, organizerEmail, organizerName, attendees sql.NullString
+		var startDate, endDate, creationDate, lastModified sql.NullFloat64
+		var allDay sql.NullInt64
+		err := rows.Scan(&summary, &startDate, &endDate, &allDay, &creationDate, &lastModified, &calendarTitle,
+			&storeName, &location, &url, &organizerEmail, &organizerName, &attendees)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		organizer := strings.TrimPrefix(organizerEmail.String, "mailto:")
+		organizerDomain := calendarEmailDomain(organizer)
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["calendar"] = calendarTitle.String
+		recordData["account"] = storeName.String
+		recordData["title"] = summary.String
+		recordData["location"] = location.String
+		recordData["url"] = url.String
+		recordData["start_time"] = utils.ConvertCFAbsoluteTime(startDate.Float64)
+		recordData["end_time"] = utils.ConvertCFAbsoluteTime(endDate.Float64)
+		recordData["all_day"] = allDay.Int64 == 1
+		recordData["creation_time"] = ""
+		if creationDate.Valid {
+			recordData["creation_time"] = utils.ConvertCFAbsoluteTime(creationDate.Float64)
+		}
+		recordData["last_modified"] = ""
+		if lastModified.Valid {
+			recordData["last_modified"] = utils.ConvertCFAbsoluteTime(lastModified.Float64)
+		}
+		recordData["organizer"] = organizer
+		recordData["organizer_name"] = organizerName.String
+		recordData["attendees"] = strings.ReplaceAll(attendees.String, "mailto:", "")
+		recordData["external_invite"] = organizerDomain != "" && len(domains) > 0 && !domains[organizerDomain]
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      recordData["start_time"].(string),
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func parseReminders(dbPath string, sourceFile string, windowStart float64, writer *utils.DataWriter, params mod.ModuleParams) error {
+	username := utils.GetUsernameFromPath(sourceFile)
+
+	query := fmt.Sprintf(`
+		SELECT
+			ZREMCDREMINDER.ZTITLE,
+			ZREMCDREMINDER.ZNOTES,
+			ZREMCDREMINDER.ZCREATIONDATE,
+			ZREMCDREMINDER.ZLASTMODIFIEDDATE,
+			ZREMCDREMINDER.ZDUEDATE,
+			ZREMCDREMINDER.ZCOMPLETED,
+			ZREMCDREMINDER.ZCOMPLETIONDATE,
+			ZREMCDBASELIST.ZNAME
+		FROM ZREMCDREMINDER
+			LEFT JOIN ZREMCDBASELIST ON ZREMCDREMINDER.ZLIST = ZREMCDBASELIST.Z_PK
+		WHERE ZREMCDREMINDER.ZMARKEDFORDELETION = 0
+			AND (ZREMCDREMINDER.ZCREATIONDATE >= %[1]f OR ZREMCDREMINDER.ZDUEDATE >= %[1]f)
+		ORDER BY ZREMCDREMINDER.ZCREATIONDATE`, windowStart)
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		return fmt.Errorf("error querying SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var title, notes, listName sql.NullString
+		var creationDate, lastModified, dueDate, completionDate sql.NullFloat64
+		var completed sql.NullInt64
+		err := rows.Scan(&title, &notes, &creationDate, &lastModified, &dueDate, &completed, &completionDate, &listName)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["list"] = listName.String
+		recordData["title"] = title.String
+		recordData["notes"] = notes.String
+		recordData["creation_time"] = utils.ConvertCFAbsoluteTime(creationDate.Float64)
+		recordData["last_modified"] = ""
+		if lastModified.Valid {
+			recordData["last_modified"] = utils.ConvertCFAbsoluteTime(lastModified.Float64)
+		}
+		recordData["due_time"] = ""
+		if dueDate.Valid {
+			recordData["due_time"] = utils.ConvertCFAbsoluteTime(dueDate.Float64)
+		}
+		recordData["completed"] = completed.Int64 == 1
+		recordData["completion_time"] = ""
+		if completionDate.Valid {
+			recordData["completion_time"] = utils.ConvertCFAbsoluteTime(completionDate.Float64)
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      recordData["creation_time"].(string),
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// calendarEmailDomain returns the lower case domain of an email address, accepting mailto: URLs
+func calendarEmailDomain(email string) string {
+	_, domain, found := strings.Cut(strings.TrimPrefix(email, "mailto:"), "@")
+	if !found {
+		return ""
+	}
+	return strings.ToLower(domain)
+}
@@ -1,7 +1,8 @@
 // This module reads and parses:
 // - Chrome history database for each user on disk.
 // - Chrome downloads database for each user on disk.
-// - Chrome profiles from the Local State file.
+// - Chrome profiles and the experimental flags enabled from chrome://flags from the Local State file.
+// - Security-relevant Preferences keys per profile (search provider, startup URLs, proxy, extensions loaded from the command line).
 // Relevant fields:
 // - visit_time: Timestamp of the visit.
 // - from_visit: ID of the previous visit (useful for tracing navigation paths).
@@ -64,6 +65,11 @@ func (m *ChromeModule) Run(params mod.ModuleParams) error {
 			params.Logger.Debug("Error when collecting Chrome profiles: %v", err)
 		}
 
+		err = getChromeLabsExperiments(location, m.GetName(), params)
+		if err != nil {
+			params.Logger.Debug("Error when collecting Chrome labs experiments: %v", err)
+		}
+
 		for _, profile := range profilesDir {
 			err = visitChromeHistory(location, profile, m.GetName(), params)
 			if err != nil {
@@ -84,6 +90,11 @@ func (m *ChromeModule) Run(params mod.ModuleParams) error {
 			if err != nil {
 				params.Logger.Debug("Error when collecting Chrome popup settings %v", err)
 			}
+
+			err = getChromePreferencesIndicators(location, profile, m.GetName(), params)
+			if err != nil {
+				params.Logger.Debug("Error when collecting Chrome preferences indicators %v", err)
+			}
 		}
 	}
 	return nil
@@ -102,6 +113,7 @@ func visitChromeHistory(location string, profileUsr string, moduleName string, p
 	if err != nil {
 		return err
 	}
+	defer writer.Close()
 
 	profile := filepath.Join(location, profileUsr, "History")
 	userProfile := strings.Split(profile, "/")[len(strings.Split(profile, "/"))-1]
@@ -169,6 +181,7 @@ func downloadsChromeHistory(location string, profileUsr string, moduleName strin
 	if err != nil {
 		return err
 	}
+	defer writer.Close()
 
 	userProfile := strings.Split(profile, "/")[len(strings.Split(profile, "/"))-1]
 	dst := "/tmp/ishinobu/" + userProfile + "_download_chrome_history"
@@ -279,6 +292,7 @@ func chromeProfiles(location string, moduleName string, params mod.ModuleParams)
 	if err != nil {
 		return nil, err
 	}
+	defer writer.Close()
 
 	// Stores the list of profilesDir
 	profilesDir := make([]string, 0)
@@ -334,6 +348,7 @@ func getChromeExtensions(location string, profileUsr string, moduleName string,
 	if err != nil {
 		return fmt.Errorf("failed to create data writer: %v", err)
 	}
+	defer writer.Close()
 
 	for _, extension := range extensions {
 		manifestFiles, err := utils.ListFiles(filepath.Join(location, profileUsr, "Extensions", extension.Name(), "*", "manifest.json"))
@@ -402,6 +417,7 @@ func getPopupChromeSettings(location string, profileUsr string, moduleName strin
 	if err != nil {
 		return fmt.Errorf("failed to create data writer: %v", err)
 	}
+	defer writer.Close()
 
 	// collect and display popup settings
 	recordData := make(map[string]interface{})
@@ -435,3 +451,196 @@ func getPopupChromeSettings(location string, profileUsr string, moduleName strin
 	}
 	return nil
 }
+
+// Extension install locations as defined by Chrome's ManifestLocation enum.
+// Unpacked and command line extensions are loaded outside the Web Store and
+// are a common sign of browser hijacking (e.g. --load-extension).
+var chromeExtensionLocations = map[float64]string{
+	1:  "internal",
+	2:  "external_pref",
+	3:  "external_registry",
+	4:  "unpacked",
+	5:  "component",
+	6:  "external_pref_download",
+	7:  "external_policy_download",
+	8:  "command_line",
+	9:  "external_policy",
+	10: "external_component",
+}
+
+func getChromePreferencesIndicators(location string, profileUsr string, moduleName string, params mod.ModuleParams) error {
+	preferencesFile := filepath.Join(location, profileUsr, "Preferences")
+	data, err := ioutil.ReadFile(preferencesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read preferences file: %v", err)
+	}
+
+	var preferences map[string]interface{}
+	if err := json.Unmarshal(data, &preferences); err != nil {
+		return fmt.Errorf("failed to parse JSON: %v", err)
+	}
+
+	userProfile := strings.Split(location, "/")[2]
+	outputFileName := utils.GetOutputFileName(moduleName+"-preferences-"+userProfile+"-"+profileUsr, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeIndicator := func(sourceFile, category, key string, value interface{}) {
+		if value == nil {
+			return
+		}
+		recordData := make(map[string]interface{})
+		recordData["os_user_name"] = userProfile
+		recordData["profile"] = profileUsr
+		recordData["category"] = category
+		recordData["key"] = key
+		recordData["value"] = value
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Default search provider overrides
+	if provider, ok := nestedChromeValue(preferences, "default_search_provider_data", "template_url_data").(map[string]interface{}); ok {
+		for _, key := range []string{"short_name", "keyword", "url", "suggestions_url", "new_tab_url", "prepopulate_id", "date_created", "last_modified"} {
+			writeIndicator(preferencesFile, "default_search_provider", key, provider[key])
+		}
+	}
+	if provider, ok := preferences["default_search_provider"].(map[string]interface{}); ok {
+		for key, value := range provider {
+			writeIndicator(preferencesFile, "default_search_provider", key, value)
+		}
+	}
+
+	// Startup URLs
+	writeIndicator(preferencesFile, "startup", "restore_on_startup", nestedChromeValue(preferences, "session", "restore_on_startup"))
+	if urls, ok := nestedChromeValue(preferences, "session", "startup_urls").([]interface{}); ok {
+		for _, url := range urls {
+			writeIndicator(preferencesFile, "startup", "startup_url", url)
+		}
+	}
+	writeIndicator(preferencesFile, "startup", "homepage", preferences["homepage"])
+	writeIndicator(preferencesFile, "startup", "homepage_is_newtabpage", preferences["homepage_is_newtabpage"])
+
+	// Proxy configuration
+	if proxy, ok := preferences["proxy"].(map[string]interface{}); ok {
+		for key, value := range proxy {
+			writeIndicator(preferencesFile, "proxy", key, value)
+		}
+	}
+
+	// Translate blocked languages
+	if languages, ok := preferences["translate_blocked_languages"].([]interface{}); ok {
+		for _, language := range languages {
+			writeIndicator(preferencesFile, "translate", "translate_blocked_language", language)
+		}
+	}
+
+	// Extensions loaded from outside the Web Store and developer mode
+	writeIndicator(preferencesFile, "automation", "developer_mode", nestedChromeValue(preferences, "extensions", "ui", "developer_mode"))
+	if settings, ok := nestedChromeValue(preferences, "extensions", "settings").(map[string]interface{}); ok {
+		for extensionID, value := range settings {
+			setting, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			extLocation, _ := setting["location"].(float64)
+			locationName := chromeExtensionLocations[extLocation]
+			if locationName != "unpacked" && locationName != "command_line" {
+				continue
+			}
+			writeIndicator(preferencesFile, "automation", "loaded_extension", map[string]interface{}{
+				"extension_id": extensionID,
+				"location":     locationName,
+				"path":         setting["path"],
+				"install_time": utils.ParseChromeTimestamp(fmt.Sprintf("%v", setting["install_time"])),
+			})
+		}
+	}
+
+	// Accessibility flags
+	if accessibility, ok := preferences["settings"].(map[string]interface{}); ok {
+		if a11y, ok := accessibility["a11y"].(map[string]interface{}); ok {
+			for key, value := range a11y {
+				writeIndicator(preferencesFile, "accessibility", key, value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getChromeLabsExperiments collects the experimental flags enabled from chrome://flags, which are stored in the
+// Local State file of the browser and shared by its profiles
+func getChromeLabsExperiments(location string, moduleName string, params mod.ModuleParams) error {
+	userProfile := strings.Split(location, "/")[2]
+	localStatePath := filepath.Join(location, "Local State")
+	data, err := ioutil.ReadFile(localStatePath)
+	if err != nil {
+		return fmt.Errorf("failed to read Local State file: %v", err)
+	}
+
+	var localState map[string]interface{}
+	if err := json.Unmarshal(data, &localState); err != nil {
+		return fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	experiments, ok := nestedChromeValue(localState, "browser", "enabled_labs_experiments").([]interface{})
+	if !ok || len(experiments) == 0 {
+		return nil
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-labs-experiments-"+userProfile, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, experiment := range experiments {
+		recordData := make(map[string]interface{})
+		recordData["os_user_name"] = userProfile
+		recordData["category"] = "automation"
+		recordData["key"] = "enabled_labs_experiment"
+		recordData["value"] = experiment
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          localStatePath,
+		}
+
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// nestedChromeValue walks a decoded JSON object following the given keys and
+// returns nil if any of them is missing.
+func nestedChromeValue(data map[string]interface{}, keys ...string) interface{} {
+	var current interface{} = data
+	for _, key := range keys {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
@@ -0,0 +1,385 @@
+// This module detects the clipboard managers installed for each user and collects their local history, as
+// credentials and other secrets frequently pass through the clipboard:
+//   - Maccy: Storage.sqlite (history items with first and last copy times, number of copies and content types).
+//   - Alfred: clipboard.alfdb (clipboard history with the source application).
+//   - Paste: the Core Data stores of the application, read from any entity with a date column.
+//   - Flycut: the clipping store of com.generalarcade.flycut.plist.
+//
+// One "manager" record is emitted per detected manager and one "entry" record per history entry, with its
+// timestamps, content type, length and SHA-256. The content itself can be left out with <InputDir>/clipboard.json:
+//
+//	{"redact": true}
+//
+// A SHA-256 of a short secret can be reversed by brute force and its length narrows the search, so with redaction
+// the length is left out and the SHA-256 is replaced by an HMAC-SHA256 keyed with a random key of the run: equal
+// contents can still be matched within the collection, but not against a list of candidate secrets.
+package modules
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ClipboardModule struct {
+	Name        string
+	Description string
+}
+
+// ClipboardConfig is the configuration of the clipboard module.
+type ClipboardConfig struct {
+	Redact bool `json:"redact"`
+}
+
+func init() {
+	module := &ClipboardModule{
+		Name:        "clipboard",
+		Description: "Detects clipboard managers (Maccy, Alfred, Paste, Flycut) and collects their clipboard history"}
+	mod.RegisterModule(module)
+}
+
+func (m *ClipboardModule) GetName() string {
+	return m.Name
+}
+
+func (m *ClipboardModule) GetDescription() string {
+	return m.Description
+}
+
+// clipboardManager is a clipboard manager with its applications and history stores
+type clipboardManager struct {
+	Applications []string
+	Stores       []string
+}
+
+// clipboardEntry is an entry of the history of a clipboard manager
+type clipboardEntry struct {
+	App         string
+	ContentType string
+	Content     string
+	FirstCopied string
+	LastCopied  string
+	Copies      interface{}
+}
+
+var (
+	clipboardManagers = map[string]clipboardManager{
+		"maccy": {
+			Applications: []string{"/Applications/Maccy.app", "/Users/*/Applications/Maccy.app"},
+			Stores:       []string{"/Users/*/Library/Containers/org.p0deje.Maccy/Data/Library/Application Support/Maccy/Storage.sqlite"},
+		},
+		"alfred": {
+			Applications: []string{"/Applications/Alfred *.app", "/Users/*/Applications/Alfred *.app"},
+			Stores: []string{
+				"/Users/*/Library/Application Support/Alfred/Databases/clipboard.alfdb",
+				"/Users/*/Library/Application Support/Alfred */Databases/clipboard.alfdb",
+			},
+		},
+		"paste": {
+			Applications: []string{"/Applications/Paste.app", "/Users/*/Applications/Paste.app"},
+			Stores: []string{
+				"/Users/*/Library/Application Support/com.wiheads.paste/*.db",
+				"/Users/*/Library/Application Support/com.wiheads.paste/*.sqlite",
+				"/Users/*/Library/Containers/com.wiheads.paste/Data/Library/Application Support/*/*.db",
+				"/Users/*/Library/Containers/com.wiheads.paste/Data/Library/Application Support/*/*.sqlite",
+			},
+		},
+		"flycut": {
+			Applications: []string{"/Applications/Flycut.app", "/Users/*/Applications/Flycut.app"},
+			Stores: []string{
+				"/Users/*/Library/Preferences/com.generalarcade.flycut.plist",
+				"/Users/*/Library/Containers/com.generalarcade.flycut/Data/Library/Preferences/com.generalarcade.flycut.plist",
+			},
+		},
+	}
+	clipboardManagerOrder = []string{"maccy", "alfred", "paste", "flycut"}
+
+	maccyQuery = `SELECT i.ZAPPLICATION AS app, i.ZFIRSTCOPIEDAT AS first_copied, i.ZLASTCOPIEDAT AS last_copied,
+i.ZNUMBEROFCOPIES AS copies, i.ZTITLE AS title, group_concat(c.ZTYPE, ', ') AS types
+FROM ZHISTORYITEM i LEFT JOIN ZHISTORYITEMCONTENT c ON c.ZITEM = i.Z_PK GROUP BY i.Z_PK`
+	alfredQuery = `SELECT item, ts, app, apppath, dataType FROM clipboard`
+	// Content types of the Alfred clipboard history
+	alfredDataTypes = map[int64]string{0: "text", 1: "image", 2: "file"}
+)
+
+func (m *ClipboardModule) Run(params mod.ModuleParams) error {
+	config := ClipboardConfig{}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Key of the content HMACs, only known for the duration of the run
+	var redactKey []byte
+	if config.Redact {
+		redactKey = make([]byte, 32)
+		if _, err := rand.Read(redactKey); err != nil {
+			return fmt.Errorf("failed to generate the redaction key: %v", err)
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-clipboard")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeRecord := func(sourceFile, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	storeCount := 0
+	for _, name := range clipboardManagerOrder {
+		manager := clipboardManagers[name]
+
+		for _, path := range utils.GlobPaths(manager.Applications...) {
+			writeRecord(path, fileModTime(path), map[string]interface{}{
+				"record_type": "manager",
+				"manager":     name,
+				"username":    utils.GetUsernameFromPath(path),
+				"path":        path,
+			})
+		}
+
+		for _, path := range utils.GlobPaths(manager.Stores...) {
+			var entries []clipboardEntry
+			if name == "flycut" {
+				entries, err = readFlycutStore(path)
+			} else {
+				storeCount++
+				dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", storeCount))
+				if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+					params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+					continue
+				}
+				dst, err := utils.CopyDatabase(path, dstDir)
+				if err != nil {
+					params.Logger.Debug("Error copying database %s: %v", path, err)
+					continue
+				}
+				switch name {
+				case "maccy":
+					entries, err = readMaccyStore(dst)
+				case "alfred":
+					entries, err = readAlfredStore(dst)
+				default:
+					entries, err = readCoreDataClipboard(dst)
+				}
+			}
+			if err != nil {
+				params.Logger.Debug("Error reading clipboard history %s: %v", path, err)
+				continue
+			}
+
+			username := utils.GetUsernameFromPath(path)
+			writeRecord(path, fileModTime(path), map[string]interface{}{
+				"record_type": "manager",
+				"manager":     name,
+				"username":    username,
+				"path":        path,
+				"entries":     len(entries),
+			})
+			for _, entry := range entries {
+				hash := sha256.Sum256([]byte(entry.Content))
+				content := entry.Content
+				var contentLength interface{} = len(entry.Content)
+				contentSHA256 := hex.EncodeToString(hash[:])
+				contentHMAC := ""
+				if config.Redact {
+					mac := hmac.New(sha256.New, redactKey)
+					mac.Write([]byte(entry.Content))
+					content, contentLength, contentSHA256 = "", "", ""
+					contentHMAC = hex.EncodeToString(mac.Sum(nil))
+				}
+				eventTimestamp := entry.LastCopied
+				if eventTimestamp == "" {
+					eventTimestamp = entry.FirstCopied
+				}
+				if eventTimestamp == "" {
+					eventTimestamp = fileModTime(path)
+				}
+				writeRecord(path, eventTimestamp, map[string]interface{}{
+					"record_type":    "entry",
+					"manager":        name,
+					"username":       username,
+					"path":           path,
+					"app":            entry.App,
+					"content_type":   entry.ContentType,
+					"first_copied":   entry.FirstCopied,
+					"last_copied":    entry.LastCopied,
+					"copies":         valueOrEmpty(entry.Copies),
+					"content":        content,
+					"content_length": contentLength,
+					"content_sha256": contentSHA256,
+					"content_hmac":   contentHMAC,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// clipboardTime converts a Core Data or Alfred timestamp (seconds since 2001-01-01) of a query row
+func clipboardTime(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return utils.ConvertCFAbsoluteTime(v)
+	case int64:
+		return utils.ConvertCFAbsoluteTime(float64(v))
+	}
+	return ""
+}
+
+// readMaccyStore returns the history items of a Maccy store
+func readMaccyStore(dbPath string) ([]clipboardEntry, error) {
+	rows, err := utils.QuerySQLiteMaps(dbPath, maccyQuery)
+	if err != nil {
+		return nil, err
+	}
+	var entries []clipboardEntry
+	for _, row := range rows {
+		entries = append(entries, clipboardEntry{
+			App:         fmt.Sprintf("%v", valueOrEmpty(row["app"])),
+			ContentType: fmt.Sprintf("%v", valueOrEmpty(row["types"])),
+			Content:     fmt.Sprintf("%v", valueOrEmpty(row["title"])),
+			FirstCopied: clipboardTime(row["first_copied"]),
+			LastCopied:  clipboardTime(row["last_copied"]),
+			Copies:      row["copies"],
+		})
+	}
+	return entries, nil
+}
+
+// readAlfredStore returns the clipboard history of Alfred
+func readAlfredStore(dbPath string) ([]clipboardEntry, error) {
+	rows, err := utils.QuerySQLiteMaps(dbPath, alfredQuery)
+	if err != nil {
+		return nil, err
+	}
+	var entries []clipboardEntry
+	for _, row := range rows {
+		app := fmt.Sprintf("%v", valueOrEmpty(row["app"]))
+		if app == "" {
+			app = fmt.Sprintf("%v", valueOrEmpty(row["apppath"]))
+		}
+		contentType := fmt.Sprintf("%v", valueOrEmpty(row["dataType"]))
+		if dataType, ok := row["dataType"].(int64); ok && alfredDataTypes[dataType] != "" {
+			contentType = alfredDataTypes[dataType]
+		}
+		entries = append(entries, clipboardEntry{
+			App:         app,
+			ContentType: contentType,
+			Content:     fmt.Sprintf("%v", valueOrEmpty(row["item"])),
+			LastCopied:  clipboardTime(row["ts"]),
+		})
+	}
+	return entries, nil
+}
+
+// readCoreDataClipboard returns the entries of a Core Data store whose schema is not known in advance. Every
+// entity (Z table) with a date column is read, taking the text, application and type columns by their name.
+func readCoreDataClipboard(dbPath string) ([]clipboardEntry, error) {
+	tables, err := utils.QuerySQLiteMaps(dbPath, `SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'Z%' AND name NOT LIKE 'Z\_%' ESCAPE '\'`)
+	if err != nil {
+		return nil, err
+	}
+	var entries []clipboardEntry
+	for _, table := range tables {
+		tableName := fmt.Sprintf("%v", table["name"])
+		columns, err := utils.QuerySQLiteMaps(dbPath, fmt.Sprintf(`PRAGMA table_info("%s")`, tableName))
+		if err != nil {
+			continue
+		}
+		var dateColumn, contentColumn, appColumn, typeColumn string
+		for _, column := range columns {
+			name := fmt.Sprintf("%v", column["name"])
+			upper := strings.ToUpper(name)
+			switch {
+			case dateColumn == "" && (strings.Contains(upper, "DATE") || strings.Contains(upper, "TIMESTAMP") || strings.Contains(upper, "COPIED")):
+				dateColumn = name
+			case contentColumn == "" && (strings.Contains(upper, "TEXT") || strings.Contains(upper, "STRING") || strings.Contains(upper, "PREVIEW") || upper == "ZTITLE" || upper == "ZCONTENT"):
+				contentColumn = name
+			case appColumn == "" && (strings.Contains(upper, "APP") || strings.Contains(upper, "SOURCE")):
+				appColumn = name
+			case typeColumn == "" && (upper == "ZTYPE" || upper == "ZKIND" || strings.Contains(upper, "UTI")):
+				typeColumn = name
+			}
+		}
+		if dateColumn == "" || (contentColumn == "" && typeColumn == "") {
+			continue
+		}
+		selected := []string{fmt.Sprintf(`"%s" AS date`, dateColumn)}
+		for alias, column := range map[string]string{"content": contentColumn, "app": appColumn, "type": typeColumn} {
+			if column != "" {
+				selected = append(selected, fmt.Sprintf(`"%s" AS %s`, column, alias))
+			}
+		}
+		rows, err := utils.QuerySQLiteMaps(dbPath, fmt.Sprintf(`SELECT %s FROM "%s"`, strings.Join(selected, ", "), tableName))
+		if err != nil {
+			continue
+		}
+		for _, row := range rows {
+			entries = append(entries, clipboardEntry{
+				App:         fmt.Sprintf("%v", valueOrEmpty(row["app"])),
+				ContentType: fmt.Sprintf("%v", valueOrEmpty(row["type"])),
+				Content:     fmt.Sprintf("%v", valueOrEmpty(row["content"])),
+				LastCopied:  clipboardTime(row["date"]),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// readFlycutStore returns the clippings of the Flycut preferences
+func readFlycutStore(path string) ([]clipboardEntry, error) {
+	var preferences map[string]interface{}
+	if err := utils.ParsePlistFile(path, &preferences); err != nil {
+		return nil, err
+	}
+	var entries []clipboardEntry
+	store, _ := preferences["store"].(map[string]interface{})
+	clippings, _ := store["jcList"].([]interface{})
+	for _, value := range clippings {
+		clipping, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		app := fmt.Sprintf("%v", valueOrEmpty(clipping["AppLocalizedName"]))
+		if app == "" {
+			app = fmt.Sprintf("%v", valueOrEmpty(clipping["AppBundleURL"]))
+		}
+		entries = append(entries, clipboardEntry{
+			App:         app,
+			ContentType: fmt.Sprintf("%v", valueOrEmpty(clipping["Type"])),
+			Content:     fmt.Sprintf("%v", valueOrEmpty(clipping["Contents"])),
+		})
+	}
+	return entries, nil
+}
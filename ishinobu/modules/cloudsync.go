@@ -0,0 +1,284 @@
+// This module collects the metadata of the cloud storage sync clients:
+//   - File Provider sync roots: /Users/*/Library/CloudStorage/* (Dropbox, GoogleDrive-<account>, OneDrive-<tenant>,
+//     Box-Box, ...), with the linked account extracted from the folder name.
+//   - Dropbox: ~/.dropbox/info.json (sync root, team and host of each account) and the recently synced files
+//     of ~/.dropbox/instance*/sync_history.db. The selective sync configuration (config.dbx) is encrypted and not decoded.
+//   - Google Drive (DriveFS): account folders of ~/Library/Application Support/Google/DriveFS, their sync roots
+//     (root_preference_sqlite.db) and files (metadata_sqlite_db).
+//   - OneDrive: accounts of the OneDrive preferences (email, tenant, sync folder) and the excluded folders.
+//   - Box Drive: files of ~/Library/Application Support/Box/Box/data/streemsfs.db.
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type CloudSyncModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &CloudSyncModule{
+		Name:        "cloudsync",
+		Description: "Collects Dropbox, Google Drive, OneDrive and Box accounts, sync roots and synced files"}
+	mod.RegisterModule(module)
+}
+
+func (m *CloudSyncModule) GetName() string {
+	return m.Name
+}
+
+func (m *CloudSyncModule) GetDescription() string {
+	return m.Description
+}
+
+// cloudSyncDatabase is a sync client database and the query listing its files
+type cloudSyncDatabase struct {
+	Client string
+	Glob   string
+	Query  string
+}
+
+var (
+	cloudSyncDatabases = []cloudSyncDatabase{
+		{
+			Client: "dropbox",
+			Glob:   "/Users/*/.dropbox/instance*/sync_history.db",
+			Query:  "SELECT * FROM sync_history",
+		},
+		{
+			Client: "googledrive",
+			Glob:   "/Users/*/Library/Application Support/Google/DriveFS/*/root_preference_sqlite.db",
+			Query:  "SELECT * FROM roots",
+		},
+		{
+			Client: "googledrive",
+			Glob:   "/Users/*/Library/Application Support/Google/DriveFS/*/metadata_sqlite_db",
+			Query:  "SELECT stable_id, local_title, mime_type, is_folder, is_owner, trashed, modified_date, viewed_by_me_date, file_size FROM items",
+		},
+		{
+			Client: "box",
+			Glob:   "/Users/*/Library/Application Support/Box/Box/data/streemsfs.db",
+			Query:  "SELECT * FROM fsnodes",
+		},
+	}
+	// Account keys of the OneDrive preferences
+	oneDriveAccountKeys = []string{"UserEmail", "UserFolder", "UserCid", "cid", "ConfiguredTenantId", "TenantName", "DisplayName"}
+)
+
+func (m *CloudSyncModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeCloud := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// File Provider sync roots, named <Provider>-<account>
+	for _, path := range utils.GlobPaths("/Users/*/Library/CloudStorage/*") {
+		name := filepath.Base(path)
+		client, account, _ := strings.Cut(name, "-")
+		writeCloud(path, fileModTime(path), map[string]interface{}{
+			"client":  strings.ToLower(client),
+			"type":    "sync_root",
+			"account": account,
+			"path":    path,
+		})
+	}
+
+	// Dropbox accounts
+	for _, path := range utils.GlobPaths("/Users/*/.dropbox/info.json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var accounts map[string]map[string]interface{}
+		if err := json.Unmarshal(data, &accounts); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for accountType, account := range accounts {
+			writeCloud(path, fileModTime(path), map[string]interface{}{
+				"client":       "dropbox",
+				"type":         "account",
+				"account":      accountType,
+				"path":         account["path"],
+				"host":         account["host"],
+				"is_team":      account["is_team"],
+				"subscription": account["subscription_type"],
+			})
+		}
+	}
+
+	// Google Drive accounts are folders named after the account identifier
+	for _, path := range utils.GlobPaths("/Users/*/Library/Application Support/Google/DriveFS/*") {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() || !isDigits(filepath.Base(path)) {
+			continue
+		}
+		writeCloud(path, fileModTime(path), map[string]interface{}{
+			"client":  "googledrive",
+			"type":    "account",
+			"account": filepath.Base(path),
+			"path":    path,
+		})
+	}
+
+	// OneDrive accounts and excluded folders
+	for _, path := range utils.GlobPaths("/Users/*/Library/Group Containers/UBF8T346G9.OneDriveStandaloneSuite/Library/Preferences/UBF8T346G9.OneDriveStandaloneSuite.plist",
+		"/Users/*/Library/Containers/com.microsoft.OneDrive-mac/Data/Library/Preferences/com.microsoft.OneDrive-mac.plist",
+		"/Users/*/Library/Preferences/com.microsoft.OneDrive.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for accountName, value := range preferences {
+			account, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			recordData := map[string]interface{}{
+				"client":  "onedrive",
+				"type":    "account",
+				"account": accountName,
+			}
+			found := false
+			for _, key := range oneDriveAccountKeys {
+				if accountValue, ok := account[key]; ok {
+					recordData[strings.ToLower(key)] = accountValue
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+			writeCloud(path, fileModTime(path), recordData)
+
+			walkPlist(account, func(item map[string]interface{}) {
+				for key, value := range item {
+					if !strings.Contains(strings.ToLower(key), "exclu") {
+						continue
+					}
+					folders, ok := value.([]interface{})
+					if !ok {
+						folders = []interface{}{value}
+					}
+					for _, folder := range folders {
+						writeCloud(path, fileModTime(path), map[string]interface{}{
+							"client":  "onedrive",
+							"type":    "exclusion",
+							"account": accountName,
+							"path":    fmt.Sprintf("%v", folder),
+						})
+					}
+				}
+			})
+		}
+	}
+
+	// Synced files and sync roots from the client databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-cloudsync")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	index := 0
+	for _, database := range cloudSyncDatabases {
+		for _, dbPath := range utils.GlobPaths(database.Glob) {
+			index++
+			dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", index))
+			if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+				params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+				continue
+			}
+			dst, err := utils.CopyDatabase(dbPath, dstDir)
+			if err != nil {
+				params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+				continue
+			}
+			rows, err := utils.QuerySQLiteMaps(dst, database.Query)
+			if err != nil {
+				params.Logger.Debug("Error querying %s: %v", dbPath, err)
+				continue
+			}
+
+			recordType := "synced_file"
+			if strings.HasSuffix(dbPath, "root_preference_sqlite.db") {
+				recordType = "sync_root"
+			}
+			for _, row := range rows {
+				eventTimestamp := cloudSyncRowTimestamp(row)
+				row["client"] = database.Client
+				row["type"] = recordType
+				row["account"] = filepath.Base(filepath.Dir(dbPath))
+				writeCloud(dbPath, eventTimestamp, row)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cloudSyncRowTimestamp converts the time columns of a sync database row (*date*, *time*, *_at, createdAt, ...)
+// to TimeFormat and returns the most recent one
+func cloudSyncRowTimestamp(row map[string]interface{}) string {
+	var timestamps []string
+	for column, value := range row {
+		number, ok := value.(int64)
+		if !ok {
+			continue
+		}
+		lower := strings.ToLower(column)
+		if !strings.Contains(lower, "date") && !strings.Contains(lower, "time") && !strings.HasSuffix(lower, "_at") && !strings.HasSuffix(lower, "edat") {
+			continue
+		}
+		// Google Drive and Box store milliseconds, Dropbox seconds
+		if number > 1e11 {
+			number /= 1000
+		}
+		formatted := utils.ConvertUnixTimestamp(number)
+		row[column] = formatted
+		timestamps = append(timestamps, formatted)
+	}
+	return utils.LatestTimestamp(timestamps...)
+}
+
+// isDigits reports whether a string is a non-empty sequence of digits
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
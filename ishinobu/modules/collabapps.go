@@ -0,0 +1,253 @@
+// This module collects the local artifacts of the collaboration applications of each user:
+//   - Slack: workspaces (id, name, domain) and downloads (file, URL, path, times) of storage/root-state.json,
+//     for the direct download and the App Store versions.
+//   - Microsoft Teams: signed-in accounts and tenants of desktop-config.json (classic Teams) and of the
+//     settings files of the new Teams (MSTeams).
+//   - Zoom: signed-in account of the us.zoom.xos preferences and the local recordings folders.
+//   - Size of the cache and data folders of each application.
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type CollabAppsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &CollabAppsModule{
+		Name:        "collabapps",
+		Description: "Collects Slack, Teams and Zoom workspaces, accounts, file transfers and cache sizes"}
+	mod.RegisterModule(module)
+}
+
+func (m *CollabAppsModule) GetName() string {
+	return m.Name
+}
+
+func (m *CollabAppsModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	slackStatePaths = []string{
+		"/Users/*/Library/Application Support/Slack/storage/root-state.json",
+		"/Users/*/Library/Containers/com.tinyspeck.slackmacgap/Data/Library/Application Support/Slack/storage/root-state.json",
+	}
+	teamsConfigPaths = []string{
+		"/Users/*/Library/Application Support/Microsoft/Teams/desktop-config.json",
+		"/Users/*/Library/Containers/com.microsoft.teams2/Data/Library/Application Support/Microsoft/MSTeams/*.json",
+	}
+	zoomPreferencePaths = []string{
+		"/Users/*/Library/Preferences/us.zoom.xos.plist",
+	}
+	// Application data folders whose size is reported
+	collabDataFolders = map[string][]string{
+		"slack": {
+			"/Users/*/Library/Application Support/Slack",
+			"/Users/*/Library/Containers/com.tinyspeck.slackmacgap/Data/Library/Application Support/Slack",
+		},
+		"teams": {
+			"/Users/*/Library/Application Support/Microsoft/Teams",
+			"/Users/*/Library/Containers/com.microsoft.teams2/Data/Library/Application Support/Microsoft/MSTeams",
+		},
+		"zoom": {
+			"/Users/*/Library/Application Support/zoom.us",
+		},
+	}
+)
+
+func (m *CollabAppsModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeCollab := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Slack workspaces and downloads
+	for _, path := range utils.GlobPaths(slackStatePaths...) {
+		state, err := readJSONFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		stateMap, _ := state.(map[string]interface{})
+
+		workspaces, _ := stateMap["workspaces"].(map[string]interface{})
+		for id, value := range workspaces {
+			workspace, _ := value.(map[string]interface{})
+			writeCollab(path, fileModTime(path), map[string]interface{}{
+				"app":          "slack",
+				"type":         "workspace",
+				"workspace_id": id,
+				"name":         workspace["name"],
+				"domain":       workspace["domain"],
+				"url":          workspace["url"],
+			})
+		}
+
+		// downloads are indexed by workspace and download id
+		downloads, _ := stateMap["downloads"].(map[string]interface{})
+		for workspaceID, value := range downloads {
+			items, _ := value.(map[string]interface{})
+			for _, item := range items {
+				download, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				startTime := collabMillis(download["startTime"])
+				writeCollab(path, startTime, map[string]interface{}{
+					"app":          "slack",
+					"type":         "file_transfer",
+					"workspace_id": workspaceID,
+					"file_name":    filepath.Base(fmt.Sprintf("%v", download["downloadPath"])),
+					"path":         download["downloadPath"],
+					"url":          download["url"],
+					"state":        download["downloadState"],
+					"start_time":   startTime,
+					"end_time":     collabMillis(download["endTime"]),
+				})
+			}
+		}
+	}
+
+	// Teams accounts and tenants
+	for _, path := range utils.GlobPaths(teamsConfigPaths...) {
+		config, err := readJSONFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		seen := make(map[string]bool)
+		walkPlist(config, func(item map[string]interface{}) {
+			for key, value := range item {
+				text, ok := value.(string)
+				lower := strings.ToLower(key)
+				if !ok || text == "" || !(strings.Contains(lower, "upn") || strings.Contains(lower, "email") || strings.Contains(lower, "tenantid")) {
+					continue
+				}
+				if seen[key+text] {
+					continue
+				}
+				seen[key+text] = true
+				writeCollab(path, fileModTime(path), map[string]interface{}{
+					"app":   "teams",
+					"type":  "account",
+					"key":   key,
+					"value": text,
+				})
+			}
+		})
+	}
+
+	// Zoom account and recordings
+	for _, path := range utils.GlobPaths(zoomPreferencePaths...) {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for key, value := range preferences {
+			text, ok := value.(string)
+			lower := strings.ToLower(key)
+			if !ok || text == "" || !(strings.Contains(lower, "email") || strings.Contains(lower, "account") || strings.Contains(lower, "domain")) {
+				continue
+			}
+			writeCollab(path, fileModTime(path), map[string]interface{}{
+				"app":   "zoom",
+				"type":  "account",
+				"key":   key,
+				"value": text,
+			})
+		}
+	}
+	for _, path := range utils.GlobPaths("/Users/*/Documents/Zoom/*") {
+		writeCollab(path, fileModTime(path), map[string]interface{}{
+			"app":  "zoom",
+			"type": "recording",
+			"path": path,
+			"size": folderSize(path),
+		})
+	}
+
+	// Cache and data folder sizes
+	for app, patterns := range collabDataFolders {
+		for _, path := range utils.GlobPaths(patterns...) {
+			writeCollab(path, fileModTime(path), map[string]interface{}{
+				"app":  app,
+				"type": "data_folder",
+				"path": path,
+				"size": folderSize(path),
+			})
+		}
+	}
+
+	return nil
+}
+
+// readJSONFile decodes a JSON file into generic maps and slices
+func readJSONFile(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// collabMillis converts a JSON number of milliseconds since the Unix epoch to TimeFormat
+func collabMillis(value interface{}) string {
+	millis, ok := value.(float64)
+	if !ok || millis <= 0 {
+		return ""
+	}
+	return utils.ConvertUnixTimestamp(int64(millis / 1000))
+}
+
+// folderSize returns the total size in bytes of the files under a folder
+func folderSize(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
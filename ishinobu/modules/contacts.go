@@ -0,0 +1,175 @@
+// This module collects the contacts of each user from the AddressBook databases:
+// - /Users/*/Library/Application Support/AddressBook/AddressBook-v22.abcddb (local contacts)
+// - /Users/*/Library/Application Support/AddressBook/Sources/*/AddressBook-v22.abcddb (iCloud, Exchange, CardDAV accounts)
+// Each contact is emitted with its names, organization, emails, phone numbers, instant messaging handles
+// and creation/modification dates, so handles observed in other artifacts can be resolved to people.
+// The databases are copied to a temporary folder before being queried.
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ContactsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &ContactsModule{
+		Name:        "contacts",
+		Description: "Collects contact names, emails, phone numbers and dates from AddressBook databases"}
+	mod.RegisterModule(module)
+}
+
+func (m *ContactsModule) GetName() string {
+	return m.Name
+}
+
+func (m *ContactsModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *ContactsModule) Run(params mod.ModuleParams) error {
+	dbPaths := utils.GlobPaths("/Users/*/Library/Application Support/AddressBook/AddressBook-v22.abcddb",
+		"/Users/*/Library/Application Support/AddressBook/Sources/*/AddressBook-v22.abcddb")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-contacts")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parseAddressBook(dst, dbPath, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing AddressBook database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseAddressBook(dbPath string, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	username := utils.GetUsernameFromPath(sourceFile)
+	source := ""
+	if strings.Contains(sourceFile, "/Sources/") {
+		source = filepath.Base(filepath.Dir(sourceFile))
+	}
+
+	query := `
+		SELECT
+			ZABCDRECORD.ZFIRSTNAME,
+			ZABCDRECORD.ZLASTNAME,
+			ZABCDRECORD.ZNICKNAME,
+			ZABCDRECORD.ZORGANIZATION,
+			ZABCDRECORD.ZJOBTITLE,
+			ZABCDRECORD.ZCREATIONDATE,
+			ZABCDRECORD.ZMODIFICATIONDATE,
+			(SELECT group_concat(ZADDRESS, ', ') FROM ZABCDEMAILADDRESS WHERE ZOWNER = ZABCDRECORD.Z_PK),
+			(SELECT group_concat(ZFULLNUMBER, ', ') FROM ZABCDPHONENUMBER WHERE ZOWNER = ZABCDRECORD.Z_PK),
+			(SELECT group_concat(ZADDRESS, ', ') FROM ZABCDMESSAGINGADDRESS WHERE ZOWNER = ZABCDRECORD.Z_PK)
+		FROM ZABCDRECORD
+		WHERE ZABCDRECORD.ZFIRSTNAME IS NOT NULL OR ZABCDRECORD.ZLASTNAME IS NOT NULL OR ZABCDRECORD.ZORGANIZATION IS NOT NULL`
+	baseQuery := `
+		SELECT
+			ZABCDRECORD.ZFIRSTNAME,
+			ZABCDRECORD.ZLASTNAME,
+			ZABCDRECORD.ZNICKNAME,
+			ZABCDRECORD.ZORGANIZATION,
+			ZABCDRECORD.ZJOBTITLE,
+			ZABCDRECORD.ZCREATIONDATE,
+			ZABCDRECORD.ZMODIFICATIONDATE,
+			(SELECT group_concat(ZADDRESS, ', ') FROM ZABCDEMAILADDRESS WHERE ZOWNER = ZABCDRECORD.Z_PK),
+			(SELECT group_concat(ZFULLNUMBER, ', ') FROM ZABCDPHONENUMBER WHERE ZOWNER = ZABCDRECORD.Z_PK),
+			NULL
+		FROM ZABCDRECORD
+		WHERE ZABCDRECORD.ZFIRSTNAME IS NOT NULL OR ZABCDRECORD.ZLASTNAME IS NOT NULL OR ZABCDRECORD.ZORGANIZATION IS NOT NULL`
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to base AddressBook query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, baseQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var firstName, lastName, nickname, organization, jobTitle, emails, phones, messaging sql.NullString
+		var creationDate, modificationDate sql.NullFloat64
+		err := rows.Scan(&firstName, &lastName, &nickname, &organization, &jobTitle, &creationDate, &modificationDate,
+			&emails, &phones, &messaging)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["source"] = source
+		recordData["first_name"] = firstName.String
+		recordData["last_name"] = lastName.String
+		recordData["nickname"] = nickname.String
+		recordData["organization"] = organization.String
+		recordData["job_title"] = jobTitle.String
+		recordData["emails"] = emails.String
+		recordData["phone_numbers"] = phones.String
+		recordData["im_handles"] = messaging.String
+		recordData["creation_time"] = ""
+		if creationDate.Valid {
+			recordData["creation_time"] = utils.ConvertCFAbsoluteTime(creationDate.Float64)
+		}
+		recordData["modification_time"] = ""
+		if modificationDate.Valid {
+			recordData["modification_time"] = utils.ConvertCFAbsoluteTime(modificationDate.Float64)
+		}
+
+		eventTimestamp := recordData["creation_time"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
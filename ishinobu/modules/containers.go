@@ -0,0 +1,223 @@
+// This module maps the sandbox containers of each user, to locate the data of the applications without a
+// dedicated module:
+//   - containers: the application containers (~/Library/Containers/<bundle ID>) and the group containers
+//     (~/Library/Group Containers/<team ID>.<group>) with the identifier and code signing information of the
+//     container metadata (.com.apple.containermanagerd.metadata.plist), the size, the number of files and the
+//     latest modification.
+//   - containers-files: the notable files of the containers (property lists and SQLite databases) with their
+//     size, creation and modification times.
+//
+// The depth of the walk inside each container is configured in <InputDir>/containers.json ({"max_depth": N}).
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ContainersModule struct {
+	Name        string
+	Description string
+}
+
+// ContainersConfig is the configuration of the containers module.
+type ContainersConfig struct {
+	MaxDepth int `json:"max_depth"`
+}
+
+func init() {
+	module := &ContainersModule{
+		Name:        "containers",
+		Description: "Maps the application and group sandbox containers of each user with their size and notable property lists and databases"}
+	mod.RegisterModule(module)
+}
+
+func (m *ContainersModule) GetName() string {
+	return m.Name
+}
+
+func (m *ContainersModule) GetDescription() string {
+	return m.Description
+}
+
+const containerMetadataFile = ".com.apple.containermanagerd.metadata.plist"
+
+var (
+	containerPaths = map[string]string{
+		"app":   "/Users/*/Library/Containers/*",
+		"group": "/Users/*/Library/Group Containers/*",
+	}
+	// Extensions of the notable files of a container
+	containerFileExtensions = map[string]string{
+		".plist":     "plist",
+		".db":        "sqlite",
+		".sqlite":    "sqlite",
+		".sqlite3":   "sqlite",
+		".sqlitedb":  "sqlite",
+		".storedata": "sqlite",
+	}
+)
+
+func (m *ContainersModule) Run(params mod.ModuleParams) error {
+	config := ContainersConfig{MaxDepth: 8}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	filesFileName := utils.GetOutputFileName(m.GetName()+"-files", params.ExportFormat, params.OutputDir)
+	filesWriter, err := utils.NewDataWriter(params.LogsDir, filesFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer filesWriter.Close()
+
+	for _, kind := range []string{"app", "group"} {
+		for _, container := range utils.GlobPaths(containerPaths[kind]) {
+			info, err := os.Stat(container)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			username := utils.GetUsernameFromPath(container)
+			identifier := filepath.Base(container)
+
+			recordData := map[string]interface{}{
+				"username":   username,
+				"kind":       kind,
+				"identifier": identifier,
+				"path":       container,
+				"team_id":    "",
+				"signing_id": "",
+				"platform":   "",
+				"size":       int64(0),
+				"files":      0,
+				"created":    utils.FileBirthTime(info),
+				"modified":   "",
+				"plists":     0,
+				"databases":  0,
+			}
+			if kind == "group" {
+				if team, _, found := strings.Cut(identifier, "."); found && len(team) == 10 {
+					recordData["team_id"] = team
+				}
+			}
+
+			var metadata map[string]interface{}
+			if err := utils.ParsePlistFile(filepath.Join(container, containerMetadataFile), &metadata); err == nil {
+				if id, ok := metadata["MCMMetadataIdentifier"].(string); ok && id != "" {
+					recordData["identifier"] = id
+				}
+				walkPlist(metadata, func(item map[string]interface{}) {
+					if team, ok := item["TeamIdentifier"].(string); ok && team != "" {
+						recordData["team_id"] = team
+					}
+					if signingID, ok := item["SigningIdentifier"].(string); ok && signingID != "" {
+						recordData["signing_id"] = signingID
+					}
+					if platform, ok := item["Platform"]; ok {
+						recordData["platform"] = fmt.Sprintf("%v", platform)
+					}
+				})
+			}
+
+			var size int64
+			var latest time.Time
+			files, plists, databases := 0, 0, 0
+			depth := strings.Count(filepath.Clean(container), string(os.PathSeparator))
+			err = filepath.WalkDir(container, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					params.Logger.Debug("Error walking %s: %v", path, err)
+					return nil
+				}
+				if entry.IsDir() {
+					if strings.Count(path, string(os.PathSeparator))-depth >= config.MaxDepth {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !entry.Type().IsRegular() || entry.Name() == containerMetadataFile {
+					return nil
+				}
+				fileInfo, err := entry.Info()
+				if err != nil {
+					return nil
+				}
+				files++
+				size += fileInfo.Size()
+				if fileInfo.ModTime().After(latest) {
+					latest = fileInfo.ModTime()
+				}
+
+				fileType, ok := containerFileExtensions[strings.ToLower(filepath.Ext(path))]
+				if !ok {
+					return nil
+				}
+				if fileType == "plist" {
+					plists++
+				} else {
+					databases++
+				}
+				modified := fileInfo.ModTime().UTC().Format(utils.TimeFormat)
+				fileRecord := utils.Record{
+					CollectionTimestamp: params.CollectionTimestamp,
+					EventTimestamp:      modified,
+					Data: map[string]interface{}{
+						"username":   username,
+						"kind":       kind,
+						"identifier": recordData["identifier"],
+						"file_type":  fileType,
+						"path":       path,
+						"relative":   strings.TrimPrefix(path, container+"/"),
+						"size":       fileInfo.Size(),
+						"created":    utils.FileBirthTime(fileInfo),
+						"modified":   modified,
+					},
+					SourceFile: path,
+				}
+				if err := filesWriter.WriteRecord(fileRecord); err != nil {
+					params.Logger.Debug("Failed to write record: %v", err)
+				}
+				return nil
+			})
+			if err != nil {
+				params.Logger.Debug("Error walking %s: %v", container, err)
+			}
+
+			recordData["size"] = size
+			recordData["files"] = files
+			recordData["plists"] = plists
+			recordData["databases"] = databases
+			eventTimestamp := params.CollectionTimestamp
+			if !latest.IsZero() {
+				eventTimestamp = latest.UTC().Format(utils.TimeFormat)
+				recordData["modified"] = eventTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          container,
+			}
+			if err := writer.WriteRecord(record); err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
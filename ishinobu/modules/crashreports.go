@@ -0,0 +1,376 @@
+// This module collects metadata from crash and diagnostic reports:
+// - /Library/Logs/DiagnosticReports/* and /Library/Logs/DiagnosticReports/Retired/*
+// - /Users/*/Library/Logs/DiagnosticReports/*
+// Both the JSON based .ips format (macOS 12+) and the legacy text format (.crash, .hang, .spin, .diag) are parsed.
+// For each report the process, path, timestamp, exception type, termination reason, responsible process
+// and the first frames of the crashed thread are extracted.
+// Full reports of the processes listed in <InputDir>/crashreports.json are copied to the collection:
+//
+//	{
+//	  "copy_processes": ["Safari", "com.apple.WebKit.WebContent", "Preview"],
+//	  "copy_all": false
+//	}
+package modules
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type CrashReportsModule struct {
+	Name        string
+	Description string
+}
+
+// CrashReportsConfig is the configuration of the crashreports module.
+type CrashReportsConfig struct {
+	CopyProcesses []string `json:"copy_processes"`
+	CopyAll       bool     `json:"copy_all"`
+}
+
+func init() {
+	module := &CrashReportsModule{
+		Name:        "crashreports",
+		Description: "Collects metadata from crash and diagnostic reports"}
+	mod.RegisterModule(module)
+}
+
+func (m *CrashReportsModule) GetName() string {
+	return m.Name
+}
+
+func (m *CrashReportsModule) GetDescription() string {
+	return m.Description
+}
+
+// Number of frames of the crashed thread kept in the records
+const crashReportBacktraceFrames = 5
+
+// crashReport holds the fields extracted from a diagnostic report
+type crashReport struct {
+	Process           string
+	PID               string
+	Path              string
+	Identifier        string
+	Version           string
+	Timestamp         string
+	BugType           string
+	ExceptionType     string
+	TerminationReason string
+	Responsible       string
+	ParentProcess     string
+	OSVersion         string
+	Backtrace         []string
+}
+
+func (m *CrashReportsModule) Run(params mod.ModuleParams) error {
+	var config CrashReportsConfig
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	copyProcesses := make(map[string]bool)
+	for _, process := range config.CopyProcesses {
+		copyProcesses[strings.ToLower(process)] = true
+	}
+
+	paths := utils.GlobPaths("/Library/Logs/DiagnosticReports/*", "/Library/Logs/DiagnosticReports/Retired/*",
+		"/Users/*/Library/Logs/DiagnosticReports/*")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	copyDir := filepath.Join(params.LogsDir, m.GetName())
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		var report crashReport
+		if strings.HasSuffix(path, ".ips") {
+			report, err = parseIPSReport(path)
+		} else {
+			report, err = parseTextReport(path)
+		}
+		if err != nil {
+			params.Logger.Debug("Error parsing diagnostic report %s: %v", path, err)
+			continue
+		}
+
+		username := "system"
+		if strings.HasPrefix(path, "/Users/") {
+			username = utils.GetUsernameFromPath(path)
+		}
+
+		flagged := config.CopyAll || copyProcesses[strings.ToLower(report.Process)] ||
+			copyProcesses[strings.ToLower(report.Identifier)]
+		copiedTo := ""
+		if flagged {
+			if err := os.MkdirAll(copyDir, os.ModePerm); err != nil {
+				params.Logger.Debug("Failed to create directory %s: %v", copyDir, err)
+			} else {
+				copiedTo = filepath.Join(copyDir, username+"_"+filepath.Base(path))
+				if err := utils.CopyFile(path, copiedTo); err != nil {
+					params.Logger.Debug("Failed to copy %s: %v", path, err)
+					copiedTo = ""
+				}
+			}
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["report_type"] = strings.TrimPrefix(filepath.Ext(path), ".")
+		recordData["process"] = report.Process
+		recordData["pid"] = report.PID
+		recordData["process_path"] = report.Path
+		recordData["identifier"] = report.Identifier
+		recordData["version"] = report.Version
+		recordData["bug_type"] = report.BugType
+		recordData["exception_type"] = report.ExceptionType
+		recordData["termination_reason"] = report.TerminationReason
+		recordData["responsible_process"] = report.Responsible
+		recordData["parent_process"] = report.ParentProcess
+		recordData["os_version"] = report.OSVersion
+		recordData["backtrace"] = strings.Join(report.Backtrace, "\n")
+		recordData["flagged"] = flagged
+		recordData["copied_to"] = copiedTo
+
+		eventTimestamp := report.Timestamp
+		if eventTimestamp == "" {
+			eventTimestamp = info.ModTime().UTC().Format(utils.TimeFormat)
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ipsHeader is the first line of an .ips report
+type ipsHeader struct {
+	AppName   string `json:"app_name"`
+	Name      string `json:"name"`
+	BundleID  string `json:"bundleID"`
+	Version   string `json:"app_version"`
+	Timestamp string `json:"timestamp"`
+	BugType   string `json:"bug_type"`
+	OSVersion string `json:"os_version"`
+}
+
+// ipsBody is the part of the .ips crash report body (bug type 309) used by the module
+type ipsBody struct {
+	ProcName        string `json:"procName"`
+	ProcPath        string `json:"procPath"`
+	PID             int    `json:"pid"`
+	ParentProc      string `json:"parentProc"`
+	ResponsibleProc string `json:"responsibleProc"`
+	CaptureTime     string `json:"captureTime"`
+	Exception       struct {
+		Type   string `json:"type"`
+		Signal string `json:"signal"`
+	} `json:"exception"`
+	Termination struct {
+		Namespace string `json:"namespace"`
+		Indicator string `json:"indicator"`
+	} `json:"termination"`
+	FaultingThread int `json:"faultingThread"`
+	Threads        []struct {
+		Frames []struct {
+			ImageIndex  int    `json:"imageIndex"`
+			ImageOffset int64  `json:"imageOffset"`
+			Symbol      string `json:"symbol"`
+		} `json:"frames"`
+	} `json:"threads"`
+	UsedImages []struct {
+		Name string `json:"name"`
+		Path string `json:"path"`
+	} `json:"usedImages"`
+}
+
+func parseIPSReport(path string) (crashReport, error) {
+	var report crashReport
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+
+	headerLine, bodyData, _ := strings.Cut(string(data), "\n")
+	var header ipsHeader
+	if err := json.Unmarshal([]byte(headerLine), &header); err != nil {
+		return report, fmt.Errorf("error parsing report header: %v", err)
+	}
+
+	report.Process = header.AppName
+	if report.Process == "" {
+		report.Process = header.Name
+	}
+	report.Identifier = header.BundleID
+	report.Version = header.Version
+	report.BugType = header.BugType
+	report.OSVersion = header.OSVersion
+	report.Timestamp = parseCrashReportDate(header.Timestamp)
+
+	// Only crash reports have a structured body, other report types are kept with their header
+	var body ipsBody
+	if err := json.Unmarshal([]byte(bodyData), &body); err != nil {
+		return report, nil
+	}
+
+	if body.ProcName != "" {
+		report.Process = body.ProcName
+	}
+	report.Path = body.ProcPath
+	if body.PID != 0 {
+		report.PID = fmt.Sprintf("%d", body.PID)
+	}
+	report.ParentProcess = body.ParentProc
+	report.Responsible = body.ResponsibleProc
+	if body.CaptureTime != "" {
+		report.Timestamp = parseCrashReportDate(body.CaptureTime)
+	}
+	report.ExceptionType = strings.TrimSpace(body.Exception.Type + " " + body.Exception.Signal)
+	report.TerminationReason = strings.TrimSpace(body.Termination.Namespace + " " + body.Termination.Indicator)
+
+	if body.FaultingThread >= 0 && body.FaultingThread < len(body.Threads) {
+		for _, frame := range body.Threads[body.FaultingThread].Frames {
+			if len(report.Backtrace) >= crashReportBacktraceFrames {
+				break
+			}
+			image := "???"
+			if frame.ImageIndex >= 0 && frame.ImageIndex < len(body.UsedImages) && body.UsedImages[frame.ImageIndex].Name != "" {
+				image = body.UsedImages[frame.ImageIndex].Name
+			}
+			symbol := frame.Symbol
+			if symbol == "" {
+				symbol = fmt.Sprintf("0x%x", frame.ImageOffset)
+			}
+			report.Backtrace = append(report.Backtrace, image+" "+symbol)
+		}
+	}
+
+	return report, nil
+}
+
+func parseTextReport(path string) (crashReport, error) {
+	var report crashReport
+
+	file, err := os.Open(path)
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+
+	crashedThread := ""
+	inBacktrace := false
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if inBacktrace {
+			if strings.TrimSpace(line) == "" || len(report.Backtrace) >= crashReportBacktraceFrames {
+				break
+			}
+			report.Backtrace = append(report.Backtrace, strings.Join(strings.Fields(line), " "))
+			continue
+		}
+
+		if crashedThread != "" && strings.HasPrefix(line, "Thread "+crashedThread+" Crashed") {
+			inBacktrace = true
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "Process", "Command":
+			if report.Process == "" {
+				name, pid, _ := strings.Cut(value, " [")
+				report.Process = strings.TrimSpace(name)
+				report.PID = strings.TrimSuffix(pid, "]")
+			}
+		case "Path":
+			if report.Path == "" {
+				report.Path = value
+			}
+		case "Identifier":
+			if report.Identifier == "" {
+				report.Identifier = value
+			}
+		case "Version":
+			if report.Version == "" {
+				report.Version = value
+			}
+		case "Parent Process":
+			report.ParentProcess = value
+		case "Responsible", "Responsible Process":
+			report.Responsible = value
+		case "Date/Time":
+			report.Timestamp = parseCrashReportDate(value)
+		case "OS Version":
+			report.OSVersion = value
+		case "Exception Type", "Event":
+			report.ExceptionType = value
+		case "Termination Reason":
+			report.TerminationReason = value
+		case "Crashed Thread":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				crashedThread = fields[0]
+			}
+		}
+	}
+
+	if report.Process == "" {
+		report.Process = strings.Split(filepath.Base(path), "_")[0]
+	}
+
+	return report, scanner.Err()
+}
+
+// parseCrashReportDate converts the dates found in diagnostic reports to TimeFormat
+func parseCrashReportDate(value string) string {
+	layouts := []string{
+		"2006-01-02 15:04:05.99 -0700",
+		"2006-01-02 15:04:05.999 -0700",
+		"2006-01-02 15:04:05.999999 -0700",
+		"2006-01-02 15:04:05 -0700",
+	}
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(utils.TimeFormat)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,373 @@
+// This module collects the developer tooling footprint of each user:
+//   - Xcode: recent projects (shared file list of Xcode), simulator devices of CoreSimulator and the projects
+//     built in DerivedData with their workspace path and last access.
+//   - VS Code and its forks (Insiders, VSCodium, Cursor, Windsurf): recently opened folders, files and workspaces
+//     (state.vscdb and the legacy storage.json) and the installed extensions.
+//   - JetBrains IDEs and Android Studio: recent projects (recentProjects.xml, recentSolutions.xml) with the last
+//     open time and the installed plugins.
+package modules
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type DevEnvModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DevEnvModule{
+		Name:        "devenv",
+		Description: "Collects Xcode, VS Code and JetBrains recent projects, simulators, DerivedData and IDE extensions"}
+	mod.RegisterModule(module)
+}
+
+func (m *DevEnvModule) GetName() string {
+	return m.Name
+}
+
+func (m *DevEnvModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	xcodeRecentPaths = []string{
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/com.apple.dt.xcode.sfl*",
+	}
+	simulatorDevicePaths = []string{
+		"/Users/*/Library/Developer/CoreSimulator/Devices/*/device.plist",
+	}
+	derivedDataPaths = []string{
+		"/Users/*/Library/Developer/Xcode/DerivedData/*/info.plist",
+	}
+	// Application Support folder and extensions folder of VS Code and its forks
+	vscodeEditors = map[string][2]string{
+		"vscode":          {"Code", ".vscode"},
+		"vscode-insiders": {"Code - Insiders", ".vscode-insiders"},
+		"vscodium":        {"VSCodium", ".vscode-oss"},
+		"cursor":          {"Cursor", ".cursor"},
+		"windsurf":        {"Windsurf", ".windsurf"},
+	}
+	jetBrainsRecentPaths = []string{
+		"/Users/*/Library/Application Support/JetBrains/*/options/recentProjects.xml",
+		"/Users/*/Library/Application Support/JetBrains/*/options/recentSolutions.xml",
+		"/Users/*/Library/Application Support/Google/AndroidStudio*/options/recentProjects.xml",
+	}
+	jetBrainsPluginPaths = []string{
+		"/Users/*/Library/Application Support/JetBrains/*/plugins/*",
+		"/Users/*/Library/Application Support/Google/AndroidStudio*/plugins/*",
+	}
+	// CoreSimulator device states
+	simulatorStates = map[uint64]string{
+		0: "creating",
+		1: "shutdown",
+		2: "booting",
+		3: "booted",
+		4: "shutting down",
+	}
+)
+
+const vscodeRecentQuery = `SELECT value FROM ItemTable WHERE key = 'history.recentlyOpenedPathsList'`
+
+func (m *DevEnvModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeDev := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		for _, key := range []string{"name", "path", "version", "publisher", "last_used"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Xcode recent projects
+	for _, path := range utils.GlobPaths(xcodeRecentPaths...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+		archive, _ := root.(map[string]interface{})
+		items, _ := archive["items"].([]interface{})
+		for _, value := range items {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			recordData := map[string]interface{}{
+				"app":  "xcode",
+				"type": "recent_project",
+				"name": valueOrEmpty(item["Name"]),
+			}
+			if bookmarkData, ok := item["Bookmark"].([]byte); ok {
+				if bookmark, err := utils.ParseBookmark(bookmarkData); err == nil && bookmark.Path != "" {
+					recordData["path"] = bookmark.Path
+					if recordData["name"] == "" {
+						recordData["name"] = filepath.Base(bookmark.Path)
+					}
+				}
+			}
+			writeDev(path, fileModTime(path), recordData)
+		}
+	}
+
+	// Simulator devices
+	for _, path := range utils.GlobPaths(simulatorDevicePaths...) {
+		var device map[string]interface{}
+		if err := utils.ParsePlistFile(path, &device); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		runtime, _ := device["runtime"].(string)
+		deviceType, _ := device["deviceType"].(string)
+		state, _ := device["state"].(uint64)
+		writeDev(path, fileModTime(path), map[string]interface{}{
+			"app":         "xcode",
+			"type":        "simulator",
+			"name":        valueOrEmpty(device["name"]),
+			"path":        filepath.Dir(path),
+			"version":     strings.TrimPrefix(runtime, "com.apple.CoreSimulator.SimRuntime."),
+			"udid":        valueOrEmpty(device["UDID"]),
+			"device_type": strings.TrimPrefix(deviceType, "com.apple.CoreSimulator.SimDeviceType."),
+			"state":       simulatorStates[state],
+		})
+	}
+
+	// DerivedData projects, the folder is named <project>-<hash>
+	for _, path := range utils.GlobPaths(derivedDataPaths...) {
+		var info map[string]interface{}
+		if err := utils.ParsePlistFile(path, &info); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		name := filepath.Base(filepath.Dir(path))
+		if dash := strings.LastIndex(name, "-"); dash > 0 {
+			name = name[:dash]
+		}
+		lastAccessed := utils.FormatPlistDate(info["LastAccessedDate"])
+		eventTimestamp := lastAccessed
+		if eventTimestamp == "" {
+			eventTimestamp = fileModTime(path)
+		}
+		writeDev(path, eventTimestamp, map[string]interface{}{
+			"app":       "xcode",
+			"type":      "derived_data",
+			"name":      name,
+			"path":      valueOrEmpty(info["WorkspacePath"]),
+			"last_used": lastAccessed,
+		})
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-devenv")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for editor, folders := range vscodeEditors {
+		// Recently opened folders, files and workspaces
+		statePaths := utils.GlobPaths(filepath.Join("/Users/*/Library/Application Support", folders[0], "User/globalStorage/state.vscdb"))
+		for i, dbPath := range statePaths {
+			dstDir := filepath.Join(tmpDir, fmt.Sprintf("%s-%d", editor, i))
+			if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+				params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+				continue
+			}
+			dst, err := utils.CopyDatabase(dbPath, dstDir)
+			if err != nil {
+				params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+				continue
+			}
+			rows, err := utils.QuerySQLiteMaps(dst, vscodeRecentQuery)
+			if err != nil {
+				params.Logger.Debug("Error querying %s: %v", dbPath, err)
+				continue
+			}
+			for _, row := range rows {
+				var recent struct {
+					Entries []map[string]interface{} `json:"entries"`
+				}
+				if err := json.Unmarshal([]byte(fmt.Sprintf("%v", row["value"])), &recent); err != nil {
+					params.Logger.Debug("Error decoding recent entries of %s: %v", dbPath, err)
+					continue
+				}
+				for _, entry := range recent.Entries {
+					writeDev(dbPath, fileModTime(dbPath), vscodeRecentEntry(editor, entry))
+				}
+			}
+		}
+
+		// Legacy location of the recent entries
+		for _, path := range utils.GlobPaths(filepath.Join("/Users/*/Library/Application Support", folders[0], "storage.json")) {
+			value, err := readJSONFile(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			storage, _ := value.(map[string]interface{})
+			opened, _ := storage["openedPathsList"].(map[string]interface{})
+			entries, _ := opened["entries"].([]interface{})
+			for _, value := range entries {
+				if entry, ok := value.(map[string]interface{}); ok {
+					writeDev(path, fileModTime(path), vscodeRecentEntry(editor, entry))
+				}
+			}
+		}
+
+		// Installed extensions
+		for _, path := range utils.GlobPaths(filepath.Join("/Users/*", folders[1], "extensions/*/package.json")) {
+			value, err := readJSONFile(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			manifest, _ := value.(map[string]interface{})
+			writeDev(path, fileModTime(filepath.Dir(path)), map[string]interface{}{
+				"app":          editor,
+				"type":         "extension",
+				"name":         fmt.Sprintf("%v.%v", valueOrEmpty(manifest["publisher"]), valueOrEmpty(manifest["name"])),
+				"display_name": valueOrEmpty(manifest["displayName"]),
+				"path":         filepath.Dir(path),
+				"version":      valueOrEmpty(manifest["version"]),
+				"publisher":    valueOrEmpty(manifest["publisher"]),
+			})
+		}
+	}
+
+	// JetBrains recent projects
+	for _, path := range utils.GlobPaths(jetBrainsRecentPaths...) {
+		projects, err := readJetBrainsRecentProjects(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		product := filepath.Base(filepath.Dir(filepath.Dir(path)))
+		home := filepath.Join("/Users", utils.GetUsernameFromPath(path))
+		for _, project := range projects {
+			projectPath := strings.ReplaceAll(project[0], "$USER_HOME$", home)
+			eventTimestamp := project[1]
+			if eventTimestamp == "" {
+				eventTimestamp = fileModTime(path)
+			}
+			writeDev(path, eventTimestamp, map[string]interface{}{
+				"app":       "jetbrains",
+				"type":      "recent_project",
+				"name":      filepath.Base(projectPath),
+				"path":      projectPath,
+				"version":   product,
+				"last_used": project[1],
+			})
+		}
+	}
+
+	// JetBrains plugins
+	for _, path := range utils.GlobPaths(jetBrainsPluginPaths...) {
+		writeDev(path, fileModTime(path), map[string]interface{}{
+			"app":     "jetbrains",
+			"type":    "extension",
+			"name":    strings.TrimSuffix(filepath.Base(path), ".jar"),
+			"path":    path,
+			"version": filepath.Base(filepath.Dir(filepath.Dir(path))),
+		})
+	}
+
+	return nil
+}
+
+// vscodeRecentEntry returns the record data of a recently opened entry of VS Code: a folder, a file or a
+// multi-root workspace, opened locally or on a remote host
+func vscodeRecentEntry(editor string, entry map[string]interface{}) map[string]interface{} {
+	kind, location := "", ""
+	if folder, ok := entry["folderUri"].(string); ok {
+		kind, location = "folder", folder
+	} else if file, ok := entry["fileUri"].(string); ok {
+		kind, location = "file", file
+	} else if workspace, ok := entry["workspace"].(map[string]interface{}); ok {
+		kind, location = "workspace", fmt.Sprintf("%v", valueOrEmpty(workspace["configPath"]))
+	}
+	path := location
+	if parsed, err := url.Parse(location); err == nil && parsed.Scheme == "file" {
+		path = parsed.Path
+	}
+	return map[string]interface{}{
+		"app":    editor,
+		"type":   "recent_" + kind,
+		"name":   filepath.Base(path),
+		"path":   path,
+		"uri":    location,
+		"remote": valueOrEmpty(entry["remoteAuthority"]),
+	}
+}
+
+// readJetBrainsRecentProjects returns the path and last open time of the projects of a JetBrains
+// recentProjects.xml file. Paths keep the $USER_HOME$ macro.
+func readJetBrainsRecentProjects(path string) ([][2]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var projects [][2]string
+	decoder := xml.NewDecoder(file)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		attributes := make(map[string]string)
+		for _, attr := range element.Attr {
+			attributes[attr.Name.Local] = attr.Value
+		}
+		switch {
+		// <entry key="$USER_HOME$/project"> of the additionalInfo map
+		case element.Name.Local == "entry" && attributes["key"] != "":
+			projects = append(projects, [2]string{attributes["key"], ""})
+		// <option name="projectOpenTimestamp" value="<milliseconds>"/> of the project meta info
+		case element.Name.Local == "option" && attributes["name"] == "projectOpenTimestamp" && len(projects) > 0:
+			if millis, err := strconv.ParseInt(attributes["value"], 10, 64); err == nil && millis > 0 {
+				projects[len(projects)-1][1] = utils.ConvertUnixTimestamp(millis / 1000)
+			}
+		}
+	}
+	return projects, nil
+}
@@ -0,0 +1,185 @@
+// This module collects the domain membership context of the host:
+//   - Kerberos tickets of the credential caches (klist -A): cache, default principal, issue and expiration
+//     times and service principal of every ticket.
+//   - Active Directory binding (dsconfigad -show): one record per setting with its section.
+//   - Open Directory LDAP bindings: /Library/Preferences/OpenDirectory/Configurations/LDAPv3/*.plist.
+//   - Directory search policy: CSPSearchPath and SearchPolicy of the /Search and /Contact nodes (dscl).
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type DirectoryServicesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DirectoryServicesModule{
+		Name:        "directoryservices",
+		Description: "Collects Kerberos tickets, Active Directory/Open Directory bindings and the search policy"}
+	mod.RegisterModule(module)
+}
+
+func (m *DirectoryServicesModule) GetName() string {
+	return m.Name
+}
+
+func (m *DirectoryServicesModule) GetDescription() string {
+	return m.Description
+}
+
+// klist prints the tickets as "Oct 16 10:00:00 2026  Oct 16 20:00:00 2026  krbtgt/REALM@REALM"
+var klistTicketRegex = regexp.MustCompile(`^(\w{3}\s+\d+ \d\d:\d\d:\d\d \d{4})\s+(>>>Expired<<<|\w{3}\s+\d+ \d\d:\d\d:\d\d \d{4})\s+(\S+)`)
+
+func (m *DirectoryServicesModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeDirectory := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Kerberos tickets
+	output, err := exec.Command("klist", "-A").Output()
+	if err != nil {
+		params.Logger.Debug("Error running klist: %v", err)
+	} else {
+		cache, principal := "", ""
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "Credentials cache:"):
+				cache = strings.TrimSpace(strings.TrimPrefix(line, "Credentials cache:"))
+				principal = ""
+				continue
+			case strings.HasPrefix(line, "Principal:"):
+				principal = strings.TrimSpace(strings.TrimPrefix(line, "Principal:"))
+				continue
+			}
+
+			match := klistTicketRegex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			issued := klistTime(match[1])
+			expires := klistTime(match[2])
+			writeDirectory("klist", issued, map[string]interface{}{
+				"type":              "kerberos_ticket",
+				"cache":             cache,
+				"principal":         principal,
+				"service_principal": match[3],
+				"issued":            issued,
+				"expires":           expires,
+				"expired":           match[2] == ">>>Expired<<<",
+			})
+		}
+	}
+
+	// Active Directory binding
+	output, err = exec.Command("dsconfigad", "-show").Output()
+	if err != nil {
+		params.Logger.Debug("Error running dsconfigad: %v", err)
+	} else {
+		section := ""
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			setting, value, found := strings.Cut(line, "=")
+			if !found {
+				section = line
+				continue
+			}
+			writeDirectory("dsconfigad -show", "", map[string]interface{}{
+				"type":    "active_directory",
+				"section": section,
+				"setting": strings.TrimSpace(setting),
+				"value":   strings.TrimSpace(value),
+			})
+		}
+	}
+
+	// Open Directory LDAP bindings
+	for _, path := range utils.GlobPaths("/Library/Preferences/OpenDirectory/Configurations/LDAPv3/*.plist") {
+		var configuration map[string]interface{}
+		if err := utils.ParsePlistFile(path, &configuration); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		server := strings.TrimSuffix(filepath.Base(path), ".plist")
+		if options, ok := configuration["options"].(map[string]interface{}); ok {
+			if value, ok := options["server"].(string); ok {
+				server = value
+			}
+		}
+		writeDirectory(path, fileModTime(path), map[string]interface{}{
+			"type":        "open_directory",
+			"node":        configuration["node name"],
+			"server":      server,
+			"description": configuration["description"],
+			"trusttype":   configuration["trusttype"],
+		})
+	}
+
+	// Search policy
+	for _, node := range []string{"/Search", "/Contact"} {
+		for _, attribute := range []string{"SearchPolicy", "CSPSearchPath"} {
+			output, err := exec.Command("dscl", node, "-read", "/", attribute).Output()
+			if err != nil {
+				params.Logger.Debug("Error reading %s %s: %v", node, attribute, err)
+				continue
+			}
+			value := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(output)), attribute+":"))
+			var values []string
+			for _, line := range strings.Split(value, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					values = append(values, line)
+				}
+			}
+			writeDirectory("dscl", "", map[string]interface{}{
+				"type":      "search_policy",
+				"node":      node,
+				"attribute": attribute,
+				"value":     strings.Join(values, ", "),
+			})
+		}
+	}
+
+	return nil
+}
+
+// klistTime converts a klist time ("Oct 16 10:00:00 2026", local time) to TimeFormat
+func klistTime(value string) string {
+	t, err := time.ParseInLocation("Jan _2 15:04:05 2006", value, time.Local)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(utils.TimeFormat)
+}
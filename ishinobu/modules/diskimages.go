@@ -0,0 +1,326 @@
+// This module reports the disk images (DMG, ISO, sparse images) mounted on the host and where they were
+// downloaded from:
+//   - Mounted images: the DiskImages UUID cache (Library/Caches/com.apple.DiskImages.UUIDCache), the recent
+//     images of DiskImageMounter (com.apple.diskimagemounter shared file list) and the attach events of
+//     diskimagesiod, diskimages-helper, hdiutil and DiskImageMounter in the unified logs over the window.
+//   - Provenance: each image is joined with the QuarantineEventsV2 database of its user, by the event ID of
+//     the com.apple.quarantine attribute of the image when it still exists, or else by the file name of the
+//     downloaded URL. The kMDItemWhereFroms attribute of the image is reported as well.
+//
+// The window defaults to the last 30 days and can be changed in <InputDir>/diskimages.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type DiskImagesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DiskImagesModule{
+		Name:        "diskimages",
+		Description: "Reports the mounted disk images with their mount time and download URL from the quarantine events"}
+	mod.RegisterModule(module)
+}
+
+func (m *DiskImagesModule) GetName() string {
+	return m.Name
+}
+
+func (m *DiskImagesModule) GetDescription() string {
+	return m.Description
+}
+
+// diskImageMount is a disk image seen mounted
+type diskImageMount struct {
+	Path      string
+	Timestamp string
+	Source    string
+	Username  string
+	Message   string
+}
+
+// quarantineEvent is a row of the QuarantineEventsV2 database
+type quarantineEvent struct {
+	ID        string
+	Timestamp string
+	Agent     string
+	DataURL   string
+	OriginURL string
+	Username  string
+}
+
+const quarantineEventsQuery = `SELECT LSQuarantineEventIdentifier AS id, LSQuarantineTimeStamp AS time,
+LSQuarantineAgentName AS agent, LSQuarantineDataURLString AS data_url, LSQuarantineOriginURLString AS origin_url
+FROM LSQuarantineEvent`
+
+var (
+	diskImageCachePaths = []string{
+		"/Users/*/Library/Caches/com.apple.DiskImages.UUIDCache",
+		"/private/var/root/Library/Caches/com.apple.DiskImages.UUIDCache",
+	}
+	diskImageRecentPaths = []string{
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/com.apple.diskimagemounter.sfl*",
+	}
+	diskImagePathRegex = regexp.MustCompile(`(?i)(?:file://)?(/[^"'\n]+?\.(?:dmg|iso|sparseimage|sparsebundle|cdr|img))\b`)
+)
+
+func (m *DiskImagesModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	var mounts []diskImageMount
+
+	// DiskImages UUID cache
+	for _, path := range utils.GlobPaths(diskImageCachePaths...) {
+		var cache interface{}
+		if err := utils.ParsePlistFile(path, &cache); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		modified := fileModTime(path)
+		for _, imagePath := range diskImagePaths(cache) {
+			mounts = append(mounts, diskImageMount{Path: imagePath, Timestamp: modified, Source: "uuid_cache", Username: utils.GetUsernameFromPath(path)})
+		}
+	}
+
+	// Recent images of DiskImageMounter
+	for _, path := range utils.GlobPaths(diskImageRecentPaths...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+		archive, _ := root.(map[string]interface{})
+		items, _ := archive["items"].([]interface{})
+		for _, value := range items {
+			item, _ := value.(map[string]interface{})
+			bookmarkData, ok := item["Bookmark"].([]byte)
+			if !ok {
+				continue
+			}
+			if bookmark, err := utils.ParseBookmark(bookmarkData); err == nil && bookmark.Path != "" {
+				mounts = append(mounts, diskImageMount{Path: bookmark.Path, Timestamp: fileModTime(path), Source: "recent_items", Username: utils.GetUsernameFromPath(path)})
+			}
+		}
+	}
+
+	// Attach events of the unified logs
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `(process == "diskimagesiod" OR process == "diskimages-helper" OR process == "hdiutil" OR process == "DiskImageMounter") AND ` +
+			`(eventMessage CONTAINS[c] ".dmg" OR eventMessage CONTAINS[c] ".iso" OR eventMessage CONTAINS[c] ".sparse" OR eventMessage CONTAINS[c] "attach")`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error querying unified logs: %v", err)
+	}
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := recordData["message"].(string)
+		match := diskImagePathRegex.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		imagePath := match[1]
+		if unescaped, err := url.PathUnescape(imagePath); err == nil {
+			imagePath = unescaped
+		}
+		mounts = append(mounts, diskImageMount{Path: imagePath, Timestamp: timestamp, Source: "unifiedlogs", Username: utils.GetUsernameFromPath(imagePath), Message: message})
+	}
+
+	events := readQuarantineEvents(params)
+	for _, mount := range mounts {
+		recordData := map[string]interface{}{
+			"username":         mount.Username,
+			"path":             mount.Path,
+			"name":             filepath.Base(mount.Path),
+			"source":           mount.Source,
+			"mount_time":       mount.Timestamp,
+			"exists":           false,
+			"quarantine_event": "",
+			"quarantine_agent": "",
+			"download_time":    "",
+			"download_url":     "",
+			"origin_url":       "",
+			"where_froms":      "",
+			"matched_by":       "",
+			"message":          mount.Message,
+		}
+
+		eventID := ""
+		if _, err := os.Stat(mount.Path); err == nil {
+			recordData["exists"] = true
+			if value, err := utils.GetExtendedAttribute(mount.Path, quarantineAttribute); err == nil {
+				_, _, _, eventID = parseQuarantineAttribute(string(value))
+				recordData["quarantine_event"] = eventID
+			}
+			if value, err := utils.GetExtendedAttribute(mount.Path, whereFromsAttribute); err == nil {
+				var urls []string
+				if _, err := plist.Unmarshal(value, &urls); err == nil {
+					recordData["where_froms"] = strings.Join(urls, ", ")
+				}
+			}
+		}
+
+		if event, matchedBy, ok := matchQuarantineEvent(events, eventID, mount); ok {
+			recordData["quarantine_event"] = event.ID
+			recordData["quarantine_agent"] = event.Agent
+			recordData["download_time"] = event.Timestamp
+			recordData["download_url"] = event.DataURL
+			recordData["origin_url"] = event.OriginURL
+			recordData["matched_by"] = matchedBy
+		}
+
+		eventTimestamp := mount.Timestamp
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          mount.Source,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// diskImagePaths returns the paths of disk images found in the keys and values of a plist
+func diskImagePaths(value interface{}) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, child := range v {
+				walk(key)
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+			if match := diskImagePathRegex.FindStringSubmatch(v); match != nil {
+				path := match[1]
+				if unescaped, err := url.PathUnescape(path); err == nil {
+					path = unescaped
+				}
+				if !seen[path] {
+					seen[path] = true
+					paths = append(paths, path)
+				}
+			}
+		}
+	}
+	walk(value)
+	return paths
+}
+
+// readQuarantineEvents returns the rows of the QuarantineEventsV2 databases of every user
+func readQuarantineEvents(params mod.ModuleParams) []quarantineEvent {
+	var events []quarantineEvent
+	tmpDir, err := os.MkdirTemp("", "ishinobu-diskimages")
+	if err != nil {
+		params.Logger.Debug("Failed to create temporary directory: %v", err)
+		return events
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.LaunchServices.QuarantineEventsV2") {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+		rows, err := utils.QuerySQLiteMaps(dst, quarantineEventsQuery)
+		if err != nil {
+			params.Logger.Debug("Error querying %s: %v", dbPath, err)
+			continue
+		}
+		for _, row := range rows {
+			timestamp := ""
+			if seconds, ok := row["time"].(float64); ok {
+				timestamp = utils.ConvertCFAbsoluteTime(seconds)
+			}
+			events = append(events, quarantineEvent{
+				ID:        fmt.Sprintf("%v", valueOrEmpty(row["id"])),
+				Timestamp: timestamp,
+				Agent:     fmt.Sprintf("%v", valueOrEmpty(row["agent"])),
+				DataURL:   fmt.Sprintf("%v", valueOrEmpty(row["data_url"])),
+				OriginURL: fmt.Sprintf("%v", valueOrEmpty(row["origin_url"])),
+				Username:  utils.GetUsernameFromPath(dbPath),
+			})
+		}
+	}
+	return events
+}
+
+// matchQuarantineEvent returns the quarantine event of a disk image, by event ID or else by the file name of
+// the downloaded URL for the same user, and how it was matched
+func matchQuarantineEvent(events []quarantineEvent, eventID string, mount diskImageMount) (quarantineEvent, string, bool) {
+	if eventID != "" {
+		for _, event := range events {
+			if strings.EqualFold(event.ID, eventID) {
+				return event, "event_id", true
+			}
+		}
+	}
+	name := filepath.Base(mount.Path)
+	var found quarantineEvent
+	ok := false
+	for _, event := range events {
+		if mount.Username != "" && event.Username != mount.Username {
+			continue
+		}
+		parsed, err := url.Parse(event.DataURL)
+		if err != nil || path.Base(parsed.Path) != name {
+			continue
+		}
+		// keep the latest download of that name
+		if !ok || event.Timestamp > found.Timestamp {
+			found, ok = event, true
+		}
+	}
+	return found, "file_name", ok
+}
@@ -0,0 +1,194 @@
+// This module collects the recently resolved domains and the resolver configuration:
+//   - Cache: mDNSResponder dumps its cache to the unified logs when it receives SIGINFO (killall -INFO mDNSResponder).
+//     The cache records logged right after the signal are emitted with the name, type, data, remaining TTL and interface.
+//     Names are redacted (<private>) unless private data is enabled in the unified logs.
+//   - Resolvers: the resolvers of each network (scutil --dns) with their domain, search domains, name servers,
+//     interface, flags and reachability, for both the default and the scoped queries.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type DNSCacheModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DNSCacheModule{
+		Name:        "dnscache",
+		Description: "Collects the mDNSResponder DNS cache and the per-network resolver configuration"}
+	mod.RegisterModule(module)
+}
+
+func (m *DNSCacheModule) GetName() string {
+	return m.Name
+}
+
+func (m *DNSCacheModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	dnsResolverRegex = regexp.MustCompile(`^resolver #(\d+)`)
+	dnsSettingRegex  = regexp.MustCompile(`^\s+([a-z_ ]+?)(?:\[\d+\])?\s*:\s*(.*)$`)
+)
+
+func (m *DNSCacheModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeDNS := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Cache records
+	entries, err := dumpMDNSResponderCache()
+	if err != nil {
+		params.Logger.Debug("Error dumping the mDNSResponder cache: %v", err)
+	}
+	for _, entry := range entries {
+		_, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := entry["eventMessage"].(string)
+		for _, line := range strings.Split(message, "\n") {
+			recordData := parseDNSCacheLine(line)
+			if recordData == nil {
+				continue
+			}
+			recordData["type"] = "cache"
+			writeDNS("unifiedlogs", timestamp, recordData)
+		}
+	}
+
+	// Resolver configuration
+	output, err := exec.Command("scutil", "--dns").Output()
+	if err != nil {
+		params.Logger.Debug("Error running scutil --dns: %v", err)
+		return nil
+	}
+	for _, resolver := range parseScutilDNS(string(output)) {
+		resolver["type"] = "resolver"
+		writeDNS("scutil --dns", "", resolver)
+	}
+
+	return nil
+}
+
+// dumpMDNSResponderCache signals mDNSResponder to log its cache and returns the log entries of the dump
+func dumpMDNSResponderCache() ([]map[string]interface{}, error) {
+	start := time.Now().UTC().Add(-time.Second)
+	if err := exec.Command("killall", "-INFO", "mDNSResponder").Run(); err != nil {
+		return nil, fmt.Errorf("error signaling mDNSResponder: %v", err)
+	}
+	// Leave mDNSResponder time to write the dump
+	time.Sleep(3 * time.Second)
+
+	query := LogCommand{
+		Predicate: `process == "mDNSResponder"`,
+		Info:      true,
+	}
+	return query.Show(start.Format(logShowTimeFormat), time.Now().UTC().Format(logShowTimeFormat), "")
+}
+
+// parseDNSCacheLine parses a cache record of the dump ("slot [Q] TTL interface [flags] type rdlen name type rdata").
+// Returns nil for the lines that are not cache records.
+func parseDNSCacheLine(line string) map[string]interface{} {
+	fields := strings.Fields(line)
+	if len(fields) < 6 || !isDigits(fields[0]) {
+		return nil
+	}
+
+	i := 1
+	if fields[i] == "Q" {
+		i++
+	}
+	ttl := fields[i]
+	if strings.Trim(ttl, "-0123456789") != "" {
+		return nil
+	}
+	iface := fields[i+1]
+
+	// The record name follows the record data length
+	for j := i + 3; j < len(fields); j++ {
+		if !isDigits(fields[j-1]) || !(strings.HasSuffix(fields[j], ".") || fields[j] == "<private>") {
+			continue
+		}
+		recordData := map[string]interface{}{
+			"name":        fields[j],
+			"record_type": fields[j-2],
+			"ttl":         ttl,
+			"interface":   iface,
+			"data":        "",
+		}
+		if j+1 < len(fields) {
+			// the data is prefixed with its type
+			rdata := fields[j+1:]
+			if len(rdata) > 1 && (strings.EqualFold(rdata[0], fields[j-2]) || rdata[0] == "Addr") {
+				rdata = rdata[1:]
+			}
+			recordData["data"] = strings.Join(rdata, " ")
+		}
+		return recordData
+	}
+	return nil
+}
+
+// parseScutilDNS parses the resolvers of `scutil --dns`. Settings with several values (nameserver[0], nameserver[1], ...)
+// are joined with commas.
+func parseScutilDNS(output string) []map[string]interface{} {
+	var resolvers []map[string]interface{}
+	var resolver map[string]interface{}
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "DNS configuration") {
+			section = "default"
+			if strings.Contains(line, "scoped") {
+				section = "scoped"
+			}
+			continue
+		}
+		if match := dnsResolverRegex.FindStringSubmatch(line); match != nil {
+			resolver = map[string]interface{}{
+				"section":  section,
+				"resolver": match[1],
+			}
+			resolvers = append(resolvers, resolver)
+			continue
+		}
+		match := dnsSettingRegex.FindStringSubmatch(line)
+		if match == nil || resolver == nil {
+			continue
+		}
+		key := strings.ReplaceAll(strings.TrimSpace(match[1]), " ", "_")
+		value := strings.TrimSpace(match[2])
+		if previous, ok := resolver[key].(string); ok && previous != "" {
+			value = previous + ", " + value
+		}
+		resolver[key] = value
+	}
+	return resolvers
+}
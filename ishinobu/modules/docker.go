@@ -0,0 +1,293 @@
+// This module collects Docker Desktop and container runtime artifacts:
+//   - Docker Desktop settings: /Users/*/Library/Group Containers/group.com.docker/settings.json (settings-store.json
+//     in recent versions), including the host folders shared with the containers.
+//   - Docker CLI configuration: /Users/*/.docker/config.json (registries, credential store, current context;
+//     credentials are never collected).
+//   - Containers and images (docker ps -a, docker images, docker inspect) when a daemon is reachable, through the
+//     default socket and the Docker Desktop socket of each user. Bind mounts of sensitive host paths are flagged.
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type DockerModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DockerModule{
+		Name:        "docker",
+		Description: "Collects Docker Desktop settings, shared paths, containers, images and sensitive bind mounts"}
+	mod.RegisterModule(module)
+}
+
+func (m *DockerModule) GetName() string {
+	return m.Name
+}
+
+func (m *DockerModule) GetDescription() string {
+	return m.Description
+}
+
+// Host paths that give a container control over the host when mounted
+var sensitiveMountPaths = []string{
+	"/etc",
+	"/private",
+	"/var/run/docker.sock",
+	"/Library",
+	"/System",
+	"/usr",
+	"/Users",
+	"/root",
+}
+
+// dockerMount is a mount of docker inspect
+type dockerMount struct {
+	Type        string `json:"Type"`
+	Source      string `json:"Source"`
+	Destination string `json:"Destination"`
+	RW          bool   `json:"RW"`
+}
+
+func (m *DockerModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeDocker := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Docker Desktop settings
+	for _, path := range utils.GlobPaths("/Users/*/Library/Group Containers/group.com.docker/settings.json",
+		"/Users/*/Library/Group Containers/group.com.docker/settings-store.json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		var settings map[string]interface{}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		username := utils.GetUsernameFromPath(path)
+		mtime := fileModTime(path)
+
+		for key, value := range settings {
+			// Shared folders are emitted one by one
+			if strings.EqualFold(key, "filesharingDirectories") {
+				folders, _ := value.([]interface{})
+				for _, folder := range folders {
+					writeDocker(path, mtime, map[string]interface{}{
+						"type":      "file_sharing",
+						"username":  username,
+						"path":      folder,
+						"sensitive": isSensitiveMountPath(fmt.Sprintf("%v", folder)),
+					})
+				}
+				continue
+			}
+			encoded, _ := json.Marshal(value)
+			writeDocker(path, mtime, map[string]interface{}{
+				"type":     "setting",
+				"username": username,
+				"setting":  key,
+				"value":    string(encoded),
+			})
+		}
+	}
+
+	// Docker CLI configuration
+	for _, path := range utils.GlobPaths("/Users/*/.docker/config.json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var config struct {
+			Auths          map[string]json.RawMessage `json:"auths"`
+			CredsStore     string                     `json:"credsStore"`
+			CurrentContext string                     `json:"currentContext"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		var registries []string
+		for registry := range config.Auths {
+			registries = append(registries, registry)
+		}
+		writeDocker(path, fileModTime(path), map[string]interface{}{
+			"type":            "cli_config",
+			"username":        utils.GetUsernameFromPath(path),
+			"registries":      strings.Join(registries, ", "),
+			"creds_store":     config.CredsStore,
+			"current_context": config.CurrentContext,
+		})
+	}
+
+	// Daemons reachable through the default socket and the Docker Desktop sockets
+	hosts := []string{""}
+	for _, socket := range utils.GlobPaths("/Users/*/.docker/run/docker.sock") {
+		hosts = append(hosts, "unix://"+socket)
+	}
+	seenContainers := make(map[string]bool)
+	for _, host := range hosts {
+		containers, err := dockerCommand(host, "ps", "-a", "--no-trunc", "--format", "{{json .}}")
+		if err != nil {
+			params.Logger.Debug("Docker daemon not reachable at %q: %v", host, err)
+			continue
+		}
+		var ids []string
+		for _, container := range containers {
+			id, _ := container["ID"].(string)
+			if id == "" || seenContainers[id] {
+				continue
+			}
+			seenContainers[id] = true
+			ids = append(ids, id)
+
+			writeDocker("docker ps", "", map[string]interface{}{
+				"type":        "container",
+				"docker_host": host,
+				"id":          id,
+				"name":        container["Names"],
+				"image":       container["Image"],
+				"command":     container["Command"],
+				"created":     container["CreatedAt"],
+				"status":      container["Status"],
+				"ports":       container["Ports"],
+			})
+		}
+
+		images, err := dockerCommand(host, "images", "--no-trunc", "--format", "{{json .}}")
+		if err != nil {
+			params.Logger.Debug("Error listing docker images: %v", err)
+		}
+		for _, image := range images {
+			writeDocker("docker images", "", map[string]interface{}{
+				"type":        "image",
+				"docker_host": host,
+				"id":          image["ID"],
+				"repository":  image["Repository"],
+				"tag":         image["Tag"],
+				"created":     image["CreatedAt"],
+				"size":        image["Size"],
+			})
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+		cmd := exec.Command("docker", append([]string{"inspect", "--format", "{{.Name}}\t{{json .Mounts}}"}, ids...)...)
+		if host != "" {
+			cmd.Env = append(os.Environ(), "DOCKER_HOST="+host)
+		}
+		output, err := cmd.Output()
+		if err != nil {
+			params.Logger.Debug("Error inspecting docker containers: %v", err)
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for scanner.Scan() {
+			name, mountsJSON, found := strings.Cut(scanner.Text(), "\t")
+			if !found {
+				continue
+			}
+			var mounts []dockerMount
+			if err := json.Unmarshal([]byte(mountsJSON), &mounts); err != nil {
+				continue
+			}
+			for _, mount := range mounts {
+				writeDocker("docker inspect", "", map[string]interface{}{
+					"type":        "mount",
+					"docker_host": host,
+					"container":   strings.TrimPrefix(name, "/"),
+					"mount_type":  mount.Type,
+					"source":      mount.Source,
+					"destination": mount.Destination,
+					"read_write":  mount.RW,
+					"sensitive":   mount.Type == "bind" && isSensitiveMountPath(mount.Source),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// dockerCommand runs a docker command printing one JSON object per line against a daemon
+func dockerCommand(host string, args ...string) ([]map[string]interface{}, error) {
+	cmd := exec.Command("docker", args...)
+	if host != "" {
+		cmd.Env = append(os.Environ(), "DOCKER_HOST="+host)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		var item map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// isSensitiveMountPath reports whether a host path is the root, a system folder, a home folder or a credential folder
+func isSensitiveMountPath(path string) bool {
+	path = filepath.Clean(path)
+	if path == "/" {
+		return true
+	}
+	for _, sensitive := range sensitiveMountPaths {
+		if path == sensitive || (sensitive != "/Users" && strings.HasPrefix(path, sensitive+"/")) {
+			return true
+		}
+	}
+	// Home folders and the credentials stored in them
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if parts[0] == "Users" {
+		if len(parts) == 2 {
+			return true
+		}
+		if len(parts) >= 3 {
+			switch parts[2] {
+			case ".ssh", ".aws", ".kube", ".gnupg", ".docker", ".config", "Library":
+				return true
+			}
+		}
+	}
+	return false
+}
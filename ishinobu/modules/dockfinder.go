@@ -0,0 +1,258 @@
+// This module collects the Dock and Finder preferences of each user:
+//   - /Users/*/Library/Preferences/com.apple.dock.plist: persistent-apps, persistent-others and recent-apps tiles.
+//     Tiles pointing to unusual locations (temporary folders, shared or hidden folders, mounted volumes,
+//     applications outside the standard folders, non-file URLs) are flagged.
+//   - /Users/*/Library/Preferences/com.apple.finder.plist: desktop items visibility, hidden files,
+//     last "Connect to Server" URL, "Go to Folder" history and recent folders.
+//   - /Users/*/Library/Preferences/com.apple.sidebarlists.plist: connected server favorites (older macOS versions).
+package modules
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type DockFinderModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DockFinderModule{
+		Name:        "dockfinder",
+		Description: "Collects Dock items and Finder preferences, flagging Dock items pointing to unusual paths"}
+	mod.RegisterModule(module)
+}
+
+func (m *DockFinderModule) GetName() string {
+	return m.Name
+}
+
+func (m *DockFinderModule) GetDescription() string {
+	return m.Description
+}
+
+// Finder settings controlling what is shown on the desktop and in Finder windows
+var finderSettings = []string{
+	"ShowHardDrivesOnDesktop",
+	"ShowExternalHardDrivesOnDesktop",
+	"ShowRemovableMediaOnDesktop",
+	"ShowMountedServersOnDesktop",
+	"CreateDesktop",
+	"AppleShowAllFiles",
+	"AppleShowAllExtensions",
+	"FXEnableExtensionChangeWarning",
+	"FXConnectToLastURL",
+	"NewWindowTargetPath",
+}
+
+// Application folders where Dock application tiles are expected to point
+var dockApplicationFolders = []string{
+	"/Applications/",
+	"/System/Applications/",
+	"/System/Library/CoreServices/",
+	"/System/Cryptexes/App/System/Applications/",
+}
+
+func (m *DockFinderModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writePreference := func(sourceFile string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+
+		eventTimestamp := fileModTime(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Dock tiles
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.dock.plist") {
+		var dock map[string]interface{}
+		if err := utils.ParsePlistFile(path, &dock); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		home := filepath.Dir(filepath.Dir(filepath.Dir(path)))
+
+		for _, section := range []string{"persistent-apps", "persistent-others", "recent-apps"} {
+			tiles, _ := dock[section].([]interface{})
+			for index, value := range tiles {
+				tile, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				recordData := dockTileData(tile, home)
+				recordData["type"] = "dock_item"
+				recordData["section"] = section
+				recordData["order"] = index + 1
+				writePreference(path, recordData)
+			}
+		}
+	}
+
+	// Finder settings, Go to Folder history and recent folders
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.finder.plist") {
+		var finder map[string]interface{}
+		if err := utils.ParsePlistFile(path, &finder); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+
+		for _, setting := range finderSettings {
+			value, ok := finder[setting]
+			if !ok {
+				continue
+			}
+			writePreference(path, map[string]interface{}{
+				"type":    "finder_setting",
+				"setting": setting,
+				"value":   value,
+			})
+		}
+
+		gotoHistory, _ := finder["GoToFieldHistory"].([]interface{})
+		for index, value := range gotoHistory {
+			writePreference(path, map[string]interface{}{
+				"type":  "finder_goto_history",
+				"order": index + 1,
+				"path":  value,
+			})
+		}
+
+		recentFolders, _ := finder["FXRecentFolders"].([]interface{})
+		for index, value := range recentFolders {
+			folder, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			recordData := map[string]interface{}{
+				"type":  "finder_recent_folder",
+				"order": index + 1,
+				"name":  folder["name"],
+			}
+			if bookmarkData, ok := folder["file-bookmark"].([]byte); ok {
+				if bookmark, err := utils.ParseBookmark(bookmarkData); err == nil {
+					recordData["path"] = bookmark.Path
+					recordData["volume_name"] = bookmark.VolumeName
+				}
+			}
+			writePreference(path, recordData)
+		}
+	}
+
+	// Connected server favorites stored by older macOS versions
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.sidebarlists.plist") {
+		var sidebar map[string]interface{}
+		if err := utils.ParsePlistFile(path, &sidebar); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		servers, _ := sidebar["favoriteservers"].(map[string]interface{})
+		items, _ := servers["CustomListItems"].([]interface{})
+		for index, value := range items {
+			server, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			writePreference(path, map[string]interface{}{
+				"type":  "finder_favorite_server",
+				"order": index + 1,
+				"name":  server["Name"],
+				"url":   server["URL"],
+			})
+		}
+	}
+
+	return nil
+}
+
+// dockTileData extracts the label, target and bundle identifier of a Dock tile
+func dockTileData(tile map[string]interface{}, home string) map[string]interface{} {
+	recordData := make(map[string]interface{})
+	tileType, _ := tile["tile-type"].(string)
+	recordData["tile_type"] = tileType
+
+	tileData, _ := tile["tile-data"].(map[string]interface{})
+	target := ""
+	if fileData, ok := tileData["file-data"].(map[string]interface{}); ok {
+		target, _ = fileData["_CFURLString"].(string)
+	}
+	if urlData, ok := tileData["url"].(map[string]interface{}); ok {
+		target, _ = urlData["_CFURLString"].(string)
+	}
+
+	label := tileData["file-label"]
+	if label == nil {
+		label = tileData["label"]
+	}
+	recordData["label"] = label
+	recordData["bundle_id"] = tileData["bundle-identifier"]
+	recordData["url"] = target
+
+	path := ""
+	if parsed, err := url.Parse(target); err == nil && parsed.Scheme == "file" {
+		path = parsed.Path
+	} else if strings.HasPrefix(target, "/") {
+		path = target
+	}
+	recordData["path"] = path
+
+	recordData["unusual_path"] = isUnusualDockTarget(tileType, target, path, home)
+
+	return recordData
+}
+
+// isUnusualDockTarget reports whether a Dock tile points outside the locations where Dock items normally live
+func isUnusualDockTarget(tileType string, target string, path string, home string) bool {
+	if path == "" {
+		// URL tiles pointing to the web are expected, other schemes are not
+		return target != "" && !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://")
+	}
+
+	for _, prefix := range []string{"/tmp/", "/private/tmp/", "/var/folders/", "/private/var/", "/Users/Shared/", "/Volumes/", "/Library/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, component := range strings.Split(path, "/") {
+		if strings.HasPrefix(component, ".") {
+			return true
+		}
+	}
+
+	if tileType == "file-tile" && strings.HasSuffix(strings.TrimSuffix(path, "/"), ".app") {
+		if strings.HasPrefix(path, home+"/Applications/") {
+			return false
+		}
+		for _, folder := range dockApplicationFolders {
+			if strings.HasPrefix(path, folder) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,339 @@
+// This module correlates the download provenance recorded by the browsers and the system into a single timeline,
+// with one record per downloaded file and all the sources that know about it:
+//   - quarantine: the QuarantineEventsV2 database of each user (URL, origin, agent and time of the download).
+//   - chrome: the downloads of Chrome, Edge and Brave profiles (target path, URL chain, referrer, start and end
+//     times, danger type).
+//   - safari: the download history of Safari (Library/Safari/Downloads.plist).
+//   - spotlight: the files under /Users with kMDItemWhereFroms (mdfind) and their kMDItemDownloadedDate.
+//   - xattr: the com.apple.quarantine, kMDItemWhereFroms and com.apple.provenance attributes of the files that
+//     still exist, with the source of the provenance ID from the ExecPolicy database.
+//
+// Files are joined on their path, and quarantine events are linked by the event ID of the com.apple.quarantine
+// attribute or else by the download URL. Quarantine events that cannot be linked to a file are reported with
+// an empty path.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type DownloadsTimelineModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DownloadsTimelineModule{
+		Name:        "downloads_timeline",
+		Description: "Correlates quarantine events, browser downloads, Spotlight WhereFroms and extended attributes into one record per downloaded file"}
+	mod.RegisterModule(module)
+}
+
+func (m *DownloadsTimelineModule) GetName() string {
+	return m.Name
+}
+
+func (m *DownloadsTimelineModule) GetDescription() string {
+	return m.Description
+}
+
+// downloadEntry is a downloaded file with the provenance of every source
+type downloadEntry struct {
+	Path             string
+	Username         string
+	URL              string
+	ReferrerURL      string
+	Browser          string
+	Started          string
+	Finished         string
+	DangerType       string
+	WhereFroms       []string
+	QuarantineEvent  string
+	QuarantineAgent  string
+	QuarantineTime   string
+	ProvenanceSource string
+	Sources          []string
+}
+
+// addSource records a source of the entry once
+func (entry *downloadEntry) addSource(source string) {
+	for _, existing := range entry.Sources {
+		if existing == source {
+			return
+		}
+	}
+	entry.Sources = append(entry.Sources, source)
+}
+
+var (
+	chromiumHistoryPaths = map[string]string{
+		"/Users/*/Library/Application Support/Google/Chrome/*/History":               "chrome",
+		"/Users/*/Library/Application Support/Microsoft Edge/*/History":              "edge",
+		"/Users/*/Library/Application Support/BraveSoftware/Brave-Browser/*/History": "brave",
+	}
+	chromiumDownloadsQuery = `SELECT d.target_path AS target_path, CAST(d.start_time AS TEXT) AS start_time,
+CAST(d.end_time AS TEXT) AS end_time, d.referrer AS referrer, d.tab_url AS tab_url, d.danger_type AS danger_type,
+(SELECT c.url FROM downloads_url_chains c WHERE c.id = d.id ORDER BY c.chain_index DESC LIMIT 1) AS url
+FROM downloads d`
+)
+
+func (m *DownloadsTimelineModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-downloads")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var order []string
+	entries := make(map[string]*downloadEntry)
+	entryOf := func(path string) *downloadEntry {
+		entry, ok := entries[path]
+		if !ok {
+			entry = &downloadEntry{Path: path, Username: utils.GetUsernameFromPath(path)}
+			entries[path] = entry
+			order = append(order, path)
+		}
+		return entry
+	}
+
+	// Chromium browsers
+	patterns := make([]string, 0, len(chromiumHistoryPaths))
+	for pattern := range chromiumHistoryPaths {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		browser := chromiumHistoryPaths[pattern]
+		for i, dbPath := range utils.GlobPaths(pattern) {
+			dstDir := filepath.Join(tmpDir, fmt.Sprintf("%s-%d", browser, i))
+			if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+				params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+				continue
+			}
+			dst, err := utils.CopyDatabase(dbPath, dstDir)
+			if err != nil {
+				params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+				continue
+			}
+			rows, err := utils.QuerySQLiteMaps(dst, chromiumDownloadsQuery)
+			if err != nil {
+				params.Logger.Debug("Error querying downloads of %s: %v", dbPath, err)
+				continue
+			}
+			for _, row := range rows {
+				path := fmt.Sprintf("%v", valueOrEmpty(row["target_path"]))
+				if path == "" {
+					continue
+				}
+				entry := entryOf(path)
+				entry.addSource(browser)
+				entry.Browser = browser
+				entry.URL = fmt.Sprintf("%v", valueOrEmpty(row["url"]))
+				entry.ReferrerURL = fmt.Sprintf("%v", valueOrEmpty(row["referrer"]))
+				if entry.ReferrerURL == "" {
+					entry.ReferrerURL = fmt.Sprintf("%v", valueOrEmpty(row["tab_url"]))
+				}
+				entry.Started = utils.ParseChromeTimestamp(fmt.Sprintf("%v", row["start_time"]))
+				entry.Finished = utils.ParseChromeTimestamp(fmt.Sprintf("%v", row["end_time"]))
+				entry.DangerType = fmt.Sprintf("%v", valueOrEmpty(row["danger_type"]))
+			}
+		}
+	}
+
+	// Safari
+	for _, path := range utils.GlobPaths("/Users/*/Library/Safari/Downloads.plist") {
+		var downloads map[string]interface{}
+		if err := utils.ParsePlistFile(path, &downloads); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		history, _ := downloads["DownloadHistory"].([]interface{})
+		for _, value := range history {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			target, _ := item["DownloadEntryPath"].(string)
+			if target == "" {
+				continue
+			}
+			if strings.HasPrefix(target, "~/") {
+				target = filepath.Join("/Users", utils.GetUsernameFromPath(path), target[2:])
+			}
+			entry := entryOf(target)
+			entry.addSource("safari")
+			entry.Browser = "safari"
+			entry.URL = fmt.Sprintf("%v", valueOrEmpty(item["DownloadEntryURL"]))
+			entry.Started = utils.FormatPlistDate(item["DownloadEntryDateAddedKey"])
+			entry.Finished = utils.FormatPlistDate(item["DownloadEntryDateFinishedKey"])
+		}
+	}
+
+	// Spotlight
+	output, err := exec.Command("mdfind", "-0", "-onlyin", "/Users", `kMDItemWhereFroms == "*"`).Output()
+	if err != nil {
+		params.Logger.Debug("Error running mdfind: %v", err)
+	}
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path == "" {
+			continue
+		}
+		attributes, err := spotlightMetadata(path)
+		if err != nil {
+			params.Logger.Debug("Error reading Spotlight metadata of %s: %v", path, err)
+			continue
+		}
+		entry := entryOf(path)
+		entry.addSource("spotlight")
+		if whereFroms, ok := attributes["kMDItemWhereFroms"].([]interface{}); ok {
+			entry.WhereFroms = nil
+			for _, whereFrom := range whereFroms {
+				entry.WhereFroms = append(entry.WhereFroms, fmt.Sprintf("%v", whereFrom))
+			}
+		}
+		if entry.Finished == "" {
+			entry.Finished = utils.FormatPlistDate(spotlightFirstValue(attributes["kMDItemDownloadedDate"]))
+		}
+	}
+
+	// Extended attributes of the files that still exist
+	provenanceSources := readProvenanceTracking(params)
+	for _, path := range order {
+		entry := entries[path]
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if value, err := utils.GetExtendedAttribute(path, quarantineAttribute); err == nil {
+			_, timestamp, agent, eventID := parseQuarantineAttribute(string(value))
+			entry.addSource("xattr")
+			entry.QuarantineEvent = eventID
+			entry.QuarantineAgent = agent
+			entry.QuarantineTime = timestamp
+		}
+		if value, err := utils.GetExtendedAttribute(path, whereFromsAttribute); err == nil {
+			var whereFroms []string
+			if _, err := plist.Unmarshal(value, &whereFroms); err == nil && len(whereFroms) > 0 {
+				entry.addSource("xattr")
+				entry.WhereFroms = whereFroms
+			}
+		}
+		if value, err := utils.GetExtendedAttribute(path, provenanceAttribute); err == nil {
+			if id, ok := parseProvenanceAttribute(value); ok {
+				entry.addSource("xattr")
+				entry.ProvenanceSource = fmt.Sprintf("%d", id)
+				if source := provenanceSources[id]; source != "" {
+					entry.ProvenanceSource = fmt.Sprintf("%d %s", id, source)
+				}
+			}
+		}
+	}
+
+	// Quarantine events, by event ID and else by URL
+	linked := make(map[int]bool)
+	events := readQuarantineEvents(params)
+	for _, path := range order {
+		entry := entries[path]
+		urls := append([]string{entry.URL}, entry.WhereFroms...)
+		for i, event := range events {
+			matched := entry.QuarantineEvent != "" && strings.EqualFold(event.ID, entry.QuarantineEvent)
+			if !matched && entry.QuarantineEvent == "" && event.DataURL != "" {
+				for _, url := range urls {
+					if url == event.DataURL {
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				continue
+			}
+			linked[i] = true
+			entry.addSource("quarantine")
+			entry.QuarantineEvent = event.ID
+			entry.QuarantineAgent = event.Agent
+			entry.QuarantineTime = event.Timestamp
+			if entry.URL == "" {
+				entry.URL = event.DataURL
+			}
+			if entry.ReferrerURL == "" {
+				entry.ReferrerURL = event.OriginURL
+			}
+			break
+		}
+	}
+	for i, event := range events {
+		if linked[i] {
+			continue
+		}
+		entry := entryOf(fmt.Sprintf("quarantine:%d", i))
+		entry.Path = ""
+		entry.Username = event.Username
+		entry.addSource("quarantine")
+		entry.URL = event.DataURL
+		entry.ReferrerURL = event.OriginURL
+		entry.QuarantineEvent = event.ID
+		entry.QuarantineAgent = event.Agent
+		entry.QuarantineTime = event.Timestamp
+	}
+
+	for _, key := range order {
+		entry := entries[key]
+		exists := false
+		if entry.Path != "" {
+			_, err := os.Stat(entry.Path)
+			exists = err == nil
+		}
+		eventTimestamp := entry.Started
+		for _, timestamp := range []string{entry.QuarantineTime, entry.Finished} {
+			if eventTimestamp == "" {
+				eventTimestamp = timestamp
+			}
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data: map[string]interface{}{
+				"username":          entry.Username,
+				"path":              entry.Path,
+				"file_exists":       exists,
+				"url":               entry.URL,
+				"referrer_url":      entry.ReferrerURL,
+				"browser":           entry.Browser,
+				"download_start":    entry.Started,
+				"download_end":      entry.Finished,
+				"danger_type":       entry.DangerType,
+				"where_froms":       strings.Join(entry.WhereFroms, ", "),
+				"quarantine_event":  entry.QuarantineEvent,
+				"quarantine_agent":  entry.QuarantineAgent,
+				"quarantine_time":   entry.QuarantineTime,
+				"provenance_source": entry.ProvenanceSource,
+				"sources":           strings.Join(entry.Sources, ", "),
+			},
+			SourceFile: strings.Join(entry.Sources, ", "),
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+// This module hunts for dylib hijacking and insertion:
+//   - DYLD_* variables (DYLD_INSERT_LIBRARIES, DYLD_LIBRARY_PATH, ...) set in the EnvironmentVariables of the
+//     LaunchAgents and LaunchDaemons and in the LSEnvironment of the applications.
+//   - Weak dylibs (LC_LOAD_WEAK_DYLIB) and @rpath dylibs of the application and launchd binaries that resolve to
+//     a missing file or to a user-writable location, where a malicious library would be loaded.
+//   - Dylibs inside application bundles (Contents/Frameworks, Contents/MacOS) signed with a team ID different
+//     from the team ID of the bundle.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type DylibHijackModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &DylibHijackModule{
+		Name:        "dylibhijack",
+		Description: "Finds DYLD environment injection, hijackable weak/rpath dylibs and foreign dylibs in app bundles"}
+	mod.RegisterModule(module)
+}
+
+func (m *DylibHijackModule) GetName() string {
+	return m.Name
+}
+
+func (m *DylibHijackModule) GetDescription() string {
+	return m.Description
+}
+
+// Locations where a non-admin user or any process can drop a library
+var userWritablePrefixes = []string{
+	"/Users/",
+	"/tmp/",
+	"/private/tmp/",
+	"/var/tmp/",
+	"/private/var/tmp/",
+	"/var/folders/",
+	"/private/var/folders/",
+}
+
+func (m *DylibHijackModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeFinding := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Binaries to inspect, with the plist that references them
+	binaries := make(map[string]string)
+
+	// DYLD variables of the launch agents and daemons
+	for _, path := range utils.GlobPaths(launchdPlistPaths...) {
+		if strings.HasPrefix(path, "/System/") {
+			continue
+		}
+		var content map[string]interface{}
+		if err := utils.ParsePlistFile(path, &content); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for name, value := range dyldVariables(content["EnvironmentVariables"]) {
+			writeFinding(path, map[string]interface{}{
+				"type":     "dyld_environment",
+				"label":    content["Label"],
+				"variable": name,
+				"value":    value,
+			})
+		}
+
+		program, _ := content["Program"].(string)
+		if program == "" {
+			if args, ok := content["ProgramArguments"].([]interface{}); ok && len(args) > 0 {
+				program = fmt.Sprintf("%v", args[0])
+			}
+		}
+		if program != "" {
+			binaries[program] = path
+		}
+	}
+
+	// Applications: LSEnvironment, main executable and bundled dylibs
+	for _, bundle := range utils.GlobPaths("/Applications/*.app", "/Applications/*/*.app", "/Users/*/Applications/*.app") {
+		infoPath := filepath.Join(bundle, "Contents", "Info.plist")
+		var bundleInfo map[string]interface{}
+		if err := utils.ParsePlistFile(infoPath, &bundleInfo); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", infoPath, err)
+			continue
+		}
+		for name, value := range dyldVariables(bundleInfo["LSEnvironment"]) {
+			writeFinding(infoPath, map[string]interface{}{
+				"type":     "dyld_environment",
+				"label":    bundleInfo["CFBundleIdentifier"],
+				"variable": name,
+				"value":    value,
+			})
+		}
+
+		if executable, ok := bundleInfo["CFBundleExecutable"].(string); ok && executable != "" {
+			binaries[filepath.Join(bundle, "Contents", "MacOS", executable)] = infoPath
+		}
+
+		// Dylibs signed by a different team than the bundle
+		dylibs := utils.GlobPaths(filepath.Join(bundle, "Contents", "Frameworks", "*.dylib"),
+			filepath.Join(bundle, "Contents", "MacOS", "*.dylib"))
+		if len(dylibs) == 0 {
+			continue
+		}
+		bundleSignature := utils.GetCodeSignature(bundle)
+		for _, dylib := range dylibs {
+			signature := utils.GetCodeSignature(dylib)
+			if signature.TeamID == bundleSignature.TeamID {
+				continue
+			}
+			writeFinding(dylib, map[string]interface{}{
+				"type":             "team_id_mismatch",
+				"bundle":           bundle,
+				"dylib":            dylib,
+				"bundle_team_id":   bundleSignature.TeamID,
+				"dylib_team_id":    signature.TeamID,
+				"signature_status": signature.Status,
+				"modified_time":    fileModTime(dylib),
+			})
+		}
+	}
+
+	// Weak and @rpath dylibs resolving to missing or user-writable files
+	for binary, reference := range binaries {
+		info, err := utils.ParseMachO(binary)
+		if err != nil {
+			params.Logger.Debug("Error parsing Mach-O %s: %v", binary, err)
+			continue
+		}
+
+		binaryWritable := isUserWritablePath(binary)
+		check := func(dylib string, weak bool) {
+			candidates := resolveDylibPaths(dylib, binary, info.Rpaths)
+			if len(candidates) == 0 || isSharedCachePath(candidates[0]) {
+				return
+			}
+			// dyld loads the first candidate that exists
+			found := -1
+			for index, candidate := range candidates {
+				if _, err := os.Stat(candidate); err == nil {
+					found = index
+					break
+				}
+			}
+			for index, candidate := range candidates {
+				missing := found < 0 || index < found
+				// A library planted in a user-writable folder only matters for binaries outside of them
+				writable := isUserWritablePath(candidate) && !binaryWritable
+				// A missing candidate is hijackable when dyld tolerates it (weak) or searches it before the real library
+				if !(writable || (missing && (weak || found >= 0))) {
+					continue
+				}
+				writeFinding(binary, map[string]interface{}{
+					"type":          "hijackable_dylib",
+					"binary":        binary,
+					"referenced_by": reference,
+					"dylib":         dylib,
+					"resolved_path": candidate,
+					"weak":          weak,
+					"missing":       missing,
+					"user_writable": writable,
+					"rpaths":        strings.Join(info.Rpaths, ", "),
+				})
+				if index == found {
+					break
+				}
+			}
+		}
+		for _, dylib := range info.WeakDylibs {
+			check(dylib, true)
+		}
+		for _, dylib := range info.Dylibs {
+			if strings.HasPrefix(dylib, "@rpath/") {
+				check(dylib, false)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dyldVariables returns the DYLD_* entries of an environment dictionary
+func dyldVariables(value interface{}) map[string]string {
+	variables := make(map[string]string)
+	environment, ok := value.(map[string]interface{})
+	if !ok {
+		return variables
+	}
+	for name, value := range environment {
+		if strings.HasPrefix(strings.ToUpper(name), "DYLD_") {
+			variables[name] = fmt.Sprintf("%v", value)
+		}
+	}
+	return variables
+}
+
+// resolveDylibPaths returns the paths where dyld looks for a library, in search order
+func resolveDylibPaths(dylib string, binary string, rpaths []string) []string {
+	binaryDir := filepath.Dir(binary)
+	expand := func(path string) string {
+		path = strings.Replace(path, "@executable_path", binaryDir, 1)
+		path = strings.Replace(path, "@loader_path", binaryDir, 1)
+		return filepath.Clean(path)
+	}
+
+	if !strings.HasPrefix(dylib, "@rpath/") {
+		return []string{expand(dylib)}
+	}
+	var paths []string
+	for _, rpath := range rpaths {
+		paths = append(paths, expand(filepath.Join(rpath, strings.TrimPrefix(dylib, "@rpath/"))))
+	}
+	return paths
+}
+
+// isSharedCachePath reports whether a system library is served from the dyld shared cache,
+// where it has no file on disk and cannot be replaced
+func isSharedCachePath(path string) bool {
+	return strings.HasPrefix(path, "/usr/lib/") || strings.HasPrefix(path, "/System/Library/")
+}
+
+// isUserWritablePath reports whether a path is in a location writable without administrator rights
+func isUserWritablePath(path string) bool {
+	for _, prefix := range userWritablePrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
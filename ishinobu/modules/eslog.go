@@ -0,0 +1,193 @@
+// This module captures live EndpointSecurity events with eslogger (macOS 13+) for a short window:
+//   - exec: process executions with the arguments, working directory and code signing identity of the target.
+//   - open: file opens with the path and open flags.
+//   - mount: file system mounts with the mount point, source and file system type.
+//
+// Every event includes the instigating process (path, pid, ppid, euid, signing id and team id).
+// eslogger must run as root and the terminal or the collector must have Full Disk Access.
+// The module is disabled unless a duration (in seconds) is set in <InputDir>/eslog.json:
+//
+//	{
+//	  "duration": 60,
+//	  "events": ["exec", "open", "mount"]
+//	}
+package modules
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ESLogModule struct {
+	Name        string
+	Description string
+}
+
+// ESLogConfig is the configuration of the eslog module.
+type ESLogConfig struct {
+	Duration int      `json:"duration"`
+	Events   []string `json:"events"`
+}
+
+func init() {
+	module := &ESLogModule{
+		Name:        "eslog",
+		Description: "Captures exec, file open and mount EndpointSecurity events for a configured duration (optional)"}
+	mod.RegisterModule(module)
+}
+
+func (m *ESLogModule) GetName() string {
+	return m.Name
+}
+
+func (m *ESLogModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *ESLogModule) Run(params mod.ModuleParams) error {
+	config := ESLogConfig{Events: []string{"exec", "open", "mount"}}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+	if config.Duration <= 0 {
+		params.Logger.Debug("eslog is disabled, set a duration in %s.json to enable it", m.GetName())
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("eslogger requires root privileges")
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Duration)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "eslogger", config.Events...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error creating eslogger pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error running eslogger: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var message map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			params.Logger.Debug("Error parsing eslogger event: %v", err)
+			continue
+		}
+
+		recordData := esEventData(message)
+		eventTimestamp := recordData["timestamp"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          "eslogger",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// eslogger is killed when the capture window ends
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("eslogger failed: %v", err)
+	}
+
+	return nil
+}
+
+// esEventData flattens an eslogger JSON message into the fields of a record
+func esEventData(message map[string]interface{}) map[string]interface{} {
+	recordData := map[string]interface{}{
+		"timestamp":         "",
+		"event":             "",
+		"process_path":      esValue(message, "process", "executable", "path"),
+		"pid":               esValue(message, "process", "audit_token", "pid"),
+		"ppid":              esValue(message, "process", "ppid"),
+		"euid":              esValue(message, "process", "audit_token", "euid"),
+		"signing_id":        esValue(message, "process", "signing_id"),
+		"team_id":           esValue(message, "process", "team_id"),
+		"target":            "",
+		"target_signing_id": "",
+		"target_team_id":    "",
+		"args":              "",
+		"cwd":               "",
+		"flags":             "",
+		"source":            "",
+		"fs_type":           "",
+	}
+	if value, ok := message["time"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			recordData["timestamp"] = t.UTC().Format(utils.TimeFormat)
+		}
+	}
+
+	event, _ := message["event"].(map[string]interface{})
+	for name, value := range event {
+		recordData["event"] = name
+		details, _ := value.(map[string]interface{})
+		switch name {
+		case "exec":
+			recordData["target"] = esValue(details, "target", "executable", "path")
+			recordData["target_signing_id"] = esValue(details, "target", "signing_id")
+			recordData["target_team_id"] = esValue(details, "target", "team_id")
+			recordData["cwd"] = esValue(details, "cwd", "path")
+			if args, ok := details["args"].([]interface{}); ok {
+				parts := make([]string, 0, len(args))
+				for _, arg := range args {
+					parts = append(parts, fmt.Sprintf("%v", arg))
+				}
+				recordData["args"] = strings.Join(parts, " ")
+			}
+		case "open":
+			recordData["target"] = esValue(details, "file", "path")
+			recordData["flags"] = esValue(details, "fflag")
+		case "mount":
+			recordData["target"] = esValue(details, "statfs", "f_mntonname")
+			recordData["source"] = esValue(details, "statfs", "f_mntfromname")
+			recordData["fs_type"] = esValue(details, "statfs", "f_fstypename")
+		}
+	}
+	return recordData
+}
+
+// esValue follows a path of keys through nested JSON objects and returns the value or an empty string
+func esValue(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+	if value == nil {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,249 @@
+// This module sweeps the high-risk locations of the file system for executables, as a quick hunting dataset
+// without a full disk walk:
+//   - Locations: /private/tmp, /private/var/tmp, /Users/Shared, the Library folder of each user and the programs
+//     run by the launch agents and daemons outside /System.
+//   - Executables: Mach-O binaries (thin and universal) and scripts (#! interpreter line).
+//   - For each executable: MD5 and SHA-256 hashes, birth and modification times, owner and mode, architectures or
+//     interpreter, code signature status, team ID and entitlements, and whether the path is the program of an
+//     autostart item (launchd, at jobs, cron, emond, Folder Actions, login hooks).
+//
+// The locations, the depth of the walk and the largest file hashed are configured in <InputDir>/execsweep.json:
+//
+//	{
+//	  "paths": ["/private/tmp", "/Users/*/Library"],
+//	  "max_depth": 6,
+//	  "max_hash_size": 104857600
+//	}
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ExecSweepModule struct {
+	Name        string
+	Description string
+}
+
+// ExecSweepConfig is the configuration of the execsweep module.
+type ExecSweepConfig struct {
+	Paths       []string `json:"paths"`
+	MaxDepth    int      `json:"max_depth"`
+	MaxHashSize int64    `json:"max_hash_size"`
+}
+
+func init() {
+	module := &ExecSweepModule{
+		Name:        "execsweep",
+		Description: "Hashes and records Mach-O and script executables of high-risk locations with signatures, entitlements and autostart references"}
+	mod.RegisterModule(module)
+}
+
+func (m *ExecSweepModule) GetName() string {
+	return m.Name
+}
+
+func (m *ExecSweepModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	execSweepPaths = []string{
+		"/private/tmp",
+		"/private/var/tmp",
+		"/Users/Shared",
+		"/Users/*/Library",
+	}
+	// Magic numbers of Mach-O files: 32 and 64-bit in both byte orders and universal binaries
+	machoMagics = [][]byte{
+		{0xfe, 0xed, 0xfa, 0xce},
+		{0xfe, 0xed, 0xfa, 0xcf},
+		{0xce, 0xfa, 0xed, 0xfe},
+		{0xcf, 0xfa, 0xed, 0xfe},
+		{0xca, 0xfe, 0xba, 0xbe},
+	}
+)
+
+func (m *ExecSweepModule) Run(params mod.ModuleParams) error {
+	config := ExecSweepConfig{Paths: execSweepPaths, MaxDepth: 6, MaxHashSize: 100 * 1024 * 1024}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	autostart := autostartPrograms(params)
+	seen := make(map[string]bool)
+
+	writeExecutable := func(path string) {
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		kind, detail := executableKind(path)
+		if kind == "" {
+			return
+		}
+
+		recordData := map[string]interface{}{
+			"username":         utils.GetUsernameFromPath(path),
+			"path":             path,
+			"type":             kind,
+			"detail":           detail,
+			"size":             info.Size(),
+			"owner":            fileOwner(path),
+			"mode":             info.Mode().String(),
+			"birth_time":       utils.FileBirthTime(info),
+			"modified":         info.ModTime().UTC().Format(utils.TimeFormat),
+			"md5":              "",
+			"sha256":           "",
+			"signature":        "",
+			"team_id":          "",
+			"identifier":       "",
+			"entitlements":     "",
+			"autostart":        autostart[path] != "",
+			"autostart_source": autostart[path],
+		}
+		if info.Size() <= config.MaxHashSize {
+			if md5Sum, sha256Sum, err := utils.HashFile(path); err == nil {
+				recordData["md5"] = md5Sum
+				recordData["sha256"] = sha256Sum
+			}
+		}
+		if kind == "macho" {
+			signature := utils.GetCodeSignature(path)
+			recordData["signature"] = signature.Status
+			recordData["team_id"] = signature.TeamID
+			recordData["identifier"] = signature.Identifier
+			if entitlements, err := utils.GetEntitlements(path); err == nil {
+				var keys []string
+				for key := range entitlements {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				recordData["entitlements"] = strings.Join(keys, ", ")
+			}
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      recordData["modified"].(string),
+			Data:                recordData,
+			SourceFile:          path,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for _, root := range utils.GlobPaths(config.Paths...) {
+		depth := strings.Count(filepath.Clean(root), string(os.PathSeparator))
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				params.Logger.Debug("Error walking %s: %v", path, err)
+				return nil
+			}
+			if entry.IsDir() {
+				if strings.Count(path, string(os.PathSeparator))-depth >= config.MaxDepth {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.Type().IsRegular() {
+				writeExecutable(path)
+			}
+			return nil
+		})
+		if err != nil {
+			params.Logger.Debug("Error walking %s: %v", root, err)
+		}
+	}
+
+	// Programs of the launch agents and daemons installed outside /System
+	for path, source := range autostart {
+		if strings.HasPrefix(source, "launchd:") && !strings.HasPrefix(path, "/System/") {
+			writeExecutable(path)
+		}
+	}
+
+	return nil
+}
+
+// executableKind returns "macho" with the architectures or "script" with the interpreter when a file is an
+// executable, and an empty string otherwise
+func executableKind(path string) (string, string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer file.Close()
+
+	header := make([]byte, 256)
+	n, _ := file.Read(header)
+	header = header[:n]
+	if len(header) < 4 {
+		return "", ""
+	}
+	for _, magic := range machoMagics {
+		if bytes.Equal(header[:4], magic) {
+			info, err := utils.ParseMachO(path)
+			if err != nil {
+				// Java class files share the magic number of universal binaries
+				return "", ""
+			}
+			return "macho", strings.Join(info.CPUs, ", ")
+		}
+	}
+	if bytes.HasPrefix(header, []byte("#!")) {
+		line, _, _ := bytes.Cut(header[2:], []byte("\n"))
+		return "script", strings.TrimSpace(string(line))
+	}
+	return "", ""
+}
+
+// autostartPrograms returns the programs started by launchd plists and the autostart items, with the
+// mechanism and file referencing them
+func autostartPrograms(params mod.ModuleParams) map[string]string {
+	programs := make(map[string]string)
+	for _, plist := range parseLaunchdPlists(params) {
+		if plist.Program != "" {
+			programs[plist.Program] = "launchd:" + plist.Path
+		}
+	}
+	for _, collector := range []func(mod.ModuleParams) []map[string]interface{}{
+		collectAtJobs,
+		collectCronJobs,
+		collectEmondRules,
+		collectFolderActions,
+		collectLoginHooks,
+	} {
+		for _, item := range collector(params) {
+			program, _ := item["program"].(string)
+			if program == "" || programs[program] != "" {
+				continue
+			}
+			programs[program] = fmt.Sprintf("%v:%v", item["src_name"], item["src_file"])
+		}
+	}
+	return programs
+}
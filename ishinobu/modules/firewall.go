@@ -0,0 +1,204 @@
+// This module collects the configuration of the Application Firewall (ALF) and the packet filter (pf):
+//   - /Library/Preferences/com.apple.alf.plist: global state, stealth mode, logging and the applications
+//     and services exceptions. On macOS 15+ the state is read from socketfilterfw as the plist is no longer used.
+//   - socketfilterfw --listapps: applications allowed or blocked to receive incoming connections.
+//     Allowed applications outside the standard application folders are flagged.
+//   - pfctl -sr and pfctl -sA: loaded pf rules and anchors, and the content of /etc/pf.conf and /etc/pf.anchors/*.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type FirewallModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &FirewallModule{
+		Name:        "firewall",
+		Description: "Collects Application Firewall settings, allowed applications and pf rules"}
+	mod.RegisterModule(module)
+}
+
+func (m *FirewallModule) GetName() string {
+	return m.Name
+}
+
+func (m *FirewallModule) GetDescription() string {
+	return m.Description
+}
+
+const socketfilterfwPath = "/usr/libexec/ApplicationFirewall/socketfilterfw"
+
+var (
+	alfGlobalStates = map[int64]string{
+		0: "off",
+		1: "on",
+		2: "block_all",
+	}
+	// socketfilterfw --listapps prints the path of each application followed by its state, e.g.
+	// ALF: /Applications/Foo.app
+	//      ( Allow incoming connections )
+	socketfilterfwAppRegex   = regexp.MustCompile(`^(?:\d+\s*:\s*|ALF:\s*)?(/.+?)\s*$`)
+	socketfilterfwStateRegex = regexp.MustCompile(`\(\s*(Allow|Block)\s+incoming connections\s*\)`)
+)
+
+func (m *FirewallModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeFirewall := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// ALF preferences
+	alfPath := "/Library/Preferences/com.apple.alf.plist"
+	var alf map[string]interface{}
+	if err := utils.ParsePlistFile(alfPath, &alf); err != nil {
+		params.Logger.Debug("Error parsing %s: %v", alfPath, err)
+	} else {
+		globalState, _ := alf["globalstate"].(uint64)
+		writeFirewall(alfPath, map[string]interface{}{
+			"type":              "alf_settings",
+			"global_state":      alfGlobalStates[int64(globalState)],
+			"stealth_mode":      alf["stealthenabled"],
+			"logging":           alf["loggingenabled"],
+			"allow_signed":      alf["allowsignedenabled"],
+			"allow_downloaded":  alf["allowdownloadsignedenabled"],
+			"firewall_unload":   alf["firewallunload"],
+			"modification_time": fileModTime(alfPath),
+		})
+
+		for _, section := range []string{"applications", "exceptions", "explicitauths"} {
+			entries, _ := alf[section].([]interface{})
+			for _, value := range entries {
+				entry, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				path, _ := entry["path"].(string)
+				if path == "" {
+					path, _ = entry["id"].(string)
+				}
+				writeFirewall(alfPath, map[string]interface{}{
+					"type":   "alf_" + strings.TrimSuffix(section, "s"),
+					"path":   path,
+					"bundle": entry["bundleid"],
+					"state":  entry["state"],
+				})
+			}
+		}
+	}
+
+	// Global state reported by socketfilterfw, also available when the plist is not used
+	for _, option := range []string{"--getglobalstate", "--getstealthmode", "--getallowsigned", "--getloggingmode"} {
+		output, err := exec.Command(socketfilterfwPath, option).Output()
+		if err != nil {
+			params.Logger.Debug("Error running socketfilterfw %s: %v", option, err)
+			continue
+		}
+		writeFirewall("socketfilterfw", map[string]interface{}{
+			"type":    "socketfilterfw_setting",
+			"setting": strings.TrimPrefix(option, "--get"),
+			"value":   strings.TrimSpace(string(output)),
+		})
+	}
+
+	// Applications allowed or blocked
+	output, err := exec.Command(socketfilterfwPath, "--listapps").Output()
+	if err != nil {
+		params.Logger.Debug("Error running socketfilterfw --listapps: %v", err)
+	} else {
+		application := ""
+		for _, line := range strings.Split(string(output), "\n") {
+			if match := socketfilterfwStateRegex.FindStringSubmatch(line); match != nil && application != "" {
+				allowed := match[1] == "Allow"
+				writeFirewall("socketfilterfw", map[string]interface{}{
+					"type":       "alf_allowed_application",
+					"path":       application,
+					"allowed":    allowed,
+					"suspicious": allowed && !isStandardApplicationPath(application),
+				})
+				application = ""
+				continue
+			}
+			if match := socketfilterfwAppRegex.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+				application = match[1]
+			}
+		}
+	}
+
+	// pf rules and anchors
+	for _, args := range [][]string{{"-s", "rules"}, {"-s", "Anchors"}, {"-s", "info"}} {
+		output, err := exec.Command("pfctl", args...).Output()
+		if err != nil {
+			params.Logger.Debug("Error running pfctl %s: %v", strings.Join(args, " "), err)
+			continue
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			writeFirewall("pfctl "+strings.Join(args, " "), map[string]interface{}{
+				"type": "pf_" + strings.ToLower(args[1]),
+				"rule": line,
+			})
+		}
+	}
+
+	// pf configuration files
+	for _, path := range append([]string{"/etc/pf.conf"}, utils.GlobPaths("/etc/pf.anchors/*")...) {
+		lines, mtime, err := readConfigLines(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		for _, line := range lines {
+			writeFirewall(path, map[string]interface{}{
+				"type":              "pf_config",
+				"rule":              line,
+				"modification_time": mtime,
+			})
+		}
+	}
+
+	return nil
+}
+
+// isStandardApplicationPath reports whether an application lives in the folders where applications are installed
+func isStandardApplicationPath(path string) bool {
+	if strings.HasPrefix(path, "/Users/") {
+		return strings.Contains(path, "/Applications/")
+	}
+	for _, folder := range dockApplicationFolders {
+		if strings.HasPrefix(path, folder) {
+			return true
+		}
+	}
+	if strings.HasPrefix(path, "/usr/local/") {
+		return false
+	}
+	return strings.HasPrefix(path, "/usr/") || strings.HasPrefix(path, "/System/") || strings.HasPrefix(path, "/Library/Apple/")
+}
@@ -0,0 +1,155 @@
+// This module collects the state of the built-in macOS malware protections:
+// - Gatekeeper assessment status: spctl --status and /var/db/SystemPolicy-prefs.plist
+// - XProtect, XProtect Remediator and MRT bundle versions
+// - XProtect detection and remediation events from the unified logs over the configured window
+// The window defaults to the last 7 days and can be changed in <InputDir>/gatekeeper.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type GatekeeperModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &GatekeeperModule{
+		Name:        "gatekeeper",
+		Description: "Collects Gatekeeper status, XProtect/MRT versions and XProtect detection events"}
+	mod.RegisterModule(module)
+}
+
+func (m *GatekeeperModule) GetName() string {
+	return m.Name
+}
+
+func (m *GatekeeperModule) GetDescription() string {
+	return m.Description
+}
+
+// Protection bundles and the Info.plist holding their versions
+var malwareProtectionBundles = map[string][]string{
+	"XProtect": {
+		"/Library/Apple/System/Library/CoreServices/XProtect.bundle/Contents/Info.plist",
+		"/System/Library/CoreServices/XProtect.bundle/Contents/Info.plist",
+	},
+	"XProtect Remediator": {
+		"/Library/Apple/System/Library/CoreServices/XProtect.app/Contents/Info.plist",
+	},
+	"MRT": {
+		"/Library/Apple/System/Library/CoreServices/MRT.app/Contents/Info.plist",
+		"/System/Library/CoreServices/MRT.app/Contents/Info.plist",
+	},
+}
+
+func (m *GatekeeperModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeStatus := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Gatekeeper status
+	output, err := exec.Command("spctl", "--status").CombinedOutput()
+	if err != nil {
+		params.Logger.Debug("Error running spctl: %v", err)
+	}
+	status := strings.TrimSpace(string(output))
+	writeStatus("spctl --status", map[string]interface{}{
+		"component": "Gatekeeper",
+		"status":    status,
+		"enabled":   strings.Contains(status, "assessments enabled"),
+	})
+
+	var systemPolicyPrefs map[string]interface{}
+	err = utils.ParsePlistFile("/var/db/SystemPolicy-prefs.plist", &systemPolicyPrefs)
+	if err != nil {
+		params.Logger.Debug("Error reading SystemPolicy preferences: %v", err)
+	} else {
+		writeStatus("/var/db/SystemPolicy-prefs.plist", map[string]interface{}{
+			"component": "Gatekeeper",
+			"status":    fmt.Sprintf("%v", systemPolicyPrefs["enabled"]),
+			"enabled":   systemPolicyPrefs["enabled"] == "yes",
+		})
+	}
+
+	// Protection bundle versions
+	for component, infoPlists := range malwareProtectionBundles {
+		for _, infoPlist := range infoPlists {
+			var info map[string]interface{}
+			if err := utils.ParsePlistFile(infoPlist, &info); err != nil {
+				continue
+			}
+			writeStatus(infoPlist, map[string]interface{}{
+				"component": component,
+				"version":   info["CFBundleShortVersionString"],
+				"build":     info["CFBundleVersion"],
+			})
+			break
+		}
+	}
+
+	// XProtect detection and remediation events
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `subsystem == "com.apple.XProtectFramework.PluginAPI" OR process BEGINSWITH "XProtect" OR process == "MRT"`,
+		Info:      true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error collecting XProtect events: %v", err)
+		return nil
+	}
+
+	eventsFileName := utils.GetOutputFileName(m.GetName()+"-xprotect-events", params.ExportFormat, params.OutputDir)
+	eventsWriter, err := utils.NewDataWriter(params.LogsDir, eventsFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer eventsWriter.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = eventsWriter.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
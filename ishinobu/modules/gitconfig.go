@@ -0,0 +1,282 @@
+// This module audits the Git configuration of the host and of each user:
+//   - Configuration files: /etc/gitconfig, the Homebrew and Xcode system configurations, ~/.gitconfig and
+//     ~/.config/git/config, one record per setting. Credential helpers other than the standard ones, URL rewrites
+//     (url.<base>.insteadOf and pushInsteadOf), core.sshCommand and the settings running commands or hooks
+//     (core.fsmonitor, core.hooksPath, ...) are flagged.
+//   - Stored credentials: the entries of ~/.git-credentials and ~/.config/git/credentials with the protocol, host,
+//     path and user name. The passwords and tokens are never collected.
+//   - Recently used repositories: the clone URLs, remotes and repository paths (git -C) of the git commands found
+//     in the shell histories of each user, with the time of the command when recorded.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type GitConfigModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &GitConfigModule{
+		Name:        "gitconfig",
+		Description: "Audits Git configuration, credential helpers, URL rewrites, stored credentials and recently used repositories"}
+	mod.RegisterModule(module)
+}
+
+func (m *GitConfigModule) GetName() string {
+	return m.Name
+}
+
+func (m *GitConfigModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	gitConfigPaths = []string{
+		"/etc/gitconfig",
+		"/usr/local/etc/gitconfig",
+		"/opt/homebrew/etc/gitconfig",
+		"/Library/Developer/CommandLineTools/usr/share/git-core/gitconfig",
+		"/Applications/Xcode*.app/Contents/Developer/usr/share/git-core/gitconfig",
+		"/Users/*/.gitconfig",
+		"/Users/*/.config/git/config",
+		"/private/var/root/.gitconfig",
+	}
+	gitCredentialPaths = []string{
+		"/Users/*/.git-credentials",
+		"/Users/*/.config/git/credentials",
+		"/private/var/root/.git-credentials",
+	}
+	gitHistoryPaths = []string{
+		"/Users/*/.*_history",
+		"/Users/*/.zhistory",
+		"/Users/*/.local/share/fish/fish_history",
+		"/private/var/root/.*_history",
+	}
+	// Credential helpers shipped with Git, Git Credential Manager and the GitHub CLI
+	standardCredentialHelpers = []string{"osxkeychain", "cache", "store", "manager", "manager-core", "gh auth git-credential"}
+	// Settings flagged whatever their value
+	gitFlaggedSettings = map[string]bool{
+		"core.sshcommand":            true,
+		"core.fsmonitor":             true,
+		"core.hookspath":             true,
+		"core.askpass":               true,
+		"core.gitproxy":              true,
+		"sequence.editor":            true,
+		"diff.external":              true,
+		"http.proxy":                 true,
+		"include.path":               true,
+		"includeif.path":             true,
+		"uploadpack.packobjectshook": true,
+	}
+	// Options of git clone followed by a value
+	gitCloneValueOptions = map[string]bool{
+		"-b": true, "--branch": true, "-o": true, "--origin": true, "-c": true, "--config": true,
+		"--depth": true, "-j": true, "--jobs": true, "-u": true, "--upload-pack": true, "--reference": true,
+		"--template": true, "--filter": true, "--separate-git-dir": true, "--shallow-since": true,
+		"--shallow-exclude": true,
+	}
+	gitSectionRegex       = regexp.MustCompile(`^\[\s*([^\s"\]]+)(?:\s+"(.*)")?\s*\]\s*(.*)$`)
+	gitCloneRegex         = regexp.MustCompile(`\bgit\s+clone\s+([^;&|]+)`)
+	gitRemoteCommandRegex = regexp.MustCompile(`\bgit\s+remote\s+(?:add|set-url)\s+\S+\s+(\S+)`)
+	gitDirectoryRegex     = regexp.MustCompile(`\bgit\s+-C\s+("[^"]+"|'[^']+'|\S+)`)
+)
+
+func (m *GitConfigModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeGit := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		username := utils.GetUsernameFromPath(sourceFile)
+		if username == "" && strings.HasPrefix(sourceFile, "/private/var/root") {
+			username = "root"
+		}
+		recordData["username"] = username
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Configuration settings
+	for _, path := range utils.GlobPaths(gitConfigPaths...) {
+		settings, err := readGitConfig(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		modified := fileModTime(path)
+		for _, setting := range settings {
+			writeGit(path, modified, map[string]interface{}{
+				"type":       "setting",
+				"section":    setting[0],
+				"subsection": setting[1],
+				"key":        setting[2],
+				"value":      setting[3],
+				"flagged":    isFlaggedGitSetting(setting[0], setting[2], setting[3]),
+			})
+		}
+	}
+
+	// Stored credentials, the secrets are dropped
+	for _, path := range utils.GlobPaths(gitCredentialPaths...) {
+		lines, modified, err := readConfigLines(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		for _, line := range lines {
+			credential, err := url.Parse(line)
+			if err != nil {
+				continue
+			}
+			_, hasPassword := credential.User.Password()
+			writeGit(path, modified, map[string]interface{}{
+				"type":         "credential",
+				"protocol":     credential.Scheme,
+				"host":         credential.Host,
+				"path":         credential.Path,
+				"user":         credential.User.Username(),
+				"has_password": hasPassword,
+			})
+		}
+	}
+
+	// Repositories used from the shell
+	for _, path := range utils.GlobPaths(gitHistoryPaths...) {
+		var entries []historyEntry
+		if historyShell(path) == "fish" {
+			entries, err = readFishHistory(path)
+		} else {
+			entries, err = readShellHistory(path)
+		}
+		if err != nil {
+			params.Logger.Debug("Error reading history file %s: %v", path, err)
+		}
+		for _, entry := range entries {
+			for action, regex := range map[string]*regexp.Regexp{"clone": gitCloneRegex, "remote": gitRemoteCommandRegex, "directory": gitDirectoryRegex} {
+				for _, match := range regex.FindAllStringSubmatch(entry.Command, -1) {
+					repository := match[1]
+					if action == "clone" {
+						repository = gitCloneRepository(repository)
+					}
+					if repository == "" {
+						continue
+					}
+					writeGit(path, entry.Timestamp, map[string]interface{}{
+						"type":       "repository",
+						"action":     action,
+						"repository": strings.Trim(repository, `"'`),
+						"command":    entry.Command,
+						"timestamp":  entry.Timestamp,
+					})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// readGitConfig returns the settings of a Git configuration file as section, subsection, key and value
+func readGitConfig(path string) ([][4]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var settings [][4]string
+	section, subsection := "", ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if match := gitSectionRegex.FindStringSubmatch(line); match != nil {
+			section, subsection = strings.ToLower(match[1]), match[2]
+			// [section.subsection] is the deprecated syntax of [section "subsection"]
+			if name, sub, found := strings.Cut(section, "."); found && subsection == "" {
+				section, subsection = name, sub
+			}
+			line = match[3]
+			if line == "" {
+				continue
+			}
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if !found {
+			// a key without value is a boolean set to true
+			value = "true"
+		}
+		settings = append(settings, [4]string{section, subsection, key, strings.Trim(value, `"`)})
+	}
+
+	return settings, scanner.Err()
+}
+
+// gitCloneRepository returns the repository of the arguments of git clone, skipping the options
+func gitCloneRepository(args string) string {
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		if gitCloneValueOptions[fields[i]] {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(fields[i], "-") {
+			return fields[i]
+		}
+	}
+	return ""
+}
+
+// isFlaggedGitSetting reports whether a setting rewrites URLs, runs commands or uses a non-standard credential helper
+func isFlaggedGitSetting(section, key, value string) bool {
+	switch {
+	case section == "url" && (key == "insteadof" || key == "pushinsteadof"):
+		return true
+	case section == "http" && key == "sslverify":
+		return strings.EqualFold(value, "false")
+	case section == "safe" && key == "directory":
+		return value == "*"
+	case section == "credential" && key == "helper":
+		helper := strings.TrimPrefix(strings.TrimSpace(value), "!")
+		if helper == "" {
+			return false
+		}
+		for _, standard := range standardCredentialHelpers {
+			if strings.HasPrefix(helper, standard) || strings.HasPrefix(filepath.Base(helper), "git-credential-"+standard) {
+				return false
+			}
+		}
+		return true
+	}
+	return gitFlaggedSettings[section+"."+key]
+}
@@ -0,0 +1,260 @@
+// This module shows the activities (documents, URLs) handed off between the Mac and the devices paired through
+// Continuity, a data movement path otherwise invisible:
+//   - knowledgeC: the /app/activity stream (NSUserActivity of the applications) with its activity type, title
+//     and URL, and the device (ZSOURCE device ID and ZSYNCPEER name and model) when the activity comes from
+//     another device.
+//   - Biome: the records of the activity and app intent streams synced from the other devices
+//     (streams/<scope>/<stream>/remote/<device>/*) and of the local UserActivity streams.
+//   - Unified logs: the Handoff advertisements sent and received by useractivityd and sharingd over the window.
+//
+// The window and the Biome streams are configured in <InputDir>/handoff.json:
+//
+//	{
+//	  "days": 7,
+//	  "streams": ["App.Intent", "UserActivity", "App.Activity", "Safari"]
+//	}
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type HandoffModule struct {
+	Name        string
+	Description string
+}
+
+// HandoffConfig is the configuration of the handoff module.
+type HandoffConfig struct {
+	Days    int      `json:"days"`
+	Streams []string `json:"streams"`
+}
+
+func init() {
+	module := &HandoffModule{
+		Name:        "handoff",
+		Description: "Collects Handoff and Continuity activities exchanged with paired devices from knowledgeC, Biome and the unified logs"}
+	mod.RegisterModule(module)
+}
+
+func (m *HandoffModule) GetName() string {
+	return m.Name
+}
+
+func (m *HandoffModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	handoffBiomePaths = []string{
+		"/Users/*/Library/Biome/streams/*/*/remote/*/*",
+		"/Users/*/Library/Biome/streams/*/*/local/*",
+		"/private/var/db/biome/streams/*/*/remote/*/*",
+	}
+	handoffActivityQuery = `SELECT o.ZSTARTDATE AS start_date, o.ZENDDATE AS end_date, s.ZBUNDLEID AS bundle_id,
+s.ZDEVICEID AS device_id, p.ZNAME AS device_name, p.ZMODEL AS device_model,
+m.Z_DKAPPLICATIONACTIVITYMETADATAKEY__ACTIVITYTYPE AS activity_type,
+m.Z_DKAPPLICATIONACTIVITYMETADATAKEY__CONTENTDESCRIPTION AS title,
+m.Z_DKAPPLICATIONACTIVITYMETADATAKEY__ITEMRELATEDCONTENTURL AS url
+FROM ZOBJECT o
+LEFT JOIN ZSTRUCTUREDMETADATA m ON o.ZSTRUCTUREDMETADATA = m.Z_PK
+LEFT JOIN ZSOURCE s ON o.ZSOURCE = s.Z_PK
+LEFT JOIN ZSYNCPEER p ON p.ZDEVICEID = s.ZDEVICEID
+WHERE o.ZSTREAMNAME = '/app/activity'
+ORDER BY o.ZSTARTDATE`
+	// Older knowledgeC databases do not have the device names of ZSYNCPEER
+	handoffActivityFallbackQuery = `SELECT o.ZSTARTDATE AS start_date, o.ZENDDATE AS end_date, s.ZBUNDLEID AS bundle_id,
+s.ZDEVICEID AS device_id, m.Z_DKAPPLICATIONACTIVITYMETADATAKEY__ACTIVITYTYPE AS activity_type,
+m.Z_DKAPPLICATIONACTIVITYMETADATAKEY__CONTENTDESCRIPTION AS title,
+m.Z_DKAPPLICATIONACTIVITYMETADATAKEY__ITEMRELATEDCONTENTURL AS url
+FROM ZOBJECT o
+LEFT JOIN ZSTRUCTUREDMETADATA m ON o.ZSTRUCTUREDMETADATA = m.Z_PK
+LEFT JOIN ZSOURCE s ON o.ZSOURCE = s.Z_PK
+WHERE o.ZSTREAMNAME = '/app/activity'
+ORDER BY o.ZSTARTDATE`
+	handoffActivityTypeRegex = regexp.MustCompile(`(?i)activityType[=:\s]+["']?([\w.-]+)`)
+	handoffURLRegex          = regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s"'<>,]+`)
+)
+
+func (m *HandoffModule) Run(params mod.ModuleParams) error {
+	config := HandoffConfig{Days: 7, Streams: []string{"App.Intent", "UserActivity", "App.Activity", "Safari"}}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeActivity := func(sourceFile, eventTimestamp string, recordData map[string]interface{}) {
+		for _, key := range []string{"username", "source", "direction", "device_id", "device_name", "device_model",
+			"bundle_id", "activity_type", "title", "url", "end", "message"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// knowledgeC application activities
+	tmpDir, err := os.MkdirTemp("", "ishinobu-handoff")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range utils.GlobPaths("/private/var/db/CoreDuet/Knowledge/knowledgeC.db",
+		"/Users/*/Library/Application Support/Knowledge/knowledgeC.db") {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+		rows, err := utils.QuerySQLiteMaps(dst, handoffActivityQuery)
+		if err != nil {
+			rows, err = utils.QuerySQLiteMaps(dst, handoffActivityFallbackQuery)
+		}
+		if err != nil {
+			params.Logger.Debug("Error querying application activities of %s: %v", dbPath, err)
+			continue
+		}
+		for _, row := range rows {
+			deviceID := fmt.Sprintf("%v", valueOrEmpty(row["device_id"]))
+			direction := "local"
+			if deviceID != "" {
+				direction = "remote"
+			}
+			writeActivity(dbPath, clipboardTime(row["start_date"]), map[string]interface{}{
+				"username":      utils.GetUsernameFromPath(dbPath),
+				"source":        "knowledgec",
+				"direction":     direction,
+				"device_id":     deviceID,
+				"device_name":   valueOrEmpty(row["device_name"]),
+				"device_model":  valueOrEmpty(row["device_model"]),
+				"bundle_id":     valueOrEmpty(row["bundle_id"]),
+				"activity_type": valueOrEmpty(row["activity_type"]),
+				"title":         valueOrEmpty(row["title"]),
+				"url":           valueOrEmpty(row["url"]),
+				"end":           clipboardTime(row["end_date"]),
+			})
+		}
+	}
+
+	// Biome streams synced from the other devices
+	for _, path := range utils.GlobPaths(handoffBiomePaths...) {
+		parts := strings.Split(path, string(os.PathSeparator))
+		if len(parts) < 4 {
+			continue
+		}
+		direction, deviceID, stream := "local", "", parts[len(parts)-3]
+		if parts[len(parts)-3] == "remote" {
+			direction, deviceID, stream = "remote", parts[len(parts)-2], parts[len(parts)-4]
+		} else if !strings.Contains(strings.ToLower(stream), "useractivity") {
+			// Only the activity streams are collected locally, the other local streams are left to the biome module
+			continue
+		}
+		if !biomeStreamSelected(stream, config.Streams) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		records, err := utils.ParseSEGB(data)
+		if err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for _, segbRecord := range records {
+			strs := biomeStrings(segbRecord.Data, 0)
+			recordData := map[string]interface{}{
+				"username":  utils.GetUsernameFromPath(path),
+				"source":    "biome:" + stream,
+				"direction": direction,
+				"device_id": deviceID,
+				"message":   strings.Join(strs, " | "),
+			}
+			for _, str := range strs {
+				switch {
+				case recordData["url"] == nil && strings.Contains(str, "://"):
+					recordData["url"] = str
+				case recordData["bundle_id"] == nil && biomeBundleIDRegex.MatchString(str):
+					recordData["bundle_id"] = str
+				case recordData["title"] == nil && strings.Contains(str, " "):
+					recordData["title"] = str
+				}
+			}
+			eventTimestamp := ""
+			if segbRecord.Timestamp > 0 {
+				eventTimestamp = utils.ConvertCFAbsoluteTime(segbRecord.Timestamp)
+			}
+			writeActivity(path, eventTimestamp, recordData)
+		}
+	}
+
+	// Handoff advertisements of useractivityd and sharingd
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `(process == "useractivityd" OR process == "sharingd") AND ` +
+			`(eventMessage CONTAINS[c] "handoff" OR eventMessage CONTAINS[c] "activityType" OR eventMessage CONTAINS[c] "advertis")`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error querying unified logs: %v", err)
+		return nil
+	}
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := recordData["message"].(string)
+		lower := strings.ToLower(message)
+		recordData["source"] = "unifiedlogs"
+		recordData["direction"] = ""
+		switch {
+		case strings.Contains(lower, "receiv") || strings.Contains(lower, "incoming") || strings.Contains(lower, "from peer"):
+			recordData["direction"] = "received"
+		case strings.Contains(lower, "advertis") || strings.Contains(lower, "sending"):
+			recordData["direction"] = "advertised"
+		}
+		if match := handoffActivityTypeRegex.FindStringSubmatch(message); match != nil {
+			recordData["activity_type"] = match[1]
+		}
+		if url := handoffURLRegex.FindString(message); url != "" {
+			recordData["url"] = url
+		}
+		writeActivity("unifiedlogs", timestamp, recordData)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+// This module collects name resolution overrides:
+// - /etc/hosts: One record per hostname mapping.
+// - /etc/resolv.conf: One record per directive (nameserver, search, domain, options).
+// - /etc/resolver/*: Per-domain resolver overrides, one record per directive.
+// Each record includes the modification time of the file. Mappings of security vendor or Apple update
+// hostnames are flagged as suspicious, as blocking or redirecting them is a common defense evasion technique.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type HostsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &HostsModule{
+		Name:        "hosts",
+		Description: "Collects hosts file and resolver overrides"}
+	mod.RegisterModule(module)
+}
+
+func (m *HostsModule) GetName() string {
+	return m.Name
+}
+
+func (m *HostsModule) GetDescription() string {
+	return m.Description
+}
+
+// Hostname fragments of security vendors and Apple update/revocation services
+var suspiciousHostsKeywords = []string{
+	"swscan.apple.com", "swdist.apple.com", "swcdn.apple.com", "mesu.apple.com", "xp.apple.com",
+	"gdmf.apple.com", "ocsp.apple.com", "ocsp2.apple.com", "api.apple-cloudkit.com", "updates.cdn-apple.com",
+	"crowdstrike", "sentinelone", "sophos", "malwarebytes", "kaspersky", "eset", "symantec", "norton",
+	"mcafee", "trendmicro", "carbonblack", "cylance", "virustotal", "bitdefender", "avast", "avg.com",
+	"objective-see", "jamf", "defender", "wdcp.microsoft.com", "securitycenter", "paloaltonetworks",
+}
+
+// Default entries of /etc/hosts
+var defaultHostsEntries = map[string]bool{
+	"localhost":             true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"localhost.localdomain": true,
+}
+
+func (m *HostsModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	err = parseHostsFile("/etc/hosts", writer, params)
+	if err != nil {
+		params.Logger.Debug("Error parsing /etc/hosts: %v", err)
+	}
+
+	resolverFiles := utils.GlobPaths("/etc/resolv.conf", "/etc/resolver/*")
+	for _, resolverFile := range resolverFiles {
+		err = parseResolverFile(resolverFile, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing %s: %v", resolverFile, err)
+		}
+	}
+
+	return nil
+}
+
+func parseHostsFile(path string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	lines, mtime, err := readConfigLines(path)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip := fields[0]
+		for _, hostname := range fields[1:] {
+			recordData := make(map[string]interface{})
+			recordData["type"] = "hosts"
+			recordData["ip"] = ip
+			recordData["hostname"] = hostname
+			recordData["default_entry"] = defaultHostsEntries[strings.ToLower(hostname)]
+			recordData["suspicious"] = isSuspiciousHost(hostname)
+			recordData["file_mtime"] = mtime
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      mtime,
+				Data:                recordData,
+				SourceFile:          path,
+			}
+
+			err = writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseResolverFile(path string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	lines, mtime, err := readConfigLines(path)
+	if err != nil {
+		return err
+	}
+
+	// Files in /etc/resolver are named after the domain they apply to
+	domain := ""
+	if strings.HasPrefix(path, "/etc/resolver/") {
+		domain = filepath.Base(path)
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 1 {
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["type"] = "resolver"
+		recordData["domain"] = domain
+		recordData["directive"] = fields[0]
+		recordData["value"] = strings.Join(fields[1:], " ")
+		recordData["suspicious"] = isSuspiciousHost(domain)
+		recordData["file_mtime"] = mtime
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      mtime,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// readConfigLines returns the non-empty lines of a configuration file without comments,
+// along with the modification time of the file.
+func readConfigLines(path string) ([]string, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	mtime := info.ModTime().UTC().Format(utils.TimeFormat)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, mtime, scanner.Err()
+}
+
+func isSuspiciousHost(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	if hostname == "" || defaultHostsEntries[hostname] {
+		return false
+	}
+	for _, keyword := range suspiciousHostsKeywords {
+		if strings.Contains(hostname, keyword) {
+			return true
+		}
+	}
+	return false
+}
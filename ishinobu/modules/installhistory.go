@@ -0,0 +1,161 @@
+// This module collects the software installation history from:
+// - /Library/Receipts/InstallHistory.plist: Display name, version, package identifiers, install date and installer process.
+// - pkgutil --pkgs and pkgutil --pkg-info-plist: Package receipts with version, install location and install time.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type InstallHistoryModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &InstallHistoryModule{
+		Name:        "installhistory",
+		Description: "Collects software install history and package receipts"}
+	mod.RegisterModule(module)
+}
+
+func (m *InstallHistoryModule) GetName() string {
+	return m.Name
+}
+
+func (m *InstallHistoryModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *InstallHistoryModule) Run(params mod.ModuleParams) error {
+	err := parseInstallHistory(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting install history: %v", err)
+	}
+
+	err = parsePkgutilReceipts(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting pkgutil receipts: %v", err)
+	}
+
+	return nil
+}
+
+func parseInstallHistory(moduleName string, params mod.ModuleParams) error {
+	installHistoryPath := "/Library/Receipts/InstallHistory.plist"
+
+	var installHistory []map[string]interface{}
+	err := utils.ParsePlistFile(installHistoryPath, &installHistory)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, item := range installHistory {
+		recordData := make(map[string]interface{})
+		recordData["display_name"] = item["displayName"]
+		recordData["display_version"] = item["displayVersion"]
+		recordData["process_name"] = item["processName"]
+		recordData["content_type"] = item["contentType"]
+
+		packageIdentifiers := make([]string, 0)
+		if identifiers, ok := item["packageIdentifiers"].([]interface{}); ok {
+			for _, identifier := range identifiers {
+				packageIdentifiers = append(packageIdentifiers, fmt.Sprintf("%v", identifier))
+			}
+		}
+		recordData["package_identifiers"] = strings.Join(packageIdentifiers, ",")
+
+		installDate := params.CollectionTimestamp
+		if date, ok := item["date"].(time.Time); ok {
+			installDate = date.UTC().Format(utils.TimeFormat)
+		}
+		recordData["date"] = installDate
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      installDate,
+			Data:                recordData,
+			SourceFile:          installHistoryPath,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func parsePkgutilReceipts(moduleName string, params mod.ModuleParams) error {
+	output, err := exec.Command("pkgutil", "--pkgs").Output()
+	if err != nil {
+		return fmt.Errorf("error running pkgutil: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-pkgutil", params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, pkgID := range strings.Split(string(output), "\n") {
+		pkgID = strings.TrimSpace(pkgID)
+		if pkgID == "" {
+			continue
+		}
+
+		pkgInfo, err := exec.Command("pkgutil", "--pkg-info-plist", pkgID).Output()
+		if err != nil {
+			params.Logger.Debug("Error getting package info for %s: %v", pkgID, err)
+			continue
+		}
+
+		var info map[string]interface{}
+		if _, err := plist.Unmarshal(pkgInfo, &info); err != nil {
+			params.Logger.Debug("Error parsing package info for %s: %v", pkgID, err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["package_id"] = pkgID
+		recordData["version"] = info["pkg-version"]
+		recordData["volume"] = info["volume"]
+		recordData["install_location"] = info["install-location"]
+
+		installTime := params.CollectionTimestamp
+		if seconds, ok := info["install-time"].(uint64); ok {
+			installTime = utils.ConvertUnixTimestamp(int64(seconds))
+		}
+		recordData["install_time"] = installTime
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      installTime,
+			Data:                recordData,
+			SourceFile:          "pkgutil --pkg-info-plist " + pkgID,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+// This module parses the CoreDuet people database to build a timeline of who the user communicated with:
+//   - /private/var/db/CoreDuet/People/interactionC.db
+//   - /Users/*/Library/Application Support/Knowledge/interactionC.db
+//
+// Each interaction is emitted with its start/end dates, application, account, direction, mechanism,
+// sender and recipients (display name and identifier such as the email address or phone number).
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type InteractionCModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &InteractionCModule{
+		Name:        "interactionc",
+		Description: "Collects app-to-contact interactions from the CoreDuet interactionC.db"}
+	mod.RegisterModule(module)
+}
+
+func (m *InteractionCModule) GetName() string {
+	return m.Name
+}
+
+func (m *InteractionCModule) GetDescription() string {
+	return m.Description
+}
+
+var interactionDirections = map[int64]string{
+	0: "incoming",
+	1: "outgoing",
+}
+
+func (m *InteractionCModule) Run(params mod.ModuleParams) error {
+	dbPaths := utils.GlobPaths("/private/var/db/CoreDuet/People/interactionC.db",
+		"/Users/*/Library/Application Support/Knowledge/interactionC.db")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-interactionc")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parseInteractionC(dst, dbPath, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing interactionC database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseInteractionC(dbPath string, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	username := "system"
+	if utils.GetUsernameFromPath(sourceFile) != "" {
+		username = utils.GetUsernameFromPath(sourceFile)
+	}
+
+	// Recipients are linked to the interactions through the Z_1INTERACTIONS join table
+	query := `
+		SELECT
+			ZINTERACTIONS.ZSTARTDATE,
+			ZINTERACTIONS.ZENDDATE,
+			ZINTERACTIONS.ZBUNDLEID,
+			ZINTERACTIONS.ZTARGETBUNDLEID,
+			ZINTERACTIONS.ZACCOUNT,
+			ZINTERACTIONS.ZDIRECTION,
+			ZINTERACTIONS.ZMECHANISM,
+			ZINTERACTIONS.ZRECIPIENTCOUNT,
+			ZINTERACTIONS.ZGROUPNAME,
+			SENDER.ZDISPLAYNAME,
+			SENDER.ZIDENTIFIER,
+			(SELECT group_concat(ZCONTACTS.ZDISPLAYNAME, ', ') FROM Z_1INTERACTIONS
+				JOIN ZCONTACTS ON ZCONTACTS.Z_PK = Z_1INTERACTIONS.Z_1RECIPIENTS
+				WHERE Z_1INTERACTIONS.Z_3INTERACTIONS = ZINTERACTIONS.Z_PK),
+			(SELECT group_concat(ZCONTACTS.ZIDENTIFIER, ', ') FROM Z_1INTERACTIONS
+				JOIN ZCONTACTS ON ZCONTACTS.Z_PK = Z_1INTERACTIONS.Z_1RECIPIENTS
+				WHERE Z_1INTERACTIONS.Z_3INTERACTIONS = ZINTERACTIONS.Z_PK)
+		FROM ZINTERACTIONS
+		LEFT JOIN ZCONTACTS SENDER ON SENDER.Z_PK = ZINTERACTIONS.ZSENDER`
+	baseQuery := `
+		SELECT
+			ZINTERACTIONS.ZSTARTDATE,
+			ZINTERACTIONS.ZENDDATE,
+			ZINTERACTIONS.ZBUNDLEID,
+			ZINTERACTIONS.ZTARGETBUNDLEID,
+			ZINTERACTIONS.ZACCOUNT,
+			ZINTERACTIONS.ZDIRECTION,
+			ZINTERACTIONS.ZMECHANISM,
+			ZINTERACTIONS.ZRECIPIENTCOUNT,
+			ZINTERACTIONS.ZGROUPNAME,
+			SENDER.ZDISPLAYNAME,
+			SENDER.ZIDENTIFIER,
+			NULL,
+			NULL
+		FROM ZINTERACTIONS
+		LEFT JOIN ZCONTACTS SENDER ON SENDER.Z_PK = ZINTERACTIONS.ZSENDER`
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to base interactionC query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, baseQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bundleID, targetBundleID, account, groupName, senderName, senderID, recipientNames, recipientIDs sql.NullString
+		var startDate, endDate sql.NullFloat64
+		var direction, mechanism, recipientCount sql.NullInt64
+		err := rows.Scan(&startDate, &endDate, &bundleID, &targetBundleID, &account, &direction, &mechanism,
+			&recipientCount, &groupName, &senderName, &senderID, &recipientNames, &recipientIDs)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["start_time"] = ""
+		if startDate.Valid {
+			recordData["start_time"] = utils.ConvertCFAbsoluteTime(startDate.Float64)
+		}
+		recordData["end_time"] = ""
+		if endDate.Valid {
+			recordData["end_time"] = utils.ConvertCFAbsoluteTime(endDate.Float64)
+		}
+		recordData["bundle_id"] = bundleID.String
+		recordData["target_bundle_id"] = targetBundleID.String
+		recordData["account"] = account.String
+		recordData["direction"] = interactionDirections[direction.Int64]
+		recordData["mechanism"] = mechanism.Int64
+		recordData["recipient_count"] = recipientCount.Int64
+		recordData["group_name"] = groupName.String
+		recordData["sender_name"] = senderName.String
+		recordData["sender_id"] = senderID.String
+		recordData["recipient_names"] = recipientNames.String
+		recordData["recipient_ids"] = recipientIDs.String
+
+		eventTimestamp := recordData["start_time"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
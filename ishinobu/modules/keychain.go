@@ -0,0 +1,236 @@
+// This module lists the items stored in the keychains without extracting any secret:
+// - /Library/Keychains/System.keychain
+// - /Users/*/Library/Keychains/*.keychain-db and *.keychain
+// Each keychain is dumped with `security dump-keychain -a` (attributes and access control lists, never -d),
+// and every item is emitted with its class, label, service, account, server, creation/modification dates
+// and the applications allowed to access it.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type KeychainModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &KeychainModule{
+		Name:        "keychain",
+		Description: "Lists keychain items metadata (class, labels, services, dates, ACL applications) without secrets"}
+	mod.RegisterModule(module)
+}
+
+func (m *KeychainModule) GetName() string {
+	return m.Name
+}
+
+func (m *KeychainModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	keychainClasses = map[string]string{
+		"genp":       "generic_password",
+		"inet":       "internet_password",
+		"0x80001000": "certificate",
+		"0x0000000F": "public_key",
+		"0x00000010": "private_key",
+		"0x00000011": "symmetric_key",
+	}
+	// Keychain attribute names, both as four character codes and as numeric identifiers of key items
+	keychainAttributes = map[string]string{
+		"labl":       "label",
+		"0x00000001": "label",
+		"svce":       "service",
+		"acct":       "account",
+		"srvr":       "server",
+		"ptcl":       "protocol",
+		"port":       "port",
+		"path":       "path",
+		"desc":       "description",
+		"cdat":       "creation_time",
+		"mdat":       "modification_time",
+		"0x00000007": "label",
+	}
+	// "acct"<blob>="user" or 0x00000007 <blob>=0x616263  "abc"
+	keychainAttributeRegex = regexp.MustCompile(`^(?:"(\w{4})"|(0x[0-9A-F]{8})) ?<\w+>=(.*)$`)
+	keychainQuotedRegex    = regexp.MustCompile(`"(.*)"$`)
+	keychainDateRegex      = regexp.MustCompile(`(\d{14})Z`)
+	keychainAppRegex       = regexp.MustCompile(`^\d+: (.+?)(?: \((?:OK|status -?\d+)\))?$`)
+)
+
+func (m *KeychainModule) Run(params mod.ModuleParams) error {
+	paths := utils.GlobPaths("/Library/Keychains/System.keychain",
+		"/Users/*/Library/Keychains/*.keychain-db",
+		"/Users/*/Library/Keychains/*.keychain")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, path := range paths {
+		// Never pass -d, it would decrypt and print the secrets
+		output, err := exec.Command("security", "dump-keychain", "-a", path).Output()
+		if err != nil {
+			params.Logger.Debug("Error dumping keychain %s: %v", path, err)
+			continue
+		}
+
+		username := "system"
+		if strings.HasPrefix(path, "/Users/") {
+			username = utils.GetUsernameFromPath(path)
+		}
+
+		for _, item := range parseKeychainDump(string(output)) {
+			item["username"] = username
+			item["keychain"] = path
+
+			eventTimestamp, _ := item["modification_time"].(string)
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                item,
+				SourceFile:          path,
+			}
+
+			err := writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseKeychainDump splits the output of `security dump-keychain -a` into one map per item
+func parseKeychainDump(output string) []map[string]interface{} {
+	var items []map[string]interface{}
+	var item map[string]interface{}
+	var applications []string
+	inApplications := false
+
+	flush := func() {
+		if item != nil {
+			item["applications"] = strings.Join(applications, ", ")
+			items = append(items, item)
+		}
+		item = nil
+		applications = nil
+		inApplications = false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "keychain: ") {
+			flush()
+			item = map[string]interface{}{
+				"class":             "",
+				"label":             "",
+				"service":           "",
+				"account":           "",
+				"server":            "",
+				"creation_time":     "",
+				"modification_time": "",
+			}
+			continue
+		}
+		if item == nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "class: "):
+			class := strings.Trim(strings.TrimPrefix(line, "class: "), `"`)
+			if name, ok := keychainClasses[class]; ok {
+				class = name
+			}
+			item["class"] = class
+			continue
+		case strings.HasPrefix(line, "applications ("):
+			inApplications = true
+			continue
+		case strings.HasPrefix(line, "entry ") || strings.HasPrefix(line, "access:"):
+			inApplications = false
+			continue
+		}
+
+		if inApplications {
+			if match := keychainAppRegex.FindStringSubmatch(line); match != nil {
+				applications = append(applications, match[1])
+				continue
+			}
+			inApplications = false
+		}
+
+		match := keychainAttributeRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		attribute := match[1]
+		if attribute == "" {
+			attribute = match[2]
+		}
+		field, ok := keychainAttributes[attribute]
+		if !ok {
+			continue
+		}
+
+		value := keychainAttributeValue(match[3])
+		if field == "creation_time" || field == "modification_time" {
+			value = keychainDate(match[3])
+		}
+		// The label may be present both as labl and as a numeric attribute, keep the first one set
+		if existing, _ := item[field].(string); existing != "" && value == "" {
+			continue
+		}
+		item[field] = value
+	}
+	flush()
+
+	return items
+}
+
+// keychainAttributeValue returns the printable value of an attribute: the quoted string when present
+func keychainAttributeValue(value string) string {
+	if value == "<NULL>" {
+		return ""
+	}
+	if match := keychainQuotedRegex.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+	return value
+}
+
+// keychainDate converts a keychain timedate attribute ("20240101120000Z\000") to TimeFormat
+func keychainDate(value string) string {
+	match := keychainDateRegex.FindStringSubmatch(value)
+	if match == nil {
+		return ""
+	}
+	t, err := time.Parse("20060102150405", match[1])
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(utils.TimeFormat)
+}
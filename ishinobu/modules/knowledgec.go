@@ -0,0 +1,194 @@
+// This module collects and parses the KnowledgeC databases used by CoreDuet to record usage activity:
+// - /private/var/db/CoreDuet/Knowledge/knowledgeC.db
+// - /Users/*/Library/Application Support/Knowledge/knowledgeC.db
+// The databases are copied to a temporary folder before being queried.
+// Streams collected:
+// - /app/usage, /app/inFocus: Application usage.
+// - /app/webUsage, /safari/history: Web usage.
+// - /device/isLocked: Device lock and unlock.
+// - /display/isBacklit: Display backlight on and off.
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type KnowledgeCModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &KnowledgeCModule{
+		Name:        "knowledgec",
+		Description: "Collects and parses application usage, device lock, backlight and web usage from KnowledgeC databases"}
+	mod.RegisterModule(module)
+}
+
+func (m *KnowledgeCModule) GetName() string {
+	return m.Name
+}
+
+func (m *KnowledgeCModule) GetDescription() string {
+	return m.Description
+}
+
+const knowledgeCStreams = "'/app/usage', '/app/inFocus', '/app/webUsage', '/safari/history', '/device/isLocked', '/display/isBacklit'"
+
+func (m *KnowledgeCModule) Run(params mod.ModuleParams) error {
+	paths := []string{"/private/var/db/CoreDuet/Knowledge/knowledgeC.db",
+		"/Users/*/Library/Application Support/Knowledge/knowledgeC.db"}
+	var dbPaths []string
+	for _, path := range paths {
+		expandedPath, err := filepath.Glob(path)
+		if err != nil {
+			continue
+		}
+		dbPaths = append(dbPaths, expandedPath...)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-knowledgec")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		username := "system"
+		if strings.HasPrefix(dbPath, "/Users/") {
+			username = utils.GetUsernameFromPath(dbPath)
+		}
+
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parseKnowledgeC(dst, dbPath, username, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing KnowledgeC database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseKnowledgeC(dbPath string, sourceFile string, username string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	// The structured metadata columns holding web usage details are not present in every macOS version,
+	// so fall back to the base query when they are missing.
+	query := `
+		SELECT
+			ZOBJECT.ZSTREAMNAME,
+			ZOBJECT.ZVALUESTRING,
+			ZOBJECT.ZVALUEINTEGER,
+			ZOBJECT.ZSTARTDATE,
+			ZOBJECT.ZENDDATE,
+			ZOBJECT.ZCREATIONDATE,
+			ZSOURCE.ZBUNDLEID,
+			ZSTRUCTUREDMETADATA.Z_DKDIGITALHEALTHMETADATAKEY__WEBDOMAIN,
+			ZSTRUCTUREDMETADATA.Z_DKDIGITALHEALTHMETADATAKEY__WEBPAGEURL
+		FROM ZOBJECT
+			LEFT JOIN ZSTRUCTUREDMETADATA ON ZOBJECT.ZSTRUCTUREDMETADATA = ZSTRUCTUREDMETADATA.Z_PK
+			LEFT JOIN ZSOURCE ON ZOBJECT.ZSOURCE = ZSOURCE.Z_PK
+		WHERE ZOBJECT.ZSTREAMNAME IN (` + knowledgeCStreams + `)
+		ORDER BY ZOBJECT.ZSTARTDATE`
+	baseQuery := `
+		SELECT
+			ZOBJECT.ZSTREAMNAME,
+			ZOBJECT.ZVALUESTRING,
+			ZOBJECT.ZVALUEINTEGER,
+			ZOBJECT.ZSTARTDATE,
+			ZOBJECT.ZENDDATE,
+			ZOBJECT.ZCREATIONDATE,
+			ZSOURCE.ZBUNDLEID,
+			NULL,
+			NULL
+		FROM ZOBJECT
+			LEFT JOIN ZSOURCE ON ZOBJECT.ZSOURCE = ZSOURCE.Z_PK
+		WHERE ZOBJECT.ZSTREAMNAME IN (` + knowledgeCStreams + `)
+		ORDER BY ZOBJECT.ZSTARTDATE`
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to base KnowledgeC query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, baseQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var streamName, valueString, bundleID, webDomain, webURL sql.NullString
+		var valueInteger sql.NullInt64
+		var startDate, endDate, creationDate sql.NullFloat64
+		err := rows.Scan(&streamName, &valueString, &valueInteger, &startDate, &endDate, &creationDate, &bundleID, &webDomain, &webURL)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["stream"] = streamName.String
+		recordData["value"] = valueString.String
+		recordData["value_integer"] = valueInteger.Int64
+		recordData["start_time"] = utils.ConvertCFAbsoluteTime(startDate.Float64)
+		recordData["end_time"] = utils.ConvertCFAbsoluteTime(endDate.Float64)
+		recordData["creation_time"] = utils.ConvertCFAbsoluteTime(creationDate.Float64)
+		recordData["duration_seconds"] = endDate.Float64 - startDate.Float64
+		recordData["bundle_id"] = bundleID.String
+		recordData["web_domain"] = webDomain.String
+		recordData["web_url"] = webURL.String
+
+		switch streamName.String {
+		case "/device/isLocked":
+			recordData["state"] = knowledgeCState(valueInteger.Int64, "locked", "unlocked")
+		case "/display/isBacklit":
+			recordData["state"] = knowledgeCState(valueInteger.Int64, "on", "off")
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      recordData["start_time"].(string),
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func knowledgeCState(value int64, enabled string, disabled string) string {
+	if value == 1 {
+		return enabled
+	}
+	return disabled
+}
@@ -0,0 +1,263 @@
+// This module inventories the packages installed globally through language package managers,
+// where supply-chain implants can persist:
+//   - npm: global node_modules of Homebrew, /usr/local, nvm and the npm prefix of each user (package.json).
+//   - pip: user and system site-packages (*.dist-info/METADATA) and pipx virtual environments.
+//   - Ruby gems: system, Homebrew and per-user gem specifications.
+//   - Executable shims and scripts in the bin folders these managers add to PATH
+//     (~/.local/bin, pyenv/rbenv shims, gem and Python user bin folders, npm global bin).
+//
+// Entries modified within the window are flagged. The window defaults to the last 30 days and can be changed
+// in <InputDir>/langpackages.json ({"days": N}).
+package modules
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type LangPackagesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &LangPackagesModule{
+		Name:        "langpackages",
+		Description: "Inventories global npm, pip/pipx and Ruby gem packages and their bin shims"}
+	mod.RegisterModule(module)
+}
+
+func (m *LangPackagesModule) GetName() string {
+	return m.Name
+}
+
+func (m *LangPackagesModule) GetDescription() string {
+	return m.Description
+}
+
+// LangPackagesConfig is the configuration of the langpackages module
+type LangPackagesConfig struct {
+	Days int `json:"days"`
+}
+
+var (
+	npmGlobalPaths = []string{
+		"/opt/homebrew/lib/node_modules",
+		"/usr/local/lib/node_modules",
+		"/Users/*/.nvm/versions/node/*/lib/node_modules",
+		"/Users/*/.npm-global/lib/node_modules",
+		"/Users/*/.volta/tools/image/packages/*/lib/node_modules",
+	}
+	pipSitePackagesPaths = []string{
+		"/Library/Python/*/site-packages",
+		"/Users/*/Library/Python/*/lib/python/site-packages",
+		"/Users/*/.local/lib/python*/site-packages",
+		"/opt/homebrew/lib/python*/site-packages",
+		"/usr/local/lib/python*/site-packages",
+	}
+	gemSpecificationPaths = []string{
+		"/Library/Ruby/Gems/*/specifications",
+		"/opt/homebrew/lib/ruby/gems/*/specifications",
+		"/usr/local/lib/ruby/gems/*/specifications",
+		"/Users/*/.gem/ruby/*/specifications",
+		"/Users/*/.local/share/gem/ruby/*/specifications",
+	}
+	shimPaths = []string{
+		"/Users/*/.local/bin",
+		"/Users/*/.pyenv/shims",
+		"/Users/*/.rbenv/shims",
+		"/Users/*/.gem/ruby/*/bin",
+		"/Users/*/Library/Python/*/bin",
+		"/Users/*/.npm-global/bin",
+		"/Users/*/.nvm/versions/node/*/bin",
+		"/Library/Ruby/Gems/*/bin",
+	}
+)
+
+func (m *LangPackagesModule) Run(params mod.ModuleParams) error {
+	config := LangPackagesConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+	windowStart := time.Now().AddDate(0, 0, -config.Days)
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writePackage := func(path string, recordData map[string]interface{}) {
+		recordData["path"] = path
+		recordData["username"] = utils.GetUsernameFromPath(path)
+		recordData["modification_time"] = ""
+		recordData["recently_modified"] = false
+		eventTimestamp := params.CollectionTimestamp
+		if info, err := os.Lstat(path); err == nil {
+			eventTimestamp = info.ModTime().UTC().Format(utils.TimeFormat)
+			recordData["modification_time"] = eventTimestamp
+			recordData["recently_modified"] = info.ModTime().After(windowStart)
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// npm global packages, including scoped packages (@scope/name)
+	for _, modulesDir := range utils.GlobPaths(npmGlobalPaths...) {
+		for _, packageJSON := range utils.GlobPaths(filepath.Join(modulesDir, "*", "package.json"),
+			filepath.Join(modulesDir, "@*", "*", "package.json")) {
+			data, err := os.ReadFile(packageJSON)
+			if err != nil {
+				continue
+			}
+			var manifest struct {
+				Name    string            `json:"name"`
+				Version string            `json:"version"`
+				Scripts map[string]string `json:"scripts"`
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				params.Logger.Debug("Error parsing %s: %v", packageJSON, err)
+				continue
+			}
+			writePackage(filepath.Dir(packageJSON), map[string]interface{}{
+				"manager": "npm",
+				"type":    "package",
+				"name":    manifest.Name,
+				"version": manifest.Version,
+				"install_hooks": strings.TrimSpace(manifest.Scripts["preinstall"] + " " +
+					manifest.Scripts["install"] + " " + manifest.Scripts["postinstall"]),
+			})
+		}
+	}
+
+	// pip site-packages
+	for _, sitePackages := range utils.GlobPaths(pipSitePackagesPaths...) {
+		for _, distInfo := range utils.GlobPaths(filepath.Join(sitePackages, "*.dist-info"), filepath.Join(sitePackages, "*.egg-info")) {
+			name, version := pythonPackageMetadata(distInfo)
+			writePackage(distInfo, map[string]interface{}{
+				"manager": "pip",
+				"type":    "package",
+				"name":    name,
+				"version": version,
+			})
+		}
+	}
+
+	// pipx virtual environments
+	for _, metadataPath := range utils.GlobPaths("/Users/*/.local/pipx/venvs/*/pipx_metadata.json",
+		"/Users/*/.local/share/pipx/venvs/*/pipx_metadata.json") {
+		data, err := os.ReadFile(metadataPath)
+		if err != nil {
+			continue
+		}
+		var metadata struct {
+			MainPackage struct {
+				Package        string `json:"package"`
+				PackageVersion string `json:"package_version"`
+				PackageOrURL   string `json:"package_or_url"`
+			} `json:"main_package"`
+		}
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", metadataPath, err)
+			continue
+		}
+		writePackage(filepath.Dir(metadataPath), map[string]interface{}{
+			"manager": "pipx",
+			"type":    "package",
+			"name":    metadata.MainPackage.Package,
+			"version": metadata.MainPackage.PackageVersion,
+			"source":  metadata.MainPackage.PackageOrURL,
+		})
+	}
+
+	// Ruby gems, named <name>-<version>.gemspec
+	for _, specifications := range utils.GlobPaths(gemSpecificationPaths...) {
+		for _, gemspec := range utils.GlobPaths(filepath.Join(specifications, "*.gemspec")) {
+			name := strings.TrimSuffix(filepath.Base(gemspec), ".gemspec")
+			version := ""
+			if index := strings.LastIndex(name, "-"); index > 0 {
+				name, version = name[:index], name[index+1:]
+			}
+			writePackage(gemspec, map[string]interface{}{
+				"manager": "gem",
+				"type":    "package",
+				"name":    name,
+				"version": version,
+			})
+		}
+	}
+
+	// Shims and scripts in the bin folders added to PATH
+	for _, binDir := range utils.GlobPaths(shimPaths...) {
+		entries, err := os.ReadDir(binDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(binDir, entry.Name())
+			target, _ := os.Readlink(path)
+			writePackage(path, map[string]interface{}{
+				"manager": "shim",
+				"type":    "executable",
+				"name":    entry.Name(),
+				"target":  target,
+			})
+		}
+	}
+
+	return nil
+}
+
+// pythonPackageMetadata returns the name and version of a *.dist-info or *.egg-info folder
+func pythonPackageMetadata(infoDir string) (string, string) {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(infoDir), ".dist-info"), ".egg-info")
+	version := ""
+	if index := strings.Index(name, "-"); index > 0 {
+		name, version = name[:index], name[index+1:]
+	}
+
+	for _, metadataName := range []string{"METADATA", "PKG-INFO"} {
+		file, err := os.Open(filepath.Join(infoDir, metadataName))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				break
+			}
+			if value, found := strings.CutPrefix(line, "Name: "); found {
+				name = value
+			} else if value, found := strings.CutPrefix(line, "Version: "); found {
+				version = value
+			}
+		}
+		file.Close()
+		break
+	}
+
+	return name, version
+}
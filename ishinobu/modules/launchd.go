@@ -0,0 +1,293 @@
+// This module collects the runtime state of launchd:
+// - launchctl print system and launchctl print gui/<uid> for each user: Loaded services with PID and last exit status.
+// - launchctl print-disabled: Services disabled in each domain.
+// - LaunchAgents and LaunchDaemons plists on disk: Label and program path.
+// - Services embedded in bundles: SMAppService plists (Contents/Library/LaunchAgents|LaunchDaemons), privileged
+// helpers (Contents/Library/LaunchServices) and XPC services (XPCServices/*.xpc).
+// Loaded services are compared against the plists on disk to reveal services loaded only in memory
+// and services loaded even though they are disabled. Services missing from the plists found on disk are looked up
+// with launchctl print <domain>/<label>, and only flagged as loaded in memory when the path of their definition
+// reported by launchd does not exist either. Applications launched by the user (application.* labels) are backed
+// by their bundle and never flagged.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type LaunchdModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &LaunchdModule{
+		Name:        "launchd",
+		Description: "Collects launchd loaded services and compares them with launch plists on disk"}
+	mod.RegisterModule(module)
+}
+
+func (m *LaunchdModule) GetName() string {
+	return m.Name
+}
+
+func (m *LaunchdModule) GetDescription() string {
+	return m.Description
+}
+
+// launchdPlist is a launch agent or daemon configuration file found on disk
+type launchdPlist struct {
+	Path    string
+	Program string
+}
+
+var launchdPlistPaths = []string{
+	"/System/Library/LaunchDaemons/*.plist",
+	"/Library/LaunchDaemons/*.plist",
+	"/System/Library/LaunchAgents/*.plist",
+	"/Library/LaunchAgents/*.plist",
+	"/Users/*/Library/LaunchAgents/*.plist",
+	"/private/var/*/Library/LaunchAgents/*.plist",
+}
+
+// Applications embedding launchd services
+var launchdBundlePaths = []string{
+	"/Applications/*.app",
+	"/Applications/*/*.app",
+	"/System/Applications/*.app",
+	"/Users/*/Applications/*.app",
+}
+
+// XPC services of the system frameworks, in addition to those of the applications
+var launchdXPCServicePaths = []string{
+	"/System/Library/Frameworks/*.framework/XPCServices/*.xpc",
+	"/System/Library/Frameworks/*.framework/Versions/*/XPCServices/*.xpc",
+	"/System/Library/PrivateFrameworks/*.framework/XPCServices/*.xpc",
+	"/System/Library/PrivateFrameworks/*.framework/Versions/*/XPCServices/*.xpc",
+	"/Library/Frameworks/*.framework/XPCServices/*.xpc",
+	"/Library/Frameworks/*.framework/Versions/*/XPCServices/*.xpc",
+}
+
+var (
+	launchdDisabledRegex = regexp.MustCompile(`^"(.+)" => (\S+)$`)
+	launchdProgramRegex  = regexp.MustCompile(`(?m)^\s*program = (.+)$`)
+	launchdPathRegex     = regexp.MustCompile(`(?m)^\s*path = (.+)$`)
+)
+
+func (m *LaunchdModule) Run(params mod.ModuleParams) error {
+	onDisk := parseLaunchdPlists(params)
+
+	domains := []string{"system"}
+	for _, home := range utils.GlobPaths("/Users/*") {
+		info, err := os.Stat(home)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid >= 500 {
+			domains = append(domains, fmt.Sprintf("gui/%d", stat.Uid))
+		}
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, domain := range domains {
+		output, err := exec.Command("launchctl", "print", domain).Output()
+		if err != nil {
+			params.Logger.Debug("Error running launchctl print %s: %v", domain, err)
+			continue
+		}
+
+		disabled := launchdDisabledServices(domain, params)
+
+		for _, service := range parseLaunchctlServices(string(output)) {
+			label := service[2]
+			plist, found := onDisk[label]
+
+			program := plist.Program
+			if !found && strings.HasPrefix(label, "application.") {
+				found = true
+			} else if !found {
+				// Services without a plist found on disk are described by launchd itself, with the path
+				// of the plist or bundle they were loaded from
+				details, err := exec.Command("launchctl", "print", domain+"/"+label).Output()
+				if err != nil {
+					params.Logger.Debug("Error running launchctl print %s/%s: %v", domain, label, err)
+				}
+				if match := launchdProgramRegex.FindStringSubmatch(string(details)); len(match) == 2 {
+					program = strings.TrimSpace(match[1])
+				}
+				if match := launchdPathRegex.FindStringSubmatch(string(details)); len(match) == 2 {
+					plist.Path = strings.TrimSpace(match[1])
+					if _, err := os.Stat(plist.Path); err == nil {
+						found = true
+					}
+				}
+			}
+
+			recordData := make(map[string]interface{})
+			recordData["domain"] = domain
+			recordData["label"] = label
+			recordData["pid"] = service[0]
+			recordData["running"] = service[0] != "0" && service[0] != "-"
+			recordData["last_exit_status"] = service[1]
+			recordData["program"] = program
+			recordData["plist_path"] = plist.Path
+			recordData["in_memory_only"] = !found
+			recordData["disabled_but_loaded"] = disabled[label]
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      params.CollectionTimestamp,
+				Data:                recordData,
+				SourceFile:          "launchctl print " + domain,
+			}
+
+			err = writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseLaunchctlServices returns the PID, last exit status and label of each service listed
+// in the services block of launchctl print.
+func parseLaunchctlServices(output string) [][3]string {
+	var services [][3]string
+	inServices := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "services = {" {
+			inServices = true
+			continue
+		}
+		if !inServices {
+			continue
+		}
+		if line == "}" {
+			break
+		}
+
+		cols := strings.Fields(line)
+		if len(cols) < 3 {
+			continue
+		}
+		services = append(services, [3]string{cols[0], cols[1], cols[len(cols)-1]})
+	}
+	return services
+}
+
+// launchdDisabledServices returns the services marked as disabled in a domain
+func launchdDisabledServices(domain string, params mod.ModuleParams) map[string]bool {
+	disabled := make(map[string]bool)
+	output, err := exec.Command("launchctl", "print-disabled", domain).Output()
+	if err != nil {
+		params.Logger.Debug("Error running launchctl print-disabled %s: %v", domain, err)
+		return disabled
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		match := launchdDisabledRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if len(match) == 3 && (match[2] == "disabled" || match[2] == "true") {
+			disabled[match[1]] = true
+		}
+	}
+	return disabled
+}
+
+// parseLaunchdPlists returns the launch agents and daemons found on disk indexed by label
+func parseLaunchdPlists(params mod.ModuleParams) map[string]launchdPlist {
+	plists := make(map[string]launchdPlist)
+	for _, path := range utils.GlobPaths(launchdPlistPaths...) {
+		var content map[string]interface{}
+		if err := utils.ParsePlistFile(path, &content); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+
+		label, ok := content["Label"].(string)
+		if !ok {
+			label = strings.TrimSuffix(filepath.Base(path), ".plist")
+		}
+
+		program, _ := content["Program"].(string)
+		if program == "" {
+			if args, ok := content["ProgramArguments"].([]interface{}); ok && len(args) > 0 {
+				program = fmt.Sprintf("%v", args[0])
+			}
+		}
+
+		plists[label] = launchdPlist{Path: path, Program: program}
+	}
+
+	var xpcServices []string
+	for _, bundle := range utils.GlobPaths(launchdBundlePaths...) {
+		for _, path := range utils.GlobPaths(
+			filepath.Join(bundle, "Contents/Library/LaunchAgents/*.plist"),
+			filepath.Join(bundle, "Contents/Library/LaunchDaemons/*.plist")) {
+			var content map[string]interface{}
+			if err := utils.ParsePlistFile(path, &content); err != nil {
+				params.Logger.Debug("Error parsing %s: %v", path, err)
+				continue
+			}
+			label, ok := content["Label"].(string)
+			if !ok {
+				label = strings.TrimSuffix(filepath.Base(path), ".plist")
+			}
+			program, _ := content["Program"].(string)
+			if program == "" {
+				program, _ = content["BundleProgram"].(string)
+				if program != "" {
+					program = filepath.Join(bundle, program)
+				}
+			}
+			plists[label] = launchdPlist{Path: path, Program: program}
+		}
+
+		// Privileged helpers are named after their label and embed their launchd plist
+		for _, path := range utils.GlobPaths(filepath.Join(bundle, "Contents/Library/LaunchServices/*")) {
+			plists[filepath.Base(path)] = launchdPlist{Path: path, Program: path}
+		}
+
+		xpcServices = append(xpcServices, utils.GlobPaths(filepath.Join(bundle, "Contents/XPCServices/*.xpc"))...)
+	}
+
+	// XPC services are loaded with their bundle identifier as label
+	for _, path := range append(xpcServices, utils.GlobPaths(launchdXPCServicePaths...)...) {
+		infoPath := filepath.Join(path, "Contents/Info.plist")
+		if _, err := os.Stat(infoPath); err != nil {
+			infoPath = filepath.Join(path, "Info.plist")
+		}
+		var content map[string]interface{}
+		if err := utils.ParsePlistFile(infoPath, &content); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", infoPath, err)
+			continue
+		}
+		label, ok := content["CFBundleIdentifier"].(string)
+		if !ok {
+			continue
+		}
+		program := ""
+		if executable, ok := content["CFBundleExecutable"].(string); ok {
+			program = filepath.Join(path, "Contents/MacOS", executable)
+		}
+		plists[label] = launchdPlist{Path: path, Program: program}
+	}
+	return plists
+}
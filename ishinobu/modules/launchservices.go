@@ -0,0 +1,269 @@
+// This module collects the LaunchServices handlers and URL scheme registrations:
+//   - /Users/*/Library/Preferences/com.apple.LaunchServices/com.apple.launchservices.secure.plist:
+//     default handlers chosen by each user for URL schemes and content types (LSHandlers).
+//     Handlers of sensitive schemes (mailto, http, https, ...) pointing to non-Apple applications are flagged.
+//   - lsregister -dump: URL schemes claimed by every registered application along with its registration date.
+//     Schemes claimed by non-Apple applications registered in the last 30 days are flagged.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type LaunchServicesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &LaunchServicesModule{
+		Name:        "launchservices",
+		Description: "Collects LaunchServices default handlers and URL scheme claims, flagging non-Apple handlers"}
+	mod.RegisterModule(module)
+}
+
+func (m *LaunchServicesModule) GetName() string {
+	return m.Name
+}
+
+func (m *LaunchServicesModule) GetDescription() string {
+	return m.Description
+}
+
+const lsregisterPath = "/System/Library/Frameworks/CoreServices.framework/Versions/A/Frameworks/LaunchServices.framework/Versions/A/Support/lsregister"
+
+// Applications registered in the last launchServicesRecentDays days are considered recently installed
+const launchServicesRecentDays = 30
+
+// Schemes commonly abused to intercept links, credentials or documents
+var sensitiveURLSchemes = map[string]bool{
+	"mailto": true,
+	"http":   true,
+	"https":  true,
+	"ftp":    true,
+	"ssh":    true,
+	"smb":    true,
+	"afp":    true,
+	"vnc":    true,
+	"file":   true,
+	"tel":    true,
+}
+
+var (
+	lsregisterFieldRegex  = regexp.MustCompile(`^([a-zA-Z ]+):\s+(.*)$`)
+	lsregisterPathIDRegex = regexp.MustCompile(`\s+\(0x[0-9a-f]+\)$`)
+	lsregisterDateLayouts = []string{
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05.999999 -0700",
+		"2006-01-02 15:04:05",
+		"01/02/2006 15:04:05",
+	}
+)
+
+func (m *LaunchServicesModule) Run(params mod.ModuleParams) error {
+	err := parseLaunchServicesHandlers(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error collecting LaunchServices handlers: %v", err)
+	}
+
+	err = parseLsregisterDump(m.GetName()+"-schemes", params)
+	if err != nil {
+		params.Logger.Debug("Error collecting lsregister claims: %v", err)
+	}
+
+	return nil
+}
+
+func parseLaunchServicesHandlers(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.LaunchServices/com.apple.launchservices.secure.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+
+		handlers, _ := preferences["LSHandlers"].([]interface{})
+		for _, value := range handlers {
+			handler, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			scheme, _ := handler["LSHandlerURLScheme"].(string)
+			contentType, _ := handler["LSHandlerContentType"].(string)
+
+			bundleID := ""
+			for _, role := range []string{"LSHandlerRoleAll", "LSHandlerRoleViewer", "LSHandlerRoleEditor", "LSHandlerRoleShell"} {
+				if id, ok := handler[role].(string); ok && id != "-" {
+					bundleID = id
+					break
+				}
+			}
+
+			nonApple := bundleID != "" && !strings.HasPrefix(strings.ToLower(bundleID), "com.apple.")
+
+			recordData := make(map[string]interface{})
+			recordData["username"] = utils.GetUsernameFromPath(path)
+			recordData["url_scheme"] = scheme
+			recordData["content_type"] = contentType
+			recordData["handler"] = bundleID
+			recordData["role_all"] = handler["LSHandlerRoleAll"]
+			recordData["role_viewer"] = handler["LSHandlerRoleViewer"]
+			recordData["role_editor"] = handler["LSHandlerRoleEditor"]
+			recordData["non_apple_handler"] = nonApple
+			recordData["suspicious"] = nonApple && sensitiveURLSchemes[strings.ToLower(scheme)]
+
+			eventTimestamp := fileModTime(path)
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          path,
+			}
+
+			err := writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lsregisterBundle holds the fields of a bundle block of `lsregister -dump`
+type lsregisterBundle struct {
+	Path       string
+	Identifier string
+	RegDate    string
+	Schemes    []string
+}
+
+func parseLsregisterDump(moduleName string, params mod.ModuleParams) error {
+	output, err := exec.Command(lsregisterPath, "-dump").Output()
+	if err != nil {
+		return fmt.Errorf("error running lsregister: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	recentLimit := time.Now().UTC().AddDate(0, 0, -launchServicesRecentDays)
+
+	writeBundle := func(bundle lsregisterBundle) {
+		if len(bundle.Schemes) == 0 {
+			return
+		}
+
+		nonApple := bundle.Identifier != "" && !strings.HasPrefix(strings.ToLower(bundle.Identifier), "com.apple.")
+		recent := false
+		if regDate, err := time.Parse(utils.TimeFormat, bundle.RegDate); err == nil {
+			recent = regDate.After(recentLimit)
+		}
+
+		for _, scheme := range bundle.Schemes {
+			recordData := make(map[string]interface{})
+			recordData["url_scheme"] = scheme
+			recordData["bundle_id"] = bundle.Identifier
+			recordData["path"] = bundle.Path
+			recordData["registration_time"] = bundle.RegDate
+			recordData["non_apple_handler"] = nonApple
+			recordData["recently_registered"] = recent
+			recordData["suspicious"] = nonApple && (recent || sensitiveURLSchemes[strings.ToLower(scheme)])
+
+			eventTimestamp := bundle.RegDate
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          "lsregister -dump",
+			}
+
+			err := writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	// Blocks are separated by lines of dashes; bundle blocks contain the path, identifier,
+	// registration date and the claimed schemes of the application.
+	var bundle lsregisterBundle
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "--------") {
+			writeBundle(bundle)
+			bundle = lsregisterBundle{}
+			continue
+		}
+
+		match := lsregisterFieldRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value := strings.TrimSpace(match[2])
+		switch strings.TrimSpace(match[1]) {
+		case "path":
+			if bundle.Path == "" {
+				bundle.Path = strings.TrimSpace(lsregisterPathIDRegex.ReplaceAllString(value, ""))
+			}
+		case "identifier", "bundle id":
+			if bundle.Identifier == "" {
+				bundle.Identifier = strings.TrimSpace(strings.Split(value, " (")[0])
+			}
+		case "reg date":
+			bundle.RegDate = parseLsregisterDate(value)
+		case "claimed schemes", "schemes":
+			for _, scheme := range strings.Split(value, ",") {
+				scheme = strings.TrimSuffix(strings.TrimSpace(scheme), ":")
+				if scheme != "" {
+					bundle.Schemes = append(bundle.Schemes, scheme)
+				}
+			}
+		}
+	}
+	writeBundle(bundle)
+
+	return scanner.Err()
+}
+
+// parseLsregisterDate converts the registration date printed by lsregister to TimeFormat
+func parseLsregisterDate(value string) string {
+	// Some versions append the raw value in parentheses
+	value = strings.TrimSpace(strings.Split(value, " (")[0])
+	for _, layout := range lsregisterDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(utils.TimeFormat)
+		}
+	}
+	return ""
+}
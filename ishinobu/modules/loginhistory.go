@@ -0,0 +1,220 @@
+// This module collects the login, logout, reboot and shutdown history:
+// - /var/run/utmpx: Parsed natively, contains the current sessions and boot records.
+// - last: Session history kept by the system (wtmp equivalent stored in ASL), including duration.
+// Each record contains the user, tty, remote host, event type and timestamps.
+package modules
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type LoginHistoryModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &LoginHistoryModule{
+		Name:        "loginhistory",
+		Description: "Collects login, logout, reboot and shutdown history from utmpx and last"}
+	mod.RegisterModule(module)
+}
+
+func (m *LoginHistoryModule) GetName() string {
+	return m.Name
+}
+
+func (m *LoginHistoryModule) GetDescription() string {
+	return m.Description
+}
+
+// utmpx record types from <utmpx.h>
+var utmpxTypes = map[int16]string{
+	0:  "empty",
+	1:  "run_level",
+	2:  "boot_time",
+	3:  "old_time",
+	4:  "new_time",
+	5:  "init_process",
+	6:  "login_process",
+	7:  "user_process",
+	8:  "dead_process",
+	9:  "accounting",
+	10: "signature",
+	11: "shutdown_time",
+}
+
+// Examples:
+// user      ttys000                   Mon Jan  1 10:00 - 11:00  (01:00)
+// user      ttys001  192.168.1.10     Mon Jan  1 10:00   still logged in
+// reboot    ~                         Mon Jan  1 09:00
+var lastEntryRegex = regexp.MustCompile(`^(\S+)\s+(\S+)\s+(?:(\S+)\s+)??((?:Mon|Tue|Wed|Thu|Fri|Sat|Sun) \w{3}\s+\d+ \d{2}:\d{2})\s*(?:- (\S+))?\s*(?:\((\S+)\)|(still logged in))?`)
+
+func (m *LoginHistoryModule) Run(params mod.ModuleParams) error {
+	err := parseUtmpx(m.GetName(), "/var/run/utmpx", params)
+	if err != nil {
+		params.Logger.Debug("Error when parsing utmpx: %v", err)
+	}
+
+	err = parseLastOutput(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when parsing last output: %v", err)
+	}
+
+	return nil
+}
+
+func parseUtmpx(moduleName string, path string, params mod.ModuleParams) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// The file stores fixed size records with 32-bit timevals (628 bytes).
+	// Fall back to the 64-bit in-memory layout (640 bytes) if the size does not match.
+	recordSize, tvOffset, hostOffset, tv64 := 628, 300, 308, false
+	if len(data)%628 != 0 && len(data)%640 == 0 {
+		recordSize, tvOffset, hostOffset, tv64 = 640, 304, 320, true
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-utmpx", params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for offset := 0; offset+recordSize <= len(data); offset += recordSize {
+		entry := data[offset : offset+recordSize]
+
+		utType := int16(binary.LittleEndian.Uint16(entry[296:298]))
+		if utType == 0 || utType == 10 {
+			continue
+		}
+
+		var seconds int64
+		var microseconds int32
+		if tv64 {
+			seconds = int64(binary.LittleEndian.Uint64(entry[tvOffset : tvOffset+8]))
+			microseconds = int32(binary.LittleEndian.Uint32(entry[tvOffset+8 : tvOffset+12]))
+		} else {
+			seconds = int64(int32(binary.LittleEndian.Uint32(entry[tvOffset : tvOffset+4])))
+			microseconds = int32(binary.LittleEndian.Uint32(entry[tvOffset+4 : tvOffset+8]))
+		}
+		timestamp := time.Unix(seconds, int64(microseconds)*1000).UTC().Format(utils.TimeFormat)
+
+		recordData := make(map[string]interface{})
+		recordData["user"] = cString(entry[0:256])
+		recordData["id"] = cString(entry[256:260])
+		recordData["tty"] = cString(entry[260:292])
+		recordData["pid"] = int32(binary.LittleEndian.Uint32(entry[292:296]))
+		recordData["type"] = utmpxTypes[utType]
+		recordData["host"] = cString(entry[hostOffset : hostOffset+256])
+		recordData["timestamp"] = timestamp
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func parseLastOutput(moduleName string, params mod.ModuleParams) error {
+	cmd := exec.Command("last")
+	cmd.Env = append(cmd.Env, "TZ=UTC")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("error running command: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// last does not print the year, entries are listed from the most recent one
+	now := time.Now().UTC()
+	year := now.Year()
+	var previous time.Time
+
+	for _, line := range strings.Split(string(output), "\n") {
+		match := lastEntryRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		start, err := time.Parse("Mon Jan 2 15:04 2006", fmt.Sprintf("%s %d", strings.Join(strings.Fields(match[4]), " "), year))
+		if err != nil {
+			params.Logger.Debug("Error parsing date: %v", err)
+			continue
+		}
+		// Moving to the previous year when dates go forward while reading backwards in time
+		if start.After(now) || (!previous.IsZero() && start.After(previous)) {
+			year--
+			start = start.AddDate(-1, 0, 0)
+		}
+		previous = start
+
+		user := match[1]
+		eventType := "login"
+		switch user {
+		case "reboot":
+			eventType = "reboot"
+		case "shutdown":
+			eventType = "shutdown"
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["user"] = user
+		recordData["tty"] = match[2]
+		recordData["host"] = match[3]
+		recordData["type"] = eventType
+		recordData["login_time"] = start.Format(utils.TimeFormat)
+		recordData["logout_time"] = match[5]
+		recordData["duration"] = match[6]
+		recordData["still_logged_in"] = match[7] != ""
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      recordData["login_time"].(string),
+			Data:                recordData,
+			SourceFile:          "last",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// cString returns the string stored in a NUL terminated byte array
+func cString(data []byte) string {
+	if idx := bytes.IndexByte(data, 0); idx >= 0 {
+		data = data[:idx]
+	}
+	return string(data)
+}
@@ -0,0 +1,139 @@
+// This module audits the login window configuration of /Library/Preferences/com.apple.loginwindow.plist:
+//   - Automatic login: autoLoginUser and the presence of /private/etc/kcpassword, which stores the password of
+//     the automatic login user with a reversible obfuscation. Automatic login with a kcpassword file is flagged.
+//   - Hidden users: Hide500Users, HiddenUsersList, HideLocalUsers and HideAdminUsers.
+//   - Guest account: GuestEnabled and guest access to SMB and AFP file sharing.
+//   - Banners: LoginwindowText and the policy banner files of /Library/Security (PolicyBanner.txt, .rtf, .rtfd),
+//     along with the display of the user list, console access and password hints.
+//
+// The content of kcpassword is never decoded.
+package modules
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type LoginWindowModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &LoginWindowModule{
+		Name:        "loginwindow",
+		Description: "Audits automatic login, kcpassword, hidden users, guest account and login window banners"}
+	mod.RegisterModule(module)
+}
+
+func (m *LoginWindowModule) GetName() string {
+	return m.Name
+}
+
+func (m *LoginWindowModule) GetDescription() string {
+	return m.Description
+}
+
+const (
+	loginWindowPlistPath = "/Library/Preferences/com.apple.loginwindow.plist"
+	kcpasswordPath       = "/private/etc/kcpassword"
+)
+
+var (
+	// Login window settings reported as they are
+	loginWindowSettings = map[string]string{
+		"autoLoginUser":          "autologin_user",
+		"autoLoginUserUID":       "autologin_uid",
+		"Hide500Users":           "hide_500_users",
+		"HiddenUsersList":        "hidden_users_list",
+		"HideLocalUsers":         "hide_local_users",
+		"HideAdminUsers":         "hide_admin_users",
+		"GuestEnabled":           "guest_enabled",
+		"LoginwindowText":        "login_window_text",
+		"SHOWFULLNAME":           "show_full_name",
+		"SHOWOTHERUSERS_MANAGED": "show_other_users",
+		"DisableConsoleAccess":   "disable_console_access",
+		"RetriesUntilHint":       "retries_until_hint",
+		"AdminHostInfo":          "admin_host_info",
+	}
+	policyBannerPaths = []string{
+		"/Library/Security/PolicyBanner.txt",
+		"/Library/Security/PolicyBanner.rtf",
+		"/Library/Security/PolicyBanner.rtfd",
+	}
+)
+
+func (m *LoginWindowModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	var preferences map[string]interface{}
+	if err := utils.ParsePlistFile(loginWindowPlistPath, &preferences); err != nil {
+		params.Logger.Debug("Error parsing %s: %v", loginWindowPlistPath, err)
+	}
+
+	recordData := make(map[string]interface{})
+	for key, field := range loginWindowSettings {
+		recordData[field] = ""
+		if value, ok := preferences[key]; ok {
+			recordData[field] = value
+		}
+	}
+
+	// Automatic login
+	autoLoginUser, _ := preferences["autoLoginUser"].(string)
+	_, err = os.Stat(kcpasswordPath)
+	kcpasswordPresent := err == nil
+	recordData["kcpassword_present"] = kcpasswordPresent
+	recordData["kcpassword_modified"] = fileModTime(kcpasswordPath)
+	recordData["autologin_enabled"] = autoLoginUser != ""
+	recordData["autologin_with_kcpassword"] = autoLoginUser != "" && kcpasswordPresent
+
+	// Guest access to file sharing
+	var smbServer, afpServer map[string]interface{}
+	_ = utils.ParsePlistFile("/Library/Preferences/SystemConfiguration/com.apple.smb.server.plist", &smbServer)
+	_ = utils.ParsePlistFile("/Library/Preferences/com.apple.AppleFileServer.plist", &afpServer)
+	recordData["smb_guest_access"] = ""
+	if value, ok := smbServer["AllowGuestAccess"]; ok {
+		recordData["smb_guest_access"] = value
+	}
+	recordData["afp_guest_access"] = ""
+	if value, ok := afpServer["guestAccess"]; ok {
+		recordData["afp_guest_access"] = value
+	}
+
+	// Policy banner shown before the login window
+	recordData["policy_banner"] = ""
+	for _, path := range policyBannerPaths {
+		if _, err := os.Stat(path); err == nil {
+			recordData["policy_banner"] = path
+			break
+		}
+	}
+
+	eventTimestamp := fileModTime(loginWindowPlistPath)
+	if eventTimestamp == "" {
+		eventTimestamp = params.CollectionTimestamp
+	}
+
+	record := utils.Record{
+		CollectionTimestamp: params.CollectionTimestamp,
+		EventTimestamp:      eventTimestamp,
+		Data:                recordData,
+		SourceFile:          loginWindowPlistPath,
+	}
+
+	err = writer.WriteRecord(record)
+	if err != nil {
+		params.Logger.Debug("Failed to write record: %v", err)
+	}
+
+	return nil
+}
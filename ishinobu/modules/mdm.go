@@ -0,0 +1,259 @@
+// This module collects the logs and state of the device management agents, normalizing the management actions
+// (policy executions, check-ins, installations, scripts) into events:
+//   - MDM enrollment: output of `profiles status -type enrollment` (DEP enrollment, MDM server).
+//   - Jamf Pro: /private/var/log/jamf.log, the management framework settings (com.jamfsoftware.jamf.plist) and the
+//     package receipts of /Library/Application Support/JAMF/Receipts.
+//   - Munki: ManagedSoftwareUpdate.log, Install.log and errors.log of /Library/Managed Installs/Logs and the
+//     ManagedInstalls preferences.
+//   - Installomator: /private/var/log/Installomator.log.
+//   - Kandji and Mosyle: agent preferences and logs when present.
+//
+// Values of settings holding passwords, tokens or keys are never collected, only whether they are set.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type MDMModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &MDMModule{
+		Name:        "mdm",
+		Description: "Collects MDM enrollment, Jamf, Munki, Installomator, Kandji and Mosyle agent state and logs as management events"}
+	mod.RegisterModule(module)
+}
+
+func (m *MDMModule) GetName() string {
+	return m.Name
+}
+
+func (m *MDMModule) GetDescription() string {
+	return m.Description
+}
+
+// mdmAgent lists the artifacts of a management agent
+type mdmAgent struct {
+	Configs  []string
+	Logs     []string
+	Receipts []string
+}
+
+// mdmEvent classifies the log messages matching a regular expression, the first group is the subject of the event
+type mdmEvent struct {
+	Event string
+	Regex *regexp.Regexp
+}
+
+var (
+	mdmAgents = map[string]mdmAgent{
+		"jamf": {
+			Configs:  []string{"/Library/Preferences/com.jamfsoftware.jamf.plist"},
+			Logs:     []string{"/private/var/log/jamf.log"},
+			Receipts: []string{"/Library/Application Support/JAMF/Receipts/*"},
+		},
+		"munki": {
+			Configs: []string{"/Library/Preferences/ManagedInstalls.plist"},
+			Logs: []string{
+				"/Library/Managed Installs/Logs/ManagedSoftwareUpdate.log",
+				"/Library/Managed Installs/Logs/Install.log",
+				"/Library/Managed Installs/Logs/errors.log",
+			},
+		},
+		"installomator": {
+			Logs: []string{"/private/var/log/Installomator.log"},
+		},
+		"kandji": {
+			Configs: []string{"/Library/Preferences/io.kandji.Kandji.plist", "/Library/Preferences/io.kandji.KandjiAgent.plist"},
+			Logs:    []string{"/Library/Logs/Kandji/*.log", "/private/var/log/kandji*.log"},
+		},
+		"mosyle": {
+			Configs: []string{"/Library/Preferences/com.mosyle.*.plist"},
+			Logs:    []string{"/Library/Logs/Mosyle*/*.log", "/private/var/log/mosyle*.log", "/Library/Application Support/Mosyle*/Logs/*.log"},
+		},
+	}
+	// Management actions, matched in order
+	mdmEvents = []mdmEvent{
+		{"policy_execution", regexp.MustCompile(`(?i)Executing Policy (.+)`)},
+		{"check_in", regexp.MustCompile(`(?i)Checking for policies triggered by "?([^"]+)"?`)},
+		{"script", regexp.MustCompile(`(?i)Running script (.+?)(?:\.\.\.|$)`)},
+		{"installation", regexp.MustCompile(`(?i)(?:Installing|Install of) (.+?)(?:\.\.\.|: |$)`)},
+		{"removal", regexp.MustCompile(`(?i)(?:Removing|Removal of) (.+?)(?:\.\.\.|: |$)`)},
+		{"download", regexp.MustCompile(`(?i)Downloading (.+?)(?:\.\.\.|$)`)},
+		{"inventory", regexp.MustCompile(`(?i)(Submitting data to .+|Inventory .+)`)},
+		{"software_check", regexp.MustCompile(`(?i)### (.*managed software check.*) ###`)},
+		{"error", regexp.MustCompile(`(?i)\b(?:ERROR|failed)\b[: ]*(.*)`)},
+	}
+	// jamf.log: Mon Jan 15 10:00:00 host jamf[123]: message
+	jamfLogRegex = regexp.MustCompile(`^\w{3} (\w{3}\s+\d{1,2} \d{2}:\d{2}:\d{2}) \S+ [^:\[]+\[\d+\]: (.*)$`)
+	// Munki logs: Jan 15 2024 10:00:00 +0100 message
+	munkiLogRegex = regexp.MustCompile(`^(\w{3} \d{2} \d{4} \d{2}:\d{2}:\d{2} [+-]\d{4}) (.*)$`)
+	// Installomator and other agents: 2024-01-15 10:00:00 : LEVEL : label : message
+	isoLogRegex = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2})\S*\]?\s*[:|-]?\s*(.*)$`)
+)
+
+func (m *MDMModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeMDM := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		for _, key := range []string{"event", "name", "value", "message"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// MDM enrollment
+	output, err := exec.Command("profiles", "status", "-type", "enrollment").Output()
+	if err != nil {
+		params.Logger.Debug("Error getting MDM enrollment status: %v", err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		writeMDM("profiles status -type enrollment", "", map[string]interface{}{
+			"agent": "mdm",
+			"type":  "enrollment",
+			"name":  strings.TrimSpace(key),
+			"value": strings.TrimSpace(value),
+		})
+	}
+
+	for agent, artifacts := range mdmAgents {
+		// Agent settings
+		for _, path := range utils.GlobPaths(artifacts.Configs...) {
+			settings, err := readRemoteAccessConfig(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			modified := fileModTime(path)
+			for key, value := range settings {
+				writeMDM(path, modified, map[string]interface{}{
+					"agent": agent,
+					"type":  "setting",
+					"name":  key,
+					"value": value,
+				})
+			}
+		}
+
+		// Packages installed by the agent
+		for _, path := range utils.GlobPaths(artifacts.Receipts...) {
+			modified := fileModTime(path)
+			writeMDM(path, modified, map[string]interface{}{
+				"agent": agent,
+				"type":  "receipt",
+				"event": "installation",
+				"name":  filepath.Base(path),
+			})
+		}
+
+		// Management events of the logs
+		for _, path := range utils.GlobPaths(artifacts.Logs...) {
+			err := scanMDMLog(path, func(timestamp, event, subject, message string) {
+				writeMDM(path, timestamp, map[string]interface{}{
+					"agent":   agent,
+					"type":    "log",
+					"event":   event,
+					"name":    subject,
+					"message": message,
+				})
+			})
+			if err != nil {
+				params.Logger.Debug("Error reading log %s: %v", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// scanMDMLog calls fn with the time, event, subject and message of the lines of an agent log describing a
+// management action. Other lines are skipped.
+func scanMDMLog(path string, fn func(timestamp, event, subject, message string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// jamf.log does not record the year
+	modified, _ := time.Parse(utils.TimeFormat, fileModTime(path))
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		timestamp, message := mdmLogLine(scanner.Text(), modified)
+		for _, event := range mdmEvents {
+			if match := event.Regex.FindStringSubmatch(message); match != nil {
+				fn(timestamp, event.Event, strings.TrimSpace(match[1]), message)
+				break
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// mdmLogLine returns the time (converted to TimeFormat) and message of a line of the jamf, Munki or
+// Installomator logs. Times without year are given the year of the last modification of the log.
+func mdmLogLine(line string, modified time.Time) (string, string) {
+	line = strings.TrimSpace(line)
+	if match := jamfLogRegex.FindStringSubmatch(line); match != nil {
+		t, err := time.ParseInLocation("2006 Jan _2 15:04:05", fmt.Sprintf("%d %s", modified.Year(), match[1]), time.Local)
+		if err != nil {
+			return "", match[2]
+		}
+		// lines written before the new year
+		if !modified.IsZero() && t.After(modified.Add(24*time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t.UTC().Format(utils.TimeFormat), match[2]
+	}
+	if match := munkiLogRegex.FindStringSubmatch(line); match != nil {
+		if t, err := time.Parse("Jan 02 2006 15:04:05 -0700", match[1]); err == nil {
+			return t.UTC().Format(utils.TimeFormat), match[2]
+		}
+		return "", match[2]
+	}
+	if match := isoLogRegex.FindStringSubmatch(line); match != nil {
+		value := strings.Replace(match[1], "T", " ", 1)
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+			return t.UTC().Format(utils.TimeFormat), match[2]
+		}
+		return "", match[2]
+	}
+	return "", line
+}
@@ -0,0 +1,268 @@
+// This module lists the Network Extensions of the host. A content filter or a DNS proxy can silently inspect or
+// reroute the traffic:
+//   - Configurations: the content filters, DNS proxies, DNS settings (encrypted DNS), app push providers, relays and
+//     the provider-based VPNs (packet tunnel and app proxy providers) of the NE configuration store
+//     (/Library/Preferences/com.apple.networkextension.plist), with the configuring application, the provider
+//     bundle identifier and the enabled state. The built-in IKEv2 and IPSec VPNs are left to the vpn module.
+//   - System extensions: the network system extensions of /Library/SystemExtensions/db.plist with their team ID,
+//     state, version and containing application. The configurations are enriched with the team ID and the
+//     application of the system extension that provides them.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type NetExtensionsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &NetExtensionsModule{
+		Name:        "netextensions",
+		Description: "Collects Network Extension content filters, DNS proxies, DNS settings and tunnel providers with their providing system extensions"}
+	mod.RegisterModule(module)
+}
+
+func (m *NetExtensionsModule) GetName() string {
+	return m.Name
+}
+
+func (m *NetExtensionsModule) GetDescription() string {
+	return m.Description
+}
+
+// networkExtensionPayload is a configuration type of the NE configuration store
+type networkExtensionPayload struct {
+	Key  string
+	Type string
+}
+
+// systemExtension holds the fields of a system extension of the system extensions database
+type systemExtension struct {
+	Identifier string
+	TeamID     string
+	State      string
+	Version    string
+	AppPath    string
+	Categories []string
+}
+
+const systemExtensionsDBPath = "/Library/SystemExtensions/db.plist"
+
+var networkExtensionPayloads = []networkExtensionPayload{
+	{"ContentFilter", "content_filter"},
+	{"DNSProxy", "dns_proxy"},
+	{"DNSSettings", "dns_settings"},
+	{"AppPush", "app_push"},
+	{"Relay", "relay"},
+	{"VPN", "vpn"},
+	{"AppVPN", "app_vpn"},
+	{"AlwaysOnVPN", "always_on_vpn"},
+}
+
+func (m *NetExtensionsModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeRecord := func(sourceFile string, recordData map[string]interface{}) {
+		eventTimestamp := fileModTime(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	extensions, err := readSystemExtensions(systemExtensionsDBPath)
+	if err != nil {
+		params.Logger.Debug("Error reading %s: %v", systemExtensionsDBPath, err)
+	}
+	providers := make(map[string]systemExtension)
+	for _, extension := range extensions {
+		providers[extension.Identifier] = extension
+	}
+
+	// NE configuration store
+	if data, err := os.ReadFile(networkExtensionPreferencesPath); err == nil {
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", networkExtensionPreferencesPath, err)
+		}
+		walkPlist(root, func(item map[string]interface{}) {
+			for _, payload := range networkExtensionPayloads {
+				configuration, ok := item[payload.Key].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				provider := networkExtensionProvider(configuration)
+				if strings.HasSuffix(payload.Key, "VPN") && provider == "" {
+					// Built-in VPN, collected by the vpn module
+					continue
+				}
+				extension := providers[provider]
+				application := valueOrEmpty(item["Application"])
+				if application == "" {
+					application = valueOrEmpty(item["ApplicationIdentifier"])
+				}
+				writeRecord(networkExtensionPreferencesPath, map[string]interface{}{
+					"type":             "configuration",
+					"payload":          payload.Type,
+					"id":               valueOrEmpty(item["Identifier"]),
+					"name":             valueOrEmpty(item["Name"]),
+					"application":      application,
+					"application_name": valueOrEmpty(item["ApplicationName"]),
+					"provider":         provider,
+					"enabled":          valueOrEmpty(configuration["Enabled"]),
+					"details":          networkExtensionDetails(configuration),
+					"team_id":          extension.TeamID,
+					"state":            extension.State,
+					"version":          extension.Version,
+					"app_path":         extension.AppPath,
+				})
+			}
+		})
+	} else if !os.IsNotExist(err) {
+		params.Logger.Debug("Error reading %s: %v", networkExtensionPreferencesPath, err)
+	}
+
+	// Network system extensions
+	for _, extension := range extensions {
+		network := false
+		for _, category := range extension.Categories {
+			if strings.Contains(category, "network_extension") {
+				network = true
+			}
+		}
+		if !network {
+			continue
+		}
+		writeRecord(systemExtensionsDBPath, map[string]interface{}{
+			"type":             "system_extension",
+			"payload":          strings.Join(extension.Categories, ", "),
+			"id":               "",
+			"name":             "",
+			"application":      "",
+			"application_name": "",
+			"provider":         extension.Identifier,
+			"enabled":          strings.HasSuffix(extension.State, "_enabled"),
+			"details":          "",
+			"team_id":          extension.TeamID,
+			"state":            extension.State,
+			"version":          extension.Version,
+			"app_path":         extension.AppPath,
+		})
+	}
+
+	return nil
+}
+
+// networkExtensionProvider returns the bundle identifier of the extension providing a configuration
+// (ProviderBundleIdentifier of the VPN and DNS proxy protocols, FilterDataProviderBundleIdentifier or
+// FilterPacketProviderBundleIdentifier of the content filters)
+func networkExtensionProvider(configuration map[string]interface{}) string {
+	var identifiers []string
+	walkPlist(configuration, func(item map[string]interface{}) {
+		for key, value := range item {
+			if identifier, ok := value.(string); ok && identifier != "" && strings.HasSuffix(key, "ProviderBundleIdentifier") {
+				identifiers = append(identifiers, identifier)
+			}
+		}
+	})
+	sort.Strings(identifiers)
+	if len(identifiers) == 0 {
+		return ""
+	}
+	return identifiers[0]
+}
+
+// networkExtensionDetails summarizes the settings of a configuration: what a content filter inspects, the
+// organization and the servers of the DNS settings
+func networkExtensionDetails(configuration map[string]interface{}) string {
+	var details []string
+	walkPlist(configuration, func(item map[string]interface{}) {
+		for _, key := range []string{"FilterSockets", "FilterPackets", "FilterBrowsers", "Organization", "DNSProtocol", "ServerURL", "ServerName", "ServerAddress"} {
+			if value, ok := item[key]; ok {
+				switch value.(type) {
+				case map[string]interface{}, []interface{}, []byte:
+					continue
+				}
+				details = append(details, fmt.Sprintf("%s=%v", key, value))
+			}
+		}
+		if servers, ok := item["Servers"].([]interface{}); ok {
+			var addresses []string
+			for _, server := range servers {
+				addresses = append(addresses, fmt.Sprintf("%v", server))
+			}
+			details = append(details, "Servers="+strings.Join(addresses, " "))
+		}
+	})
+	sort.Strings(details)
+	return strings.Join(details, ", ")
+}
+
+// readSystemExtensions returns the system extensions of the system extensions database
+func readSystemExtensions(path string) ([]systemExtension, error) {
+	var db map[string]interface{}
+	if err := utils.ParsePlistFile(path, &db); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var extensions []systemExtension
+	items, _ := db["extensions"].([]interface{})
+	for _, value := range items {
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		extension := systemExtension{
+			Identifier: fmt.Sprintf("%v", valueOrEmpty(item["identifier"])),
+			TeamID:     fmt.Sprintf("%v", valueOrEmpty(item["teamID"])),
+			State:      fmt.Sprintf("%v", valueOrEmpty(item["state"])),
+		}
+		if version, ok := item["bundleVersion"].(map[string]interface{}); ok {
+			extension.Version = fmt.Sprintf("%v", valueOrEmpty(version["CFBundleShortVersionString"]))
+			if build, ok := version["CFBundleVersion"]; ok {
+				extension.Version = strings.TrimSpace(fmt.Sprintf("%s (%v)", extension.Version, build))
+			}
+		}
+		if container, ok := item["container"].(map[string]interface{}); ok {
+			extension.AppPath = fmt.Sprintf("%v", valueOrEmpty(container["bundlePath"]))
+		}
+		if extension.AppPath == "" {
+			// originPath is the extension inside the application bundle
+			origin := fmt.Sprintf("%v", valueOrEmpty(item["originPath"]))
+			if index := strings.Index(origin, ".app/"); index >= 0 {
+				extension.AppPath = origin[:index+4]
+			}
+		}
+		categories, _ := item["categories"].([]interface{})
+		for _, category := range categories {
+			extension.Categories = append(extension.Categories, fmt.Sprintf("%v", category))
+		}
+		extensions = append(extensions, extension)
+	}
+	return extensions, nil
+}
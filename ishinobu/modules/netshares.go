@@ -0,0 +1,231 @@
+// This module reconstructs the network shares (SMB, AFP, NFS, WebDAV, FTP, VNC) accessed by each user:
+//   - Finder preferences: the last server of Connect to Server (FXConnectToLastURL), the recent servers of
+//     com.apple.recentitems.plist and the favorite servers of com.apple.sidebarlists.plist on older releases.
+//   - Shared file lists: the FavoriteServers and RecentServers lists (com.apple.sharedfilelist).
+//   - Mount events: NetAuth, mount_smbfs, mount_afp, mount_nfs, mount_webdav and smbfs messages of the unified
+//     logs over the window.
+//
+// The password of the URLs is never reported. The window defaults to the last 30 days and can be changed in
+// <InputDir>/netshares.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type NetSharesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &NetSharesModule{
+		Name:        "netshares",
+		Description: "Collects the network shares accessed from Finder recent and favorite servers and the share mount events"}
+	mod.RegisterModule(module)
+}
+
+func (m *NetSharesModule) GetName() string {
+	return m.Name
+}
+
+func (m *NetSharesModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	netShareListPaths = []string{
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.FavoriteServers.sfl*",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.RecentServers.sfl*",
+	}
+	netShareURLRegex = regexp.MustCompile(`(?i)\b(?:smb|cifs|afp|nfs|webdavs?|ftp|vnc)://[^\s"'<>,]+`)
+)
+
+func (m *NetSharesModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeShare := func(sourceFile, eventTimestamp, source, name, shareURL, detail string) {
+		server, share, user := netShareParts(shareURL)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data: map[string]interface{}{
+				"username":     utils.GetUsernameFromPath(sourceFile),
+				"source":       source,
+				"name":         name,
+				"url":          redactNetShareURL(shareURL),
+				"server":       server,
+				"share":        share,
+				"account_name": user,
+				"detail":       detail,
+			},
+			SourceFile: sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Finder preferences
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.finder.plist") {
+		var finder map[string]interface{}
+		if err := utils.ParsePlistFile(path, &finder); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		if lastURL, ok := finder["FXConnectToLastURL"].(string); ok && lastURL != "" {
+			writeShare(path, fileModTime(path), "connect_to_last_url", "", lastURL, "")
+		}
+	}
+
+	// Recent and favorite servers of the legacy preference lists
+	for _, list := range []struct{ pattern, key, source string }{
+		{"/Users/*/Library/Preferences/com.apple.recentitems.plist", "RecentServers", "recent_servers"},
+		{"/Users/*/Library/Preferences/com.apple.sidebarlists.plist", "favoriteservers", "favorite_servers"},
+	} {
+		for _, path := range utils.GlobPaths(list.pattern) {
+			var prefs map[string]interface{}
+			if err := utils.ParsePlistFile(path, &prefs); err != nil {
+				params.Logger.Debug("Error parsing %s: %v", path, err)
+				continue
+			}
+			servers, _ := prefs[list.key].(map[string]interface{})
+			items, _ := servers["CustomListItems"].([]interface{})
+			for _, value := range items {
+				item, ok := value.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				shareURL, _ := item["URL"].(string)
+				if shareURL == "" {
+					continue
+				}
+				writeShare(path, fileModTime(path), list.source, fmt.Sprintf("%v", valueOrEmpty(item["Name"])), shareURL, "")
+			}
+		}
+	}
+
+	// FavoriteServers and RecentServers shared file lists
+	for _, path := range utils.GlobPaths(netShareListPaths...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+		archive, ok := root.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		list, _ := sharedFileListName(path)
+		source := "recent_servers"
+		if strings.HasPrefix(list, "FavoriteServers") {
+			source = "favorite_servers"
+		}
+		items, _ := archive["items"].([]interface{})
+		for _, value := range items {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			shareURL, _ := item["URL"].(string)
+			if shareURL == "" {
+				if bookmarkData, ok := item["Bookmark"].([]byte); ok {
+					if bookmark, err := utils.ParseBookmark(bookmarkData); err == nil {
+						shareURL = bookmark.VolumePath
+						if shareURL == "" {
+							shareURL = bookmark.Path
+						}
+					}
+				}
+			}
+			if shareURL == "" {
+				continue
+			}
+			writeShare(path, fileModTime(path), source, fmt.Sprintf("%v", valueOrEmpty(item["Name"])), shareURL, "")
+		}
+	}
+
+	// Mount events of the unified logs
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `process == "NetAuthSysAgent" OR process == "NetAuthAgent" OR process == "mount_smbfs" OR ` +
+			`process == "mount_afp" OR process == "mount_nfs" OR process == "mount_webdav" OR subsystem == "com.apple.smbfs" OR ` +
+			`(process == "kernel" AND eventMessage CONTAINS[c] "smbfs")`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error querying unified logs: %v", err)
+		return nil
+	}
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := recordData["message"].(string)
+		processPath, _ := recordData["process_path"].(string)
+		shareURL := netShareURLRegex.FindString(message)
+		if shareURL == "" && !strings.Contains(strings.ToLower(message), "mount") {
+			continue
+		}
+		writeShare("unifiedlogs", timestamp, "unifiedlogs", filepath.Base(processPath), shareURL, redactNetShareURL(message))
+	}
+
+	return nil
+}
+
+// netShareParts returns the server, the share and the account name of a share URL
+func netShareParts(shareURL string) (string, string, string) {
+	parsed, err := url.Parse(shareURL)
+	if err != nil || parsed.Host == "" {
+		return "", "", ""
+	}
+	user := ""
+	if parsed.User != nil {
+		user = parsed.User.Username()
+		// SMB account names may carry the domain as DOMAIN;user
+		if _, name, ok := strings.Cut(user, ";"); ok {
+			user = name
+		}
+	}
+	return parsed.Hostname(), strings.Trim(parsed.Path, "/"), user
+}
+
+// redactNetShareURL removes the passwords of the share URLs of a string
+func redactNetShareURL(value string) string {
+	return netShareURLRegex.ReplaceAllStringFunc(value, func(shareURL string) string {
+		parsed, err := url.Parse(shareURL)
+		if err != nil || parsed.User == nil {
+			return shareURL
+		}
+		if _, ok := parsed.User.Password(); ok {
+			parsed.User = url.UserPassword(parsed.User.Username(), "xxxxx")
+		}
+		return parsed.String()
+	})
+}
@@ -0,0 +1,220 @@
+// This module collects the notes of each user from the Notes database:
+// - /Users/*/Library/Group Containers/group.com.apple.notes/NoteStore.sqlite
+// Each note is emitted with its title, folder, account, creation/modification dates and whether it
+// is password protected or marked for deletion.
+// The note bodies are stored as gzipped protocol buffers; their text and snippet (the beginning of the text) are
+// included when enabled in <InputDir>/notes.json ({"include_text": true}). Password protected notes are encrypted
+// and their text and snippet are never included.
+// The databases are copied to a temporary folder before being queried.
+package modules
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type NotesModule struct {
+	Name        string
+	Description string
+}
+
+// NotesConfig is the configuration of the notes module.
+type NotesConfig struct {
+	IncludeText bool `json:"include_text"`
+}
+
+func init() {
+	module := &NotesModule{
+		Name:        "notes",
+		Description: "Collects note titles, folders, timestamps and optionally text from the Notes database"}
+	mod.RegisterModule(module)
+}
+
+func (m *NotesModule) GetName() string {
+	return m.Name
+}
+
+func (m *NotesModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *NotesModule) Run(params mod.ModuleParams) error {
+	var config NotesConfig
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	dbPaths := utils.GlobPaths("/Users/*/Library/Group Containers/group.com.apple.notes/NoteStore.sqlite")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-notes")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parseNoteStore(dst, dbPath, config.IncludeText, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing Notes database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseNoteStore(dbPath string, sourceFile string, includeText bool, writer *utils.DataWriter, params mod.ModuleParams) error {
+	username := utils.GetUsernameFromPath(sourceFile)
+
+	// The creation date column was renamed in macOS 10.15, fall back to the older name when missing.
+	query := `
+		SELECT
+			Note.ZTITLE1,
+			Note.ZSNIPPET,
+			Note.ZCREATIONDATE3,
+			Note.ZMODIFICATIONDATE1,
+			Note.ZISPASSWORDPROTECTED,
+			Note.ZMARKEDFORDELETION,
+			Folder.ZTITLE2,
+			Account.ZNAME,
+			NoteData.ZDATA
+		FROM ZICCLOUDSYNCINGOBJECT AS Note
+			LEFT JOIN ZICCLOUDSYNCINGOBJECT AS Folder ON Note.ZFOLDER = Folder.Z_PK
+			LEFT JOIN ZICCLOUDSYNCINGOBJECT AS Account ON Folder.ZOWNER = Account.Z_PK
+			LEFT JOIN ZICNOTEDATA AS NoteData ON NoteData.ZNOTE = Note.Z_PK
+		WHERE Note.ZTITLE1 IS NOT NULL`
+	legacyQuery := `
+		SELECT
+			Note.ZTITLE1,
+			Note.ZSNIPPET,
+			Note.ZCREATIONDATE1,
+			Note.ZMODIFICATIONDATE1,
+			Note.ZISPASSWORDPROTECTED,
+			Note.ZMARKEDFORDELETION,
+			Folder.ZTITLE2,
+			Account.ZNAME,
+			NoteData.ZDATA
+		FROM ZICCLOUDSYNCINGOBJECT AS Note
+			LEFT JOIN ZICCLOUDSYNCINGOBJECT AS Folder ON Note.ZFOLDER = Folder.Z_PK
+			LEFT JOIN ZICCLOUDSYNCINGOBJECT AS Account ON Folder.ZOWNER = Account.Z_PK
+			LEFT JOIN ZICNOTEDATA AS NoteData ON NoteData.ZNOTE = Note.Z_PK
+		WHERE Note.ZTITLE1 IS NOT NULL`
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to legacy Notes query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, legacyQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var title, snippet, folder, account sql.NullString
+		var creationDate, modificationDate sql.NullFloat64
+		var passwordProtected, markedForDeletion sql.NullInt64
+		var data []byte
+		err := rows.Scan(&title, &snippet, &creationDate, &modificationDate, &passwordProtected, &markedForDeletion,
+			&folder, &account, &data)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["title"] = title.String
+		recordData["folder"] = folder.String
+		recordData["account"] = account.String
+		recordData["creation_time"] = ""
+		if creationDate.Valid {
+			recordData["creation_time"] = utils.ConvertCFAbsoluteTime(creationDate.Float64)
+		}
+		recordData["modification_time"] = ""
+		if modificationDate.Valid {
+			recordData["modification_time"] = utils.ConvertCFAbsoluteTime(modificationDate.Float64)
+		}
+		recordData["password_protected"] = passwordProtected.Int64 == 1
+		recordData["marked_for_deletion"] = markedForDeletion.Int64 == 1
+
+		if includeText && passwordProtected.Int64 != 1 {
+			recordData["snippet"] = snippet.String
+			if len(data) > 0 {
+				text, err := decodeNoteBody(data)
+				if err != nil {
+					params.Logger.Debug("Error decoding note %s: %v", title.String, err)
+				}
+				recordData["text"] = text
+			}
+		}
+
+		eventTimestamp := recordData["modification_time"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// decodeNoteBody extracts the plain text of a note from its gzipped protocol buffer
+// (NoteStoreProto.document.note.note_text)
+func decodeNoteBody(data []byte) (string, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	proto, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	text, ok := utils.ProtobufBytes(proto, 2, 3, 2)
+	if !ok {
+		return "", fmt.Errorf("note text not found")
+	}
+	return string(text), nil
+}
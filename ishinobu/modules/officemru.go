@@ -0,0 +1,281 @@
+// This module collects the recently used documents of the productivity applications of each user:
+//   - Microsoft Office: the security scoped bookmarks of Word, Excel and PowerPoint
+//     (/Users/*/Library/Containers/com.microsoft.<App>/Data/Library/Preferences/com.microsoft.<app>.securebookmarks.plist)
+//     with the last used date of each document, and the File MRU and Reading Locations keys of the Office
+//     registry (/Users/*/Library/Group Containers/UBF8T346G9.Office/MicrosoftRegistrationDB.reg).
+//   - Adobe Acrobat and Reader: the cRecentFiles list of the com.adobe.Acrobat.Pro and com.adobe.Reader preferences.
+//   - Apple iWork: the recent documents lists of Pages, Numbers and Keynote (shared file lists).
+//
+// Document MRUs keep the path of files opened by the user, such as phishing attachments, after they are deleted.
+package modules
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type OfficeMRUModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &OfficeMRUModule{
+		Name:        "officemru",
+		Description: "Collects recently used documents of Microsoft Office, Adobe Acrobat and Apple iWork"}
+	mod.RegisterModule(module)
+}
+
+func (m *OfficeMRUModule) GetName() string {
+	return m.Name
+}
+
+func (m *OfficeMRUModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	officeSecureBookmarkPaths = []string{
+		"/Users/*/Library/Containers/com.microsoft.Word/Data/Library/Preferences/com.microsoft.Word.securebookmarks.plist",
+		"/Users/*/Library/Containers/com.microsoft.Excel/Data/Library/Preferences/com.microsoft.Excel.securebookmarks.plist",
+		"/Users/*/Library/Containers/com.microsoft.Powerpoint/Data/Library/Preferences/com.microsoft.Powerpoint.securebookmarks.plist",
+	}
+	acrobatPreferencePaths = []string{
+		"/Users/*/Library/Preferences/com.adobe.Acrobat.Pro.plist",
+		"/Users/*/Library/Preferences/com.adobe.Reader.plist",
+	}
+	iWorkRecentDocumentPaths = []string{
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/com.apple.iwork.*.sfl*",
+	}
+	// Office registry values of the recent documents, the key names vary between versions
+	officeRegistryQuery = `
+		SELECT
+			KEY.node_id AS node_id,
+			KEY.name AS key_name,
+			PARENT.name AS parent_name,
+			APP.name AS app_name,
+			VALUE.name AS value_name,
+			VALUE.value AS value
+		FROM HKEY_CURRENT_USER KEY
+		JOIN HKEY_CURRENT_USER PARENT ON PARENT.node_id = KEY.parent_id
+		LEFT JOIN HKEY_CURRENT_USER APP ON APP.node_id = PARENT.parent_id
+		JOIN HKEY_CURRENT_USER_values VALUE ON VALUE.node_id = KEY.node_id
+		WHERE PARENT.name IN ('File MRU', 'Reading Locations', 'Place MRU')`
+	acrobatDateRegex = regexp.MustCompile(`D:(\d{14})`)
+)
+
+func (m *OfficeMRUModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeMRU := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = fileModTime(sourceFile)
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Office security scoped bookmarks, indexed by the URL of the document
+	for _, path := range utils.GlobPaths(officeSecureBookmarkPaths...) {
+		var bookmarks map[string]interface{}
+		if err := utils.ParsePlistFile(path, &bookmarks); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		app := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(path), ".securebookmarks.plist"), "com.microsoft.")
+		for documentURL, value := range bookmarks {
+			entry, _ := value.(map[string]interface{})
+			lastUsed := utils.FormatPlistDate(entry["kLastUsedDateKey"])
+			recordData := map[string]interface{}{
+				"app":       app,
+				"source":    "securebookmarks",
+				"path":      officeURLPath(documentURL),
+				"url":       documentURL,
+				"last_used": lastUsed,
+			}
+			if bookmarkData, ok := entry["kBookmarkDataKey"].([]byte); ok {
+				if bookmark, err := utils.ParseBookmark(bookmarkData); err == nil && bookmark.Path != "" {
+					recordData["path"] = bookmark.Path
+				}
+			}
+			writeMRU(path, lastUsed, recordData)
+		}
+	}
+
+	// Office registry
+	tmpDir, err := os.MkdirTemp("", "ishinobu-officemru")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range utils.GlobPaths("/Users/*/Library/Group Containers/UBF8T346G9.Office/MicrosoftRegistrationDB.reg") {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+		rows, err := utils.QuerySQLiteMaps(dst, officeRegistryQuery)
+		if err != nil {
+			params.Logger.Debug("Error querying Office registry %s: %v", dbPath, err)
+			continue
+		}
+
+		// Group the values of each key into one document
+		var order []int64
+		documents := make(map[int64]map[string]interface{})
+		for _, row := range rows {
+			nodeID, _ := row["node_id"].(int64)
+			document, ok := documents[nodeID]
+			if !ok {
+				document = map[string]interface{}{
+					"app":       fmt.Sprintf("%v", row["app_name"]),
+					"source":    fmt.Sprintf("%v", row["parent_name"]),
+					"key":       fmt.Sprintf("%v", row["key_name"]),
+					"path":      "",
+					"url":       "",
+					"last_used": "",
+				}
+				documents[nodeID] = document
+				order = append(order, nodeID)
+			}
+			value := strings.TrimRight(fmt.Sprintf("%v", row["value"]), "\x00")
+			switch strings.ToLower(fmt.Sprintf("%v", row["value_name"])) {
+			case "file path", "item path", "path":
+				document["path"] = value
+			case "datetime", "last used", "lastused":
+				document["last_used"] = value
+			case "url", "file url":
+				document["url"] = value
+			}
+		}
+		for _, nodeID := range order {
+			document := documents[nodeID]
+			eventTimestamp := ""
+			if t, err := time.Parse("2006-01-02T15:04", document["last_used"].(string)); err == nil {
+				eventTimestamp = t.UTC().Format(utils.TimeFormat)
+			}
+			writeMRU(dbPath, eventTimestamp, document)
+		}
+	}
+
+	// Adobe Acrobat and Reader
+	for _, path := range utils.GlobPaths(acrobatPreferencePaths...) {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		app := strings.TrimSuffix(filepath.Base(path), ".plist")
+		walkPlist(preferences, func(item map[string]interface{}) {
+			documentPath := acrobatString(item["tDIText"])
+			if documentPath == "" {
+				return
+			}
+			lastUsed := ""
+			if match := acrobatDateRegex.FindStringSubmatch(acrobatString(item["sDate"])); match != nil {
+				if t, err := time.ParseInLocation("20060102150405", match[1], time.Local); err == nil {
+					lastUsed = t.UTC().Format(utils.TimeFormat)
+				}
+			}
+			writeMRU(path, lastUsed, map[string]interface{}{
+				"app":       app,
+				"source":    "cRecentFiles",
+				"path":      documentPath,
+				"url":       "",
+				"file_name": acrobatString(item["tFileName"]),
+				"file_size": item["uFileSize"],
+				"last_used": lastUsed,
+			})
+		})
+	}
+
+	// Apple iWork recent documents
+	for _, path := range utils.GlobPaths(iWorkRecentDocumentPaths...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+		archive, _ := root.(map[string]interface{})
+		items, _ := archive["items"].([]interface{})
+		_, app := sharedFileListName(path)
+		for index, value := range items {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			recordData := map[string]interface{}{
+				"app":       app,
+				"source":    "sharedfilelist",
+				"order":     index + 1,
+				"path":      "",
+				"url":       "",
+				"last_used": "",
+			}
+			if bookmarkData, ok := item["Bookmark"].([]byte); ok {
+				if bookmark, err := utils.ParseBookmark(bookmarkData); err == nil {
+					recordData["path"] = bookmark.Path
+				}
+			}
+			writeMRU(path, "", recordData)
+		}
+	}
+
+	return nil
+}
+
+// officeURLPath returns the local path of a file URL
+func officeURLPath(documentURL string) string {
+	parsed, err := url.Parse(documentURL)
+	if err != nil || parsed.Scheme != "file" {
+		return ""
+	}
+	return parsed.Path
+}
+
+// acrobatString returns the text of an Acrobat preference value, stored either as a string or as data
+func acrobatString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return strings.TrimRight(string(v), "\x00")
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+// This module collects the open network sockets and their owning processes.
+// Command: lsof -i -nP
+// Each record contains the process name, PID, user, protocol, local and remote addresses and the socket state.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type OpenPortsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &OpenPortsModule{
+		Name:        "openports",
+		Description: "Collects listening ports and open sockets with their owning processes"}
+	mod.RegisterModule(module)
+}
+
+func (m *OpenPortsModule) GetName() string {
+	return m.Name
+}
+
+func (m *OpenPortsModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *OpenPortsModule) Run(params mod.ModuleParams) error {
+	// lsof exits with 1 when some files could not be listed, keep the partial output
+	output, err := exec.Command("lsof", "-i", "-nP").Output()
+	if err != nil && len(output) == 0 {
+		return fmt.Errorf("error running command: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	lines := strings.Split(string(output), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+
+	// COMMAND PID USER FD TYPE DEVICE SIZE/OFF NODE NAME
+	for _, line := range lines[1:] {
+		cols := strings.Fields(line)
+		if len(cols) < 9 {
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["process"] = strings.ReplaceAll(cols[0], `\x20`, " ")
+		recordData["pid"] = cols[1]
+		recordData["user"] = cols[2]
+		recordData["fd"] = cols[3]
+		recordData["ip_version"] = cols[4]
+		recordData["protocol"] = cols[7]
+
+		name := strings.Join(cols[8:], " ")
+		state := ""
+		if idx := strings.Index(name, " ("); idx >= 0 {
+			state = strings.Trim(name[idx+1:], "()")
+			name = name[:idx]
+		}
+		recordData["state"] = state
+
+		localAddress, remoteAddress := name, ""
+		if parts := strings.SplitN(name, "->", 2); len(parts) == 2 {
+			localAddress, remoteAddress = parts[0], parts[1]
+		}
+		recordData["local_address"] = localAddress
+		recordData["remote_address"] = remoteAddress
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          "lsof -i -nP",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+// This module inventories the software installed through package managers:
+//   - Installer receipts: /private/var/db/receipts/*.plist (identifier, version, install date, installer process).
+//   - Homebrew formulae (Cellar/*/*/INSTALL_RECEIPT.json), casks (Caskroom) and taps (Library/Taps) of the
+//     /opt/homebrew and /usr/local prefixes. Third-party taps are flagged.
+//   - MacPorts: /opt/local/var/macports/registry/registry.db.
+//   - Nix: manifest.json of the default and per-user profiles.
+package modules
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type PackagesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &PackagesModule{
+		Name:        "packages",
+		Description: "Inventories installer receipts, Homebrew formulae/casks/taps, MacPorts and Nix packages"}
+	mod.RegisterModule(module)
+}
+
+func (m *PackagesModule) GetName() string {
+	return m.Name
+}
+
+func (m *PackagesModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	homebrewPrefixes = []string{"/opt/homebrew", "/usr/local"}
+	gitRemoteRegex   = regexp.MustCompile(`(?m)^\s*url\s*=\s*(\S+)`)
+)
+
+// homebrewReceipt is the INSTALL_RECEIPT.json written by Homebrew for every installed formula
+type homebrewReceipt struct {
+	Time                  int64  `json:"time"`
+	InstalledOnRequest    bool   `json:"installed_on_request"`
+	InstalledAsDependency bool   `json:"installed_as_dependency"`
+	PouredFromBottle      bool   `json:"poured_from_bottle"`
+	HomebrewVersion       string `json:"homebrew_version"`
+	Source                struct {
+		Tap  string `json:"tap"`
+		Path string `json:"path"`
+	} `json:"source"`
+}
+
+func (m *PackagesModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writePackage := func(sourceFile string, installTime string, recordData map[string]interface{}) {
+		recordData["install_time"] = installTime
+		eventTimestamp := installTime
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Installer receipts
+	for _, path := range utils.GlobPaths("/private/var/db/receipts/*.plist") {
+		var receipt map[string]interface{}
+		if err := utils.ParsePlistFile(path, &receipt); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		writePackage(path, utils.FormatPlistDate(receipt["InstallDate"]), map[string]interface{}{
+			"manager":         "pkgutil",
+			"type":            "receipt",
+			"name":            receipt["PackageIdentifier"],
+			"version":         receipt["PackageVersion"],
+			"install_prefix":  receipt["InstallPrefixPath"],
+			"install_process": receipt["InstallProcessName"],
+		})
+	}
+
+	for _, prefix := range homebrewPrefixes {
+		// Formulae
+		for _, path := range utils.GlobPaths(filepath.Join(prefix, "Cellar", "*", "*", "INSTALL_RECEIPT.json")) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			var receipt homebrewReceipt
+			if err := json.Unmarshal(data, &receipt); err != nil {
+				params.Logger.Debug("Error parsing %s: %v", path, err)
+				continue
+			}
+			versionDir := filepath.Dir(path)
+			writePackage(path, utils.ConvertUnixTimestamp(receipt.Time), map[string]interface{}{
+				"manager":              "homebrew",
+				"type":                 "formula",
+				"name":                 filepath.Base(filepath.Dir(versionDir)),
+				"version":              filepath.Base(versionDir),
+				"tap":                  receipt.Source.Tap,
+				"installed_on_request": receipt.InstalledOnRequest,
+				"poured_from_bottle":   receipt.PouredFromBottle,
+				"homebrew_version":     receipt.HomebrewVersion,
+			})
+		}
+
+		// Casks: Caskroom/<token>/<version> and Caskroom/<token>/.metadata/<version>/<timestamp>/
+		for _, caskDir := range utils.GlobPaths(filepath.Join(prefix, "Caskroom", "*")) {
+			versions, err := os.ReadDir(caskDir)
+			if err != nil {
+				continue
+			}
+			for _, version := range versions {
+				if !version.IsDir() || strings.HasPrefix(version.Name(), ".") {
+					continue
+				}
+				installTime := fileModTime(filepath.Join(caskDir, version.Name()))
+				metadata := utils.GlobPaths(filepath.Join(caskDir, ".metadata", version.Name(), "*"))
+				if len(metadata) > 0 {
+					stamp := filepath.Base(metadata[len(metadata)-1])
+					if t, err := time.ParseInLocation("20060102150405", strings.SplitN(stamp, ".", 2)[0], time.Local); err == nil {
+						installTime = t.UTC().Format(utils.TimeFormat)
+					}
+				}
+				writePackage(caskDir, installTime, map[string]interface{}{
+					"manager": "homebrew",
+					"type":    "cask",
+					"name":    filepath.Base(caskDir),
+					"version": version.Name(),
+				})
+			}
+		}
+
+		// Taps
+		for _, tapDir := range utils.GlobPaths(filepath.Join(prefix, "Library", "Taps", "*", "*")) {
+			remote := ""
+			if config, err := os.ReadFile(filepath.Join(tapDir, ".git", "config")); err == nil {
+				if match := gitRemoteRegex.FindSubmatch(config); match != nil {
+					remote = string(match[1])
+				}
+			}
+			owner := filepath.Base(filepath.Dir(tapDir))
+			writePackage(tapDir, fileModTime(tapDir), map[string]interface{}{
+				"manager":     "homebrew",
+				"type":        "tap",
+				"name":        owner + "/" + strings.TrimPrefix(filepath.Base(tapDir), "homebrew-"),
+				"remote":      remote,
+				"third_party": owner != "homebrew",
+			})
+		}
+	}
+
+	// MacPorts
+	registry := "/opt/local/var/macports/registry/registry.db"
+	if _, err := os.Stat(registry); err == nil {
+		err := collectMacPorts(registry, writePackage, params)
+		if err != nil {
+			params.Logger.Debug("Error collecting MacPorts packages: %v", err)
+		}
+	}
+
+	// Nix profiles
+	for _, path := range utils.GlobPaths("/nix/var/nix/profiles/default/manifest.json",
+		"/nix/var/nix/profiles/per-user/*/profile/manifest.json",
+		"/Users/*/.nix-profile/manifest.json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		var manifest struct {
+			Elements json.RawMessage `json:"elements"`
+		}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		// Elements are a list in version 2 of the manifest and a map indexed by name in version 3
+		var elements []map[string]interface{}
+		if err := json.Unmarshal(manifest.Elements, &elements); err != nil {
+			var named map[string]map[string]interface{}
+			if err := json.Unmarshal(manifest.Elements, &named); err != nil {
+				params.Logger.Debug("Error parsing elements of %s: %v", path, err)
+				continue
+			}
+			for name, element := range named {
+				element["name"] = name
+				elements = append(elements, element)
+			}
+		}
+		for _, element := range elements {
+			storePaths, _ := element["storePaths"].([]interface{})
+			var paths []string
+			for _, storePath := range storePaths {
+				paths = append(paths, fmt.Sprintf("%v", storePath))
+			}
+			name := element["name"]
+			if name == nil {
+				name = element["attrPath"]
+			}
+			writePackage(path, fileModTime(path), map[string]interface{}{
+				"manager":     "nix",
+				"type":        "profile_element",
+				"name":        name,
+				"source":      element["originalUrl"],
+				"store_paths": strings.Join(paths, ", "),
+			})
+		}
+	}
+
+	return nil
+}
+
+// collectMacPorts lists the ports of the MacPorts registry
+func collectMacPorts(registry string, writePackage func(string, string, map[string]interface{}), params mod.ModuleParams) error {
+	tmpDir, err := os.MkdirTemp("", "ishinobu-packages")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath, err := utils.CopyDatabase(registry, tmpDir)
+	if err != nil {
+		return fmt.Errorf("error copying database: %v", err)
+	}
+
+	rows, err := utils.QuerySQLite(dbPath, "SELECT name, version, revision, variants, date, requested, state FROM ports")
+	if err != nil {
+		return fmt.Errorf("error querying SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, version, variants, state sql.NullString
+		var revision, date, requested sql.NullInt64
+		if err := rows.Scan(&name, &version, &revision, &variants, &date, &requested, &state); err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+		writePackage(registry, utils.ConvertUnixTimestamp(date.Int64), map[string]interface{}{
+			"manager":              "macports",
+			"type":                 "port",
+			"name":                 name.String,
+			"version":              fmt.Sprintf("%s_%d", version.String, revision.Int64),
+			"variants":             variants.String,
+			"installed_on_request": requested.Int64 == 1,
+			"state":                state.String,
+		})
+	}
+
+	return nil
+}
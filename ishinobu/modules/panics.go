@@ -0,0 +1,250 @@
+// This module collects the evidence of unexpected reboots, which often correlate with exploitation attempts:
+//   - Kernel panics: the .panic reports and the panic-full .ips reports (bug type 210) of
+//     /Library/Logs/DiagnosticReports and its Retired folder, with the panic message, the panicked task, the
+//     kernel version, the last started kext and the kexts in the backtrace.
+//   - Shutdown causes: the "Previous shutdown cause" messages of the kernel in the unified logs over the window,
+//     with the description of the cause code.
+//   - Boot arguments: the boot-args NVRAM variable (nvram boot-args).
+//
+// The window defaults to the last 30 days and can be changed in <InputDir>/panics.json ({"days": N}).
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type PanicsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &PanicsModule{
+		Name:        "panics",
+		Description: "Collects kernel panic reports, previous shutdown causes and NVRAM boot-args"}
+	mod.RegisterModule(module)
+}
+
+func (m *PanicsModule) GetName() string {
+	return m.Name
+}
+
+func (m *PanicsModule) GetDescription() string {
+	return m.Description
+}
+
+// panicReport holds the fields extracted from a kernel panic report
+type panicReport struct {
+	Timestamp     string
+	OSVersion     string
+	Message       string
+	PanickedTask  string
+	KernelVersion string
+	LastKext      string
+	BacktraceKext []string
+}
+
+var (
+	panicMessageRegex  = regexp.MustCompile(`panic\(cpu \d+ caller [^)]*\):\s*(.*)`)
+	panicTaskRegex     = regexp.MustCompile(`Panicked task [^\n]*?pid \d+: ([^\n]+)`)
+	panicKernelRegex   = regexp.MustCompile(`Kernel version:\s*\n?\s*([^\n]+)`)
+	panicLastKextRegex = regexp.MustCompile(`last started kext at \d+:\s*(\S+)`)
+	panicKextRegex     = regexp.MustCompile(`^\s*((?:com|org|net|io)\.[\w.-]+)\(`)
+	shutdownCauseRegex = regexp.MustCompile(`Previous shutdown cause:\s*(-?\d+)`)
+	// Descriptions of the shutdown cause codes
+	shutdownCauses = map[int]string{
+		5:    "normal shutdown",
+		3:    "hard shutdown (power button)",
+		0:    "power disconnected",
+		-3:   "multiple temperature sensors exceeded the limit",
+		-60:  "bad master directory block",
+		-61:  "watchdog timer",
+		-62:  "watchdog timer (system hang)",
+		-64:  "kernel panic",
+		-71:  "memory temperature",
+		-74:  "battery temperature",
+		-75:  "power adapter communication",
+		-78:  "incorrect current from power adapter",
+		-79:  "incorrect current from battery",
+		-86:  "proximity temperature",
+		-95:  "CPU temperature",
+		-100: "power supply temperature",
+		-103: "battery cell under voltage",
+		-104: "battery empty",
+		-128: "unknown, possibly memory",
+	}
+)
+
+func (m *PanicsModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeRecord := func(sourceFile, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Kernel panic reports
+	for _, path := range utils.GlobPaths("/Library/Logs/DiagnosticReports/*.panic", "/Library/Logs/DiagnosticReports/Retired/*.panic",
+		"/Library/Logs/DiagnosticReports/*.ips", "/Library/Logs/DiagnosticReports/Retired/*.ips") {
+		report, ok, err := parsePanicReport(path)
+		if err != nil {
+			params.Logger.Debug("Error parsing panic report %s: %v", path, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		eventTimestamp := report.Timestamp
+		if eventTimestamp == "" {
+			eventTimestamp = fileModTime(path)
+		}
+		writeRecord(path, eventTimestamp, map[string]interface{}{
+			"type":              "panic",
+			"message":           report.Message,
+			"panicked_task":     report.PanickedTask,
+			"kernel_version":    report.KernelVersion,
+			"os_version":        report.OSVersion,
+			"last_kext":         report.LastKext,
+			"backtrace_kexts":   strings.Join(report.BacktraceKext, ", "),
+			"shutdown_cause":    "",
+			"cause_description": "",
+		})
+	}
+
+	// Previous shutdown causes
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `process == "kernel" AND eventMessage CONTAINS "Previous shutdown cause"`,
+		Info:      true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		params.Logger.Debug("Error querying unified logs: %v", err)
+	}
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := recordData["message"].(string)
+		match := shutdownCauseRegex.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		recordData["type"] = "shutdown_cause"
+		recordData["shutdown_cause"] = match[1]
+		recordData["cause_description"] = ""
+		if code, err := strconv.Atoi(match[1]); err == nil {
+			recordData["cause_description"] = shutdownCauses[code]
+		}
+		writeRecord("unifiedlogs", timestamp, recordData)
+	}
+
+	// Boot arguments
+	output, err := exec.Command("nvram", "boot-args").Output()
+	bootArgs := ""
+	if err == nil {
+		_, bootArgs, _ = strings.Cut(strings.TrimSpace(string(output)), "\t")
+	}
+	writeRecord("nvram", params.CollectionTimestamp, map[string]interface{}{
+		"type":      "boot_args",
+		"boot_args": bootArgs,
+		"set":       err == nil,
+	})
+
+	return nil
+}
+
+// parsePanicReport parses a kernel panic report. Reports start with a JSON header line, followed by a JSON body
+// with the panic string (panicString, or macOSPanicString for the panics of the bridge OS) or by the text of
+// the panic on older releases. ok is false for .ips reports that are not panics.
+func parsePanicReport(path string) (panicReport, bool, error) {
+	var report panicReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, false, err
+	}
+
+	headerLine, body, _ := strings.Cut(string(data), "\n")
+	var header ipsHeader
+	if err := json.Unmarshal([]byte(headerLine), &header); err != nil {
+		// Legacy reports are plain text
+		body = string(data)
+	}
+	if filepath.Ext(path) == ".ips" && header.BugType != "210" {
+		return report, false, nil
+	}
+	report.Timestamp = parseCrashReportDate(header.Timestamp)
+	report.OSVersion = header.OSVersion
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &fields); err == nil {
+		for _, key := range []string{"panicString", "macOSPanicString"} {
+			if text, ok := fields[key].(string); ok && text != "" {
+				body = text
+				break
+			}
+		}
+		if date, ok := fields["date"].(string); ok && report.Timestamp == "" {
+			report.Timestamp = parseCrashReportDate(date)
+		}
+	}
+
+	if match := panicMessageRegex.FindStringSubmatch(body); match != nil {
+		report.Message = strings.TrimSpace(match[1])
+	} else {
+		first, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+		report.Message = strings.TrimSpace(first)
+	}
+	if match := panicTaskRegex.FindStringSubmatch(body); match != nil {
+		report.PanickedTask = strings.TrimSpace(match[1])
+	}
+	if match := panicKernelRegex.FindStringSubmatch(body); match != nil {
+		report.KernelVersion = strings.TrimSpace(match[1])
+	}
+	if match := panicLastKextRegex.FindStringSubmatch(body); match != nil {
+		report.LastKext = match[1]
+	}
+	if _, backtrace, found := strings.Cut(body, "Kernel Extensions in backtrace:"); found {
+		for _, line := range strings.Split(backtrace, "\n")[1:] {
+			match := panicKextRegex.FindStringSubmatch(line)
+			if match == nil {
+				if strings.TrimSpace(line) == "" {
+					break
+				}
+				continue
+			}
+			report.BacktraceKext = append(report.BacktraceKext, match[1])
+		}
+	}
+
+	return report, true, nil
+}
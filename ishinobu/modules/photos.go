@@ -0,0 +1,193 @@
+// This module collects the metadata of the assets of each Photos library without copying any media:
+// - /Users/*/Pictures/*.photoslibrary/database/Photos.sqlite
+// Each asset is emitted with its file name, original file name, directory in the library, importing
+// application, creation/import/modification dates, whether it has location data, and whether it is
+// a screenshot, hidden or in the trash.
+// The databases are copied to a temporary folder before being queried.
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type PhotosModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &PhotosModule{
+		Name:        "photos",
+		Description: "Collects asset metadata from Photos libraries"}
+	mod.RegisterModule(module)
+}
+
+func (m *PhotosModule) GetName() string {
+	return m.Name
+}
+
+func (m *PhotosModule) GetDescription() string {
+	return m.Description
+}
+
+// ZKINDSUBTYPE value of screenshots
+const photosScreenshotSubtype = 10
+
+// Photos stores -180 as latitude and longitude of assets without location
+const photosNoLocation = -180.0
+
+func (m *PhotosModule) Run(params mod.ModuleParams) error {
+	dbPaths := utils.GlobPaths("/Users/*/Pictures/*.photoslibrary/database/Photos.sqlite")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-photos")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parsePhotosLibrary(dst, dbPath, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing Photos database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parsePhotosLibrary(dbPath string, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	username := utils.GetUsernameFromPath(sourceFile)
+	library := filepath.Dir(filepath.Dir(sourceFile))
+
+	// macOS 11+ stores the assets in ZASSET, macOS 10.15 in ZGENERICASSET without the importer bundle identifier.
+	query := `
+		SELECT
+			ZASSET.ZUUID,
+			ZASSET.ZFILENAME,
+			ZASSET.ZDIRECTORY,
+			ZADDITIONALASSETATTRIBUTES.ZORIGINALFILENAME,
+			ZADDITIONALASSETATTRIBUTES.ZIMPORTEDBYBUNDLEIDENTIFIER,
+			ZASSET.ZDATECREATED,
+			ZASSET.ZADDEDDATE,
+			ZASSET.ZMODIFICATIONDATE,
+			ZASSET.ZLATITUDE,
+			ZASSET.ZLONGITUDE,
+			ZASSET.ZKINDSUBTYPE,
+			ZASSET.ZHIDDEN,
+			ZASSET.ZTRASHEDSTATE
+		FROM ZASSET
+			LEFT JOIN ZADDITIONALASSETATTRIBUTES ON ZADDITIONALASSETATTRIBUTES.ZASSET = ZASSET.Z_PK
+		ORDER BY ZASSET.ZADDEDDATE`
+	legacyQuery := `
+		SELECT
+			ZGENERICASSET.ZUUID,
+			ZGENERICASSET.ZFILENAME,
+			ZGENERICASSET.ZDIRECTORY,
+			ZADDITIONALASSETATTRIBUTES.ZORIGINALFILENAME,
+			NULL,
+			ZGENERICASSET.ZDATECREATED,
+			ZGENERICASSET.ZADDEDDATE,
+			ZGENERICASSET.ZMODIFICATIONDATE,
+			ZGENERICASSET.ZLATITUDE,
+			ZGENERICASSET.ZLONGITUDE,
+			ZGENERICASSET.ZKINDSUBTYPE,
+			ZGENERICASSET.ZHIDDEN,
+			ZGENERICASSET.ZTRASHEDSTATE
+		FROM ZGENERICASSET
+			LEFT JOIN ZADDITIONALASSETATTRIBUTES ON ZADDITIONALASSETATTRIBUTES.ZASSET = ZGENERICASSET.Z_PK
+		ORDER BY ZGENERICASSET.ZADDEDDATE`
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to legacy Photos query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, legacyQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var uuid, filename, directory, originalFilename, importedBy sql.NullString
+		var dateCreated, addedDate, modificationDate, latitude, longitude sql.NullFloat64
+		var kindSubtype, hidden, trashed sql.NullInt64
+		err := rows.Scan(&uuid, &filename, &directory, &originalFilename, &importedBy, &dateCreated, &addedDate,
+			&modificationDate, &latitude, &longitude, &kindSubtype, &hidden, &trashed)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["library"] = library
+		recordData["uuid"] = uuid.String
+		recordData["filename"] = filename.String
+		recordData["directory"] = directory.String
+		recordData["original_filename"] = originalFilename.String
+		recordData["imported_by"] = importedBy.String
+		recordData["creation_time"] = ""
+		if dateCreated.Valid {
+			recordData["creation_time"] = utils.ConvertCFAbsoluteTime(dateCreated.Float64)
+		}
+		recordData["import_time"] = ""
+		if addedDate.Valid {
+			recordData["import_time"] = utils.ConvertCFAbsoluteTime(addedDate.Float64)
+		}
+		recordData["modification_time"] = ""
+		if modificationDate.Valid {
+			recordData["modification_time"] = utils.ConvertCFAbsoluteTime(modificationDate.Float64)
+		}
+		recordData["has_location"] = latitude.Valid && longitude.Valid &&
+			latitude.Float64 != photosNoLocation && longitude.Float64 != photosNoLocation &&
+			!(latitude.Float64 == 0 && longitude.Float64 == 0)
+		recordData["screenshot"] = kindSubtype.Int64 == photosScreenshotSubtype
+		recordData["hidden"] = hidden.Int64 == 1
+		recordData["trashed"] = trashed.Int64 == 1
+
+		eventTimestamp := recordData["import_time"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
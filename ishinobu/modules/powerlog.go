@@ -0,0 +1,264 @@
+// This module extracts device activity from PowerLog to corroborate user presence:
+//   - /private/var/db/powerlog/Library/BatteryLife/CurrentPowerlog.PLSQL
+//   - /private/var/db/powerlog/Library/BatteryLife/Archives/*.PLSQL.gz (decompressed before being queried)
+//
+// Three kinds of records are emitted:
+//   - charging_session: intervals with external power connected (PLBatteryAgent_EventBackward_Battery),
+//     with the battery level at the start and end of the session.
+//   - display_on: intervals with the display active (PLDisplayAgent tables).
+//   - process_energy: per-process CPU and energy usage of the coalition intervals (PLCoalitionAgent).
+package modules
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type PowerLogModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &PowerLogModule{
+		Name:        "powerlog",
+		Description: "Collects charging sessions, display-on intervals and per-process energy usage from PowerLog"}
+	mod.RegisterModule(module)
+}
+
+func (m *PowerLogModule) GetName() string {
+	return m.Name
+}
+
+func (m *PowerLogModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	// Tables and columns reporting the display state, depending on the macOS version
+	powerLogDisplayQueries = []string{
+		"SELECT timestamp, Active FROM PLDisplayAgent_EventForward_Display ORDER BY timestamp",
+		"SELECT timestamp, Active FROM PLDisplayAgent_EventPoint_Display ORDER BY timestamp",
+		"SELECT timestamp, Brightness FROM PLDisplayAgent_EventForward_Display ORDER BY timestamp",
+	}
+	powerLogProcessQueries = []string{
+		"SELECT * FROM PLCoalitionAgent_EventInterval_CoalitionInterval",
+		"SELECT * FROM PLProcessMonitorAgent_EventInterval_ProcessMonitorInterval",
+	}
+)
+
+// powerLogState is a timestamped on/off state and the battery level when known
+type powerLogState struct {
+	Timestamp float64
+	On        bool
+	Level     sql.NullFloat64
+}
+
+func (m *PowerLogModule) Run(params mod.ModuleParams) error {
+	dbPaths := utils.GlobPaths("/private/var/db/powerlog/Library/BatteryLife/CurrentPowerlog.PLSQL",
+		"/private/var/db/powerlog/Library/BatteryLife/Archives/*.PLSQL.gz")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-powerlog")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		var dst string
+		if strings.HasSuffix(dbPath, ".gz") {
+			dst = filepath.Join(dstDir, strings.TrimSuffix(filepath.Base(dbPath), ".gz"))
+			err = gunzipFile(dbPath, dst)
+		} else {
+			dst, err = utils.CopyDatabase(dbPath, dstDir)
+		}
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parsePowerLog(dst, dbPath, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing PowerLog %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parsePowerLog(dbPath string, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	writePowerLog := func(eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Charging sessions
+	states, err := queryPowerLogStates(dbPath, "SELECT timestamp, ExternalConnected, Level FROM PLBatteryAgent_EventBackward_Battery ORDER BY timestamp")
+	if err != nil {
+		params.Logger.Debug("Error querying battery events: %v", err)
+	}
+	for _, session := range powerLogIntervals(states) {
+		start, end := session[0], session[1]
+		recordData := map[string]interface{}{
+			"type":        "charging_session",
+			"start_time":  utils.ConvertUnixTimestamp(int64(start.Timestamp)),
+			"end_time":    "",
+			"start_level": start.Level.Float64,
+			"end_level":   "",
+		}
+		if end != nil {
+			recordData["end_time"] = utils.ConvertUnixTimestamp(int64(end.Timestamp))
+			recordData["end_level"] = end.Level.Float64
+		}
+		writePowerLog(recordData["start_time"].(string), recordData)
+	}
+
+	// Display on intervals
+	for _, query := range powerLogDisplayQueries {
+		states, err := queryPowerLogStates(dbPath, query)
+		if err != nil {
+			continue
+		}
+		for _, interval := range powerLogIntervals(states) {
+			recordData := map[string]interface{}{
+				"type":       "display_on",
+				"start_time": utils.ConvertUnixTimestamp(int64(interval[0].Timestamp)),
+				"end_time":   "",
+			}
+			if interval[1] != nil {
+				recordData["end_time"] = utils.ConvertUnixTimestamp(int64(interval[1].Timestamp))
+			}
+			writePowerLog(recordData["start_time"].(string), recordData)
+		}
+		break
+	}
+
+	// Per-process energy usage, columns vary between versions and are emitted as they are
+	for _, query := range powerLogProcessQueries {
+		rows, err := utils.QuerySQLiteMaps(dbPath, query)
+		if err != nil {
+			continue
+		}
+		for _, row := range rows {
+			eventTimestamp := ""
+			if timestamp, ok := row["timestamp"].(float64); ok {
+				eventTimestamp = utils.ConvertUnixTimestamp(int64(timestamp))
+				row["timestamp"] = eventTimestamp
+			}
+			row["type"] = "process_energy"
+			writePowerLog(eventTimestamp, row)
+		}
+		break
+	}
+
+	return nil
+}
+
+// queryPowerLogStates runs a query returning a timestamp, a value considered on when greater than zero
+// and optionally a battery level
+func queryPowerLogStates(dbPath string, query string) ([]powerLogState, error) {
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []powerLogState
+	for rows.Next() {
+		var timestamp, value sql.NullFloat64
+		var state powerLogState
+		targets := []interface{}{&timestamp, &value}
+		if len(columns) > 2 {
+			targets = append(targets, &state.Level)
+		}
+		if err := rows.Scan(targets...); err != nil || !timestamp.Valid {
+			continue
+		}
+		state.Timestamp = timestamp.Float64
+		state.On = value.Float64 > 0
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// powerLogIntervals returns the intervals where the state is on as start and end states.
+// The end is nil when the state is still on at the end of the log.
+func powerLogIntervals(states []powerLogState) [][2]*powerLogState {
+	var intervals [][2]*powerLogState
+	var start *powerLogState
+	for i := range states {
+		state := &states[i]
+		if state.On && start == nil {
+			start = state
+		} else if !state.On && start != nil {
+			intervals = append(intervals, [2]*powerLogState{start, state})
+			start = nil
+		}
+	}
+	if start != nil {
+		intervals = append(intervals, [2]*powerLogState{start, nil})
+	}
+	return intervals
+}
+
+// gunzipFile decompresses a gzip file to dst
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, reader)
+	return err
+}
@@ -0,0 +1,279 @@
+// This module collects the CUPS printing history:
+//   - /private/var/log/cups/page_log*: pages printed per job with the printer, user, job name, originating host and media.
+//   - /private/var/log/cups/access_log*: IPP requests (job submissions, cancellations, printer changes) with the client and user.
+//   - /private/var/spool/cups/c*: job control files of the jobs kept by CUPS (PreserveJobHistory), with the
+//     document name, user, printer, originating host and creation/completion times. The data files (d*) of the
+//     jobs are listed with their size, as they contain the printed documents while the job files are preserved.
+package modules
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type PrintingModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &PrintingModule{
+		Name:        "printing",
+		Description: "Collects CUPS print jobs from the page log, access log and job control files"}
+	mod.RegisterModule(module)
+}
+
+func (m *PrintingModule) GetName() string {
+	return m.Name
+}
+
+func (m *PrintingModule) GetDescription() string {
+	return m.Description
+}
+
+const cupsLogDateLayout = "02/Jan/2006:15:04:05 -0700"
+
+var (
+	// printer user job-id [date] page-number num-copies job-billing job-originating-host-name job-name media sides
+	cupsPageLogRegex = regexp.MustCompile(`^(\S+) (\S+) (\d+) \[([^\]]+)\] (\S+) (\S+) (\S+) (\S+) (.*) (\S+) (\S+)$`)
+	// host group user [date] "method resource version" status bytes ipp-operation ipp-status
+	cupsAccessLogRegex = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "(\S+) (\S+) [^"]*" (\d+) (\S+)(?: (\S+) (\S+))?`)
+	// Attributes of the job control files that are emitted
+	cupsJobAttributes = map[string]string{
+		"job-name":                  "job_name",
+		"job-originating-user-name": "user",
+		"job-originating-host-name": "host",
+		"job-printer-uri":           "printer_uri",
+		"document-name-supplied":    "document_name",
+		"document-format-supplied":  "document_format",
+		"job-k-octets":              "size_kb",
+		"job-impressions-completed": "pages",
+		"job-state":                 "state",
+		"time-at-creation":          "created",
+		"time-at-processing":        "processed",
+		"time-at-completed":         "completed",
+	}
+)
+
+// IPP value tags used by the job control files
+const (
+	ippTagEnd      = 0x03
+	ippTagInteger  = 0x21
+	ippTagEnum     = 0x23
+	ippTagDelimMax = 0x0f
+)
+
+func (m *PrintingModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writePrint := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for _, path := range utils.GlobPaths("/private/var/log/cups/page_log*") {
+		err := readCupsLog(path, func(line string) {
+			match := cupsPageLogRegex.FindStringSubmatch(line)
+			if match == nil {
+				return
+			}
+			timestamp := cupsLogTime(match[4])
+			writePrint(path, timestamp, map[string]interface{}{
+				"type":      "page",
+				"printer":   match[1],
+				"user":      match[2],
+				"job_id":    match[3],
+				"timestamp": timestamp,
+				"page":      match[5],
+				"copies":    match[6],
+				"billing":   cupsLogValue(match[7]),
+				"host":      cupsLogValue(match[8]),
+				"job_name":  cupsLogValue(match[9]),
+				"media":     cupsLogValue(match[10]),
+				"sides":     cupsLogValue(match[11]),
+			})
+		})
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+		}
+	}
+
+	for _, path := range utils.GlobPaths("/private/var/log/cups/access_log*") {
+		err := readCupsLog(path, func(line string) {
+			match := cupsAccessLogRegex.FindStringSubmatch(line)
+			if match == nil {
+				return
+			}
+			timestamp := cupsLogTime(match[4])
+			writePrint(path, timestamp, map[string]interface{}{
+				"type":          "request",
+				"host":          match[1],
+				"user":          cupsLogValue(match[3]),
+				"timestamp":     timestamp,
+				"method":        match[5],
+				"resource":      match[6],
+				"status":        match[7],
+				"bytes":         match[8],
+				"ipp_operation": cupsLogValue(match[9]),
+				"ipp_status":    cupsLogValue(match[10]),
+			})
+		})
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+		}
+	}
+
+	for _, path := range utils.GlobPaths("/private/var/spool/cups/c*") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		recordData := map[string]interface{}{
+			"type":   "job",
+			"job_id": strings.TrimLeft(strings.TrimPrefix(filepath.Base(path), "c"), "0"),
+		}
+		for _, name := range cupsJobAttributes {
+			recordData[name] = ""
+		}
+		for name, value := range parseIPPAttributes(data) {
+			if field, ok := cupsJobAttributes[name]; ok {
+				recordData[field] = value
+			}
+		}
+		for _, field := range []string{"created", "processed", "completed"} {
+			if seconds, ok := recordData[field].(int32); ok && seconds > 0 {
+				recordData[field] = utils.ConvertUnixTimestamp(int64(seconds))
+			}
+		}
+
+		// Data files of the job: d<job id>-<document number>
+		var dataFiles []string
+		for _, dataFile := range utils.GlobPaths(filepath.Join(filepath.Dir(path), "d"+strings.TrimPrefix(filepath.Base(path), "c")+"-*")) {
+			if info, err := os.Stat(dataFile); err == nil {
+				dataFiles = append(dataFiles, fmt.Sprintf("%s (%d bytes)", dataFile, info.Size()))
+			}
+		}
+		recordData["data_files"] = strings.Join(dataFiles, ", ")
+
+		eventTimestamp, _ := recordData["created"].(string)
+		writePrint(path, eventTimestamp, recordData)
+	}
+
+	return nil
+}
+
+// readCupsLog calls fn for every non-empty line of a CUPS log file
+func readCupsLog(path string, fn func(line string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// cupsLogTime converts a CUPS log date to TimeFormat
+func cupsLogTime(value string) string {
+	t, err := time.Parse(cupsLogDateLayout, value)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(utils.TimeFormat)
+}
+
+// cupsLogValue returns an empty string for the "-" placeholder of missing values
+func cupsLogValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// parseIPPAttributes decodes the attributes of an IPP message, as stored in the CUPS job control files.
+// Integers and enums are returned as int32, other values as strings. Only the first value of multi-valued
+// attributes is kept.
+func parseIPPAttributes(data []byte) map[string]interface{} {
+	attributes := make(map[string]interface{})
+	// version (2), operation or status (2), request id (4)
+	if len(data) < 8 {
+		return attributes
+	}
+	offset := 8
+	name := ""
+	for offset < len(data) {
+		tag := data[offset]
+		offset++
+		if tag == ippTagEnd {
+			break
+		}
+		if tag <= ippTagDelimMax {
+			continue
+		}
+
+		if offset+2 > len(data) {
+			break
+		}
+		nameLength := int(binary.BigEndian.Uint16(data[offset:]))
+		offset += 2
+		if offset+nameLength+2 > len(data) {
+			break
+		}
+		// An empty name is an additional value of the previous attribute
+		additional := nameLength == 0
+		if !additional {
+			name = string(data[offset : offset+nameLength])
+		}
+		offset += nameLength
+		valueLength := int(binary.BigEndian.Uint16(data[offset:]))
+		offset += 2
+		if offset+valueLength > len(data) {
+			break
+		}
+		value := data[offset : offset+valueLength]
+		offset += valueLength
+
+		if additional {
+			continue
+		}
+		if (tag == ippTagInteger || tag == ippTagEnum) && len(value) == 4 {
+			attributes[name] = int32(binary.BigEndian.Uint32(value))
+		} else {
+			attributes[name] = string(value)
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,138 @@
+// This module collects the running processes and verifies the code signature of their executables.
+// Commands:
+// - ps -axo pid=,ppid=,user=,lstart=,comm=: PID, parent PID, user, start time and executable path.
+// - ps -axo pid=,args=: Command line arguments.
+// - codesign -dv / codesign --verify / spctl --assess: Signature, team ID and notarization of each executable.
+// Unsigned, ad-hoc signed and invalid executables are flagged as suspicious. The signature of executables without
+// an absolute path or deleted from disk is unknown and not flagged.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ProcessesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &ProcessesModule{
+		Name:        "processes",
+		Description: "Collects running processes and verifies the code signature of their executables"}
+	mod.RegisterModule(module)
+}
+
+func (m *ProcessesModule) GetName() string {
+	return m.Name
+}
+
+func (m *ProcessesModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *ProcessesModule) Run(params mod.ModuleParams) error {
+	processes, err := runPs("pid=,ppid=,user=,lstart=,comm=")
+	if err != nil {
+		return fmt.Errorf("error running command: %v", err)
+	}
+
+	arguments := make(map[string]string)
+	argsOutput, err := runPs("pid=,args=")
+	if err != nil {
+		params.Logger.Debug("Error collecting process arguments: %v", err)
+	}
+	for _, line := range argsOutput {
+		pid, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		arguments[pid] = strings.TrimSpace(args)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Executables are verified only once even if several processes share them
+	signatures := make(map[string]utils.CodeSignature)
+
+	for _, line := range processes {
+		// pid ppid user Mon Jan 2 15:04:05 2006 path
+		cols := strings.Fields(line)
+		if len(cols) < 9 {
+			continue
+		}
+
+		pid := cols[0]
+		path := strings.Join(cols[8:], " ")
+
+		startTime := params.CollectionTimestamp
+		parsedStart, err := time.Parse("Mon Jan 2 15:04:05 2006", strings.Join(cols[3:8], " "))
+		if err != nil {
+			params.Logger.Debug("Error parsing start time: %v", err)
+		} else {
+			startTime = parsedStart.UTC().Format(utils.TimeFormat)
+		}
+
+		signature, ok := signatures[path]
+		if !ok {
+			signature = utils.GetCodeSignature(path)
+			signatures[path] = signature
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["pid"] = pid
+		recordData["ppid"] = cols[1]
+		recordData["user"] = cols[2]
+		recordData["start_time"] = startTime
+		recordData["path"] = path
+		recordData["arguments"] = arguments[pid]
+		recordData["signature_status"] = signature.Status
+		recordData["signature_valid"] = signature.Valid
+		recordData["signing_identifier"] = signature.Identifier
+		recordData["team_id"] = signature.TeamID
+		recordData["authority"] = strings.Join(signature.Authorities, ",")
+		recordData["notarized"] = signature.Notarized
+		recordData["assessment"] = signature.Assessment
+		recordData["suspicious"] = signature.IsSuspicious()
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      startTime,
+			Data:                recordData,
+			SourceFile:          "ps",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// runPs runs ps for all processes with the given output format in UTC and returns the non-empty lines.
+func runPs(format string) ([]string, error) {
+	cmd := exec.Command("ps", "-axo", format)
+	cmd.Env = append(cmd.Env, "TZ=UTC")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,285 @@
+// This module walks the Downloads folders and the user-writable locations holding executables and records the
+// download provenance stored in the extended attributes of each file:
+//   - com.apple.quarantine: quarantine flags, time, downloading agent and event ID (to join with the
+//     QuarantineEventsV2 database).
+//   - com.apple.provenance: the provenance ID set by Gatekeeper, resolved with the provenance_tracking table of
+//     /var/db/SystemPolicyConfiguration/ExecPolicy when readable (root).
+//   - com.apple.metadata:kMDItemWhereFroms: the download and referrer URLs.
+//
+// The MD5 and SHA-256 hashes of the files are computed. Application bundles (.app, .pkg, ...) are reported as one
+// item without walking their content.
+// The locations, the depth of the walk and the largest file hashed are configured in <InputDir>/provenance.json:
+//
+//	{
+//	  "paths": ["/Users/*/Downloads", "/Users/*/Applications"],
+//	  "max_depth": 4,
+//	  "max_hash_size": 104857600
+//	}
+package modules
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type ProvenanceModule struct {
+	Name        string
+	Description string
+}
+
+// ProvenanceConfig is the configuration of the provenance module.
+type ProvenanceConfig struct {
+	Paths       []string `json:"paths"`
+	MaxDepth    int      `json:"max_depth"`
+	MaxHashSize int64    `json:"max_hash_size"`
+}
+
+func init() {
+	module := &ProvenanceModule{
+		Name:        "provenance",
+		Description: "Records the quarantine, provenance and where-from extended attributes and hashes of downloaded and user-writable executables"}
+	mod.RegisterModule(module)
+}
+
+func (m *ProvenanceModule) GetName() string {
+	return m.Name
+}
+
+func (m *ProvenanceModule) GetDescription() string {
+	return m.Description
+}
+
+const (
+	quarantineAttribute = "com.apple.quarantine"
+	provenanceAttribute = "com.apple.provenance"
+	whereFromsAttribute = "com.apple.metadata:kMDItemWhereFroms"
+	execPolicyPath      = "/var/db/SystemPolicyConfiguration/ExecPolicy"
+)
+
+var (
+	provenancePaths = []string{
+		"/Users/*/Downloads",
+		"/Users/*/Desktop",
+		"/Users/*/Applications",
+		"/Users/*/bin",
+		"/Users/*/.local/bin",
+		"/Users/Shared",
+		"/private/tmp",
+		"/private/var/tmp",
+		"/usr/local/bin",
+		"/opt/homebrew/bin",
+	}
+	// Bundles reported as a single item
+	provenanceBundleExtensions = []string{".app", ".pkg", ".mpkg", ".bundle", ".framework", ".kext", ".plugin", ".appex", ".xpc"}
+)
+
+func (m *ProvenanceModule) Run(params mod.ModuleParams) error {
+	config := ProvenanceConfig{Paths: provenancePaths, MaxDepth: 4, MaxHashSize: 100 * 1024 * 1024}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	provenance := readProvenanceTracking(params)
+
+	writeItem := func(path string, entry fs.DirEntry) {
+		info, err := entry.Info()
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			return
+		}
+		recordData := map[string]interface{}{
+			"username":          utils.GetUsernameFromPath(path),
+			"path":              path,
+			"size":              info.Size(),
+			"modified":          info.ModTime().UTC().Format(utils.TimeFormat),
+			"bundle":            entry.IsDir(),
+			"md5":               "",
+			"sha256":            "",
+			"quarantine_flags":  "",
+			"quarantine_time":   "",
+			"quarantine_agent":  "",
+			"quarantine_event":  "",
+			"provenance_id":     "",
+			"provenance_source": "",
+			"where_froms":       "",
+			"attributes":        "",
+		}
+		if !entry.IsDir() && info.Size() <= config.MaxHashSize {
+			if md5Sum, sha256Sum, err := utils.HashFile(path); err == nil {
+				recordData["md5"] = md5Sum
+				recordData["sha256"] = sha256Sum
+			}
+		}
+
+		names, err := utils.ListExtendedAttributes(path)
+		if err != nil {
+			params.Logger.Debug("Error listing extended attributes of %s: %v", path, err)
+		}
+		recordData["attributes"] = strings.Join(names, ", ")
+		for _, name := range names {
+			switch name {
+			case quarantineAttribute, provenanceAttribute, whereFromsAttribute:
+			default:
+				continue
+			}
+			value, err := utils.GetExtendedAttribute(path, name)
+			if err != nil {
+				params.Logger.Debug("Error reading %s of %s: %v", name, path, err)
+				continue
+			}
+			switch name {
+			case quarantineAttribute:
+				flags, timestamp, agent, event := parseQuarantineAttribute(string(value))
+				recordData["quarantine_flags"] = flags
+				recordData["quarantine_time"] = timestamp
+				recordData["quarantine_agent"] = agent
+				recordData["quarantine_event"] = event
+			case provenanceAttribute:
+				if id, ok := parseProvenanceAttribute(value); ok {
+					recordData["provenance_id"] = id
+					recordData["provenance_source"] = provenance[id]
+				}
+			case whereFromsAttribute:
+				var urls []string
+				if _, err := plist.Unmarshal(value, &urls); err == nil {
+					recordData["where_froms"] = strings.Join(urls, ", ")
+				}
+			}
+		}
+
+		eventTimestamp, _ := recordData["quarantine_time"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = recordData["modified"].(string)
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for _, root := range utils.GlobPaths(config.Paths...) {
+		depth := strings.Count(filepath.Clean(root), string(os.PathSeparator))
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				params.Logger.Debug("Error walking %s: %v", path, err)
+				return nil
+			}
+			if entry.IsDir() {
+				if isProvenanceBundle(path) {
+					writeItem(path, entry)
+					return filepath.SkipDir
+				}
+				if strings.Count(path, string(os.PathSeparator))-depth >= config.MaxDepth {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.Type().IsRegular() {
+				writeItem(path, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			params.Logger.Debug("Error walking %s: %v", root, err)
+		}
+	}
+
+	return nil
+}
+
+// parseQuarantineAttribute splits a com.apple.quarantine value (flags;hexadecimal time;agent;event ID) and
+// converts the time to TimeFormat
+func parseQuarantineAttribute(value string) (string, string, string, string) {
+	fields := strings.SplitN(strings.TrimRight(value, "\x00"), ";", 4)
+	for len(fields) < 4 {
+		fields = append(fields, "")
+	}
+	timestamp := ""
+	if seconds, err := strconv.ParseInt(fields[1], 16, 64); err == nil && seconds > 0 {
+		timestamp = utils.ConvertUnixTimestamp(seconds)
+	}
+	return fields[0], timestamp, fields[2], fields[3]
+}
+
+// parseProvenanceAttribute returns the provenance ID of a com.apple.provenance value:
+// version (1 byte), flags (2 bytes) and the little-endian ID (8 bytes)
+func parseProvenanceAttribute(value []byte) (int64, bool) {
+	if len(value) < 11 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(value[3:11])), true
+}
+
+// readProvenanceTracking returns a description of the source (bundle, signing identifier, team and URL) of each
+// provenance ID of the ExecPolicy database
+func readProvenanceTracking(params mod.ModuleParams) map[int64]string {
+	sources := make(map[int64]string)
+	if _, err := os.Stat(execPolicyPath); err != nil {
+		return sources
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-provenance")
+	if err != nil {
+		params.Logger.Debug("Failed to create temporary directory: %v", err)
+		return sources
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dst, err := utils.CopyDatabase(execPolicyPath, tmpDir)
+	if err != nil {
+		params.Logger.Debug("Error copying database %s: %v", execPolicyPath, err)
+		return sources
+	}
+	rows, err := utils.QuerySQLiteMaps(dst, "SELECT * FROM provenance_tracking")
+	if err != nil {
+		params.Logger.Debug("Error querying %s: %v", execPolicyPath, err)
+		return sources
+	}
+	for _, row := range rows {
+		id, ok := row["pk"].(int64)
+		if !ok {
+			continue
+		}
+		var parts []string
+		for _, column := range []string{"bundle_id", "signing_identifier", "team_identifier", "url"} {
+			if value, ok := row[column]; ok && value != nil && fmt.Sprintf("%v", value) != "" {
+				parts = append(parts, fmt.Sprintf("%s=%v", column, value))
+			}
+		}
+		sources[id] = strings.Join(parts, " ")
+	}
+	return sources
+}
+
+// isProvenanceBundle reports whether a directory is a bundle reported as a single item
+func isProvenanceBundle(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	for _, bundle := range provenanceBundleExtensions {
+		if extension == bundle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+// This module collects the shared file lists (SFL2/SFL3) that store recent items and Finder favorites for each user:
+//   - /Users/*/Library/Application Support/com.apple.sharedfilelist/*.sfl2, *.sfl3
+//     (RecentDocuments, RecentApplications, RecentServers, FavoriteItems, FavoriteVolumes, ...)
+//   - /Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/*.sfl2, *.sfl3
+//     (recent documents of each application)
+//
+// The files are NSKeyedArchiver archives. The target of each item is resolved from its bookmark data.
+// Items are emitted in the order they are stored in the list, which is most recent first for recent items.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type RecentItemsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &RecentItemsModule{
+		Name:        "recentitems",
+		Description: "Collects recent documents, applications, servers and Finder favorites from shared file lists"}
+	mod.RegisterModule(module)
+}
+
+func (m *RecentItemsModule) GetName() string {
+	return m.Name
+}
+
+func (m *RecentItemsModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *RecentItemsModule) Run(params mod.ModuleParams) error {
+	paths := utils.GlobPaths(
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/*.sfl2",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/*.sfl3",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/*.sfl2",
+		"/Users/*/Library/Application Support/com.apple.sharedfilelist/com.apple.LSSharedFileList.ApplicationRecentDocuments/*.sfl3")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", path, err)
+			continue
+		}
+
+		archive, ok := root.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		items, _ := archive["items"].([]interface{})
+
+		list, application := sharedFileListName(path)
+		username := utils.GetUsernameFromPath(path)
+
+		for index, value := range items {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			recordData := make(map[string]interface{})
+			recordData["username"] = username
+			recordData["list"] = list
+			recordData["application"] = application
+			recordData["order"] = index + 1
+			recordData["name"] = item["Name"]
+			recordData["uuid"] = item["uuid"]
+			recordData["visibility"] = item["visibility"]
+
+			if url, ok := item["URL"].(string); ok {
+				recordData["url"] = url
+			}
+
+			if bookmarkData, ok := item["Bookmark"].([]byte); ok {
+				bookmark, err := utils.ParseBookmark(bookmarkData)
+				if err != nil {
+					params.Logger.Debug("Error parsing bookmark in %s: %v", path, err)
+				} else {
+					recordData["path"] = bookmark.Path
+					recordData["volume_name"] = bookmark.VolumeName
+					recordData["volume_path"] = bookmark.VolumePath
+					recordData["volume_uuid"] = bookmark.VolumeUUID
+					recordData["target_creation_time"] = bookmark.CreationDate
+					if recordData["name"] == nil && bookmark.Path != "" {
+						recordData["name"] = filepath.Base(bookmark.Path)
+					}
+				}
+			}
+
+			eventTimestamp := fileModTime(path)
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
+			}
+
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          path,
+			}
+
+			err := writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sharedFileListName returns the list name of a shared file list (RecentDocuments, FavoriteItems, ...)
+// and, for per-application recent documents, the bundle identifier of the application.
+func sharedFileListName(path string) (string, string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if filepath.Base(filepath.Dir(path)) == "com.apple.LSSharedFileList.ApplicationRecentDocuments" {
+		return "ApplicationRecentDocuments", name
+	}
+	return strings.TrimPrefix(name, "com.apple.LSSharedFileList."), ""
+}
@@ -0,0 +1,427 @@
+// This module detects third-party remote access tools and collects their configuration and connection logs:
+//   - TeamViewer: installation, client ID and unattended access settings of the preferences, incoming and
+//     outgoing connections (connections_incoming.txt, connections.txt) and the connection lines of the log files.
+//   - AnyDesk: installation, ID and unattended access settings of system.conf and user.conf, connections of
+//     connection_trace.txt and the session lines of ad.trace and ad_svc.trace.
+//   - Chrome Remote Desktop: host configuration (host ID, owner and name) and the client connections of the
+//     host log.
+//   - RustDesk: ID and custom rendezvous and relay servers of RustDesk.toml and RustDesk2.toml and the connection
+//     lines of the logs.
+//   - Splashtop and LogMeIn: installation, preferences and the session lines of the logs.
+//
+// Passwords, password hashes and keys found in the configurations are never collected, only whether they are set.
+// Settings granting unattended access are flagged.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type RemoteAccessModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &RemoteAccessModule{
+		Name:        "remoteaccess",
+		Description: "Detects TeamViewer, AnyDesk, Chrome Remote Desktop, RustDesk, Splashtop and LogMeIn and collects their configuration and connection logs"}
+	mod.RegisterModule(module)
+}
+
+func (m *RemoteAccessModule) GetName() string {
+	return m.Name
+}
+
+func (m *RemoteAccessModule) GetDescription() string {
+	return m.Description
+}
+
+// remoteAccessTool lists the artifacts of a remote access tool
+type remoteAccessTool struct {
+	Applications []string
+	Configs      []string
+	Connections  []string
+	Logs         []string
+	// Log lines containing one of the keywords are reported
+	Keywords []string
+	// Settings granting unattended access when set
+	Unattended []string
+}
+
+var (
+	remoteAccessTools = map[string]remoteAccessTool{
+		"teamviewer": {
+			Applications: []string{"/Applications/TeamViewer*.app", "/Users/*/Applications/TeamViewer*.app"},
+			Configs: []string{
+				"/Library/Preferences/com.teamviewer.teamviewer.preferences.plist",
+				"/Library/Preferences/com.teamviewer.teamviewer.preferences.Machine.plist",
+				"/Users/*/Library/Preferences/com.teamviewer.teamviewer.preferences.plist",
+				"/Users/*/Library/Preferences/com.teamviewer.TeamViewer.plist",
+			},
+			Connections: []string{
+				"/Library/Application Support/TeamViewer/connections_incoming.txt",
+				"/Users/*/Library/Application Support/TeamViewer/connections.txt",
+				"/Users/*/Library/Application Support/TeamViewer/connections_incoming.txt",
+			},
+			Logs:       []string{"/Library/Logs/TeamViewer/*.log", "/Users/*/Library/Logs/TeamViewer/*.log"},
+			Keywords:   []string{"CPersistentParticipantManager::AddParticipant", "Remote control session", "incoming connection", "Authentication", "LoginDesktopWindow"},
+			Unattended: []string{"always_online", "permanentpassword", "security_passwordstrength", "unattendedaccess"},
+		},
+		"anydesk": {
+			Applications: []string{"/Applications/AnyDesk.app", "/Users/*/Applications/AnyDesk.app"},
+			Configs: []string{
+				"/Users/*/.anydesk/system.conf",
+				"/Users/*/.anydesk/user.conf",
+				"/Library/Application Support/AnyDesk/system.conf",
+				"/private/var/root/.anydesk/system.conf",
+			},
+			Connections: []string{
+				"/Users/*/.anydesk/connection_trace.txt",
+				"/Library/Application Support/AnyDesk/connection_trace.txt",
+				"/private/var/root/.anydesk/connection_trace.txt",
+			},
+			Logs: []string{
+				"/Users/*/.anydesk/*.trace",
+				"/Library/Application Support/AnyDesk/*.trace",
+				"/private/var/root/.anydesk/*.trace",
+			},
+			Keywords:   []string{"Incoming session request", "Logged in from", "Accepting from", "Remote OS", "Remote version", "Session stopped", "File transfer", "Authenticated"},
+			Unattended: []string{"ad.anynet.pwd_hash", "ad.anynet.pwd_salt", "ad.security.unattended", "ad.security.interactive_access"},
+		},
+		"chrome_remote_desktop": {
+			Applications: []string{"/Library/PrivilegedHelperTools/ChromeRemoteDesktopHost.app", "/Applications/Chrome Remote Desktop Host Uninstaller.app"},
+			Configs:      []string{"/Library/PrivilegedHelperTools/org.chromium.chromoting.json"},
+			Logs:         []string{"/private/var/log/org.chromium.chromoting.log*"},
+			Keywords:     []string{"Client connected", "Client disconnected", "Channel IP for client", "access denied"},
+			Unattended:   []string{"host_id"},
+		},
+		"rustdesk": {
+			Applications: []string{"/Applications/RustDesk.app", "/Users/*/Applications/RustDesk.app"},
+			Configs: []string{
+				"/Users/*/Library/Preferences/com.carriez.RustDesk/RustDesk.toml",
+				"/Users/*/Library/Preferences/com.carriez.RustDesk/RustDesk2.toml",
+				"/private/var/root/Library/Preferences/com.carriez.RustDesk/RustDesk.toml",
+				"/private/var/root/Library/Preferences/com.carriez.RustDesk/RustDesk2.toml",
+			},
+			Logs: []string{
+				"/Users/*/Library/Logs/RustDesk/*.log",
+				"/Users/*/Library/Logs/RustDesk/*/*.log",
+				"/private/var/root/Library/Logs/RustDesk/*/*.log",
+			},
+			Keywords:   []string{"Connection opened from", "Connection closed", "authorized", "Login failed", "new connection", "file transfer"},
+			Unattended: []string{"password", "permanent_password", "verification-method", "approve-mode"},
+		},
+		"splashtop": {
+			Applications: []string{"/Applications/Splashtop*.app", "/Users/*/Applications/Splashtop*.app"},
+			Configs: []string{
+				"/Library/Preferences/com.splashtop.Splashtop-Streamer.plist",
+				"/Users/*/Library/Preferences/com.splashtop.Splashtop-Streamer.plist",
+				"/Users/*/Library/Preferences/com.splashtop.stb.plist",
+			},
+			Logs:       []string{"/Library/Logs/Splashtop*/*", "/Users/*/Library/Logs/Splashtop*/*", "/Users/*/Library/Logs/SPLog.txt"},
+			Keywords:   []string{"session start", "session stop", "connected", "disconnected", "client ip", "login"},
+			Unattended: []string{"securitycode", "requirepassword", "deployed"},
+		},
+		"logmein": {
+			Applications: []string{"/Applications/LogMeIn*.app", "/Applications/GoTo*.app", "/Library/Application Support/LogMeIn/*.app"},
+			Configs: []string{
+				"/Library/Preferences/com.logmein.*.plist",
+				"/Users/*/Library/Preferences/com.logmein.*.plist",
+			},
+			Logs:       []string{"/Library/Logs/LogMeIn/*.log", "/Library/Application Support/LogMeIn/Logs/*.log", "/Users/*/Library/Logs/LogMeIn*/*.log"},
+			Keywords:   []string{"remote control", "session started", "session ended", "logged in", "authentication", "connected from"},
+			Unattended: []string{"hostid", "accountid", "deployid"},
+		},
+	}
+	// Settings whose value is never collected
+	remoteAccessSecretWords = []string{"pass", "pwd", "hash", "salt", "secret", "token", "private", "key_pair", "keypair", "privkey"}
+	// Timestamps of the log lines: 2024-01-31 10:00:00, 2024/01/31 10:00:00 or 2024-01-31T10:00:00
+	remoteAccessLogTimeRegex = regexp.MustCompile(`(\d{4})[-/](\d{2})[-/](\d{2})[ T](\d{2}:\d{2}:\d{2})`)
+	// Timestamps of the TeamViewer connection logs: 31-01-2024 10:00:00
+	teamViewerTimeRegex = regexp.MustCompile(`^\d{2}-\d{2}-\d{4} \d{2}:\d{2}:\d{2}$`)
+	// Columns of the AnyDesk connection trace are separated by tabs or runs of spaces
+	anyDeskFieldRegex = regexp.MustCompile(`\t+|\s{2,}`)
+)
+
+func (m *RemoteAccessModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeRemote := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		username := utils.GetUsernameFromPath(sourceFile)
+		if username == "" && strings.HasPrefix(sourceFile, "/private/var/root") {
+			username = "root"
+		}
+		recordData["username"] = username
+		for _, key := range []string{"name", "value", "remote_id", "remote_user", "start", "end", "message"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		if _, ok := recordData["flagged"]; !ok {
+			recordData["flagged"] = false
+		}
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for name, tool := range remoteAccessTools {
+		// Installations
+		for _, path := range utils.GlobPaths(tool.Applications...) {
+			var info map[string]interface{}
+			infoPath := filepath.Join(path, "Contents", "Info.plist")
+			if err := utils.ParsePlistFile(infoPath, &info); err != nil {
+				params.Logger.Debug("Error parsing %s: %v", infoPath, err)
+			}
+			writeRemote(path, fileModTime(path), map[string]interface{}{
+				"tool":  name,
+				"type":  "installation",
+				"name":  valueOrEmpty(info["CFBundleIdentifier"]),
+				"value": valueOrEmpty(info["CFBundleShortVersionString"]),
+			})
+		}
+
+		// Configuration settings
+		for _, path := range utils.GlobPaths(tool.Configs...) {
+			settings, err := readRemoteAccessConfig(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			modified := fileModTime(path)
+			for key, value := range settings {
+				writeRemote(path, modified, map[string]interface{}{
+					"tool":    name,
+					"type":    "setting",
+					"name":    key,
+					"value":   value,
+					"flagged": value != "" && value != "false" && value != "0" && isUnattendedSetting(tool, key),
+				})
+			}
+		}
+
+		// Connection logs
+		for _, path := range utils.GlobPaths(tool.Connections...) {
+			lines, _, err := readConfigLines(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			for _, line := range lines {
+				var connection map[string]interface{}
+				if name == "anydesk" {
+					connection = parseAnyDeskConnection(line)
+				} else {
+					connection = parseTeamViewerConnection(line)
+				}
+				if connection == nil {
+					continue
+				}
+				connection["tool"] = name
+				connection["type"] = "connection"
+				connection["message"] = line
+				writeRemote(path, fmt.Sprintf("%v", connection["start"]), connection)
+			}
+		}
+
+		// Session lines of the logs
+		for _, path := range utils.GlobPaths(tool.Logs...) {
+			err := scanRemoteAccessLog(path, tool.Keywords, func(timestamp, line string) {
+				writeRemote(path, timestamp, map[string]interface{}{
+					"tool":    name,
+					"type":    "log",
+					"start":   timestamp,
+					"message": line,
+				})
+			})
+			if err != nil {
+				params.Logger.Debug("Error reading log %s: %v", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readRemoteAccessConfig returns the settings of a plist, JSON or key=value (conf, TOML) configuration file.
+// The values of secret settings are replaced by "<set>".
+func readRemoteAccessConfig(path string) (map[string]string, error) {
+	settings := make(map[string]interface{})
+	switch filepath.Ext(path) {
+	case ".plist":
+		if err := utils.ParsePlistFile(path, &settings); err != nil {
+			return nil, err
+		}
+	case ".json":
+		value, err := readJSONFile(path)
+		if err != nil {
+			return nil, err
+		}
+		settings, _ = value.(map[string]interface{})
+	default:
+		lines, _, err := readConfigLines(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+			settings[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+
+	result := make(map[string]string)
+	for key, value := range settings {
+		text := ""
+		switch value.(type) {
+		case map[string]interface{}, []interface{}, []byte:
+			// nested values are not reported
+			continue
+		case nil:
+		default:
+			text = fmt.Sprintf("%v", value)
+		}
+		if text != "" && isRemoteAccessSecret(key) {
+			text = "<set>"
+		}
+		result[key] = text
+	}
+	return result, nil
+}
+
+// isRemoteAccessSecret reports whether a setting holds a password, hash or key
+func isRemoteAccessSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range remoteAccessSecretWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnattendedSetting reports whether a setting of a tool grants unattended access
+func isUnattendedSetting(tool remoteAccessTool, key string) bool {
+	key = strings.ToLower(key)
+	for _, setting := range tool.Unattended {
+		if key == setting {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTeamViewerConnection parses a line of the TeamViewer connection logs:
+// <ID> <name> <start> <end> <local user> <connection type> <session ID>, separated by tabs
+func parseTeamViewerConnection(line string) map[string]interface{} {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 {
+		return nil
+	}
+	connection := map[string]interface{}{
+		"remote_id":   strings.TrimSpace(fields[0]),
+		"remote_user": strings.TrimSpace(fields[1]),
+		"start":       teamViewerTime(fields[2]),
+		"end":         teamViewerTime(fields[3]),
+		"name":        "",
+		"value":       "",
+	}
+	if len(fields) > 4 {
+		connection["name"] = strings.TrimSpace(fields[4])
+	}
+	if len(fields) > 5 {
+		connection["value"] = strings.TrimSpace(fields[5])
+	}
+	return connection
+}
+
+// teamViewerTime converts a time of the TeamViewer connection logs (local time) to TimeFormat
+func teamViewerTime(value string) string {
+	value = strings.TrimSpace(value)
+	if !teamViewerTimeRegex.MatchString(value) {
+		return ""
+	}
+	t, err := time.ParseInLocation("02-01-2006 15:04:05", value, time.Local)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(utils.TimeFormat)
+}
+
+// parseAnyDeskConnection parses a line of the AnyDesk connection trace:
+// <Incoming|Outgoing> <date, time> <authentication> <remote ID> <local ID>
+func parseAnyDeskConnection(line string) map[string]interface{} {
+	fields := anyDeskFieldRegex.Split(strings.TrimSpace(line), -1)
+	if len(fields) < 4 {
+		return nil
+	}
+	start := ""
+	if t, err := time.ParseInLocation("2006-01-02, 15:04", strings.TrimSpace(fields[1]), time.Local); err == nil {
+		start = t.UTC().Format(utils.TimeFormat)
+	}
+	return map[string]interface{}{
+		"name":      strings.TrimSpace(fields[0]),
+		"value":     strings.TrimSpace(fields[2]),
+		"remote_id": strings.TrimSpace(fields[3]),
+		"start":     start,
+	}
+}
+
+// scanRemoteAccessLog calls fn with the time (local time converted to TimeFormat) and text of the lines of a
+// log file containing one of the keywords
+func scanRemoteAccessLog(path string, keywords []string, fn func(timestamp, line string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lower := strings.ToLower(line)
+		for _, keyword := range keywords {
+			if !strings.Contains(lower, strings.ToLower(keyword)) {
+				continue
+			}
+			timestamp := ""
+			if match := remoteAccessLogTimeRegex.FindStringSubmatch(line); match != nil {
+				value := fmt.Sprintf("%s-%s-%s %s", match[1], match[2], match[3], match[4])
+				if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+					timestamp = t.UTC().Format(utils.TimeFormat)
+				}
+			}
+			fn(timestamp, line)
+			break
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,210 @@
+// This module reconstructs inbound and outbound Apple Remote Desktop and Screen Sharing activity:
+//   - ARD agent settings: /Library/Preferences/com.apple.RemoteDesktop.plist and /Library/Preferences/com.apple.ARDAgent.plist.
+//   - Outbound connections: recent hosts of the Screen Sharing application
+//     (/Users/*/Library/Containers/com.apple.ScreenSharing/Data/Library/Preferences/com.apple.ScreenSharing.plist)
+//     and saved connections (*.vncloc).
+//   - Inbound connections: unified logs of screensharingd, ScreensharingAgent and ARDAgent (authentication and
+//     connection messages) over the configured window. The remote address and user are extracted from the messages.
+//
+// The window defaults to the last 7 days and can be changed in <InputDir>/screensharing.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ScreenSharingModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &ScreenSharingModule{
+		Name:        "screensharing",
+		Description: "Collects ARD agent settings, Screen Sharing recent hosts and connection events"}
+	mod.RegisterModule(module)
+}
+
+func (m *ScreenSharingModule) GetName() string {
+	return m.Name
+}
+
+func (m *ScreenSharingModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	screenSharingAddressRegex = regexp.MustCompile(`\b((?:\d{1,3}\.){3}\d{1,3})\b`)
+	screenSharingUserRegex    = regexp.MustCompile(`(?i)\buser(?:name)?[\s:=]+"?([A-Za-z0-9._@-]+)"?`)
+)
+
+func (m *ScreenSharingModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	err = collectScreenSharingSettings(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error collecting Screen Sharing settings: %v", err)
+	}
+
+	err = collectScreenSharingEvents(m.GetName()+"-events", config.Days, params)
+	if err != nil {
+		params.Logger.Debug("Error collecting Screen Sharing events: %v", err)
+	}
+
+	return nil
+}
+
+func collectScreenSharingSettings(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeSetting := func(sourceFile string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+
+		eventTimestamp := fileModTime(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// ARD agent settings
+	for _, path := range []string{"/Library/Preferences/com.apple.RemoteDesktop.plist", "/Library/Preferences/com.apple.ARDAgent.plist"} {
+		var settings map[string]interface{}
+		if err := utils.ParsePlistFile(path, &settings); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for key, value := range settings {
+			writeSetting(path, map[string]interface{}{
+				"type":    "ard_setting",
+				"setting": key,
+				"value":   fmt.Sprintf("%v", value),
+			})
+		}
+	}
+
+	// Recent hosts of the Screen Sharing application
+	for _, path := range utils.GlobPaths("/Users/*/Library/Containers/com.apple.ScreenSharing/Data/Library/Preferences/com.apple.ScreenSharing.plist",
+		"/Users/*/Library/Preferences/com.apple.ScreenSharing.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		walkPlist(preferences, func(item map[string]interface{}) {
+			for key, value := range item {
+				if !strings.Contains(strings.ToLower(key), "recent") {
+					continue
+				}
+				hosts, ok := value.([]interface{})
+				if !ok {
+					hosts = []interface{}{value}
+				}
+				for index, host := range hosts {
+					if _, isString := host.(string); !isString {
+						continue
+					}
+					writeSetting(path, map[string]interface{}{
+						"type":  "recent_host",
+						"key":   key,
+						"order": index + 1,
+						"host":  host,
+					})
+				}
+			}
+		})
+	}
+
+	// Saved connections
+	for _, path := range utils.GlobPaths("/Users/*/Library/Containers/com.apple.ScreenSharing/Data/Library/Application Support/Screen Sharing/*.vncloc",
+		"/Users/*/Library/Application Support/Screen Sharing/*.vncloc",
+		"/Users/*/Desktop/*.vncloc",
+		"/Users/*/Documents/*.vncloc") {
+		var location map[string]interface{}
+		if err := utils.ParsePlistFile(path, &location); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		writeSetting(path, map[string]interface{}{
+			"type": "saved_connection",
+			"host": location["URL"],
+		})
+	}
+
+	return nil
+}
+
+func collectScreenSharingEvents(moduleName string, days int, params mod.ModuleParams) error {
+	startTime, endTime := unifiedLogsTimeRange(days)
+	query := LogCommand{
+		Predicate: `(process == "screensharingd" OR process == "ScreensharingAgent" OR process == "ARDAgent") AND ` +
+			`(eventMessage CONTAINS[c] "authentication" OR eventMessage CONTAINS[c] "connect" OR eventMessage CONTAINS[c] "client")`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+
+		message, _ := recordData["message"].(string)
+		recordData["remote_address"] = ""
+		if match := screenSharingAddressRegex.FindStringSubmatch(message); match != nil {
+			recordData["remote_address"] = match[1]
+		}
+		recordData["remote_user"] = ""
+		if match := screenSharingUserRegex.FindStringSubmatch(message); match != nil {
+			recordData["remote_user"] = match[1]
+		}
+		lowerMessage := strings.ToLower(message)
+		recordData["authentication_failed"] = strings.Contains(lowerMessage, "authentication") &&
+			(strings.Contains(lowerMessage, "fail") || strings.Contains(lowerMessage, "denied"))
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
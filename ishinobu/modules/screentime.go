@@ -0,0 +1,211 @@
+// This module parses the Screen Time store, which often survives when other usage artifacts are purged:
+//   - /private/var/folders/*/*/0/com.apple.ScreenTimeAgent/Store/RMAdminStore-Local.sqlite
+//   - /private/var/folders/*/*/0/com.apple.ScreenTimeAgent/Store/RMAdminStore-Cloud.sqlite (usage synced from other devices)
+//
+// Two kinds of records are emitted:
+//   - usage: time spent per application (bundle identifier) or web domain in each usage block, with the device and user.
+//   - pickups: pickups and notifications per application in each usage block, and the pickups without application usage.
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ScreenTimeModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &ScreenTimeModule{
+		Name:        "screentime",
+		Description: "Collects Screen Time per-app and web usage durations, pickups and notifications"}
+	mod.RegisterModule(module)
+}
+
+func (m *ScreenTimeModule) GetName() string {
+	return m.Name
+}
+
+func (m *ScreenTimeModule) GetDescription() string {
+	return m.Description
+}
+
+const (
+	screenTimeUsageQuery = `
+		SELECT
+			ZUSAGETIMEDITEM.ZBUNDLEIDENTIFIER,
+			ZUSAGETIMEDITEM.ZDOMAIN,
+			ZUSAGETIMEDITEM.ZTOTALTIMEINSECONDS,
+			ZUSAGECATEGORY.ZIDENTIFIER,
+			ZUSAGEBLOCK.ZSTARTDATE,
+			ZUSAGEBLOCK.ZLASTEVENTDATE,
+			ZCOREDEVICE.ZNAME,
+			ZCOREUSER.ZAPPLEID
+		FROM ZUSAGETIMEDITEM
+		LEFT JOIN ZUSAGECATEGORY ON ZUSAGECATEGORY.Z_PK = ZUSAGETIMEDITEM.ZCATEGORY
+		LEFT JOIN ZUSAGEBLOCK ON ZUSAGEBLOCK.Z_PK = ZUSAGECATEGORY.ZBLOCK
+		LEFT JOIN ZUSAGE ON ZUSAGE.Z_PK = ZUSAGEBLOCK.ZUSAGE
+		LEFT JOIN ZCOREDEVICE ON ZCOREDEVICE.Z_PK = ZUSAGE.ZDEVICE
+		LEFT JOIN ZCOREUSER ON ZCOREUSER.Z_PK = ZUSAGE.ZUSER`
+	screenTimePickupsQuery = `
+		SELECT
+			ZUSAGECOUNTEDITEM.ZBUNDLEIDENTIFIER,
+			ZUSAGECOUNTEDITEM.ZNUMBEROFPICKUPS,
+			ZUSAGECOUNTEDITEM.ZNUMBEROFNOTIFICATIONS,
+			ZUSAGEBLOCK.ZNUMBEROFPICKUPSWITHOUTAPPLICATIONUSAGE,
+			ZUSAGEBLOCK.ZSTARTDATE,
+			ZUSAGEBLOCK.ZLASTEVENTDATE,
+			ZCOREDEVICE.ZNAME,
+			ZCOREUSER.ZAPPLEID
+		FROM ZUSAGECOUNTEDITEM
+		LEFT JOIN ZUSAGEBLOCK ON ZUSAGEBLOCK.Z_PK = ZUSAGECOUNTEDITEM.ZBLOCK
+		LEFT JOIN ZUSAGE ON ZUSAGE.Z_PK = ZUSAGEBLOCK.ZUSAGE
+		LEFT JOIN ZCOREDEVICE ON ZCOREDEVICE.Z_PK = ZUSAGE.ZDEVICE
+		LEFT JOIN ZCOREUSER ON ZCOREUSER.Z_PK = ZUSAGE.ZUSER`
+)
+
+func (m *ScreenTimeModule) Run(params mod.ModuleParams) error {
+	dbPaths := utils.GlobPaths("/private/var/folders/*/*/0/com.apple.ScreenTimeAgent/Store/RMAdminStore-Local.sqlite",
+		"/private/var/folders/*/*/0/com.apple.ScreenTimeAgent/Store/RMAdminStore-Cloud.sqlite")
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	// Create a temporary folder to store the copied databases
+	tmpDir, err := os.MkdirTemp("", "ishinobu-screentime")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parseScreenTimeUsage(dst, dbPath, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing Screen Time usage %s: %v", dbPath, err)
+		}
+
+		err = parseScreenTimePickups(dst, dbPath, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing Screen Time pickups %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseScreenTimeUsage(dbPath string, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	rows, err := utils.QuerySQLite(dbPath, screenTimeUsageQuery)
+	if err != nil {
+		return fmt.Errorf("error querying SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bundleID, domain, category, device, appleID sql.NullString
+		var totalTime, startDate, lastEventDate sql.NullFloat64
+		err := rows.Scan(&bundleID, &domain, &totalTime, &category, &startDate, &lastEventDate, &device, &appleID)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := screenTimeBlockData(startDate, lastEventDate, device, appleID)
+		recordData["type"] = "usage"
+		recordData["bundle_id"] = bundleID.String
+		recordData["domain"] = domain.String
+		recordData["category"] = category.String
+		recordData["usage_seconds"] = totalTime.Float64
+
+		writeScreenTimeRecord(recordData, sourceFile, writer, params)
+	}
+
+	return nil
+}
+
+func parseScreenTimePickups(dbPath string, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	rows, err := utils.QuerySQLite(dbPath, screenTimePickupsQuery)
+	if err != nil {
+		return fmt.Errorf("error querying SQLite: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bundleID, device, appleID sql.NullString
+		var pickups, notifications, pickupsWithoutUsage sql.NullInt64
+		var startDate, lastEventDate sql.NullFloat64
+		err := rows.Scan(&bundleID, &pickups, &notifications, &pickupsWithoutUsage, &startDate, &lastEventDate, &device, &appleID)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := screenTimeBlockData(startDate, lastEventDate, device, appleID)
+		recordData["type"] = "pickups"
+		recordData["bundle_id"] = bundleID.String
+		recordData["pickups"] = pickups.Int64
+		recordData["notifications"] = notifications.Int64
+		recordData["pickups_without_usage"] = pickupsWithoutUsage.Int64
+
+		writeScreenTimeRecord(recordData, sourceFile, writer, params)
+	}
+
+	return nil
+}
+
+// screenTimeBlockData returns the fields of the usage block (hour) a record belongs to
+func screenTimeBlockData(startDate, lastEventDate sql.NullFloat64, device, appleID sql.NullString) map[string]interface{} {
+	recordData := make(map[string]interface{})
+	recordData["block_start"] = ""
+	if startDate.Valid {
+		recordData["block_start"] = utils.ConvertCFAbsoluteTime(startDate.Float64)
+	}
+	recordData["last_event"] = ""
+	if lastEventDate.Valid {
+		recordData["last_event"] = utils.ConvertCFAbsoluteTime(lastEventDate.Float64)
+	}
+	recordData["device"] = device.String
+	recordData["apple_id"] = appleID.String
+	return recordData
+}
+
+func writeScreenTimeRecord(recordData map[string]interface{}, sourceFile string, writer *utils.DataWriter, params mod.ModuleParams) {
+	eventTimestamp := recordData["block_start"].(string)
+	if eventTimestamp == "" {
+		eventTimestamp = params.CollectionTimestamp
+	}
+
+	record := utils.Record{
+		CollectionTimestamp: params.CollectionTimestamp,
+		EventTimestamp:      eventTimestamp,
+		Data:                recordData,
+		SourceFile:          sourceFile,
+	}
+
+	err := writer.WriteRecord(record)
+	if err != nil {
+		params.Logger.Debug("Failed to write record: %v", err)
+	}
+}
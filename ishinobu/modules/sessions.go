@@ -0,0 +1,149 @@
+// This module builds a session activity timeline from the unified logs, to answer who was at the keyboard
+// during a window of interest:
+//   - loginwindow: logins, logouts and the fast user switching of the console user (session moved on or off the
+//     console).
+//   - Screen lock: the screenIsLocked and screenIsUnlocked notifications sent by loginwindow.
+//   - Screen saver: the start and stop of the screen saver.
+//
+// Each event is attributed to the user of the session (from the uid of the message or of the log entry) and
+// flagged as present when it shows the user at the keyboard (login, unlock, switch in, screen saver stopped).
+// The window defaults to the last 7 days and can be changed in <InputDir>/sessions.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SessionsModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SessionsModule{
+		Name:        "sessions",
+		Description: "Builds a per-user session timeline of console user switches and screen lock, unlock and screen saver events"}
+	mod.RegisterModule(module)
+}
+
+func (m *SessionsModule) GetName() string {
+	return m.Name
+}
+
+func (m *SessionsModule) GetDescription() string {
+	return m.Description
+}
+
+// sessionEvent is an event of the session timeline, found by a string of the log message
+type sessionEvent struct {
+	Match   string
+	Event   string
+	Present bool
+}
+
+var (
+	// Checked in order, the first match classifies the message
+	sessionEvents = []sessionEvent{
+		{"screenIsUnlocked", "unlock", true},
+		{"screenIsLocked", "lock", false},
+		{"screensaver.didstop", "screensaver_stop", true},
+		{"screensaver.didstart", "screensaver_start", false},
+		{"sessionDidMoveOnConsole", "switch_in", true},
+		{"sessionDidMoveOffConsole", "switch_out", false},
+		{"SessionDidBecomeActive", "switch_in", true},
+		{"SessionDidResignActive", "switch_out", false},
+		{"sessionDidLogin", "login", true},
+		{"logoutcompleted", "logout", false},
+		{"logoutInitiated", "logout", false},
+	}
+	sessionUIDRegex = regexp.MustCompile(`(?i)\buid[:=]?\s*(\d+)`)
+)
+
+func (m *SessionsModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	var conditions []string
+	for _, event := range sessionEvents {
+		conditions = append(conditions, fmt.Sprintf(`eventMessage CONTAINS[c] "%s"`, event.Match))
+	}
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	query := LogCommand{
+		Predicate: `(process == "loginwindow" OR process == "ScreenSaverEngine" OR process == "sessionlogoutd") AND (` +
+			strings.Join(conditions, " OR ") + `)`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return fmt.Errorf("error querying unified logs: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	usernames := make(map[string]string)
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message, _ := recordData["message"].(string)
+
+		event, ok := classifySessionEvent(message)
+		if !ok {
+			continue
+		}
+
+		// The uid of the message is the user of the session, the uid of the entry is the sending process
+		uid := fmt.Sprintf("%v", valueOrEmpty(recordData["uid"]))
+		if match := sessionUIDRegex.FindStringSubmatch(message); match != nil {
+			uid = match[1]
+		}
+		username, ok := usernames[uid]
+		if !ok {
+			username = uid
+			if account, err := user.LookupId(uid); err == nil {
+				username = account.Username
+			}
+			usernames[uid] = username
+		}
+
+		recordData["username"] = username
+		recordData["session_uid"] = uid
+		recordData["event"] = event.Event
+		recordData["present"] = event.Present
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// classifySessionEvent returns the session event of a log message
+func classifySessionEvent(message string) (sessionEvent, bool) {
+	lower := strings.ToLower(message)
+	for _, event := range sessionEvents {
+		if strings.Contains(lower, strings.ToLower(event.Match)) {
+			return event, true
+		}
+	}
+	return sessionEvent{}, false
+}
@@ -0,0 +1,181 @@
+// This module reports the remote access surface exposed by the host through the sharing services:
+//   - Remote Login (SSH), Screen Sharing, File Sharing (smbd) and Remote Apple Events: the service is enabled
+//     when its launchd job is loaded in the system domain (launchctl print system/<label>) and not disabled.
+//   - Remote Management (ARD): /Library/Preferences/com.apple.RemoteManagement.plist and the ARD agent launchd job.
+//   - Content Caching: /Library/Preferences/com.apple.AssetCache.plist.
+//   - Internet Sharing: /Library/Preferences/SystemConfiguration/com.apple.nat.plist.
+//
+// Allowed users are read from the service access groups (com.apple.access_ssh, com.apple.access_screensharing, ...)
+// and from the naprivs attribute of the users for Remote Management.
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SharingModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SharingModule{
+		Name:        "sharing",
+		Description: "Reports the enabled state and allowed users of the sharing services"}
+	mod.RegisterModule(module)
+}
+
+func (m *SharingModule) GetName() string {
+	return m.Name
+}
+
+func (m *SharingModule) GetDescription() string {
+	return m.Description
+}
+
+// sharingService is a sharing service controlled by a launchd job and an access group
+type sharingService struct {
+	Name        string
+	Label       string
+	AccessGroup string
+}
+
+var sharingServices = []sharingService{
+	{Name: "Remote Login (SSH)", Label: "com.openssh.sshd", AccessGroup: "com.apple.access_ssh"},
+	{Name: "Screen Sharing", Label: "com.apple.screensharing", AccessGroup: "com.apple.access_screensharing"},
+	{Name: "File Sharing (SMB)", Label: "com.apple.smbd", AccessGroup: "com.apple.access_smb"},
+	{Name: "Remote Apple Events", Label: "com.apple.AEServer", AccessGroup: "com.apple.access_remote_ae"},
+	{Name: "Remote Management (ARD)", Label: "com.apple.RemoteDesktop.agent"},
+}
+
+func (m *SharingModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeService := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	disabled := launchdDisabledServices("system", params)
+
+	for _, service := range sharingServices {
+		loaded := exec.Command("launchctl", "print", "system/"+service.Label).Run() == nil
+
+		allowedUsers := ""
+		if service.AccessGroup != "" {
+			allowedUsers = dsclGroupMembers(service.AccessGroup)
+		}
+
+		recordData := map[string]interface{}{
+			"service":       service.Name,
+			"label":         service.Label,
+			"enabled":       loaded && !disabled[service.Label],
+			"loaded":        loaded,
+			"disabled":      disabled[service.Label],
+			"access_group":  service.AccessGroup,
+			"allowed_users": allowedUsers,
+			// Without an access group every local user is allowed
+			"all_users_allowed": service.AccessGroup != "" && allowedUsers == "",
+		}
+
+		if service.Label == "com.apple.RemoteDesktop.agent" {
+			addRemoteManagementSettings(recordData)
+		}
+
+		writeService("launchctl", recordData)
+	}
+
+	// Content Caching
+	assetCachePath := "/Library/Preferences/com.apple.AssetCache.plist"
+	var assetCache map[string]interface{}
+	if err := utils.ParsePlistFile(assetCachePath, &assetCache); err != nil {
+		params.Logger.Debug("Error parsing %s: %v", assetCachePath, err)
+	} else {
+		activated, _ := assetCache["Activated"].(bool)
+		writeService(assetCachePath, map[string]interface{}{
+			"service":        "Content Caching",
+			"enabled":        activated,
+			"cache_location": assetCache["DataPath"],
+			"listen_ranges":  assetCache["ListenRanges"],
+			"allow_personal": assetCache["AllowPersonalCaching"],
+			"allow_shared":   assetCache["AllowSharedCaching"],
+		})
+	}
+
+	// Internet Sharing
+	natPath := "/Library/Preferences/SystemConfiguration/com.apple.nat.plist"
+	var nat map[string]interface{}
+	if err := utils.ParsePlistFile(natPath, &nat); err != nil {
+		params.Logger.Debug("Error parsing %s: %v", natPath, err)
+	} else {
+		natSettings, _ := nat["NAT"].(map[string]interface{})
+		enabled := false
+		switch value := natSettings["Enabled"].(type) {
+		case bool:
+			enabled = value
+		case uint64:
+			enabled = value == 1
+		}
+		writeService(natPath, map[string]interface{}{
+			"service":           "Internet Sharing",
+			"enabled":           enabled,
+			"primary_interface": natSettings["PrimaryInterface"],
+			"shared_interfaces": natSettings["SharingDevices"],
+		})
+	}
+
+	return nil
+}
+
+// addRemoteManagementSettings adds the ARD agent preferences and the users with remote management privileges
+func addRemoteManagementSettings(recordData map[string]interface{}) {
+	var settings map[string]interface{}
+	if err := utils.ParsePlistFile("/Library/Preferences/com.apple.RemoteManagement.plist", &settings); err == nil {
+		recordData["all_users_allowed"] = settings["ARD_AllLocalUsers"] == true
+		recordData["all_users_privileges"] = settings["ARD_AllLocalUsersPrivs"]
+		recordData["vnc_legacy_password"] = settings["VNCLegacyConnectionsEnabled"]
+		recordData["screen_sharing_request_permission"] = settings["ScreenSharingReqPermEnabled"]
+	}
+
+	// dscl . -list /Users naprivs prints "<user> <privileges>" for the users allowed to use ARD
+	output, err := exec.Command("dscl", ".", "-list", "/Users", "naprivs").Output()
+	if err != nil {
+		return
+	}
+	var users []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			users = append(users, fields[0]+":"+fields[1])
+		}
+	}
+	recordData["allowed_users"] = strings.Join(users, ", ")
+}
+
+// dsclGroupMembers returns the members of a local group, separated by commas
+func dsclGroupMembers(group string) string {
+	output, err := exec.Command("dscl", ".", "-read", "/Groups/"+group, "GroupMembership").Output()
+	if err != nil {
+		return ""
+	}
+	members := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(output)), "GroupMembership:"))
+	return strings.Join(strings.Fields(members), ", ")
+}
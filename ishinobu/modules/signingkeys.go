@@ -0,0 +1,156 @@
+// This module inventories the signing keys of each user, metadata only:
+//   - GnuPG public keyrings (~/.gnupg/pubring.kbx and the legacy pubring.gpg): fingerprint, key ID, algorithm,
+//     size, creation date and user IDs of every key and subkey.
+//   - GnuPG secret keys (~/.gnupg/private-keys-v1.d/*.key): keygrip and whether the key is protected by a passphrase.
+//   - Code signing identities (Developer ID, Apple Development, ...) of the login keychains and of the System keychain
+//     (security find-identity -v -p codesigning), with the certificate hash and team ID.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SigningKeysModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SigningKeysModule{
+		Name:        "signingkeys",
+		Description: "Inventories GnuPG keys and code signing identities of the keychains (metadata only)"}
+	mod.RegisterModule(module)
+}
+
+func (m *SigningKeysModule) GetName() string {
+	return m.Name
+}
+
+func (m *SigningKeysModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	gnupgHomeDirectories = []string{"/Users/*/.gnupg", "/private/var/root/.gnupg"}
+	signingKeychainPaths = []string{
+		"/Users/*/Library/Keychains/login.keychain-db",
+		"/Library/Keychains/System.keychain",
+	}
+	// 1) <SHA-1 hash> "<identity name>"
+	codeSigningIdentityRegex = regexp.MustCompile(`^\s*\d+\)\s+([0-9A-F]{40})\s+"(.+)"`)
+	teamIDRegex              = regexp.MustCompile(`\(([A-Z0-9]{10})\)\s*$`)
+)
+
+func (m *SigningKeysModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeKey := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		username := utils.GetUsernameFromPath(sourceFile)
+		if username == "" && strings.HasPrefix(sourceFile, "/private/var/root") {
+			username = "root"
+		}
+		recordData["username"] = username
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	for _, home := range utils.GlobPaths(gnupgHomeDirectories...) {
+		// Public keyrings
+		for _, name := range []string{"pubring.kbx", "pubring.gpg"} {
+			path := filepath.Join(home, name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			keyblocks := [][]byte{data}
+			if name == "pubring.kbx" {
+				keyblocks = utils.ParseKeybox(data)
+			}
+			for _, keyblock := range keyblocks {
+				for _, key := range utils.ParseOpenPGPKeys(keyblock) {
+					keyType := "gpg_public_key"
+					if key.Subkey {
+						keyType = "gpg_public_subkey"
+					}
+					writeKey(path, key.Created, map[string]interface{}{
+						"type":        keyType,
+						"key_id":      key.KeyID,
+						"fingerprint": key.Fingerprint,
+						"algorithm":   key.Algorithm,
+						"bits":        key.Bits,
+						"created":     key.Created,
+						"primary_id":  key.PrimaryID,
+						"user_ids":    strings.Join(key.UserIDs, ", "),
+					})
+				}
+			}
+		}
+
+		// Secret keys are stored by keygrip
+		for _, path := range utils.GlobPaths(filepath.Join(home, "private-keys-v1.d", "*.key")) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			writeKey(path, fileModTime(path), map[string]interface{}{
+				"type":      "gpg_secret_key",
+				"keygrip":   strings.TrimSuffix(filepath.Base(path), ".key"),
+				"protected": strings.Contains(string(data), "protected-private-key"),
+			})
+		}
+	}
+
+	// Code signing identities
+	for _, keychain := range utils.GlobPaths(signingKeychainPaths...) {
+		output, err := exec.Command("security", "find-identity", "-v", "-p", "codesigning", keychain).Output()
+		if err != nil {
+			params.Logger.Debug("Error listing code signing identities of %s: %v", keychain, err)
+			continue
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			match := codeSigningIdentityRegex.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			teamID := ""
+			if team := teamIDRegex.FindStringSubmatch(match[2]); team != nil {
+				teamID = team[1]
+			}
+			identityType, _, _ := strings.Cut(match[2], ":")
+			writeKey(keychain, fileModTime(keychain), map[string]interface{}{
+				"type":          "codesign_identity",
+				"identity":      match[2],
+				"identity_type": identityType,
+				"sha1":          match[1],
+				"team_id":       teamID,
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// This module collects the Siri and dictation configuration and data of each user, which can evidence voice
+// initiated actions and app usage missing from other sources:
+//   - Settings: the values of the Siri preferences (com.apple.assistant.support, com.apple.assistant.backedup,
+//     com.apple.Siri) such as Assistant Enabled, Dictation Enabled, VoiceTriggerUserEnabled and the data sharing
+//     status, and the dictation keys of com.apple.HIToolbox.
+//   - Data stores: the databases of Library/Assistant (Siri analytics, learned vocabulary and app intents) with
+//     their tables, number of rows and modification time.
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SiriModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SiriModule{
+		Name:        "siri",
+		Description: "Collects Siri and dictation settings and the Siri analytics and learned data stores of each user"}
+	mod.RegisterModule(module)
+}
+
+func (m *SiriModule) GetName() string {
+	return m.Name
+}
+
+func (m *SiriModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	siriPreferencePaths = []string{
+		"/Users/*/Library/Preferences/com.apple.assistant.support.plist",
+		"/Users/*/Library/Preferences/com.apple.assistant.backedup.plist",
+		"/Users/*/Library/Preferences/com.apple.Siri.plist",
+		"/Users/*/Library/Preferences/com.apple.HIToolbox.plist",
+	}
+	siriStorePaths = []string{
+		"/Users/*/Library/Assistant/*.db",
+		"/Users/*/Library/Assistant/*.sqlite",
+		"/Users/*/Library/Assistant/*.sqlitedb",
+		"/Users/*/Library/Assistant/*/*.db",
+		"/Users/*/Library/Assistant/*/*.sqlite",
+		"/Users/*/Library/Assistant/*/*.sqlitedb",
+	}
+)
+
+func (m *SiriModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeRecord := func(sourceFile string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		eventTimestamp := fileModTime(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Settings
+	for _, path := range utils.GlobPaths(siriPreferencePaths...) {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		dictationOnly := strings.HasSuffix(path, "com.apple.HIToolbox.plist")
+		keys := make([]string, 0, len(preferences))
+		for key := range preferences {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if dictationOnly && !strings.Contains(key, "Dictation") {
+				continue
+			}
+			var value string
+			switch v := preferences[key].(type) {
+			case map[string]interface{}, []interface{}, []byte:
+				continue
+			case time.Time:
+				value = utils.FormatPlistDate(v)
+			default:
+				value = fmt.Sprintf("%v", v)
+			}
+			writeRecord(path, map[string]interface{}{
+				"type":       "setting",
+				"preference": strings.TrimSuffix(filepath.Base(path), ".plist"),
+				"key":        key,
+				"value":      value,
+				"tables":     "",
+				"rows":       0,
+			})
+		}
+	}
+
+	// Data stores
+	tmpDir, err := os.MkdirTemp("", "ishinobu-siri")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range utils.GlobPaths(siriStorePaths...) {
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+		tables, err := utils.QuerySQLiteMaps(dst, `SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name`)
+		if err != nil {
+			params.Logger.Debug("Error querying %s: %v", dbPath, err)
+			continue
+		}
+		var summary []string
+		total := int64(0)
+		for _, table := range tables {
+			name := fmt.Sprintf("%v", table["name"])
+			rows, err := utils.QuerySQLiteMaps(dst, fmt.Sprintf(`SELECT COUNT(*) AS count FROM "%s"`, name))
+			if err != nil || len(rows) == 0 {
+				continue
+			}
+			count, _ := rows[0]["count"].(int64)
+			total += count
+			summary = append(summary, fmt.Sprintf("%s=%d", name, count))
+		}
+		writeRecord(dbPath, map[string]interface{}{
+			"type":       "data_store",
+			"preference": "",
+			"key":        strings.TrimPrefix(dbPath, filepath.Join("/Users", utils.GetUsernameFromPath(dbPath), "Library", "Assistant")+"/"),
+			"value":      "",
+			"tables":     strings.Join(summary, ", "),
+			"rows":       total,
+		})
+	}
+
+	return nil
+}
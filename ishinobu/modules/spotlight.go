@@ -0,0 +1,257 @@
+// This module extracts Spotlight metadata of the files in user directories using the live Spotlight index:
+//   - mdfind: files under /Users with download provenance (kMDItemWhereFroms) or used in the last 30 days (kMDItemLastUsedDate).
+//   - mdls: kMDItemWhereFroms, kMDItemLastUsedDate, kMDItemDownloadedDate, kMDItemUseCount and creation dates of each file.
+//   - Query history: the queries typed by each user in Spotlight with the item selected and the last time it was used
+//     (/Users/*/Library/Application Support/com.apple.spotlight.Shortcuts and com.apple.spotlight/com.apple.spotlight.Shortcuts.v3),
+//     and the raw queries of the saved searches (/Users/*/Library/Saved Searches/*.savedSearch).
+//
+// The Spotlight stores (/System/Volumes/Data/.Spotlight-V100/Store-V2/*/store.db and .store.db) can also be copied
+// to the collection for offline parsing.
+// The window and the copy of the stores are configured in <InputDir>/spotlight.json:
+//
+//	{
+//	  "days": 30,
+//	  "copy_store": true
+//	}
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type SpotlightModule struct {
+	Name        string
+	Description string
+}
+
+// SpotlightConfig is the configuration of the spotlight module.
+type SpotlightConfig struct {
+	Days      int  `json:"days"`
+	CopyStore bool `json:"copy_store"`
+}
+
+func init() {
+	module := &SpotlightModule{
+		Name:        "spotlight",
+		Description: "Collects Spotlight metadata such as download provenance and last used dates of user files"}
+	mod.RegisterModule(module)
+}
+
+func (m *SpotlightModule) GetName() string {
+	return m.Name
+}
+
+func (m *SpotlightModule) GetDescription() string {
+	return m.Description
+}
+
+// Spotlight attributes extracted with mdls
+var spotlightAttributes = []string{
+	"kMDItemWhereFroms",
+	"kMDItemLastUsedDate",
+	"kMDItemDownloadedDate",
+	"kMDItemUseCount",
+	"kMDItemContentCreationDate",
+	"kMDItemContentModificationDate",
+	"kMDItemDateAdded",
+	"kMDItemContentType",
+}
+
+func (m *SpotlightModule) Run(params mod.ModuleParams) error {
+	config := SpotlightConfig{Days: 30}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	if config.CopyStore {
+		copySpotlightStores(m.GetName(), params)
+	}
+
+	err = collectSpotlightQueries(m.GetName()+"-queries", params)
+	if err != nil {
+		params.Logger.Debug("Error collecting Spotlight queries: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	query := fmt.Sprintf(`kMDItemWhereFroms == "*" || kMDItemLastUsedDate >= $time.today(-%d)`, config.Days)
+	output, err := exec.Command("mdfind", "-0", "-onlyin", "/Users", query).Output()
+	if err != nil {
+		return fmt.Errorf("error running mdfind: %v", err)
+	}
+
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path == "" {
+			continue
+		}
+
+		attributes, err := spotlightMetadata(path)
+		if err != nil {
+			params.Logger.Debug("Error reading Spotlight metadata of %s: %v", path, err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = utils.GetUsernameFromPath(path)
+		recordData["path"] = path
+		recordData["where_froms"] = attributes["kMDItemWhereFroms"]
+		recordData["last_used_date"] = utils.FormatPlistDate(attributes["kMDItemLastUsedDate"])
+		recordData["downloaded_date"] = utils.FormatPlistDate(spotlightFirstValue(attributes["kMDItemDownloadedDate"]))
+		recordData["use_count"] = attributes["kMDItemUseCount"]
+		recordData["creation_date"] = utils.FormatPlistDate(attributes["kMDItemContentCreationDate"])
+		recordData["modification_date"] = utils.FormatPlistDate(attributes["kMDItemContentModificationDate"])
+		recordData["date_added"] = utils.FormatPlistDate(attributes["kMDItemDateAdded"])
+		recordData["content_type"] = attributes["kMDItemContentType"]
+
+		eventTimestamp := utils.LatestTimestamp(recordData["last_used_date"].(string), recordData["downloaded_date"].(string))
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          "mdls",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// collectSpotlightQueries collects the queries typed in Spotlight and the saved searches of each user
+func collectSpotlightQueries(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeQuery := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Shortcuts are indexed by the query typed by the user
+	shortcutPaths := utils.GlobPaths("/Users/*/Library/Application Support/com.apple.spotlight.Shortcuts",
+		"/Users/*/Library/Application Support/com.apple.spotlight/com.apple.spotlight.Shortcuts*")
+	for _, path := range shortcutPaths {
+		var shortcuts map[string]interface{}
+		if err := utils.ParsePlistFile(path, &shortcuts); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		for query, value := range shortcuts {
+			shortcut, _ := value.(map[string]interface{})
+			lastUsed := utils.FormatPlistDate(shortcut["LAST_USED"])
+			writeQuery(path, lastUsed, map[string]interface{}{
+				"type":         "typed_query",
+				"query":        query,
+				"display_name": shortcut["DISPLAY_NAME"],
+				"url":          shortcut["URL"],
+				"last_used":    lastUsed,
+			})
+		}
+	}
+
+	for _, path := range utils.GlobPaths("/Users/*/Library/Saved Searches/*.savedSearch") {
+		var search map[string]interface{}
+		if err := utils.ParsePlistFile(path, &search); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		modified := fileModTime(path)
+		writeQuery(path, modified, map[string]interface{}{
+			"type":         "saved_search",
+			"query":        search["RawQuery"],
+			"display_name": strings.TrimSuffix(filepath.Base(path), ".savedSearch"),
+			"url":          "",
+			"last_used":    modified,
+		})
+	}
+
+	return nil
+}
+
+// spotlightMetadata returns the Spotlight attributes of a file using `mdls -plist -`
+func spotlightMetadata(path string) (map[string]interface{}, error) {
+	args := []string{}
+	for _, attribute := range spotlightAttributes {
+		args = append(args, "-name", attribute)
+	}
+	args = append(args, "-plist", "-", path)
+
+	output, err := exec.Command("mdls", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]interface{}
+	if err := plist.NewDecoder(bytes.NewReader(output)).Decode(&attributes); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
+
+// spotlightFirstValue returns the first element of multi-valued attributes such as kMDItemDownloadedDate
+func spotlightFirstValue(value interface{}) interface{} {
+	if values, ok := value.([]interface{}); ok {
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0]
+	}
+	return value
+}
+
+// copySpotlightStores copies the Spotlight store databases to the collection for offline parsing
+func copySpotlightStores(moduleName string, params mod.ModuleParams) {
+	stores := utils.GlobPaths("/System/Volumes/Data/.Spotlight-V100/Store-V*/*/store.db",
+		"/System/Volumes/Data/.Spotlight-V100/Store-V*/*/.store.db",
+		"/.Spotlight-V100/Store-V*/*/store.db",
+		"/.Spotlight-V100/Store-V*/*/.store.db")
+
+	for _, store := range stores {
+		dstDir := filepath.Join(params.LogsDir, moduleName, filepath.Base(filepath.Dir(store)))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+		if err := utils.CopyFile(store, filepath.Join(dstDir, filepath.Base(store))); err != nil {
+			params.Logger.Debug("Failed to copy %s: %v", store, err)
+		}
+	}
+}
@@ -0,0 +1,630 @@
+// This module collects the SSH artifacts of the host and of each user:
+//   - authorized_keys, authorized_keys2 and known_hosts of /Users/*/.ssh and /private/var/root/.ssh.
+//   - Client configuration: ~/.ssh/config, /etc/ssh/ssh_config and /etc/ssh/ssh_config.d/*, one record per directive
+//     with the Host or Match block it applies to. Directives that tunnel, forward the agent or run commands
+//     (ProxyJump, ProxyCommand, ForwardAgent, LocalCommand, *Forward, ...) are flagged.
+//   - Server configuration: /etc/ssh/sshd_config and /etc/ssh/sshd_config.d/*, one record per directive. Directives
+//     that weaken the server policy (PermitRootLogin yes, PasswordAuthentication yes, AuthorizedKeysCommand, ...) are flagged.
+//   - Private keys: the OpenSSH, PEM (PKCS#1, PKCS#8, SEC1) and PuTTY private keys of each .ssh directory with their
+//     type, size, passphrase protection, permissions and the fingerprint of the matching public key. World-readable
+//     and unencrypted keys are flagged. The key material is never collected.
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SSHModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SSHModule{
+		Name:        "ssh",
+		Description: "Collects authorized_keys, known_hosts, private keys and the SSH client and server configuration directives"}
+	mod.RegisterModule(module)
+}
+
+func (m *SSHModule) GetName() string {
+	return m.Name
+}
+
+func (m *SSHModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	sshHomeDirectories   = []string{"/Users/*/.ssh", "/private/var/root/.ssh"}
+	sshClientConfigPaths = []string{
+		"/Users/*/.ssh/config",
+		"/private/var/root/.ssh/config",
+		"/etc/ssh/ssh_config",
+		"/etc/ssh/ssh_config.d/*",
+	}
+	sshServerConfigPaths = []string{
+		"/etc/ssh/sshd_config",
+		"/etc/ssh/sshd_config.d/*",
+	}
+	// Client directives flagged whatever their value
+	sshClientFlaggedDirectives = map[string]bool{
+		"proxyjump":           true,
+		"proxycommand":        true,
+		"localcommand":        true,
+		"localforward":        true,
+		"remoteforward":       true,
+		"dynamicforward":      true,
+		"knownhostscommand":   true,
+		"pkcs11provider":      true,
+		"securitykeyprovider": true,
+	}
+	// Client directives flagged when set to the value
+	sshClientFlaggedValues = map[string]string{
+		"forwardagent":          "yes",
+		"forwardx11trusted":     "yes",
+		"stricthostkeychecking": "no",
+		"userknownhostsfile":    "/dev/null",
+		"permitlocalcommand":    "yes",
+	}
+	// Server directives flagged whatever their value
+	sshServerFlaggedDirectives = map[string]bool{
+		"authorizedkeyscommand":       true,
+		"authorizedprincipalscommand": true,
+		"forcecommand":                true,
+		"trustedusercakeys":           true,
+	}
+	// Server directives flagged when set to the value
+	sshServerFlaggedValues = map[string]string{
+		"permitrootlogin":                 "yes",
+		"passwordauthentication":          "yes",
+		"permitemptypasswords":            "yes",
+		"permituserenvironment":           "yes",
+		"gatewayports":                    "yes",
+		"strictmodes":                     "no",
+		"pubkeyauthentication":            "no",
+		"challengeresponseauthentication": "yes",
+	}
+	// Curve sizes of the ECDSA keys
+	sshECDSABits = map[string]int{
+		"nistp256": 256,
+		"nistp384": 384,
+		"nistp521": 521,
+	}
+)
+
+// Maximum size of the files read as candidate private keys
+const sshMaxKeyFileSize = 64 * 1024
+
+// sshPrivateKey holds the properties of a private key
+type sshPrivateKey struct {
+	Format    string
+	KeyType   string
+	Bits      int
+	Encrypted bool
+	// Public key blob in the SSH wire format, when it can be derived from the private key file
+	PublicKey []byte
+}
+
+func (m *SSHModule) Run(params mod.ModuleParams) error {
+	err := collectSSHKeyFiles(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error collecting SSH key files: %v", err)
+	}
+
+	err = collectSSHConfig(m.GetName()+"-config", params)
+	if err != nil {
+		params.Logger.Debug("Error collecting SSH configuration: %v", err)
+	}
+
+	err = collectSSHPrivateKeys(m.GetName()+"-keys", params)
+	if err != nil {
+		params.Logger.Debug("Error collecting SSH private keys: %v", err)
+	}
+
+	return nil
+}
+
+func collectSSHKeyFiles(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, directory := range utils.GlobPaths(sshHomeDirectories...) {
+		for _, name := range []string{"authorized_keys", "authorized_keys2", "known_hosts"} {
+			path := filepath.Join(directory, name)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			err := parseSSHFile(path, name, writer, params)
+			if err != nil {
+				params.Logger.Debug("Error parsing %s: %v", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseSSHFile emits a record per entry of an authorized_keys or known_hosts file. The options of the authorized keys
+// (command=, from=, environment=, no-pty, ...) and the key comments are emitted as separate fields.
+func parseSSHFile(path string, fileType string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	username := utils.GetUsernameFromPath(path)
+	if username == "" && strings.HasPrefix(path, "/private/var/root") {
+		username = "root"
+	}
+	eventTimestamp := fileModTime(path)
+	if eventTimestamp == "" {
+		eventTimestamp = params.CollectionTimestamp
+	}
+
+	lineNumber := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		recordData := map[string]interface{}{
+			"username":    username,
+			"file":        fileType,
+			"line":        lineNumber,
+			"hosts":       "",
+			"options":     "",
+			"command":     "",
+			"from":        "",
+			"environment": "",
+			"no_pty":      false,
+			"key_type":    "",
+			"key":         "",
+			"comment":     "",
+			"entry":       line,
+		}
+		if fileType == "known_hosts" {
+			// [@marker] hosts key-type key [comment]
+			fields := strings.Fields(line)
+			if strings.HasPrefix(fields[0], "@") && len(fields) > 1 {
+				fields = fields[1:]
+			}
+			recordData["hosts"] = fields[0]
+			line = strings.TrimSpace(strings.TrimPrefix(line[strings.Index(line, fields[0]):], fields[0]))
+		} else if !isSSHKeyType(strings.Fields(line)[0]) {
+			// [options] key-type key [comment]
+			options, rest := splitSSHOptions(line)
+			line = rest
+			recordData["options"] = options
+			for name, value := range parseSSHOptions(options) {
+				switch name {
+				case "command", "from", "environment":
+					recordData[name] = value
+				case "no-pty":
+					recordData["no_pty"] = true
+				}
+			}
+		}
+		if fields := strings.Fields(line); len(fields) > 1 {
+			recordData["key_type"] = fields[0]
+			recordData["key"] = fields[1]
+			recordData["comment"] = strings.Join(fields[2:], " ")
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// isSSHKeyType reports whether a field of an authorized_keys entry is a key type rather than options
+func isSSHKeyType(field string) bool {
+	return strings.HasPrefix(field, "ssh-") || strings.HasPrefix(field, "ecdsa-sha2-") || strings.HasPrefix(field, "sk-")
+}
+
+// splitSSHOptions splits an authorized_keys entry into its options and the key. Options end at the first
+// whitespace outside double quotes.
+func splitSSHOptions(line string) (string, string) {
+	quoted := false
+	for i, c := range line {
+		switch {
+		case c == '"' && (i == 0 || line[i-1] != '\\'):
+			quoted = !quoted
+		case (c == ' ' || c == '\t') && !quoted:
+			return line[:i], strings.TrimSpace(line[i:])
+		}
+	}
+	return line, ""
+}
+
+// parseSSHOptions returns the comma separated options of an authorized_keys entry. Flags (no-pty, restrict, ...)
+// have an empty value and quotes are removed from the values.
+func parseSSHOptions(options string) map[string]string {
+	parsed := make(map[string]string)
+	quoted := false
+	start := 0
+	for i := 0; i <= len(options); i++ {
+		if i < len(options) {
+			if options[i] == '"' && (i == 0 || options[i-1] != '\\') {
+				quoted = !quoted
+			}
+			if options[i] != ',' || quoted {
+				continue
+			}
+		}
+		name, value, _ := strings.Cut(options[start:i], "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(value) > 1 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+		value = strings.ReplaceAll(value, `\"`, `"`)
+		if name != "" {
+			if previous, ok := parsed[name]; ok && value != "" {
+				value = previous + ", " + value
+			}
+			parsed[name] = value
+		}
+		start = i + 1
+	}
+	return parsed
+}
+
+func collectSSHConfig(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, path := range utils.GlobPaths(sshClientConfigPaths...) {
+		err := parseSSHConfig(path, "client", writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+		}
+	}
+	for _, path := range utils.GlobPaths(sshServerConfigPaths...) {
+		err := parseSSHConfig(path, "server", writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// parseSSHConfig emits a record per directive of an ssh_config or sshd_config file, with the Host or Match
+// block it belongs to
+func parseSSHConfig(path string, configType string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	lines, mtime, err := readConfigLines(path)
+	if err != nil {
+		return err
+	}
+	if mtime == "" {
+		mtime = params.CollectionTimestamp
+	}
+
+	username := utils.GetUsernameFromPath(path)
+	if username == "" && strings.HasPrefix(path, "/private/var/root") {
+		username = "root"
+	}
+
+	block := ""
+	for _, line := range lines {
+		// Directives are separated from their value by whitespace or "="
+		directive, value := line, ""
+		if idx := strings.IndexAny(line, " \t="); idx >= 0 {
+			directive = line[:idx]
+			value = strings.TrimLeft(line[idx:], " \t=")
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		lower := strings.ToLower(directive)
+		if lower == "host" || lower == "match" {
+			block = directive + " " + value
+			continue
+		}
+
+		recordData := map[string]interface{}{
+			"username":  username,
+			"config":    configType,
+			"block":     block,
+			"directive": directive,
+			"value":     value,
+			"flagged":   isFlaggedSSHDirective(configType, lower, value),
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      mtime,
+			Data:                recordData,
+			SourceFile:          path,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// isFlaggedSSHDirective reports whether a directive tunnels or runs commands (client) or weakens the server policy
+func isFlaggedSSHDirective(configType string, directive string, value string) bool {
+	flaggedDirectives, flaggedValues := sshClientFlaggedDirectives, sshClientFlaggedValues
+	if configType == "server" {
+		flaggedDirectives, flaggedValues = sshServerFlaggedDirectives, sshServerFlaggedValues
+	}
+	if flaggedDirectives[directive] {
+		return strings.ToLower(value) != "none"
+	}
+	if flagged, ok := flaggedValues[directive]; ok {
+		return strings.EqualFold(value, flagged)
+	}
+	return false
+}
+
+func collectSSHPrivateKeys(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, directory := range utils.GlobPaths(sshHomeDirectories...) {
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", directory, err)
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(directory, entry.Name())
+			info, err := entry.Info()
+			if err != nil || !info.Mode().IsRegular() || info.Size() > sshMaxKeyFileSize || strings.HasSuffix(path, ".pub") {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			key, ok := parseSSHPrivateKey(data)
+			if !ok {
+				continue
+			}
+
+			// The fingerprint is computed from the matching .pub file, or from the public key stored in the private key
+			publicKey := key.PublicKey
+			publicKeyFile := ""
+			if pub, err := os.ReadFile(path + ".pub"); err == nil {
+				fields := strings.Fields(string(pub))
+				if len(fields) > 1 {
+					if blob, err := base64.StdEncoding.DecodeString(fields[1]); err == nil {
+						publicKey = blob
+						publicKeyFile = path + ".pub"
+					}
+				}
+			}
+			fingerprint := ""
+			if publicKey != nil {
+				sum := sha256.Sum256(publicKey)
+				fingerprint = "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+				if key.KeyType == "" || key.Bits == 0 {
+					key.KeyType, key.Bits = sshPublicKeyInfo(publicKey)
+				}
+			}
+
+			mode := info.Mode().Perm()
+			worldReadable := mode&0o004 != 0
+			username := utils.GetUsernameFromPath(path)
+			if username == "" && strings.HasPrefix(path, "/private/var/root") {
+				username = "root"
+			}
+
+			recordData := map[string]interface{}{
+				"username":        username,
+				"format":          key.Format,
+				"key_type":        key.KeyType,
+				"bits":            key.Bits,
+				"encrypted":       key.Encrypted,
+				"permissions":     fmt.Sprintf("%04o", uint32(mode)),
+				"owner":           fileOwner(path),
+				"world_readable":  worldReadable,
+				"fingerprint":     fingerprint,
+				"public_key_file": publicKeyFile,
+				"flagged":         worldReadable || !key.Encrypted,
+			}
+
+			eventTimestamp := info.ModTime().UTC().Format(utils.TimeFormat)
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          path,
+			}
+
+			err = writer.WriteRecord(record)
+			if err != nil {
+				params.Logger.Debug("Failed to write record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseSSHPrivateKey identifies a private key file and returns its properties
+func parseSSHPrivateKey(data []byte) (sshPrivateKey, bool) {
+	if bytes.HasPrefix(data, []byte("PuTTY-User-Key-File-")) {
+		key := sshPrivateKey{Format: "putty"}
+		for _, line := range strings.Split(string(data), "\n") {
+			name, value, _ := strings.Cut(strings.TrimSpace(line), ": ")
+			switch {
+			case strings.HasPrefix(name, "PuTTY-User-Key-File-"):
+				key.KeyType = value
+			case name == "Encryption":
+				key.Encrypted = value != "none"
+			}
+		}
+		return key, true
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return sshPrivateKey{}, false
+	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return sshPrivateKey{Format: "pkcs8", Encrypted: true}, true
+	}
+
+	key := sshPrivateKey{Format: "pem", KeyType: strings.ToLower(strings.TrimSuffix(block.Type, " PRIVATE KEY"))}
+	if block.Headers["Proc-Type"] == "4,ENCRYPTED" {
+		key.Encrypted = true
+		return key, true
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key.Format = "pkcs8"
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return key, true
+	}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.KeyType, key.Bits = "ssh-rsa", k.N.BitLen()
+	case *ecdsa.PrivateKey:
+		key.KeyType, key.Bits = "ecdsa", k.Curve.Params().BitSize
+	case ed25519.PrivateKey:
+		key.KeyType, key.Bits = "ssh-ed25519", 256
+	}
+	return key, true
+}
+
+// parseOpenSSHPrivateKey parses the header of an openssh-key-v1 private key: cipher, KDF and public keys
+func parseOpenSSHPrivateKey(data []byte) (sshPrivateKey, bool) {
+	key := sshPrivateKey{Format: "openssh"}
+	magic := []byte("openssh-key-v1\x00")
+	if !bytes.HasPrefix(data, magic) {
+		return key, true
+	}
+	data = data[len(magic):]
+
+	cipher, data, ok := sshString(data)
+	if !ok {
+		return key, true
+	}
+	key.Encrypted = string(cipher) != "none"
+	// kdf name and options
+	if _, data, ok = sshString(data); !ok {
+		return key, true
+	}
+	if _, data, ok = sshString(data); !ok || len(data) < 4 {
+		return key, true
+	}
+	// number of keys, the first public key is reported
+	data = data[4:]
+	if publicKey, _, ok := sshString(data); ok {
+		key.PublicKey = publicKey
+		key.KeyType, key.Bits = sshPublicKeyInfo(publicKey)
+	}
+	return key, true
+}
+
+// sshPublicKeyInfo returns the type and size in bits of a public key in the SSH wire format
+func sshPublicKeyInfo(blob []byte) (string, int) {
+	keyType, data, ok := sshString(blob)
+	if !ok {
+		return "", 0
+	}
+	name := string(keyType)
+	switch {
+	case name == "ssh-rsa":
+		// exponent then modulus
+		if _, data, ok = sshString(data); !ok {
+			return name, 0
+		}
+		modulus, _, ok := sshString(data)
+		if !ok {
+			return name, 0
+		}
+		modulus = bytes.TrimLeft(modulus, "\x00")
+		bits := len(modulus) * 8
+		if len(modulus) > 0 {
+			for b := modulus[0]; b&0x80 == 0 && bits > 0; b <<= 1 {
+				bits--
+			}
+		}
+		return name, bits
+	case name == "ssh-dss":
+		prime, _, ok := sshString(data)
+		if !ok {
+			return name, 0
+		}
+		return name, len(bytes.TrimLeft(prime, "\x00")) * 8
+	case strings.Contains(name, "ed25519"):
+		return name, 256
+	case strings.HasPrefix(name, "ecdsa-sha2-") || strings.HasPrefix(name, "sk-ecdsa-sha2-"):
+		curve, _, _ := sshString(data)
+		return name, sshECDSABits[string(curve)]
+	}
+	return name, 0
+}
+
+// sshString reads a length-prefixed string of the SSH wire format and returns it with the remaining data
+func sshString(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(length) {
+		return nil, nil, false
+	}
+	return data[4 : 4+length], data[4+length:], true
+}
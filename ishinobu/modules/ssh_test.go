@@ -0,0 +1,123 @@
+package modules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSSHOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantOptions string
+		wantKey     string
+	}{
+		{
+			name:        "flag options",
+			line:        "no-pty,no-port-forwarding ssh-ed25519 AAAAC3 user@host",
+			wantOptions: "no-pty,no-port-forwarding",
+			wantKey:     "ssh-ed25519 AAAAC3 user@host",
+		},
+		{
+			name:        "quoted command with spaces and commas",
+			line:        `command="/bin/backup --from a,b",no-pty ssh-rsa AAAAB3`,
+			wantOptions: `command="/bin/backup --from a,b",no-pty`,
+			wantKey:     "ssh-rsa AAAAB3",
+		},
+		{
+			name:        "escaped quotes in a quoted value",
+			line:        `command="echo \"a b\"" ssh-ed25519 AAAAC3`,
+			wantOptions: `command="echo \"a b\""`,
+			wantKey:     "ssh-ed25519 AAAAC3",
+		},
+		{
+			name:        "tab after the options",
+			line:        "restrict\tssh-ed25519 AAAAC3",
+			wantOptions: "restrict",
+			wantKey:     "ssh-ed25519 AAAAC3",
+		},
+		{
+			name:        "options without a key",
+			line:        `from="10.0.0.1"`,
+			wantOptions: `from="10.0.0.1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, key := splitSSHOptions(tt.line)
+			if options != tt.wantOptions || key != tt.wantKey {
+				t.Errorf("splitSSHOptions() = %q, %q, want %q, %q", options, key, tt.wantOptions, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestParseSSHOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		want    map[string]string
+	}{
+		{
+			name:    "quoted comma",
+			options: `command="a,b"`,
+			want:    map[string]string{"command": "a,b"},
+		},
+		{
+			name:    "escaped quotes",
+			options: `command="echo \"a,b\"",no-pty`,
+			want:    map[string]string{"command": `echo "a,b"`, "no-pty": ""},
+		},
+		{
+			name:    "repeated from and environment",
+			options: `from="10.0.0.0/8",environment="A=1",from="192.168.1.1",environment="B=2"`,
+			want:    map[string]string{"from": "10.0.0.0/8, 192.168.1.1", "environment": "A=1, B=2"},
+		},
+		{
+			name:    "flag options",
+			options: "restrict,No-Pty,port-forwarding",
+			want:    map[string]string{"restrict": "", "no-pty": "", "port-forwarding": ""},
+		},
+		{
+			name:    "unquoted value",
+			options: "expiry-time=20300101",
+			want:    map[string]string{"expiry-time": "20300101"},
+		},
+		{
+			name:    "no options",
+			options: "",
+			want:    map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSSHOptions(tt.options)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSSHOptions(%q) = %v, want %v", tt.options, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSSHKeyType(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"ssh-ed25519", true},
+		{"ssh-rsa", true},
+		{"ecdsa-sha2-nistp256", true},
+		{"sk-ssh-ed25519@openssh.com", true},
+		{"no-pty", false},
+		{`command="/bin/true"`, false},
+	}
+
+	// Entries starting with a key type have no options
+	for _, tt := range tests {
+		if got := isSSHKeyType(tt.field); got != tt.want {
+			t.Errorf("isSSHKeyType(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// This module audits the privilege configuration of the host:
+//   - /etc/sudoers and /etc/sudoers.d/*: rules are parsed into user/group, host, runas, tags (NOPASSWD, SETENV, ...)
+//     and commands. Defaults, aliases and include directives are emitted as they are.
+//     Rules granting every command without password (NOPASSWD: ALL) are flagged.
+//   - /etc/pam.d/*: one record per module line. Touch ID (pam_tid), modules loaded from outside /usr/lib/pam
+//     and pam_permit used to satisfy authentication are flagged.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SudoersModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SudoersModule{
+		Name:        "sudoers",
+		Description: "Parses sudoers rules and PAM configuration to find privilege backdoors"}
+	mod.RegisterModule(module)
+}
+
+func (m *SudoersModule) GetName() string {
+	return m.Name
+}
+
+func (m *SudoersModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	sudoersAliasRegex = regexp.MustCompile(`^(User_Alias|Runas_Alias|Host_Alias|Cmnd_Alias|Cmd_Alias)\s+(.+)$`)
+	// (runas) followed by tags such as NOPASSWD: or SETENV:
+	sudoersRunasRegex = regexp.MustCompile(`^\(([^)]*)\)\s*`)
+	sudoersTagRegex   = regexp.MustCompile(`^([A-Z_]+):\s*`)
+)
+
+func (m *SudoersModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeRule := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// sudoers
+	for _, path := range append([]string{"/etc/sudoers"}, utils.GlobPaths("/etc/sudoers.d/*")...) {
+		lines, err := readSudoersLines(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		mtime := fileModTime(path)
+
+		for _, line := range lines {
+			recordData := map[string]interface{}{
+				"type":              "",
+				"line":              line,
+				"modification_time": mtime,
+			}
+
+			switch {
+			case strings.HasPrefix(line, "#include") || strings.HasPrefix(line, "@include"):
+				recordData["type"] = "include"
+			case strings.HasPrefix(line, "Defaults"):
+				recordData["type"] = "defaults"
+			case sudoersAliasRegex.MatchString(line):
+				match := sudoersAliasRegex.FindStringSubmatch(line)
+				recordData["type"] = "alias"
+				recordData["alias_type"] = match[1]
+				recordData["definition"] = match[2]
+			default:
+				recordData["type"] = "rule"
+				for key, value := range parseSudoersRule(line) {
+					recordData[key] = value
+				}
+			}
+
+			writeRule(path, recordData)
+		}
+	}
+
+	// PAM configuration
+	for _, path := range utils.GlobPaths("/etc/pam.d/*") {
+		lines, mtime, err := readConfigLines(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			moduleType, control, module := fields[0], fields[1], fields[2]
+			writeRule(path, map[string]interface{}{
+				"type":              "pam",
+				"service":           filepath.Base(path),
+				"module_type":       moduleType,
+				"control":           control,
+				"module":            module,
+				"arguments":         strings.Join(fields[3:], " "),
+				"line":              line,
+				"modification_time": mtime,
+				"touch_id":          strings.Contains(module, "pam_tid"),
+				"non_standard_path": strings.HasPrefix(module, "/") && !strings.HasPrefix(module, "/usr/lib/pam/"),
+				"permit_auth":       moduleType == "auth" && control == "sufficient" && strings.Contains(module, "pam_permit"),
+			})
+		}
+	}
+
+	return nil
+}
+
+// readSudoersLines returns the logical lines of a sudoers file: comments are removed except the
+// #include and #includedir directives, and lines ending with a backslash are joined.
+func readSudoersLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	current := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#include") {
+			if idx := strings.Index(line, "#"); idx >= 0 {
+				line = strings.TrimSpace(line[:idx])
+			}
+		}
+		if strings.HasSuffix(line, "\\") {
+			current += strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		line = strings.TrimSpace(current + line)
+		current = ""
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if current = strings.TrimSpace(current); current != "" {
+		lines = append(lines, current)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseSudoersRule splits a rule such as "%admin ALL = (ALL) NOPASSWD: ALL" into its fields
+func parseSudoersRule(line string) map[string]interface{} {
+	recordData := map[string]interface{}{
+		"principal":    "",
+		"is_group":     false,
+		"host":         "",
+		"runas":        "",
+		"tags":         "",
+		"commands":     "",
+		"nopasswd":     false,
+		"all_commands": false,
+		"suspicious":   false,
+	}
+
+	left, right, found := strings.Cut(line, "=")
+	if !found {
+		return recordData
+	}
+	fields := strings.Fields(left)
+	if len(fields) == 0 {
+		return recordData
+	}
+	principal := strings.Join(fields[:len(fields)-1], " ")
+	host := fields[len(fields)-1]
+	if len(fields) == 1 {
+		principal, host = fields[0], ""
+	}
+
+	right = strings.TrimSpace(right)
+	runas := ""
+	if match := sudoersRunasRegex.FindStringSubmatch(right); match != nil {
+		runas = match[1]
+		right = right[len(match[0]):]
+	}
+	var tags []string
+	for {
+		match := sudoersTagRegex.FindStringSubmatch(right)
+		if match == nil {
+			break
+		}
+		tags = append(tags, match[1])
+		right = right[len(match[0]):]
+	}
+	commands := strings.TrimSpace(right)
+
+	nopasswd := false
+	for _, tag := range tags {
+		if tag == "NOPASSWD" {
+			nopasswd = true
+		}
+	}
+	allCommands := false
+	for _, command := range strings.Split(commands, ",") {
+		if strings.TrimSpace(command) == "ALL" {
+			allCommands = true
+		}
+	}
+
+	recordData["principal"] = principal
+	recordData["is_group"] = strings.HasPrefix(principal, "%")
+	recordData["host"] = host
+	recordData["runas"] = runas
+	recordData["tags"] = strings.Join(tags, ", ")
+	recordData["commands"] = commands
+	recordData["nopasswd"] = nopasswd
+	recordData["all_commands"] = allCommands
+	recordData["suspicious"] = nopasswd && allCommands
+
+	return recordData
+}
@@ -0,0 +1,112 @@
+// This module collects the system context of the host in a single record:
+// - macOS product name, version and build: sw_vers
+// - Hardware model and serial number: sysctl hw.model and ioreg IOPlatformExpertDevice
+// - Kernel version and arguments: sysctl kern.version, kern.bootargs and nvram boot-args
+// - Boot time and uptime: sysctl kern.boottime
+// - System Integrity Protection status: csrutil status
+// - FileVault status: fdesetup status
+package modules
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type SysInfoModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &SysInfoModule{
+		Name:        "sysinfo",
+		Description: "Collects system information and hardware inventory"}
+	mod.RegisterModule(module)
+}
+
+func (m *SysInfoModule) GetName() string {
+	return m.Name
+}
+
+func (m *SysInfoModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *SysInfoModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	recordData := make(map[string]interface{})
+
+	hostname, err := utils.GetHostname()
+	if err != nil {
+		params.Logger.Debug("Failed to get hostname: %v", err)
+	}
+	recordData["hostname"] = hostname
+
+	recordData["product_name"] = runSysInfoCommand(params, "sw_vers", "-productName")
+	recordData["product_version"] = runSysInfoCommand(params, "sw_vers", "-productVersion")
+	recordData["build_version"] = runSysInfoCommand(params, "sw_vers", "-buildVersion")
+	recordData["hardware_model"] = runSysInfoCommand(params, "sysctl", "-n", "hw.model")
+	recordData["cpu_brand"] = runSysInfoCommand(params, "sysctl", "-n", "machdep.cpu.brand_string")
+	recordData["memory_bytes"] = runSysInfoCommand(params, "sysctl", "-n", "hw.memsize")
+	recordData["kernel_version"] = runSysInfoCommand(params, "sysctl", "-n", "kern.version")
+	recordData["kernel_bootargs"] = runSysInfoCommand(params, "sysctl", "-n", "kern.bootargs")
+	recordData["nvram_boot_args"] = strings.TrimPrefix(runSysInfoCommand(params, "nvram", "boot-args"), "boot-args\t")
+	recordData["sip_status"] = runSysInfoCommand(params, "csrutil", "status")
+	recordData["filevault_status"] = runSysInfoCommand(params, "fdesetup", "status")
+
+	serialNumber, err := utils.GetSerialNumber()
+	if err != nil {
+		params.Logger.Debug("Failed to get serial number: %v", err)
+	}
+	recordData["serial_number"] = serialNumber
+
+	// kern.boottime format: { sec = 1700000000, usec = 123456 } Tue Nov 14 22:13:20 2023
+	bootTime := ""
+	match := regexp.MustCompile(`sec = (\d+)`).FindStringSubmatch(runSysInfoCommand(params, "sysctl", "-n", "kern.boottime"))
+	if len(match) == 2 {
+		seconds, err := strconv.ParseInt(match[1], 10, 64)
+		if err == nil {
+			bootTime = utils.ConvertUnixTimestamp(seconds)
+			recordData["uptime_seconds"] = int64(time.Since(time.Unix(seconds, 0)).Seconds())
+		}
+	}
+	recordData["boot_time"] = bootTime
+
+	record := utils.Record{
+		CollectionTimestamp: params.CollectionTimestamp,
+		EventTimestamp:      params.CollectionTimestamp,
+		Data:                recordData,
+		SourceFile:          m.GetName(),
+	}
+
+	err = writer.WriteRecord(record)
+	if err != nil {
+		params.Logger.Debug("Failed to write record: %v", err)
+		return fmt.Errorf("failed to write record: %v", err)
+	}
+
+	return nil
+}
+
+// runSysInfoCommand returns the trimmed output of a command or an empty string if it fails.
+func runSysInfoCommand(params mod.ModuleParams, name string, args ...string) string {
+	output, err := exec.Command(name, args...).Output()
+	if err != nil {
+		params.Logger.Debug("Error running %s: %v", name, err)
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
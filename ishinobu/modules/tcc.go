@@ -0,0 +1,212 @@
+// This module collects and parses the Transparency, Consent and Control (TCC) databases:
+// - /Library/Application Support/com.apple.TCC/TCC.db
+// - /Users/*/Library/Application Support/com.apple.TCC/TCC.db
+// Each record contains the client (bundle id or path), the service (Full Disk Access, Screen Recording,
+// Accessibility, etc.), the auth value and the modification and prompt timestamps.
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type TCCModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &TCCModule{
+		Name:        "tcc",
+		Description: "Collects and parses privacy permissions from TCC databases"}
+	mod.RegisterModule(module)
+}
+
+func (m *TCCModule) GetName() string {
+	return m.Name
+}
+
+func (m *TCCModule) GetDescription() string {
+	return m.Description
+}
+
+// Human readable names of the most relevant TCC services
+var tccServices = map[string]string{
+	"kTCCServiceSystemPolicyAllFiles":          "Full Disk Access",
+	"kTCCServiceScreenCapture":                 "Screen Recording",
+	"kTCCServiceAccessibility":                 "Accessibility",
+	"kTCCServiceListenEvent":                   "Input Monitoring",
+	"kTCCServicePostEvent":                     "Post Events",
+	"kTCCServiceAppleEvents":                   "Automation",
+	"kTCCServiceCamera":                        "Camera",
+	"kTCCServiceMicrophone":                    "Microphone",
+	"kTCCServiceDeveloperTool":                 "Developer Tools",
+	"kTCCServiceEndpointSecurityClient":        "Endpoint Security",
+	"kTCCServiceSystemPolicyDesktopFolder":     "Desktop Folder",
+	"kTCCServiceSystemPolicyDocumentsFolder":   "Documents Folder",
+	"kTCCServiceSystemPolicyDownloadsFolder":   "Downloads Folder",
+	"kTCCServiceSystemPolicyNetworkVolumes":    "Network Volumes",
+	"kTCCServiceSystemPolicyRemovableVolumes":  "Removable Volumes",
+	"kTCCServiceSystemPolicySysAdminFiles":     "Administer Files",
+	"kTCCServiceSystemPolicyAppBundles":        "App Management",
+	"kTCCServiceAddressBook":                   "Contacts",
+	"kTCCServiceCalendar":                      "Calendars",
+	"kTCCServiceReminders":                     "Reminders",
+	"kTCCServicePhotos":                        "Photos",
+	"kTCCServiceLocation":                      "Location",
+	"kTCCServiceFileProviderDomain":            "File Provider",
+	"kTCCServiceRemoteDesktop":                 "Remote Desktop",
+	"kTCCServiceBluetoothAlways":               "Bluetooth",
+	"kTCCServiceSpeechRecognition":             "Speech Recognition",
+	"kTCCServiceMediaLibrary":                  "Media Library",
+	"kTCCServiceUbiquity":                      "iCloud",
+	"kTCCServiceLiverpool":                     "Location Services",
+	"kTCCServiceFileProviderPresence":          "File Provider Presence",
+	"kTCCServiceSystemPolicyDeveloperFiles":    "Developer Files",
+	"kTCCServiceAppleEventsBundleIDAutomation": "Automation",
+}
+
+var tccAuthValues = map[int64]string{
+	0: "denied",
+	1: "unknown",
+	2: "allowed",
+	3: "limited",
+}
+
+var tccAuthReasons = map[int64]string{
+	1:  "error",
+	2:  "user_consent",
+	3:  "user_set",
+	4:  "system_set",
+	5:  "service_policy",
+	6:  "mdm_policy",
+	7:  "override_policy",
+	8:  "missing_usage_string",
+	9:  "prompt_timeout",
+	10: "preflight_unknown",
+	11: "entitled",
+	12: "app_type_policy",
+}
+
+func (m *TCCModule) Run(params mod.ModuleParams) error {
+	paths := []string{"/Library/Application Support/com.apple.TCC/TCC.db",
+		"/Users/*/Library/Application Support/com.apple.TCC/TCC.db"}
+	var dbPaths []string
+	for _, path := range paths {
+		expandedPath, err := filepath.Glob(path)
+		if err != nil {
+			continue
+		}
+		dbPaths = append(dbPaths, expandedPath...)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-tcc")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for i, dbPath := range dbPaths {
+		username := "system"
+		if strings.HasPrefix(dbPath, "/Users/") {
+			username = utils.GetUsernameFromPath(dbPath)
+		}
+
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			params.Logger.Debug("Failed to create directory %s: %v", dstDir, err)
+			continue
+		}
+
+		dst, err := utils.CopyDatabase(dbPath, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", dbPath, err)
+			continue
+		}
+
+		err = parseTCC(dst, dbPath, username, writer, params)
+		if err != nil {
+			params.Logger.Debug("Error parsing TCC database %s: %v", dbPath, err)
+		}
+	}
+
+	return nil
+}
+
+func parseTCC(dbPath string, sourceFile string, username string, writer *utils.DataWriter, params mod.ModuleParams) error {
+	// macOS 11+ stores auth_value/auth_reason. Older versions use the allowed and prompt_count columns.
+	query := `
+		SELECT service, client, client_type, auth_value, auth_reason, indirect_object_identifier, last_modified, last_reminded
+		FROM access`
+	legacyQuery := `
+		SELECT service, client, client_type, CASE allowed WHEN 1 THEN 2 ELSE 0 END, NULL, NULL, last_modified, NULL
+		FROM access`
+
+	rows, err := utils.QuerySQLite(dbPath, query)
+	if err != nil {
+		params.Logger.Debug("Falling back to legacy TCC query: %v", err)
+		rows, err = utils.QuerySQLite(dbPath, legacyQuery)
+		if err != nil {
+			return fmt.Errorf("error querying SQLite: %v", err)
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var service, client, indirectObject sql.NullString
+		var clientType, authValue, authReason, lastModified, lastReminded sql.NullInt64
+		err := rows.Scan(&service, &client, &clientType, &authValue, &authReason, &indirectObject, &lastModified, &lastReminded)
+		if err != nil {
+			params.Logger.Debug("Error scanning row: %v", err)
+			continue
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["username"] = username
+		recordData["service"] = service.String
+		recordData["service_name"] = tccServices[service.String]
+		recordData["client"] = client.String
+		if clientType.Int64 == 0 {
+			recordData["client_type"] = "bundle_id"
+		} else {
+			recordData["client_type"] = "absolute_path"
+		}
+		recordData["auth_value"] = tccAuthValues[authValue.Int64]
+		recordData["auth_reason"] = tccAuthReasons[authReason.Int64]
+		recordData["indirect_object"] = indirectObject.String
+		recordData["last_modified"] = utils.ConvertUnixTimestamp(lastModified.Int64)
+		recordData["last_reminded"] = utils.ConvertUnixTimestamp(lastReminded.Int64)
+
+		eventTimestamp := recordData["last_modified"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
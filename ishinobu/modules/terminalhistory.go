@@ -1,15 +1,25 @@
 // Description: This module collects and parses terminal histories from the following paths:
-// - /Users/*/.*_history
+// - /Users/*/.*_history (.zsh_history, .bash_history, etc.) and /Users/*/.zhistory
 // - /Users/*/.bash_sessions/*
-// - /private/var/*/.*_history
-// - /private/var/*/.bash_sessions/*
-// The module parses the terminal histories and extracts the username and command executed.
+// - /Users/*/.local/share/fish/fish_history
+// - /private/var/*/.*_history, /private/var/*/.zhistory and /private/var/*/.bash_sessions/* (root and service accounts)
+// The module parses the terminal histories and extracts the username and command executed, one record per command
+// with its position in the history file. Timestamps are extracted when present:
+// - zsh extended history: ": <start>:<elapsed>;<command>"
+// - bash with HISTTIMEFORMAT: "#<epoch>" line before the command
+// - fish: "- cmd: <command>" followed by "  when: <epoch>"
+// zsh histories store the non-ASCII bytes metafied (0x83 followed by the byte xor 0x20), which are decoded.
 package modules
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
 	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
@@ -35,60 +45,206 @@ func (m *TerminalModule) GetDescription() string {
 	return m.Description
 }
 
+var (
+	zshExtendedHistoryRegex = regexp.MustCompile(`^: (\d+):(\d+);(.*)$`)
+	bashTimestampRegex      = regexp.MustCompile(`^#(\d{9,})$`)
+)
+
+// historyEntry is a command read from a history file
+type historyEntry struct {
+	Command   string
+	Timestamp string
+	Duration  string
+}
+
 func (m *TerminalModule) Run(params mod.ModuleParams) error {
-	paths := []string{"/Users/*/.*_history", "/Users/*/.bash_sessions/*",
-		"/private/var/*/.*_history", "/private/var/*/.bash_sessions/*"}
-	var expandedPaths []string
-	for _, path := range paths {
-		expandedPath, err := filepath.Glob(path)
-		if err != nil {
-			continue
-		}
-		expandedPaths = append(expandedPaths, expandedPath...)
-	}
+	expandedPaths := utils.GlobPaths("/Users/*/.*_history", "/Users/*/.zhistory", "/Users/*/.bash_sessions/*",
+		"/Users/*/.local/share/fish/fish_history",
+		"/private/var/*/.*_history", "/private/var/*/.zhistory", "/private/var/*/.bash_sessions/*")
 
 	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
 	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
 	if err != nil {
 		return err
 	}
+	defer writer.Close()
 
 	for _, path := range expandedPaths {
 		username := utils.GetUsernameFromPath(path)
 
-		file, err := os.Open(path)
+		var entries []historyEntry
+		shell := historyShell(path)
+		if shell == "fish" {
+			entries, err = readFishHistory(path)
+		} else {
+			entries, err = readShellHistory(path)
+		}
+		// The entries read before an error are still collected
 		if err != nil {
-			params.Logger.Debug("Error opening file: %v", err)
-			continue
+			params.Logger.Debug("Error reading history file %s: %v", path, err)
 		}
-		defer file.Close()
-
-		r := bufio.NewReader(file)
-		for {
-			line, _, err := r.ReadLine()
-
-			if len(line) > 0 {
-				recordData := make(map[string]interface{})
-				recordData["username"] = username
-				recordData["command"] = string(line)
-
-				record := utils.Record{
-					CollectionTimestamp: params.CollectionTimestamp,
-					EventTimestamp:      params.CollectionTimestamp,
-					Data:                recordData,
-					SourceFile:          path,
-				}
-
-				err := writer.WriteRecord(record)
-				if err != nil {
-					params.Logger.Debug("Error writing record: %v", err)
-				}
+
+		for index, entry := range entries {
+			recordData := make(map[string]interface{})
+			recordData["username"] = username
+			recordData["shell"] = shell
+			recordData["command"] = entry.Command
+			recordData["order"] = index + 1
+			recordData["command_timestamp"] = entry.Timestamp
+			recordData["elapsed_seconds"] = entry.Duration
+
+			eventTimestamp := entry.Timestamp
+			if eventTimestamp == "" {
+				eventTimestamp = params.CollectionTimestamp
 			}
 
+			record := utils.Record{
+				CollectionTimestamp: params.CollectionTimestamp,
+				EventTimestamp:      eventTimestamp,
+				Data:                recordData,
+				SourceFile:          path,
+			}
+
+			err := writer.WriteRecord(record)
 			if err != nil {
-				break
+				params.Logger.Debug("Error writing record: %v", err)
 			}
 		}
 	}
 	return nil
 }
+
+func historyShell(path string) string {
+	name := filepath.Base(path)
+	switch {
+	case name == "fish_history":
+		return "fish"
+	case strings.HasPrefix(name, ".zsh") || name == ".zhistory":
+		return "zsh"
+	case strings.HasPrefix(name, ".bash") || strings.Contains(path, "/.bash_sessions/"):
+		return "bash"
+	case strings.HasSuffix(name, "_history"):
+		return strings.TrimSuffix(strings.TrimPrefix(name, "."), "_history")
+	}
+	return ""
+}
+
+// readShellHistory reads zsh and bash style histories, including extended zsh entries,
+// multi-line zsh commands and bash HISTTIMEFORMAT timestamps. The lines of zsh histories are unmetafied.
+func readShellHistory(path string) ([]historyEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	pendingTimestamp := ""
+	continuation := false
+	unmetafy := historyShell(path) == "zsh"
+
+	err = readHistoryLines(file, func(raw []byte) {
+		line := string(raw)
+		if unmetafy {
+			line = unmetafyZsh(raw)
+		}
+
+		// zsh stores multi-line commands with a trailing backslash
+		if continuation && len(entries) > 0 {
+			last := &entries[len(entries)-1]
+			last.Command += "\n" + strings.TrimSuffix(line, "\\")
+			continuation = strings.HasSuffix(line, "\\")
+			return
+		}
+
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+
+		if match := bashTimestampRegex.FindStringSubmatch(line); match != nil {
+			pendingTimestamp = historyTimestamp(match[1])
+			return
+		}
+
+		entry := historyEntry{Command: line, Timestamp: pendingTimestamp}
+		pendingTimestamp = ""
+		if match := zshExtendedHistoryRegex.FindStringSubmatch(line); match != nil {
+			entry.Timestamp = historyTimestamp(match[1])
+			entry.Duration = match[2]
+			entry.Command = match[3]
+		}
+
+		continuation = strings.HasSuffix(entry.Command, "\\")
+		entry.Command = strings.TrimSuffix(entry.Command, "\\")
+		entries = append(entries, entry)
+	})
+
+	return entries, err
+}
+
+// readFishHistory reads the pseudo-YAML format used by fish
+func readFishHistory(path string) ([]historyEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []historyEntry
+	err = readHistoryLines(file, func(raw []byte) {
+		line := string(raw)
+		switch {
+		case strings.HasPrefix(line, "- cmd: "):
+			entries = append(entries, historyEntry{Command: strings.TrimPrefix(line, "- cmd: ")})
+		case strings.HasPrefix(line, "  when: ") && len(entries) > 0:
+			entries[len(entries)-1].Timestamp = historyTimestamp(strings.TrimPrefix(line, "  when: "))
+		}
+	})
+
+	return entries, err
+}
+
+// readHistoryLines calls handle for each line of a history file, without its line ending. Lines of any length are
+// read, as history files can contain long pasted commands.
+func readHistoryLines(file io.Reader, handle func(line []byte)) error {
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte("\n"))
+			handle(bytes.TrimSuffix(line, []byte("\r")))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unmetafyZsh decodes a line of a zsh history, where the bytes used internally by zsh (NUL and 0x83 to 0xa2, which
+// appear in UTF-8 characters) are stored as the 0x83 meta byte followed by the byte xor 0x20
+func unmetafyZsh(line []byte) string {
+	if bytes.IndexByte(line, 0x83) < 0 {
+		return string(line)
+	}
+	decoded := make([]byte, 0, len(line))
+	for i := 0; i < len(line); i++ {
+		if line[i] == 0x83 && i+1 < len(line) {
+			i++
+			decoded = append(decoded, line[i]^0x20)
+			continue
+		}
+		decoded = append(decoded, line[i])
+	}
+	return string(decoded)
+}
+
+func historyTimestamp(epoch string) string {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(epoch), 10, 64)
+	if err != nil {
+		return ""
+	}
+	return utils.ConvertUnixTimestamp(seconds)
+}
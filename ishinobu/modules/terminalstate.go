@@ -0,0 +1,224 @@
+// This module collects the state of terminal emulators for each user:
+//   - Terminal.app saved state: ~/Library/Saved Application State/com.apple.Terminal.savedState/windows.plist
+//     (window titles include the working directory and the running command).
+//   - Terminal.app profiles: ~/Library/Preferences/com.apple.Terminal.plist (commands run when a window opens).
+//   - iTerm2 profiles and saved arrangements: ~/Library/Preferences/com.googlecode.iterm2.plist
+//     (custom commands, working directories and initial text).
+//   - iTerm2 command history recorded by shell integration: ~/Library/Application Support/iTerm2/*CommandHistory*.plist
+//   - iTerm2 saved state: ~/Library/Saved Application State/com.googlecode.iterm2.savedState/windows.plist (window
+//     titles) and the files of ~/Library/Application Support/iTerm2/SavedState. The SavedState database holds the
+//     sessions restored at launch (contents and history of the panes) in an undocumented iTerm2-specific encoding
+//     that changes between releases, so its files are only listed with their size and modification time, to be
+//     copied and examined with iTerm2 itself.
+package modules
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type TerminalStateModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &TerminalStateModule{
+		Name:        "terminalstate",
+		Description: "Collects Terminal.app and iTerm2 saved state, profiles and command history"}
+	mod.RegisterModule(module)
+}
+
+func (m *TerminalStateModule) GetName() string {
+	return m.Name
+}
+
+func (m *TerminalStateModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *TerminalStateModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeState := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Terminal.app and iTerm2 saved windows
+	savedWindows := [][2]string{
+		{"com.apple.Terminal.savedState", "terminal_window"},
+		{"com.googlecode.iterm2.savedState", "iterm2_window"},
+	}
+	for _, state := range savedWindows {
+		stateType := state[1]
+		for _, path := range utils.GlobPaths("/Users/*/Library/Saved Application State/" + state[0] + "/windows.plist") {
+			var windows []map[string]interface{}
+			if err := utils.ParsePlistFile(path, &windows); err != nil {
+				params.Logger.Debug("Error parsing %s: %v", path, err)
+				continue
+			}
+			for _, window := range windows {
+				writeState(path, fileModTime(path), map[string]interface{}{
+					"type":      stateType,
+					"title":     window["NSTitle"],
+					"window_id": window["NSWindowID"],
+				})
+			}
+		}
+	}
+
+	// Terminal.app profiles
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.apple.Terminal.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		profiles, _ := preferences["Window Settings"].(map[string]interface{})
+		for name, value := range profiles {
+			profile, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			writeState(path, fileModTime(path), map[string]interface{}{
+				"type":        "terminal_profile",
+				"profile":     name,
+				"command":     profile["CommandString"],
+				"run_command": profile["RunCommandAsShell"],
+				"shell":       profile["Shell"],
+				"default":     preferences["Default Window Settings"] == name,
+				"startup":     preferences["Startup Window Settings"] == name,
+			})
+		}
+	}
+
+	// iTerm2 profiles and arrangements
+	for _, path := range utils.GlobPaths("/Users/*/Library/Preferences/com.googlecode.iterm2.plist") {
+		var preferences map[string]interface{}
+		if err := utils.ParsePlistFile(path, &preferences); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+
+		profiles, _ := preferences["New Bookmarks"].([]interface{})
+		for _, value := range profiles {
+			profile, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			writeState(path, fileModTime(path), map[string]interface{}{
+				"type":              "iterm2_profile",
+				"profile":           profile["Name"],
+				"guid":              profile["Guid"],
+				"custom_command":    profile["Custom Command"],
+				"command":           profile["Command"],
+				"custom_directory":  profile["Custom Directory"],
+				"working_directory": profile["Working Directory"],
+				"initial_text":      profile["Initial Text"],
+			})
+		}
+
+		arrangements, _ := preferences["Window Arrangements"].(map[string]interface{})
+		for name, value := range arrangements {
+			windows, _ := value.([]interface{})
+			directories := make([]interface{}, 0)
+			walkPlist(value, func(item map[string]interface{}) {
+				if directory, ok := item["Working Directory"]; ok {
+					directories = append(directories, directory)
+				}
+			})
+			writeState(path, fileModTime(path), map[string]interface{}{
+				"type":                "iterm2_arrangement",
+				"arrangement":         name,
+				"windows":             len(windows),
+				"working_directories": directories,
+			})
+		}
+	}
+
+	// iTerm2 shell integration command history
+	for _, path := range utils.GlobPaths("/Users/*/Library/Application Support/iTerm2/*ommandHistory*.plist") {
+		var history interface{}
+		if err := utils.ParsePlistFile(path, &history); err != nil {
+			params.Logger.Debug("Error parsing %s: %v", path, err)
+			continue
+		}
+		walkPlist(history, func(item map[string]interface{}) {
+			command, ok := item["command"]
+			if !ok {
+				return
+			}
+			lastUsed := ""
+			if useTime, ok := item["last used"].(float64); ok {
+				lastUsed = utils.ConvertCFAbsoluteTime(useTime)
+			}
+			writeState(path, lastUsed, map[string]interface{}{
+				"type":      "iterm2_command",
+				"command":   command,
+				"directory": item["directory"],
+				"use_count": item["uses"],
+				"last_used": lastUsed,
+			})
+		})
+	}
+
+	// iTerm2 restorable state, listed only
+	for _, path := range utils.GlobPaths("/Users/*/Library/Application Support/iTerm2/SavedState/*") {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		writeState(path, fileModTime(path), map[string]interface{}{
+			"type": "iterm2_saved_state",
+			"size": info.Size(),
+		})
+	}
+
+	return nil
+}
+
+// walkPlist calls fn for every dictionary found in a decoded plist value
+func walkPlist(value interface{}, fn func(map[string]interface{})) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		fn(v)
+		for _, child := range v {
+			walkPlist(child, fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkPlist(child, fn)
+		}
+	}
+}
+
+// fileModTime returns the modification time of a file in TimeFormat or an empty string if it cannot be read
+func fileModTime(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return info.ModTime().UTC().Format(utils.TimeFormat)
+}
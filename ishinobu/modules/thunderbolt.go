@@ -0,0 +1,214 @@
+// This module collects the Thunderbolt and display connections of the host, to capture docking stations and
+// external devices:
+//   - Thunderbolt/USB4 device tree: every bus and connected device of system_profiler SPThunderboltDataType
+//     (name, vendor, IDs, UID, route, mode and firmware version) with its parent device.
+//   - Displays: the displays connected at collection time (system_profiler SPDisplaysDataType) with their vendor,
+//     product, serial number, connection type and resolution.
+//   - Connection events: Thunderbolt messages of the kernel and display connection messages of WindowServer in the
+//     unified logs over the configured window (thunderbolt-events).
+//
+// The window defaults to the last 7 days and can be changed in <InputDir>/thunderbolt.json ({"days": N}).
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type ThunderboltModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &ThunderboltModule{
+		Name:        "thunderbolt",
+		Description: "Collects the Thunderbolt device tree, connected displays and their connection events"}
+	mod.RegisterModule(module)
+}
+
+func (m *ThunderboltModule) GetName() string {
+	return m.Name
+}
+
+func (m *ThunderboltModule) GetDescription() string {
+	return m.Description
+}
+
+func (m *ThunderboltModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	err = collectThunderboltEvents(m.GetName()+"-events", config.Days, params)
+	if err != nil {
+		params.Logger.Debug("Error collecting Thunderbolt and display events: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeDevice := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Thunderbolt device tree
+	buses, err := systemProfilerItems("SPThunderboltDataType")
+	if err != nil {
+		params.Logger.Debug("Error running system_profiler SPThunderboltDataType: %v", err)
+	}
+	var walk func(items []interface{}, parent string)
+	walk = func(items []interface{}, parent string) {
+		for _, value := range items {
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := valueOrEmpty(item["device_name_key"])
+			if name == "" {
+				name = valueOrEmpty(item["_name"])
+			}
+			writeDevice("system_profiler SPThunderboltDataType", map[string]interface{}{
+				"type":          "thunderbolt",
+				"name":          name,
+				"vendor":        valueOrEmpty(item["vendor_name_key"]),
+				"vendor_id":     valueOrEmpty(item["vendor_id_key"]),
+				"product_id":    valueOrEmpty(item["device_id_key"]),
+				"serial_number": valueOrEmpty(item["switch_uid_key"]),
+				"route":         valueOrEmpty(item["route_string_key"]),
+				"connection":    valueOrEmpty(item["mode_key"]),
+				"version":       valueOrEmpty(item["switch_version_key"]),
+				"resolution":    "",
+				"parent":        parent,
+			})
+			if children, ok := item["_items"].([]interface{}); ok {
+				walk(children, fmt.Sprintf("%v", name))
+			}
+		}
+	}
+	walk(buses, "")
+
+	// Connected displays
+	adapters, err := systemProfilerItems("SPDisplaysDataType")
+	if err != nil {
+		params.Logger.Debug("Error running system_profiler SPDisplaysDataType: %v", err)
+	}
+	for _, value := range adapters {
+		adapter, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		displays, _ := adapter["spdisplays_ndrvs"].([]interface{})
+		for _, value := range displays {
+			display, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// manufacture date of the display
+			manufactured := ""
+			if year, ok := display["_spdisplays_display-year"]; ok {
+				manufactured = fmt.Sprintf("%v-W%v", year, valueOrEmpty(display["_spdisplays_display-week"]))
+			}
+			writeDevice("system_profiler SPDisplaysDataType", map[string]interface{}{
+				"type":          "display",
+				"name":          valueOrEmpty(display["_name"]),
+				"vendor":        "",
+				"vendor_id":     valueOrEmpty(display["_spdisplays_display-vendor-id"]),
+				"product_id":    valueOrEmpty(display["_spdisplays_display-product-id"]),
+				"serial_number": valueOrEmpty(display["_spdisplays_display-serial-number"]),
+				"route":         "",
+				"connection":    valueOrEmpty(display["spdisplays_connection_type"]),
+				"version":       manufactured,
+				"resolution":    valueOrEmpty(display["_spdisplays_resolution"]),
+				"parent":        valueOrEmpty(adapter["_name"]),
+			})
+		}
+	}
+
+	return nil
+}
+
+// systemProfilerItems returns the items of a system_profiler data type
+func systemProfilerItems(dataType string) ([]interface{}, error) {
+	output, err := exec.Command("system_profiler", dataType, "-json").Output()
+	if err != nil {
+		return nil, err
+	}
+	var report map[string][]interface{}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, err
+	}
+	return report[dataType], nil
+}
+
+func collectThunderboltEvents(moduleName string, days int, params mod.ModuleParams) error {
+	startTime, endTime := unifiedLogsTimeRange(days)
+	query := LogCommand{
+		Predicate: `(process == "kernel" AND (eventMessage CONTAINS[c] "thunderbolt" OR eventMessage CONTAINS[c] "USB4")) OR ` +
+			`(process == "WindowServer" AND eventMessage CONTAINS[c] "display" AND ` +
+			`(eventMessage CONTAINS[c] "connect" OR eventMessage CONTAINS[c] "added" OR eventMessage CONTAINS[c] "removed"))`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+
+		message, _ := recordData["message"].(string)
+		lowerMessage := strings.ToLower(message)
+		recordData["device_type"] = "thunderbolt"
+		if strings.Contains(lowerMessage, "display") {
+			recordData["device_type"] = "display"
+		}
+		recordData["action"] = ""
+		switch {
+		case strings.Contains(lowerMessage, "disconnect") || strings.Contains(lowerMessage, "removed") || strings.Contains(lowerMessage, "unplug"):
+			recordData["action"] = "disconnect"
+		case strings.Contains(lowerMessage, "connect") || strings.Contains(lowerMessage, "added") || strings.Contains(lowerMessage, "plug"):
+			recordData["action"] = "connect"
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
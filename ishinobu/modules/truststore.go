@@ -0,0 +1,255 @@
+// This module audits the certificate trust store to find root CAs that enable TLS interception:
+//   - Trust settings of the system, admin and user domains (security trust-settings-export), with the
+//     certificate hash, issuer, modification date and trust result of every entry.
+//   - Certificates added to /Library/Keychains/System.keychain and to the user keychains
+//     (security find-certificate -a -p), with subject, issuer, validity and SHA-1/SHA-256 fingerprints.
+//     The Apple roots live in SystemRootCertificates.keychain, so self-signed CAs found in these keychains are
+//     flagged as non-Apple roots. The install date is taken from the trust settings of the certificate when present.
+package modules
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type TrustStoreModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &TrustStoreModule{
+		Name:        "truststore",
+		Description: "Audits certificate trust settings and non-Apple root CAs"}
+	mod.RegisterModule(module)
+}
+
+func (m *TrustStoreModule) GetName() string {
+	return m.Name
+}
+
+func (m *TrustStoreModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	// Trust settings domains and the flag of security trust-settings-export selecting them
+	trustSettingsDomains = []struct {
+		Name string
+		Flag string
+	}{
+		{Name: "user"},
+		{Name: "admin", Flag: "-d"},
+		{Name: "system", Flag: "-s"},
+	}
+	// kSecTrustSettingsResult values
+	trustSettingsResults = map[uint64]string{
+		0: "invalid",
+		1: "trust_root",
+		2: "trust_as_root",
+		3: "deny",
+		4: "unspecified",
+	}
+)
+
+// trustSetting is the trust settings entry of a certificate, indexed by its SHA-1 hash
+type trustSetting struct {
+	Domain  string
+	ModDate string
+	Results string
+}
+
+func (m *TrustStoreModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeTrust := func(sourceFile string, eventTimestamp string, recordData map[string]interface{}) {
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Create a temporary folder to store the exported trust settings
+	tmpDir, err := os.MkdirTemp("", "ishinobu-truststore")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	trustSettings := make(map[string]trustSetting)
+	for _, domain := range trustSettingsDomains {
+		exportPath := filepath.Join(tmpDir, domain.Name+".plist")
+		args := []string{"trust-settings-export"}
+		if domain.Flag != "" {
+			args = append(args, domain.Flag)
+		}
+		// security fails when the domain has no trust settings
+		if err := exec.Command("security", append(args, exportPath)...).Run(); err != nil {
+			params.Logger.Debug("No trust settings exported for the %s domain: %v", domain.Name, err)
+			continue
+		}
+
+		var export struct {
+			TrustList map[string]map[string]interface{} `plist:"trustList"`
+		}
+		if err := utils.ParsePlistFile(exportPath, &export); err != nil {
+			params.Logger.Debug("Error parsing trust settings of the %s domain: %v", domain.Name, err)
+			continue
+		}
+
+		for hash, entry := range export.TrustList {
+			setting := trustSetting{
+				Domain:  domain.Name,
+				ModDate: utils.FormatPlistDate(entry["modDate"]),
+				Results: trustSettingsResultList(entry["trustSettings"]),
+			}
+			trustSettings[strings.ToUpper(hash)] = setting
+
+			issuer := ""
+			if issuerName, ok := entry["issuerName"].([]byte); ok {
+				issuer = decodeDistinguishedName(issuerName)
+			}
+			serialNumber := ""
+			if serial, ok := entry["serialNumber"].([]byte); ok {
+				serialNumber = hex.EncodeToString(serial)
+			}
+
+			writeTrust("security trust-settings-export", setting.ModDate, map[string]interface{}{
+				"type":          "trust_setting",
+				"domain":        domain.Name,
+				"sha1":          strings.ToUpper(hash),
+				"issuer":        issuer,
+				"serial_number": serialNumber,
+				"trust_results": setting.Results,
+				"modified_time": setting.ModDate,
+			})
+		}
+	}
+
+	// Certificates added to the system and user keychains
+	keychains := append([]string{"/Library/Keychains/System.keychain"},
+		utils.GlobPaths("/Users/*/Library/Keychains/*.keychain-db", "/Users/*/Library/Keychains/*.keychain")...)
+	for _, keychain := range keychains {
+		output, err := exec.Command("security", "find-certificate", "-a", "-p", keychain).Output()
+		if err != nil {
+			params.Logger.Debug("Error listing certificates of %s: %v", keychain, err)
+			continue
+		}
+
+		rest := output
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				params.Logger.Debug("Error parsing certificate of %s: %v", keychain, err)
+				continue
+			}
+
+			sha1Sum := sha1.Sum(certificate.Raw)
+			sha256Sum := sha256.Sum256(certificate.Raw)
+			fingerprint := strings.ToUpper(hex.EncodeToString(sha1Sum[:]))
+			isRoot := certificate.IsCA && certificate.CheckSignatureFrom(certificate) == nil
+			setting := trustSettings[fingerprint]
+
+			writeTrust(keychain, setting.ModDate, map[string]interface{}{
+				"type":          "certificate",
+				"keychain":      keychain,
+				"username":      utils.GetUsernameFromPath(keychain),
+				"subject":       certificate.Subject.String(),
+				"issuer":        certificate.Issuer.String(),
+				"serial_number": certificate.SerialNumber.Text(16),
+				"not_before":    certificate.NotBefore.UTC().Format(utils.TimeFormat),
+				"not_after":     certificate.NotAfter.UTC().Format(utils.TimeFormat),
+				"sha1":          fingerprint,
+				"sha256":        strings.ToUpper(hex.EncodeToString(sha256Sum[:])),
+				"is_ca":         certificate.IsCA,
+				"is_root":       isRoot,
+				"trust_domain":  setting.Domain,
+				"trust_results": setting.Results,
+				"install_time":  setting.ModDate,
+				// Roots shipped by Apple are in SystemRootCertificates.keychain, any root here was added
+				"non_apple_root": isRoot,
+			})
+		}
+	}
+
+	return nil
+}
+
+// trustSettingsResultList returns the trust results of the trust settings array of a certificate
+func trustSettingsResultList(value interface{}) string {
+	settings, ok := value.([]interface{})
+	if !ok {
+		return ""
+	}
+	// An empty array means the certificate is trusted as a root for every policy
+	if len(settings) == 0 {
+		return trustSettingsResults[1]
+	}
+
+	var results []string
+	for _, item := range settings {
+		setting, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		result := uint64(1)
+		switch value := setting["kSecTrustSettingsResult"].(type) {
+		case uint64:
+			result = value
+		case int64:
+			result = uint64(value)
+		}
+		name := trustSettingsResults[result]
+		if policy, ok := setting["kSecTrustSettingsPolicyName"].(string); ok && policy != "" {
+			name = policy + ":" + name
+		}
+		results = append(results, name)
+	}
+	return strings.Join(results, ", ")
+}
+
+// decodeDistinguishedName converts a DER encoded X.501 name to its string form
+func decodeDistinguishedName(data []byte) string {
+	var sequence pkix.RDNSequence
+	if _, err := asn1.Unmarshal(data, &sequence); err != nil {
+		return hex.EncodeToString(data)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&sequence)
+	return name.String()
+}
@@ -1,13 +1,30 @@
 // This module is useful to investigate the list of logs from the unified logging system.
-// Commands:
-// - System Logs - Kernel Messages: log show --predicate 'process == "kernel"' --info --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - Security Logs - Authentication Attempts: log show --predicate 'eventMessage CONTAINS[c] "authentication"' --info --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - Network Logs - Network Activities: log show --predicate 'subsystem == "com.apple.network"' --info --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - User Activity Logs - Login Sessions: log show --predicate 'eventMessage CONTAINS "login"' --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - File System Events - Disk Mounts: log show --predicate 'eventMessage CONTAINS "disk"' --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - Configuration Changes - Software Installations: log show --predicate 'eventMessage CONTAINS "install" OR eventMessage CONTAINS "update"' --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - Hardware Events - Peripheral Connections: log show --predicate 'eventMessage CONTAINS "USB" OR eventMessage CONTAINS "Peripheral"' --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
-// - Time and Date Changes - System Time Adjustments: log show --predicate 'eventMessage CONTAINS "system time"' --start "2021-09-01 00:00:00" --end "2021-09-30 23:59:59"
+// The predicates, subsystems and time range are read from the module configuration file
+// (<InputDir>/unifiedlogs.json). When no configuration is present, the default queries below are used.
+// If an archive is configured, logs are read from the .logarchive instead of the live system (dead-disk mode).
+// Default queries:
+// - [Enabled] Command Line Activity - Run With Elevated Privileges: process == "sudo"
+// - [Enabled] SSH Activity - Remote Connections: process == "ssh" OR process == "sshd"
+// - [Enabled] Screen Sharing Activity - Remote Desktop Connections: process == "screensharingd" OR process == "ScreensharingAgent"
+// - [Enabled] Session creation or deletion: process == "securityd" AND eventMessage CONTAINS "session" AND subsystem == "com.apple.securityd"
+// - [Disabled] System Logs - Kernel Messages: process == "kernel"
+// - [Disabled] Security Logs - Authentication Attempts: eventMessage CONTAINS[c] "authentication"
+// - [Disabled] Network Logs - Network Activities: subsystem == "com.apple.network"
+// - [Disabled] User Activity Logs - Login Sessions: eventMessage CONTAINS "login"
+// - [Disabled] File System Events - Disk Mounts: eventMessage CONTAINS "disk"
+// - [Disabled] Configuration Changes - Software Installations: eventMessage CONTAINS "install" OR eventMessage CONTAINS "update"
+// - [Disabled] Hardware Events - Peripheral Connections: eventMessage CONTAINS "USB" OR eventMessage CONTAINS "Peripheral"
+// - [Disabled] Time and Date Changes - System Time Adjustments: eventMessage CONTAINS "system time"
+//
+// Example configuration:
+//
+//	{
+//	  "days": 7,
+//	  "archive": "/Volumes/evidence/system_logs.logarchive",
+//	  "queries": [
+//	    {"description": "AirDrop activity", "subsystems": ["com.apple.sharing"], "predicate": "category == \"AirDrop\"", "info": true}
+//	  ]
+//	}
 package modules
 
 import (
@@ -26,10 +43,95 @@ type UnifiedLogsModule struct {
 	Description string
 }
 
-// LogCommand represents a log collection command with its description and output file path.
+// LogCommand represents a log collection query with its description, predicate and subsystems.
 type LogCommand struct {
-	Description string
-	Command     string
+	Description string   `json:"description"`
+	Predicate   string   `json:"predicate"`
+	Subsystems  []string `json:"subsystems"`
+	Info        bool     `json:"info"`
+	Debug       bool     `json:"debug"`
+	Disabled    bool     `json:"disabled"`
+}
+
+// UnifiedLogsConfig is the configuration of the unifiedlogs module.
+// Start and End use the "2006-01-02 15:04:05" format and take precedence over Days.
+type UnifiedLogsConfig struct {
+	Days    int          `json:"days"`
+	Start   string       `json:"start"`
+	End     string       `json:"end"`
+	Archive string       `json:"archive"`
+	Queries []LogCommand `json:"queries"`
+}
+
+// LogWindowConfig is the configuration of modules that extract events from the unified logs
+// over the last Days days.
+type LogWindowConfig struct {
+	Days int `json:"days"`
+}
+
+// Time layout accepted by `log show --start/--end`
+const logShowTimeFormat = "2006-01-02 15:04:05"
+
+var defaultLogCommands = []LogCommand{
+	{
+		Description: "Command Line Activity - Run With Elevated Privileges",
+		Predicate:   `process == "sudo"`,
+	},
+	{
+		Description: "SSH Activity - Remote Connections",
+		Predicate:   `process == "ssh" OR process == "sshd"`,
+	},
+	{
+		Description: "Screen Sharing Activity - Remote Desktop Connections",
+		Predicate:   `process == "screensharingd" OR process == "ScreensharingAgent"`,
+	},
+	{
+		Description: "Session creation or deletion",
+		Predicate:   `process == "securityd" AND eventMessage CONTAINS "session" AND subsystem == "com.apple.securityd"`,
+	},
+	{
+		Description: "System Logs - Kernel Messages",
+		Predicate:   `process == "kernel"`,
+		Info:        true,
+		Disabled:    true,
+	},
+	{
+		Description: "Security Logs - Authentication Attempts",
+		Predicate:   `eventMessage CONTAINS[c] "authentication"`,
+		Info:        true,
+		Disabled:    true,
+	},
+	{
+		Description: "Network Logs - Network Activities",
+		Predicate:   `subsystem == "com.apple.network"`,
+		Info:        true,
+		Disabled:    true,
+	},
+	{
+		Description: "User Activity Logs - Login Sessions",
+		Predicate:   `eventMessage CONTAINS "login"`,
+		Disabled:    true,
+	},
+	{
+		Description: "File System Events - Disk Mounts",
+		Predicate:   `eventMessage CONTAINS "disk"`,
+		Disabled:    true,
+	},
+	{
+		Description: "Configuration Changes - Software Installations",
+		Predicate:   `eventMessage CONTAINS "install" OR eventMessage CONTAINS "update"`,
+		Disabled:    true,
+	},
+	{
+		Description: "Hardware Events - Peripheral Connections",
+		Predicate:   `eventMessage CONTAINS "USB" OR eventMessage CONTAINS "Peripheral"`,
+		Disabled:    true,
+	},
+	{
+		Description: "Time and Date Changes - System Time Adjustments",
+		Predicate:   `eventMessage CONTAINS "system time"`,
+		Disabled:    true,
+	},
 }
 
 func init() {
@@ -48,61 +150,21 @@ func (m *UnifiedLogsModule) GetDescription() string {
 }
 
 func (m *UnifiedLogsModule) Run(params mod.ModuleParams) error {
-	// Time range for the last 30 days
-	nDays := 1
-	endTime := time.Now().Format("2006-01-02 15:04:05")
-	startTime := time.Now().AddDate(0, 0, -nDays).Format("2006-01-02 15:04:05")
-
-	// List of log collection commands
-	commands := []LogCommand{
-		// {
-		// 	Description: "System Logs - Kernel Messages",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'process == "kernel"' --style json --quiet --info --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "Security Logs - Authentication Attempts",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'eventMessage CONTAINS[c] "authentication"' --style json --quiet --info --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "Network Logs - Network Activities",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'subsystem == "com.apple.network"' --style json --quiet --info --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "User Activity Logs - Login Sessions",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'eventMessage CONTAINS "login"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "File System Events - Disk Mounts",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'eventMessage CONTAINS "disk"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "Configuration Changes - Software Installations",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'eventMessage CONTAINS "install" OR eventMessage CONTAINS "update"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "Hardware Events - Peripheral Connections",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'eventMessage CONTAINS "USB" OR eventMessage CONTAINS "Peripheral"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		// {
-		// 	Description: "Time and Date Changes - System Time Adjustments",
-		// 	Command:     fmt.Sprintf(`log show --predicate 'eventMessage CONTAINS "system time"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		// },
-		{
-			Description: "Command Line Activity - Run With Elevated Privileges",
-			Command:     fmt.Sprintf(`log show --predicate 'process == "sudo"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		},
-		{
-			Description: "SSH Activity - Remote Connections",
-			Command:     fmt.Sprintf(`log show --predicate 'process == "ssh" OR process == "sshd"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		},
-		{
-			Description: "Screen Sharing Activity - Remote Desktop Connections",
-			Command:     fmt.Sprintf(`log show --predicate 'process == "screensharingd" OR process == "ScreensharingAgent"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		},
-		{
-			Description: "Session creation or deletion",
-			Command:     fmt.Sprintf(`log show --predicate 'process == "securityd" AND eventMessage CONTAINS "session" AND subsystem == "com.apple.securityd"' --style json --quiet --start "%s" --end "%s"`, startTime, endTime),
-		},
+	config := UnifiedLogsConfig{
+		Days:    1,
+		Queries: defaultLogCommands,
+	}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	startTime, endTime := unifiedLogsTimeRange(config.Days)
+	if config.Start != "" {
+		startTime = config.Start
+	}
+	if config.End != "" {
+		endTime = config.End
 	}
 
 	// Prepare the output file
@@ -113,42 +175,27 @@ func (m *UnifiedLogsModule) Run(params mod.ModuleParams) error {
 	}
 	defer writer.Close()
 
-	// Run each log collection command
-	for _, cmd := range commands {
-
-		// Run the command
-		cmdexec := exec.Command("bash", "-c", cmd.Command)
+	// Run each log collection query
+	for _, cmd := range config.Queries {
+		if cmd.Disabled {
+			continue
+		}
 
-		// Set the TZ environment variable to UTC
-		cmdexec.Env = append(cmdexec.Env, "TZ=UTC")
-		output, err := cmdexec.CombinedOutput()
+		logEntries, err := cmd.Show(startTime, endTime, config.Archive)
 		if err != nil {
-			params.Logger.Debug("Command output: %s", output)
+			params.Logger.Debug("Error collecting %s: %v", cmd.Description, err)
+			continue
 		}
 
-		var logEntries []map[string]interface{}
-
-		// Parse the JSON output
-		err = json.Unmarshal(output, &logEntries)
-		if err != nil {
-			params.Logger.Debug("Error parsing JSON output: %v", err)
+		sourceFileName := m.GetName() + strings.ReplaceAll(cmd.Description, " ", "_")
+		if config.Archive != "" {
+			sourceFileName = config.Archive
 		}
 
-		// Iterate over each log entry and print it as a JSON object
 		for _, entry := range logEntries {
-			// Create a record data map
-			recordData := make(map[string]interface{})
-			for key, value := range entry {
-				recordData[key] = value
-			}
-
-			// Parse the timestamp
-			timestamp, err := utils.ParseTimestamp(recordData["timestamp"].(string))
-			if err != nil {
-				params.Logger.Debug("Error parsing timestamp: %v", err)
-			}
+			recordData, timestamp := unifiedLogRecordData(entry, params)
+			recordData["query"] = cmd.Description
 
-			sourceFileName := m.GetName() + strings.ReplaceAll(cmd.Description, " ", "_")
 			// Create a record
 			record := utils.Record{
 				CollectionTimestamp: params.CollectionTimestamp,
@@ -158,7 +205,7 @@ func (m *UnifiedLogsModule) Run(params mod.ModuleParams) error {
 			}
 
 			// Write the record
-			err = writer.WriteRecord(record)
+			err := writer.WriteRecord(record)
 			if err != nil {
 				params.Logger.Debug("Failed to write record: %v", err)
 			}
@@ -167,3 +214,117 @@ func (m *UnifiedLogsModule) Run(params mod.ModuleParams) error {
 
 	return nil
 }
+
+// unifiedLogsTimeRange returns the start and end time of the last nDays in the format used by `log show`.
+// Times are in UTC as `log show` is run with TZ=UTC.
+func unifiedLogsTimeRange(nDays int) (string, string) {
+	now := time.Now().UTC()
+	endTime := now.Format(logShowTimeFormat)
+	startTime := now.AddDate(0, 0, -nDays).Format(logShowTimeFormat)
+	return startTime, endTime
+}
+
+// Show runs `log show` with the query predicate over the given time range and returns the parsed JSON entries.
+// If archive is not empty, logs are read from that .logarchive instead of the live system.
+func (c LogCommand) Show(startTime, endTime, archive string) ([]map[string]interface{}, error) {
+	args := []string{"show"}
+	if archive != "" {
+		args = append(args, archive)
+	}
+
+	predicate := c.Predicate
+	if len(c.Subsystems) > 0 {
+		subsystems := make([]string, 0, len(c.Subsystems))
+		for _, subsystem := range c.Subsystems {
+			subsystems = append(subsystems, fmt.Sprintf("subsystem == %q", subsystem))
+		}
+		subsystemPredicate := strings.Join(subsystems, " OR ")
+		if predicate != "" {
+			predicate = fmt.Sprintf("(%s) AND (%s)", predicate, subsystemPredicate)
+		} else {
+			predicate = subsystemPredicate
+		}
+	}
+	if predicate != "" {
+		args = append(args, "--predicate", predicate)
+	}
+
+	args = append(args, "--style", "json", "--quiet")
+	if c.Info {
+		args = append(args, "--info")
+	}
+	if c.Debug {
+		args = append(args, "--debug")
+	}
+	if startTime != "" {
+		args = append(args, "--start", startTime)
+	}
+	if endTime != "" {
+		args = append(args, "--end", endTime)
+	}
+
+	cmd := exec.Command("log", args...)
+	// Set the TZ environment variable to UTC
+	cmd.Env = append(cmd.Env, "TZ=UTC")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running log show: %v", err)
+	}
+
+	var logEntries []map[string]interface{}
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return logEntries, nil
+	}
+
+	// Parse the JSON output
+	err = json.Unmarshal(output, &logEntries)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON output: %v", err)
+	}
+
+	return logEntries, nil
+}
+
+// unifiedLogRecordData normalizes a log entry and returns the record data along with its event timestamp.
+func unifiedLogRecordData(entry map[string]interface{}, params mod.ModuleParams) (map[string]interface{}, string) {
+	recordData := normalizeUnifiedLogEntry(entry)
+
+	timestamp, err := utils.ParseTimestamp(fmt.Sprintf("%v", entry["timestamp"]))
+	if err != nil {
+		params.Logger.Debug("Error parsing timestamp: %v", err)
+	}
+
+	return recordData, timestamp
+}
+
+// normalizeUnifiedLogEntry maps a `log show --style json` entry to the fields kept in the records.
+func normalizeUnifiedLogEntry(entry map[string]interface{}) map[string]interface{} {
+	recordData := make(map[string]interface{})
+	fields := map[string]string{
+		"timestamp":          "timestamp",
+		"eventMessage":       "message",
+		"eventType":          "event_type",
+		"messageType":        "message_type",
+		"subsystem":          "subsystem",
+		"category":           "category",
+		"processID":          "pid",
+		"processImagePath":   "process_path",
+		"senderImagePath":    "sender_path",
+		"userID":             "uid",
+		"activityIdentifier": "activity_id",
+		"traceID":            "trace_id",
+		"bootUUID":           "boot_uuid",
+	}
+	for key, field := range fields {
+		if value, ok := entry[key]; ok {
+			recordData[field] = value
+		}
+	}
+
+	if path, ok := entry["processImagePath"].(string); ok {
+		parts := strings.Split(path, "/")
+		recordData["process"] = parts[len(parts)-1]
+	}
+
+	return recordData
+}
@@ -0,0 +1,333 @@
+// This module dumps the local accounts from the directory services (dscl -plist . -readall /Users):
+//   - Record name, real name, UID/GID, shell and home directory.
+//   - authentication_authority: secure token, disabled and Kerberos tags of the account.
+//   - accountPolicyData: creation time, last password change and failed login attempts.
+//   - IsHidden attribute and membership to the admin and com.apple.access_ssh groups.
+//
+// Accounts with UID < 500 that are not system accounts (prefixed by "_" or root, daemon, nobody)
+// and hidden accounts with a login shell are flagged, as both are used to keep persistent access.
+//
+// The residue of the accounts removed before the collection is written to users-deleted:
+//   - Home folders archived on deletion: /Users/Deleted Users/*.dmg and *.sparseimage.
+//   - Orphaned home folders of /Users without a matching account, with their owner UID, birth time and the last
+//     modification of their content.
+//   - lastUserName of the login window referring to an account that no longer exists.
+//   - Setup time of the system (/private/var/db/.AppleSetupDone), to tell accounts created after the setup.
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type UsersModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &UsersModule{
+		Name:        "users",
+		Description: "Dumps local accounts attributes and flags hidden or unusual accounts"}
+	mod.RegisterModule(module)
+}
+
+func (m *UsersModule) GetName() string {
+	return m.Name
+}
+
+func (m *UsersModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	systemAccounts = map[string]bool{
+		"root":   true,
+		"daemon": true,
+		"nobody": true,
+	}
+	nonLoginShells = map[string]bool{
+		"":                  true,
+		"/usr/bin/false":    true,
+		"/sbin/nologin":     true,
+		"/usr/sbin/nologin": true,
+	}
+)
+
+func (m *UsersModule) Run(params mod.ModuleParams) error {
+	output, err := exec.Command("dscl", "-plist", ".", "-readall", "/Users").Output()
+	if err != nil {
+		return fmt.Errorf("error running dscl: %v", err)
+	}
+	var users []map[string][]string
+	if err := plist.NewDecoder(bytes.NewReader(output)).Decode(&users); err != nil {
+		return fmt.Errorf("error parsing dscl output: %v", err)
+	}
+
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	err = collectDeletedUsers(m.GetName()+"-deleted", users, params)
+	if err != nil {
+		params.Logger.Debug("Error collecting deleted users: %v", err)
+	}
+
+	admins := groupMemberSet("admin")
+	sshUsers := groupMemberSet("com.apple.access_ssh")
+
+	for _, user := range users {
+		attribute := func(name string) string {
+			return strings.Join(user["dsAttrTypeStandard:"+name], ", ")
+		}
+		native := func(name string) string {
+			return strings.Join(user["dsAttrTypeNative:"+name], ", ")
+		}
+
+		name := attribute("RecordName")
+		if names := user["dsAttrTypeStandard:RecordName"]; len(names) > 0 {
+			name = names[0]
+		}
+		uid, uidErr := strconv.Atoi(attribute("UniqueID"))
+		shell := attribute("UserShell")
+		authority := attribute("AuthenticationAuthority")
+		hidden := native("IsHidden") == "1" || strings.EqualFold(native("IsHidden"), "yes")
+		loginShell := !nonLoginShells[shell]
+		systemAccount := strings.HasPrefix(name, "_") || systemAccounts[name]
+
+		recordData := map[string]interface{}{
+			"username":                 name,
+			"aliases":                  attribute("RecordName"),
+			"real_name":                attribute("RealName"),
+			"uid":                      attribute("UniqueID"),
+			"gid":                      attribute("PrimaryGroupID"),
+			"generated_uid":            attribute("GeneratedUID"),
+			"shell":                    shell,
+			"home":                     attribute("NFSHomeDirectory"),
+			"authentication_authority": authority,
+			"secure_token":             strings.Contains(authority, ";SecureToken;"),
+			"disabled":                 strings.Contains(authority, ";DisabledUser;") || strings.Contains(authority, "DisabledTags"),
+			"hidden":                   hidden,
+			"login_shell":              loginShell,
+			"admin":                    admins[name],
+			"ssh_access_group":         sshUsers[name],
+			"creation_time":            "",
+			"password_last_set":        "",
+			"failed_login_count":       "",
+			"failed_login_time":        "",
+			"hidden_low_uid":           uidErr == nil && uid >= 0 && uid < 500 && !systemAccount,
+			"hidden_with_login_shell":  hidden && loginShell && !systemAccount,
+		}
+
+		eventTimestamp := params.CollectionTimestamp
+		if policyData := native("accountPolicyData"); policyData != "" {
+			var policy map[string]interface{}
+			if _, err := plist.Unmarshal([]byte(policyData), &policy); err != nil {
+				params.Logger.Debug("Error parsing accountPolicyData of %s: %v", name, err)
+			} else {
+				recordData["creation_time"] = accountPolicyTime(policy["creationTime"])
+				recordData["password_last_set"] = accountPolicyTime(policy["passwordLastSetTime"])
+				recordData["failed_login_count"] = policy["failedLoginCount"]
+				recordData["failed_login_time"] = accountPolicyTime(policy["failedLoginTimestamp"])
+				if creationTime, _ := recordData["creation_time"].(string); creationTime != "" {
+					eventTimestamp = creationTime
+				}
+			}
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          "dscl . -readall /Users",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// collectDeletedUsers reports the archived and orphaned home folders and the other traces of removed accounts
+func collectDeletedUsers(moduleName string, users []map[string][]string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	names := make(map[string]bool)
+	uids := make(map[string]bool)
+	homes := make(map[string]bool)
+	for _, user := range users {
+		for _, name := range user["dsAttrTypeStandard:RecordName"] {
+			names[name] = true
+		}
+		for _, uid := range user["dsAttrTypeStandard:UniqueID"] {
+			uids[uid] = true
+		}
+		for _, home := range user["dsAttrTypeStandard:NFSHomeDirectory"] {
+			homes[filepath.Clean(home)] = true
+		}
+	}
+
+	writeResidue := func(sourceFile string, recordData map[string]interface{}) {
+		for _, key := range []string{"account", "path", "owner", "size", "birth_time", "modified", "last_activity"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		eventTimestamp, _ := recordData["modified"].(string)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Setup of the system
+	setupDone := time.Time{}
+	if info, err := os.Stat("/private/var/db/.AppleSetupDone"); err == nil {
+		setupDone = info.ModTime()
+		writeResidue("/private/var/db/.AppleSetupDone", map[string]interface{}{
+			"type":       "setup_done",
+			"path":       "/private/var/db/.AppleSetupDone",
+			"birth_time": utils.FileBirthTime(info),
+			"modified":   info.ModTime().UTC().Format(utils.TimeFormat),
+		})
+	}
+
+	// Home folders archived when the account was deleted
+	for _, path := range utils.GlobPaths("/Users/Deleted Users/*") {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		account := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		writeResidue(path, map[string]interface{}{
+			"type":           "deleted_home_archive",
+			"account":        account,
+			"account_exists": names[account],
+			"path":           path,
+			"owner":          fileOwner(path),
+			"size":           info.Size(),
+			"birth_time":     utils.FileBirthTime(info),
+			"modified":       info.ModTime().UTC().Format(utils.TimeFormat),
+		})
+	}
+
+	// Home folders without account
+	for _, path := range utils.GlobPaths("/Users/*") {
+		info, err := os.Stat(path)
+		name := filepath.Base(path)
+		if err != nil || !info.IsDir() || homes[path] || name == "Shared" || name == "Deleted Users" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		owner := fileOwner(path)
+		lastActivity := latestModification(path, 3)
+		writeResidue(path, map[string]interface{}{
+			"type":                "orphaned_home",
+			"account":             name,
+			"account_exists":      names[name],
+			"path":                path,
+			"owner":               owner,
+			"owner_exists":        names[owner] || uids[owner],
+			"birth_time":          utils.FileBirthTime(info),
+			"modified":            info.ModTime().UTC().Format(utils.TimeFormat),
+			"last_activity":       lastActivity,
+			"created_after_setup": !setupDone.IsZero() && info.ModTime().After(setupDone),
+		})
+	}
+
+	// Last user of the login window
+	var loginWindow map[string]interface{}
+	if err := utils.ParsePlistFile("/Library/Preferences/com.apple.loginwindow.plist", &loginWindow); err == nil {
+		if lastUser, ok := loginWindow["lastUserName"].(string); ok && lastUser != "" && !names[lastUser] {
+			writeResidue("/Library/Preferences/com.apple.loginwindow.plist", map[string]interface{}{
+				"type":     "last_user_missing",
+				"account":  lastUser,
+				"path":     "/Library/Preferences/com.apple.loginwindow.plist",
+				"modified": fileModTime("/Library/Preferences/com.apple.loginwindow.plist"),
+			})
+		}
+	}
+
+	return nil
+}
+
+// latestModification returns the latest modification time of the files under a folder, up to a depth
+func latestModification(root string, maxDepth int) string {
+	latest := time.Time{}
+	depth := strings.Count(filepath.Clean(root), string(os.PathSeparator))
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() && strings.Count(path, string(os.PathSeparator))-depth >= maxDepth {
+			return filepath.SkipDir
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if latest.IsZero() {
+		return ""
+	}
+	return latest.UTC().Format(utils.TimeFormat)
+}
+
+// groupMemberSet returns the members of a local group as a set
+func groupMemberSet(group string) map[string]bool {
+	members := make(map[string]bool)
+	for _, member := range strings.Split(dsclGroupMembers(group), ", ") {
+		if member != "" {
+			members[member] = true
+		}
+	}
+	return members
+}
+
+// accountPolicyTime converts an accountPolicyData time (seconds since the Unix epoch) to TimeFormat
+func accountPolicyTime(value interface{}) string {
+	var seconds float64
+	switch v := value.(type) {
+	case float64:
+		seconds = v
+	case uint64:
+		seconds = float64(v)
+	case int64:
+		seconds = float64(v)
+	default:
+		return ""
+	}
+	if seconds <= 0 {
+		return ""
+	}
+	return utils.ConvertUnixTimestamp(int64(seconds))
+}
@@ -0,0 +1,240 @@
+// This module collects mounted volumes and the history of mounts and disk image attachments:
+//   - diskutil list -plist: disks, partitions and APFS volumes with their mount points.
+//   - hdiutil info -plist: attached disk images with their image path and mount points.
+//   - Unified logs: mount and unmount events from diskarbitrationd and disk image attach events
+//     (DiskImages2, diskimagesiod) over the configured window. Disk image names are extracted from the messages.
+//
+// The window defaults to the last 7 days and can be changed in <InputDir>/volumes.json ({"days": N}).
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+	"howett.net/plist"
+)
+
+type VolumesModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &VolumesModule{
+		Name:        "volumes",
+		Description: "Collects mounted volumes, attached disk images and mount history"}
+	mod.RegisterModule(module)
+}
+
+func (m *VolumesModule) GetName() string {
+	return m.Name
+}
+
+func (m *VolumesModule) GetDescription() string {
+	return m.Description
+}
+
+var diskImageNameRegex = regexp.MustCompile(`([^/\s"'<>]+\.(?i:dmg|sparseimage|sparsebundle|iso|img|cdr))\b`)
+
+// diskutilList is the output of `diskutil list -plist`
+type diskutilList struct {
+	AllDisksAndPartitions []diskutilDisk `plist:"AllDisksAndPartitions"`
+}
+
+type diskutilDisk struct {
+	DeviceIdentifier string         `plist:"DeviceIdentifier"`
+	Content          string         `plist:"Content"`
+	Size             uint64         `plist:"Size"`
+	VolumeName       string         `plist:"VolumeName"`
+	MountPoint       string         `plist:"MountPoint"`
+	Partitions       []diskutilDisk `plist:"Partitions"`
+	APFSVolumes      []diskutilDisk `plist:"APFSVolumes"`
+}
+
+// hdiutilInfo is the output of `hdiutil info -plist`
+type hdiutilInfo struct {
+	Images []struct {
+		ImagePath      string `plist:"image-path"`
+		ImageType      string `plist:"image-type"`
+		Removable      bool   `plist:"removable"`
+		SystemEntities []struct {
+			DevEntry   string `plist:"dev-entry"`
+			MountPoint string `plist:"mount-point"`
+		} `plist:"system-entities"`
+	} `plist:"images"`
+}
+
+func (m *VolumesModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	err = collectMountedVolumes(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error collecting mounted volumes: %v", err)
+	}
+
+	err = collectVolumeEvents(m.GetName()+"-events", config.Days, params)
+	if err != nil {
+		params.Logger.Debug("Error collecting volume events: %v", err)
+	}
+
+	return nil
+}
+
+func collectMountedVolumes(moduleName string, params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeVolume := func(sourceFile string, recordData map[string]interface{}) {
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// Attached disk images, indexed by device so volumes can be linked to their image
+	imagesByDevice := make(map[string]string)
+	output, err := exec.Command("hdiutil", "info", "-plist").Output()
+	if err != nil {
+		params.Logger.Debug("Error running hdiutil info: %v", err)
+	} else {
+		var info hdiutilInfo
+		if err := plist.NewDecoder(bytes.NewReader(output)).Decode(&info); err != nil {
+			params.Logger.Debug("Error parsing hdiutil info: %v", err)
+		}
+		for _, image := range info.Images {
+			var devices, mountPoints []string
+			for _, entity := range image.SystemEntities {
+				device := strings.TrimPrefix(entity.DevEntry, "/dev/")
+				imagesByDevice[device] = image.ImagePath
+				devices = append(devices, device)
+				if entity.MountPoint != "" {
+					mountPoints = append(mountPoints, entity.MountPoint)
+				}
+			}
+			writeVolume("hdiutil info", map[string]interface{}{
+				"type":        "disk_image",
+				"image_path":  image.ImagePath,
+				"image_type":  image.ImageType,
+				"removable":   image.Removable,
+				"device":      strings.Join(devices, ", "),
+				"mount_point": strings.Join(mountPoints, ", "),
+			})
+		}
+	}
+
+	output, err = exec.Command("diskutil", "list", "-plist").Output()
+	if err != nil {
+		return fmt.Errorf("error running diskutil list: %v", err)
+	}
+	var list diskutilList
+	if err := plist.NewDecoder(bytes.NewReader(output)).Decode(&list); err != nil {
+		return fmt.Errorf("error parsing diskutil list: %v", err)
+	}
+
+	for _, disk := range list.AllDisksAndPartitions {
+		volumes := append(append([]diskutilDisk{}, disk.Partitions...), disk.APFSVolumes...)
+		if disk.MountPoint != "" {
+			volumes = append(volumes, disk)
+		}
+		for _, volume := range volumes {
+			diskImage := imagesByDevice[volume.DeviceIdentifier]
+			if diskImage == "" {
+				diskImage = imagesByDevice[disk.DeviceIdentifier]
+			}
+			writeVolume("diskutil list", map[string]interface{}{
+				"type":        "volume",
+				"disk":        disk.DeviceIdentifier,
+				"device":      volume.DeviceIdentifier,
+				"volume_name": volume.VolumeName,
+				"content":     volume.Content,
+				"size":        volume.Size,
+				"mount_point": volume.MountPoint,
+				"mounted":     volume.MountPoint != "",
+				"disk_image":  diskImage,
+			})
+		}
+	}
+
+	return nil
+}
+
+func collectVolumeEvents(moduleName string, days int, params mod.ModuleParams) error {
+	startTime, endTime := unifiedLogsTimeRange(days)
+	query := LogCommand{
+		Predicate: `(process == "diskarbitrationd" AND (eventMessage CONTAINS[c] "mount" OR eventMessage CONTAINS[c] "eject")) ` +
+			`OR subsystem == "com.apple.DiskImages2" OR process == "diskimagesiod" OR process == "diskimages-helper"`,
+		Info: true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName, params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+
+		message, _ := recordData["message"].(string)
+		recordData["volume_event"] = volumeEventType(message)
+		recordData["disk_image"] = ""
+		if match := diskImageNameRegex.FindStringSubmatch(message); match != nil {
+			recordData["disk_image"] = match[1]
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func volumeEventType(message string) string {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "unmount"):
+		return "unmount"
+	case strings.Contains(message, "eject"):
+		return "eject"
+	case strings.Contains(message, "detach"):
+		return "detach"
+	case strings.Contains(message, "attach"):
+		return "attach"
+	case strings.Contains(message, "mount"):
+		return "mount"
+	}
+	return ""
+}
@@ -0,0 +1,340 @@
+// This module collects the VPN and tunnel configurations of the host:
+//   - SystemConfiguration services: L2TP, PPTP and IPSec (Cisco) services of
+//     /Library/Preferences/SystemConfiguration/preferences.plist with their server address and account.
+//   - Network Extension configurations: IKEv2 and third-party VPNs of /Library/Preferences/com.apple.networkextension.plist.
+//   - WireGuard: the tunnels of the wg-quick configuration files (/etc/wireguard, /usr/local/etc/wireguard,
+//     /opt/homebrew/etc/wireguard) with the addresses and peers. Private keys are never collected.
+//   - OpenVPN clients: the remote servers of the Tunnelblick and Viscosity configurations.
+//   - Active tunnels: the utun, ipsec, ppp and wg interfaces that are up, with their addresses.
+package modules
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type VPNModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &VPNModule{
+		Name:        "vpn",
+		Description: "Collects VPN services, WireGuard and OpenVPN client configurations and active tunnel interfaces"}
+	mod.RegisterModule(module)
+}
+
+func (m *VPNModule) GetName() string {
+	return m.Name
+}
+
+func (m *VPNModule) GetDescription() string {
+	return m.Description
+}
+
+const (
+	systemConfigurationPreferencesPath = "/Library/Preferences/SystemConfiguration/preferences.plist"
+	networkExtensionPreferencesPath    = "/Library/Preferences/com.apple.networkextension.plist"
+)
+
+var (
+	wireGuardConfigPaths = []string{
+		"/etc/wireguard/*.conf",
+		"/usr/local/etc/wireguard/*.conf",
+		"/opt/homebrew/etc/wireguard/*.conf",
+	}
+	openVPNConfigPaths = map[string][]string{
+		"tunnelblick": {
+			"/Users/*/Library/Application Support/Tunnelblick/Configurations/*.tblk/Contents/Resources/*.ovpn",
+			"/Users/*/Library/Application Support/Tunnelblick/Configurations/*.ovpn",
+			"/Library/Application Support/Tunnelblick/Shared/*.tblk/Contents/Resources/*.ovpn",
+		},
+		"viscosity": {
+			"/Users/*/Library/Application Support/Viscosity/OpenVPN/*/config.conf",
+		},
+	}
+	// Prefixes of the tunnel interfaces
+	tunnelInterfacePrefixes = []string{"utun", "ipsec", "ppp", "wg", "tun", "tap"}
+	// Network Extension configuration types holding a VPN
+	networkExtensionVPNKeys = []string{"VPN", "AppVPN", "AlwaysOnVPN"}
+)
+
+func (m *VPNModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeVPN := func(sourceFile string, recordData map[string]interface{}) {
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		eventTimestamp := fileModTime(sourceFile)
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// SystemConfiguration VPN services
+	var preferences map[string]interface{}
+	if err := utils.ParsePlistFile(systemConfigurationPreferencesPath, &preferences); err != nil {
+		params.Logger.Debug("Error parsing %s: %v", systemConfigurationPreferencesPath, err)
+	}
+	services, _ := preferences["NetworkServices"].(map[string]interface{})
+	for id, value := range services {
+		service, _ := value.(map[string]interface{})
+		iface, _ := service["Interface"].(map[string]interface{})
+		interfaceType, _ := iface["Type"].(string)
+		if interfaceType != "PPP" && interfaceType != "IPSec" && interfaceType != "VPN" {
+			continue
+		}
+		ppp, _ := service["PPP"].(map[string]interface{})
+		ipsec, _ := service["IPSec"].(map[string]interface{})
+		server := ppp["CommRemoteAddress"]
+		if server == nil {
+			server = ipsec["RemoteAddress"]
+		}
+		account := ppp["AuthName"]
+		if account == nil {
+			account = ipsec["XAuthName"]
+		}
+		writeVPN(systemConfigurationPreferencesPath, map[string]interface{}{
+			"type":       "service",
+			"id":         id,
+			"name":       service["UserDefinedName"],
+			"protocol":   strings.TrimSpace(fmt.Sprintf("%s %v", interfaceType, valueOrEmpty(iface["SubType"]))),
+			"server":     valueOrEmpty(server),
+			"account":    valueOrEmpty(account),
+			"provider":   "",
+			"enabled":    "",
+			"interfaces": "",
+		})
+	}
+
+	// Network Extension VPN configurations
+	if data, err := os.ReadFile(networkExtensionPreferencesPath); err == nil {
+		root, err := utils.DecodeKeyedArchive(data)
+		if err != nil {
+			params.Logger.Debug("Error decoding %s: %v", networkExtensionPreferencesPath, err)
+		}
+		walkPlist(root, func(item map[string]interface{}) {
+			for _, key := range networkExtensionVPNKeys {
+				vpn, ok := item[key].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				protocol, _ := vpn["Protocol"].(map[string]interface{})
+				server := protocol["ServerAddress"]
+				if server == nil {
+					server = protocol["RemoteAddress"]
+				}
+				writeVPN(networkExtensionPreferencesPath, map[string]interface{}{
+					"type":       "network_extension",
+					"id":         valueOrEmpty(item["Identifier"]),
+					"name":       valueOrEmpty(item["Name"]),
+					"protocol":   key,
+					"server":     valueOrEmpty(server),
+					"account":    valueOrEmpty(protocol["Username"]),
+					"provider":   valueOrEmpty(protocol["ProviderBundleIdentifier"]),
+					"enabled":    valueOrEmpty(vpn["Enabled"]),
+					"interfaces": "",
+				})
+			}
+		})
+	}
+
+	// WireGuard tunnels
+	for _, path := range utils.GlobPaths(wireGuardConfigPaths...) {
+		sections, err := readINISections(path)
+		if err != nil {
+			params.Logger.Debug("Error reading %s: %v", path, err)
+			continue
+		}
+		var addresses, peers []string
+		for _, section := range sections {
+			switch section["[section]"] {
+			case "Interface":
+				addresses = append(addresses, section["Address"])
+			case "Peer":
+				peers = append(peers, fmt.Sprintf("%s (%s)", section["Endpoint"], section["AllowedIPs"]))
+			}
+		}
+		writeVPN(path, map[string]interface{}{
+			"type":       "wireguard",
+			"id":         "",
+			"name":       strings.TrimSuffix(filepath.Base(path), ".conf"),
+			"protocol":   "WireGuard",
+			"server":     strings.Join(peers, ", "),
+			"account":    "",
+			"provider":   "",
+			"enabled":    "",
+			"interfaces": strings.Join(addresses, ", "),
+		})
+	}
+
+	// OpenVPN client configurations
+	for client, patterns := range openVPNConfigPaths {
+		for _, path := range utils.GlobPaths(patterns...) {
+			remotes, name, err := readOpenVPNConfig(path)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", path, err)
+				continue
+			}
+			if name == "" {
+				name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+				if tblk := strings.Index(path, ".tblk/"); tblk >= 0 {
+					name = strings.TrimSuffix(filepath.Base(path[:tblk+5]), ".tblk")
+				}
+			}
+			writeVPN(path, map[string]interface{}{
+				"type":       client,
+				"id":         "",
+				"name":       name,
+				"protocol":   "OpenVPN",
+				"server":     strings.Join(remotes, ", "),
+				"account":    "",
+				"provider":   "",
+				"enabled":    "",
+				"interfaces": "",
+			})
+		}
+	}
+
+	// Active tunnel interfaces
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		params.Logger.Debug("Error listing network interfaces: %v", err)
+		return nil
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || !isTunnelInterface(iface.Name) {
+			continue
+		}
+		var addresses []string
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				addresses = append(addresses, addr.String())
+			}
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      params.CollectionTimestamp,
+			Data: map[string]interface{}{
+				"type":       "interface",
+				"id":         iface.Index,
+				"name":       iface.Name,
+				"protocol":   "",
+				"server":     "",
+				"account":    "",
+				"provider":   "",
+				"enabled":    true,
+				"interfaces": strings.Join(addresses, ", "),
+				"username":   "",
+			},
+			SourceFile: "interfaces",
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// isTunnelInterface reports whether an interface name is one of a tunnel interface
+func isTunnelInterface(name string) bool {
+	for _, prefix := range tunnelInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueOrEmpty returns an empty string for missing values
+func valueOrEmpty(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
+// readINISections reads the sections of an INI style file such as a wg-quick configuration. The name of each
+// section is stored under the "[section]" key. PrivateKey and PresharedKey values are skipped.
+func readINISections(path string) ([]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sections []map[string]string
+	var section map[string]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = map[string]string{"[section]": strings.Trim(line, "[]")}
+			sections = append(sections, section)
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || section == nil || strings.HasSuffix(key, "Key") && key != "PublicKey" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if previous, ok := section[key]; ok {
+			value = previous + ", " + value
+		}
+		section[key] = value
+	}
+	return sections, scanner.Err()
+}
+
+// readOpenVPNConfig returns the remote servers ("host port proto") of an OpenVPN configuration and the
+// connection name set by Viscosity
+func readOpenVPNConfig(path string) ([]string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	var remotes []string
+	name := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#viscosity name ") {
+			name = strings.TrimPrefix(line, "#viscosity name ")
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == "remote" {
+			remotes = append(remotes, strings.Join(fields[1:], " "))
+		}
+	}
+	return remotes, name, scanner.Err()
+}
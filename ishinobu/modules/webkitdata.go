@@ -0,0 +1,334 @@
+// This module collects the website data stored by WebKit for Safari and the other WebKit applications of each
+// user, showing the origins that persisted data on the host:
+//   - LocalStorage: the .localstorage databases (and their -wal and -shm files) of each origin, with the number
+//     of items.
+//   - IndexedDB: the IndexedDB folders of each origin.
+//   - Cache storage: the CacheStorage folders of each origin.
+//   - Service workers: the registrations of SWRegistrations.db with their scope, script URL and last update check.
+//
+// The legacy layout names the files after the origin (https_www.example.com_0). The current layout stores each
+// origin under WebsiteData/Default/<top origin hash>/<origin hash>, with an origin file holding the top and frame
+// origins. Each record holds the origin, the data type, the size and the last modification time.
+package modules
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type WebKitDataModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &WebKitDataModule{
+		Name:        "webkitdata",
+		Description: "Collects Safari and WebKit LocalStorage, IndexedDB, cache storage and service worker registrations per origin"}
+	mod.RegisterModule(module)
+}
+
+func (m *WebKitDataModule) GetName() string {
+	return m.Name
+}
+
+func (m *WebKitDataModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	webKitDataPaths = []string{
+		"/Users/*/Library/WebKit/WebsiteData",
+		"/Users/*/Library/WebKit/*/WebsiteData",
+		"/Users/*/Library/Containers/com.apple.Safari/Data/Library/WebKit/WebsiteData",
+	}
+	// Folders of the data types in the current layout
+	webKitDataTypes = map[string]string{
+		"LocalStorage":   "local_storage",
+		"IndexedDB":      "indexeddb",
+		"CacheStorage":   "cache_storage",
+		"ServiceWorkers": "service_worker",
+	}
+)
+
+func (m *WebKitDataModule) Run(params mod.ModuleParams) error {
+	outputFileName := utils.GetOutputFileName(m.GetName(), params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	tmpDir, err := os.MkdirTemp("", "ishinobu-webkitdata")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	copies := 0
+
+	writeRecord := func(sourceFile, eventTimestamp string, recordData map[string]interface{}) {
+		for _, key := range []string{"top_origin", "scope", "script_url", "last_update_check"} {
+			if _, ok := recordData[key]; !ok {
+				recordData[key] = ""
+			}
+		}
+		if _, ok := recordData["items"]; !ok {
+			recordData["items"] = ""
+		}
+		recordData["username"] = utils.GetUsernameFromPath(sourceFile)
+		recordData["application"] = webKitApplication(sourceFile)
+		recordData["last_modified"] = eventTimestamp
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		if err := writer.WriteRecord(record); err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	// countLocalStorageItems returns the number of items of a LocalStorage database
+	countLocalStorageItems := func(path string) interface{} {
+		copies++
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", copies))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			return ""
+		}
+		dst, err := utils.CopyDatabase(path, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", path, err)
+			return ""
+		}
+		rows, err := utils.QuerySQLiteMaps(dst, `SELECT COUNT(*) AS count FROM ItemTable`)
+		if err != nil || len(rows) == 0 {
+			return ""
+		}
+		return rows[0]["count"]
+	}
+
+	// writeServiceWorkers writes the registrations of a SWRegistrations.db database
+	writeServiceWorkers := func(path string) {
+		copies++
+		dstDir := filepath.Join(tmpDir, fmt.Sprintf("%d", copies))
+		if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
+			return
+		}
+		dst, err := utils.CopyDatabase(path, dstDir)
+		if err != nil {
+			params.Logger.Debug("Error copying database %s: %v", path, err)
+			return
+		}
+		rows, err := utils.QuerySQLiteMaps(dst, `SELECT * FROM Records`)
+		if err != nil {
+			params.Logger.Debug("Error querying %s: %v", path, err)
+			return
+		}
+		for _, row := range rows {
+			lastUpdateCheck := ""
+			if seconds, ok := row["lastUpdateCheckTime"].(float64); ok && seconds > 0 {
+				lastUpdateCheck = utils.ConvertUnixTimestamp(int64(seconds))
+			}
+			script, _ := row["script"].(string)
+			writeRecord(path, fileModTime(path), map[string]interface{}{
+				"data_type":         "service_worker",
+				"origin":            valueOrEmpty(row["origin"]),
+				"top_origin":        valueOrEmpty(row["topOrigin"]),
+				"scope":             valueOrEmpty(row["scopeURL"]),
+				"script_url":        valueOrEmpty(row["scriptURL"]),
+				"last_update_check": lastUpdateCheck,
+				"size":              len(script),
+			})
+		}
+	}
+
+	for _, root := range utils.GlobPaths(webKitDataPaths...) {
+		// Legacy LocalStorage databases
+		for _, path := range utils.GlobPaths(filepath.Join(root, "LocalStorage", "*.localstorage")) {
+			size := int64(0)
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				if info, err := os.Stat(path + suffix); err == nil {
+					size += info.Size()
+				}
+			}
+			writeRecord(path, latestModTime(path, path+"-wal"), map[string]interface{}{
+				"data_type": "local_storage",
+				"origin":    webKitLegacyOrigin(strings.TrimSuffix(filepath.Base(path), ".localstorage")),
+				"size":      size,
+				"items":     countLocalStorageItems(path),
+			})
+		}
+
+		// Legacy IndexedDB folders
+		for _, path := range utils.GlobPaths(filepath.Join(root, "IndexedDB", "*"), filepath.Join(root, "IndexedDB", "v1", "*")) {
+			if info, err := os.Stat(path); err != nil || !info.IsDir() || filepath.Base(path) == "v1" {
+				continue
+			}
+			writeRecord(path, folderModTime(path), map[string]interface{}{
+				"data_type": "indexeddb",
+				"origin":    webKitLegacyOrigin(filepath.Base(path)),
+				"size":      folderSize(path),
+			})
+		}
+
+		// Service worker registrations
+		for _, path := range utils.GlobPaths(filepath.Join(root, "ServiceWorkers", "SWRegistrations.db"),
+			filepath.Join(root, "Default", "*", "*", "ServiceWorkers", "SWRegistrations.db")) {
+			writeServiceWorkers(path)
+		}
+
+		// Current layout, one folder per origin
+		for _, originDir := range utils.GlobPaths(filepath.Join(root, "Default", "*", "*")) {
+			if info, err := os.Stat(originDir); err != nil || !info.IsDir() {
+				continue
+			}
+			topOrigin, origin := "", ""
+			if data, err := os.ReadFile(filepath.Join(originDir, "origin")); err == nil {
+				topOrigin, origin = webKitOriginFile(data)
+			}
+			entries, err := os.ReadDir(originDir)
+			if err != nil {
+				params.Logger.Debug("Error reading %s: %v", originDir, err)
+				continue
+			}
+			for _, entry := range entries {
+				dataType, ok := webKitDataTypes[entry.Name()]
+				if !ok || !entry.IsDir() || dataType == "service_worker" {
+					continue
+				}
+				path := filepath.Join(originDir, entry.Name())
+				recordData := map[string]interface{}{
+					"data_type":  dataType,
+					"origin":     origin,
+					"top_origin": topOrigin,
+					"size":       folderSize(path),
+				}
+				if dataType == "local_storage" {
+					if database := filepath.Join(path, "localstorage.sqlite3"); fileModTime(database) != "" {
+						recordData["items"] = countLocalStorageItems(database)
+					}
+				}
+				writeRecord(path, folderModTime(path), recordData)
+			}
+		}
+	}
+
+	return nil
+}
+
+// webKitApplication returns the application owning a WebsiteData folder: Safari for its container, the bundle
+// identifier of Library/WebKit/<bundle>, or WebKit for the shared folder
+func webKitApplication(path string) string {
+	if strings.Contains(path, "/Containers/com.apple.Safari/") {
+		return "com.apple.Safari"
+	}
+	_, rest, found := strings.Cut(path, "/Library/WebKit/")
+	if !found {
+		return ""
+	}
+	bundle, _, _ := strings.Cut(rest, "/")
+	if bundle == "WebsiteData" {
+		return "WebKit"
+	}
+	return bundle
+}
+
+// webKitLegacyOrigin converts the origin of a legacy file name (scheme_host_port) to an URL
+func webKitLegacyOrigin(name string) string {
+	scheme, rest, found := strings.Cut(name, "_")
+	if !found {
+		return name
+	}
+	host, port := rest, ""
+	if index := strings.LastIndex(rest, "_"); index >= 0 {
+		host, port = rest[:index], rest[index+1:]
+	}
+	if port != "" && port != "0" {
+		return fmt.Sprintf("%s://%s:%s", scheme, host, port)
+	}
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
+
+// webKitOriginFile returns the top and frame origins of the origin file of the current layout. Each origin is
+// serialized as its scheme, host and port, the strings are found by their readable content.
+func webKitOriginFile(data []byte) (string, string) {
+	var origins []string
+	strs := readableStrings(data, 2)
+	for i := 0; i+1 < len(strs); i++ {
+		scheme := strs[i]
+		if scheme != "http" && scheme != "https" && scheme != "file" && !strings.HasSuffix(scheme, "-extension") {
+			continue
+		}
+		origins = append(origins, fmt.Sprintf("%s://%s", scheme, strs[i+1]))
+		i++
+	}
+	switch len(origins) {
+	case 0:
+		return "", ""
+	case 1:
+		return origins[0], origins[0]
+	}
+	return origins[0], origins[1]
+}
+
+// readableStrings returns the runs of printable ASCII characters of at least minLength bytes
+func readableStrings(data []byte, minLength int) []string {
+	var strs []string
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && data[i] >= 0x20 && data[i] < 0x7f {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minLength {
+			strs = append(strs, string(data[start:i]))
+		}
+		start = -1
+	}
+	return strs
+}
+
+// latestModTime returns the latest modification time of the existing files in TimeFormat
+func latestModTime(paths ...string) string {
+	var latest time.Time
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if latest.IsZero() {
+		return ""
+	}
+	return latest.UTC().Format(utils.TimeFormat)
+}
+
+// folderModTime returns the latest modification time of the files under a folder in TimeFormat
+func folderModTime(path string) string {
+	var latest time.Time
+	_ = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if latest.IsZero() {
+		return ""
+	}
+	return latest.UTC().Format(utils.TimeFormat)
+}
@@ -0,0 +1,227 @@
+// This module collects the Wi-Fi connection history:
+//   - Known networks: /Library/Preferences/com.apple.wifi.known-networks.plist (macOS 11+) and
+//     /Library/Preferences/SystemConfiguration/com.apple.airport.preferences.plist (older versions).
+//   - Join, leave and roam events from the airportd/wifid processes in the unified logs over the configured window.
+//
+// Each event is normalized with its SSID and BSSID when present in the message and flagged when the SSID
+// belongs to the known networks inventory.
+// The window defaults to the last 7 days and can be changed in <InputDir>/wifi.json ({"days": N}).
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gnzdotmx/ishinobu/ishinobu/mod"
+	"github.com/gnzdotmx/ishinobu/ishinobu/utils"
+)
+
+type WifiModule struct {
+	Name        string
+	Description string
+}
+
+func init() {
+	module := &WifiModule{
+		Name:        "wifi",
+		Description: "Collects known Wi-Fi networks and Wi-Fi connection events"}
+	mod.RegisterModule(module)
+}
+
+func (m *WifiModule) GetName() string {
+	return m.Name
+}
+
+func (m *WifiModule) GetDescription() string {
+	return m.Description
+}
+
+var (
+	wifiSSIDRegex  = regexp.MustCompile(`(?i)\bssid[=:\s]+['"]?([^'",\]\)]+?)['"]?(?:[,\s\]\)]|$)`)
+	wifiBSSIDRegex = regexp.MustCompile(`(?i)\b([0-9a-f]{1,2}(?::[0-9a-f]{1,2}){5})\b`)
+)
+
+func (m *WifiModule) Run(params mod.ModuleParams) error {
+	config := LogWindowConfig{Days: 7}
+	err := mod.LoadModuleConfig(params, m.GetName(), &config)
+	if err != nil {
+		return err
+	}
+
+	knownNetworks, err := parseKnownNetworks(m.GetName(), params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting known networks: %v", err)
+	}
+
+	err = collectWifiEvents(m.GetName(), config.Days, knownNetworks, params)
+	if err != nil {
+		params.Logger.Debug("Error when collecting Wi-Fi events: %v", err)
+	}
+
+	return nil
+}
+
+// parseKnownNetworks writes the known networks records and returns the set of known SSIDs
+func parseKnownNetworks(moduleName string, params mod.ModuleParams) (map[string]bool, error) {
+	knownNetworks := make(map[string]bool)
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-known-networks", params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return knownNetworks, fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	writeNetwork := func(sourceFile string, recordData map[string]interface{}) {
+		knownNetworks[fmt.Sprintf("%v", recordData["ssid"])] = true
+
+		eventTimestamp := utils.LatestTimestamp(
+			fmt.Sprintf("%v", recordData["added_at"]),
+			fmt.Sprintf("%v", recordData["joined_by_user_at"]),
+			fmt.Sprintf("%v", recordData["joined_by_system_at"]),
+			fmt.Sprintf("%v", recordData["last_connected"]))
+		if eventTimestamp == "" {
+			eventTimestamp = params.CollectionTimestamp
+		}
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      eventTimestamp,
+			Data:                recordData,
+			SourceFile:          sourceFile,
+		}
+		err := writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	knownNetworksPlist := "/Library/Preferences/com.apple.wifi.known-networks.plist"
+	var networks map[string]interface{}
+	if err := utils.ParsePlistFile(knownNetworksPlist, &networks); err != nil {
+		params.Logger.Debug("Error reading %s: %v", knownNetworksPlist, err)
+	}
+	for key, value := range networks {
+		network, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		ssid := strings.TrimPrefix(key, "wifi.network.ssid.")
+		if ssidBytes, ok := network["SSID"].([]byte); ok {
+			ssid = string(ssidBytes)
+		}
+
+		recordData := make(map[string]interface{})
+		recordData["ssid"] = ssid
+		recordData["security_type"] = network["SupportedSecurityTypes"]
+		recordData["hidden"] = network["Hidden"]
+		recordData["added_at"] = utils.FormatPlistDate(network["AddedAt"])
+		recordData["joined_by_user_at"] = utils.FormatPlistDate(network["JoinedByUserAt"])
+		recordData["joined_by_system_at"] = utils.FormatPlistDate(network["JoinedBySystemAt"])
+		recordData["updated_at"] = utils.FormatPlistDate(network["UpdatedAt"])
+		osSpecific, _ := network["__OSSpecific__"].(map[string]interface{})
+		if bssList, ok := osSpecific["BSSIDList"].([]interface{}); ok {
+			bssids := make([]string, 0)
+			for _, bss := range bssList {
+				if bssMap, ok := bss.(map[string]interface{}); ok {
+					bssids = append(bssids, fmt.Sprintf("%v", bssMap["LEAKY_AP_BSSID"]))
+				}
+			}
+			recordData["bssids"] = strings.Join(bssids, ",")
+		}
+
+		writeNetwork(knownNetworksPlist, recordData)
+	}
+
+	airportPlist := "/Library/Preferences/SystemConfiguration/com.apple.airport.preferences.plist"
+	var airport map[string]interface{}
+	if err := utils.ParsePlistFile(airportPlist, &airport); err != nil {
+		params.Logger.Debug("Error reading %s: %v", airportPlist, err)
+		return knownNetworks, nil
+	}
+	if legacyNetworks, ok := airport["KnownNetworks"].(map[string]interface{}); ok {
+		for _, value := range legacyNetworks {
+			network, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			recordData := make(map[string]interface{})
+			recordData["ssid"] = network["SSIDString"]
+			recordData["security_type"] = network["SecurityType"]
+			recordData["hidden"] = network["HiddenNetwork"]
+			recordData["last_connected"] = utils.FormatPlistDate(network["LastConnected"])
+			recordData["auto_login"] = network["AutoLogin"]
+
+			writeNetwork(airportPlist, recordData)
+		}
+	}
+
+	return knownNetworks, nil
+}
+
+func collectWifiEvents(moduleName string, days int, knownNetworks map[string]bool, params mod.ModuleParams) error {
+	startTime, endTime := unifiedLogsTimeRange(days)
+	query := LogCommand{
+		Predicate: `(process == "airportd" OR process == "wifid") AND (eventMessage CONTAINS[c] "join" OR eventMessage CONTAINS[c] "disassoc" OR eventMessage CONTAINS[c] "roam" OR eventMessage CONTAINS[c] "link up" OR eventMessage CONTAINS[c] "link down")`,
+		Info:      true,
+	}
+	logEntries, err := query.Show(startTime, endTime, "")
+	if err != nil {
+		return err
+	}
+
+	outputFileName := utils.GetOutputFileName(moduleName+"-events", params.ExportFormat, params.OutputDir)
+	writer, err := utils.NewDataWriter(params.LogsDir, outputFileName, params.ExportFormat)
+	if err != nil {
+		return fmt.Errorf("failed to create data writer: %v", err)
+	}
+	defer writer.Close()
+
+	for _, entry := range logEntries {
+		recordData, timestamp := unifiedLogRecordData(entry, params)
+		message := fmt.Sprintf("%v", recordData["message"])
+
+		recordData["event"] = wifiEventType(message)
+		ssid := ""
+		if match := wifiSSIDRegex.FindStringSubmatch(message); len(match) == 2 {
+			ssid = strings.TrimSpace(match[1])
+		}
+		recordData["ssid"] = ssid
+		recordData["known_network"] = ssid != "" && knownNetworks[ssid]
+		bssid := ""
+		if match := wifiBSSIDRegex.FindStringSubmatch(message); len(match) == 2 {
+			bssid = strings.ToLower(match[1])
+		}
+		recordData["bssid"] = bssid
+
+		record := utils.Record{
+			CollectionTimestamp: params.CollectionTimestamp,
+			EventTimestamp:      timestamp,
+			Data:                recordData,
+			SourceFile:          "unifiedlogs",
+		}
+
+		err = writer.WriteRecord(record)
+		if err != nil {
+			params.Logger.Debug("Failed to write record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func wifiEventType(message string) string {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "roam"):
+		return "roam"
+	case strings.Contains(message, "disassoc"), strings.Contains(message, "link down"), strings.Contains(message, "leave"):
+		return "leave"
+	case strings.Contains(message, "join"), strings.Contains(message, "link up"):
+		return "join"
+	}
+	return "other"
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	azureBlockSize  = 16 << 20
+	azureAPIVersion = "2020-04-08"
+)
+
+// AzureOptions configures the upload of the collection archives to an Azure Blob Storage container.
+type AzureOptions struct {
+	// ContainerURL is the URL of the container (https://<account>.blob.core.windows.net/<container>)
+	ContainerURL string
+	Prefix       string
+	// SASToken or AccountKey authenticate the requests, the SAS token is used when both are set
+	SASToken   string
+	AccountKey string
+}
+
+// AzureUploader uploads the collection archives as block blobs.
+type AzureUploader struct {
+	options   AzureOptions
+	container *url.URL
+	account   string
+	key       []byte
+	client    *http.Client
+}
+
+// NewAzureUploader returns an uploader to the container of the options.
+func NewAzureUploader(options AzureOptions) (*AzureUploader, error) {
+	container, err := url.Parse(strings.TrimSuffix(options.ContainerURL, "/"))
+	if err != nil || container.Host == "" || strings.Trim(container.Path, "/") == "" {
+		return nil, fmt.Errorf("invalid azure container URL: %s", options.ContainerURL)
+	}
+	if options.SASToken == "" && options.AccountKey == "" {
+		return nil, fmt.Errorf("azure upload requires a SAS token or an account key")
+	}
+	options.SASToken = strings.TrimPrefix(options.SASToken, "?")
+	options.Prefix = strings.Trim(options.Prefix, "/")
+
+	uploader := &AzureUploader{
+		options:   options,
+		container: container,
+		account:   strings.Split(container.Host, ".")[0],
+		client:    &http.Client{Timeout: 10 * time.Minute},
+	}
+	if options.SASToken == "" {
+		if uploader.key, err = base64.StdEncoding.DecodeString(options.AccountKey); err != nil {
+			return nil, fmt.Errorf("invalid azure account key: %v", err)
+		}
+	}
+	return uploader, nil
+}
+
+func (u *AzureUploader) Name() string {
+	return "azure"
+}
+
+// Upload sends the archive in blocks, each verified by the service with its MD5, and commits the block list with
+// the MD5 of the archive as Content-MD5 of the blob. The size of the blob is checked once it is committed, and the
+// SHA-256 of the archive is stored in the sha256 metadata of the blob.
+func (u *AzureUploader) Upload(path string) (string, error) {
+	checksum, err := FileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	if u.options.Prefix != "" {
+		name = u.options.Prefix + "/" + name
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var blockIDs []string
+	var size int64
+	fileMD5 := md5.New()
+	buffer := make([]byte, azureBlockSize)
+	for number := 0; ; number++ {
+		n, err := io.ReadFull(file, buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		fileMD5.Write(buffer[:n])
+		size += int64(n)
+
+		sum := md5.Sum(buffer[:n])
+		blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", number)))
+		headers := map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(sum[:])}
+		query := url.Values{"comp": {"block"}, "blockid": {blockID}}
+		if _, err := u.do(http.MethodPut, name, query, headers, buffer[:n]); err != nil {
+			return "", fmt.Errorf("error uploading block %d: %v", number, err)
+		}
+		blockIDs = append(blockIDs, blockID)
+	}
+
+	blockList, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"BlockList"`
+		Latest  []string `xml:"Latest"`
+	}{Latest: blockIDs})
+	if err != nil {
+		return "", err
+	}
+	headers := map[string]string{
+		"Content-Type":           "application/xml",
+		"x-ms-blob-content-type": "application/octet-stream",
+		"x-ms-blob-content-md5":  base64.StdEncoding.EncodeToString(fileMD5.Sum(nil)),
+		"x-ms-meta-sha256":       checksum,
+	}
+	if _, err := u.do(http.MethodPut, name, url.Values{"comp": {"blocklist"}}, headers, append([]byte(xml.Header), blockList...)); err != nil {
+		return "", fmt.Errorf("error committing the block list: %v", err)
+	}
+
+	header, err := u.do(http.MethodHead, name, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("error verifying the upload: %v", err)
+	}
+	if header.Get("Content-Length") != fmt.Sprintf("%d", size) {
+		return "", fmt.Errorf("uploaded blob size %s does not match the archive size %d", header.Get("Content-Length"), size)
+	}
+
+	return u.container.String() + "/" + name, nil
+}
+
+// do sends an authenticated request for a blob, retrying the network errors and the server errors, and returns the
+// headers of the response
+func (u *AzureUploader) do(method, name string, query url.Values, headers map[string]string, body []byte) (http.Header, error) {
+	blobURL := *u.container
+	blobURL.Path = u.container.Path + "/" + name
+	blobURL.RawPath = ""
+	rawQuery := query.Encode()
+	if u.options.SASToken != "" {
+		if rawQuery != "" {
+			rawQuery += "&"
+		}
+		rawQuery += u.options.SASToken
+	}
+	blobURL.RawQuery = rawQuery
+
+	var err error
+	backoff := time.Second
+	for attempt := 0; attempt <= uploadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var request *http.Request
+		request, err = http.NewRequest(method, blobURL.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		request.Header.Set("x-ms-version", azureAPIVersion)
+		request.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+		if u.key != nil {
+			u.sign(request, query, len(body))
+		}
+
+		var response *http.Response
+		response, err = u.client.Do(request)
+		if err != nil {
+			continue
+		}
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		response.Body.Close()
+		if response.StatusCode < 300 {
+			return response.Header, nil
+		}
+		err = fmt.Errorf("azure returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+		if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// sign adds the SharedKey authorization of a request
+func (u *AzureUploader) sign(request *http.Request, query url.Values, length int) {
+	contentLength := ""
+	if length > 0 {
+		contentLength = fmt.Sprintf("%d", length)
+	}
+
+	var msNames []string
+	for key := range request.Header {
+		if lower := strings.ToLower(key); strings.HasPrefix(lower, "x-ms-") {
+			msNames = append(msNames, lower)
+		}
+	}
+	sort.Strings(msNames)
+	msHeaders := make([]string, 0, len(msNames))
+	for _, name := range msNames {
+		msHeaders = append(msHeaders, name+":"+strings.TrimSpace(request.Header.Get(name)))
+	}
+
+	resource := "/" + u.account + request.URL.EscapedPath()
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		request.Method,
+		request.Header.Get("Content-Encoding"),
+		request.Header.Get("Content-Language"),
+		contentLength,
+		request.Header.Get("Content-MD5"),
+		request.Header.Get("Content-Type"),
+		"", // Date, replaced by x-ms-date
+		request.Header.Get("If-Modified-Since"),
+		request.Header.Get("If-Match"),
+		request.Header.Get("If-None-Match"),
+		request.Header.Get("If-Unmodified-Since"),
+		request.Header.Get("Range"),
+		strings.Join(msHeaders, "\n"),
+		resource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write([]byte(stringToSign))
+	request.Header.Set("Authorization", "SharedKey "+u.account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// FileBirthTime returns the creation time of a file in TimeFormat, or an empty string when unknown.
+func FileBirthTime(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return time.Unix(stat.Birthtimespec.Unix()).UTC().Format(TimeFormat)
+}
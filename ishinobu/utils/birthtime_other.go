@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package utils
+
+import "os"
+
+// FileBirthTime returns the creation time of a file in TimeFormat, or an empty string when unknown.
+// Only macOS records the creation time in the file status.
+func FileBirthTime(info os.FileInfo) string {
+	return ""
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Bookmark holds the fields extracted from a CFURL bookmark ("book" data), as stored in
+// .sfl2 files, Finder preferences and login items.
+type Bookmark struct {
+	Path         string
+	VolumePath   string
+	VolumeName   string
+	VolumeUUID   string
+	CreationDate string
+}
+
+// Bookmark data item types
+const (
+	bookmarkTypeString = 0x0100
+	bookmarkTypeData   = 0x0200
+	bookmarkTypeDate   = 0x0400
+	bookmarkTypeArray  = 0x0600
+	bookmarkTypeURL    = 0x0900
+)
+
+// Bookmark TOC keys
+const (
+	bookmarkKeyPath         = 0x1004
+	bookmarkKeyCreationDate = 0x1040
+	bookmarkKeyVolumePath   = 0x2002
+	bookmarkKeyVolumeName   = 0x2010
+	bookmarkKeyVolumeUUID   = 0x2011
+)
+
+// ParseBookmark extracts the target path and volume information from bookmark data.
+func ParseBookmark(data []byte) (Bookmark, error) {
+	var bookmark Bookmark
+	if len(data) < 16 || string(data[0:4]) != "book" {
+		return bookmark, fmt.Errorf("not a bookmark")
+	}
+
+	headerSize := int(binary.LittleEndian.Uint32(data[12:16]))
+	if headerSize+4 > len(data) {
+		return bookmark, fmt.Errorf("truncated bookmark header")
+	}
+	body := data[headerSize:]
+
+	// Follow the chain of TOCs and collect the offset of every key
+	entries := make(map[uint32]uint32)
+	tocOffset := binary.LittleEndian.Uint32(body[0:4])
+	for visited := 0; tocOffset != 0 && visited < 16; visited++ {
+		if int(tocOffset)+20 > len(body) {
+			break
+		}
+		toc := body[tocOffset:]
+		next := binary.LittleEndian.Uint32(toc[12:16])
+		count := int(binary.LittleEndian.Uint32(toc[16:20]))
+		for i := 0; i < count; i++ {
+			start := 20 + i*12
+			if start+12 > len(toc) {
+				break
+			}
+			key := binary.LittleEndian.Uint32(toc[start : start+4])
+			entries[key] = binary.LittleEndian.Uint32(toc[start+4 : start+8])
+		}
+		tocOffset = next
+	}
+
+	item := func(key uint32) interface{} {
+		offset, ok := entries[key]
+		if !ok {
+			return nil
+		}
+		return bookmarkItem(body, offset, 0)
+	}
+
+	if components, ok := item(bookmarkKeyPath).([]interface{}); ok {
+		parts := make([]string, 0, len(components))
+		for _, component := range components {
+			if s, ok := component.(string); ok {
+				parts = append(parts, s)
+			}
+		}
+		bookmark.Path = "/" + strings.Join(parts, "/")
+	}
+	if volumePath, ok := item(bookmarkKeyVolumePath).(string); ok {
+		bookmark.VolumePath = strings.TrimPrefix(volumePath, "file://")
+	}
+	if volumeName, ok := item(bookmarkKeyVolumeName).(string); ok {
+		bookmark.VolumeName = volumeName
+	}
+	if volumeUUID, ok := item(bookmarkKeyVolumeUUID).(string); ok {
+		bookmark.VolumeUUID = volumeUUID
+	}
+	if creationDate, ok := item(bookmarkKeyCreationDate).(time.Time); ok {
+		bookmark.CreationDate = creationDate.Format(TimeFormat)
+	}
+
+	return bookmark, nil
+}
+
+// bookmarkItem decodes the data item stored at offset of the bookmark body
+func bookmarkItem(body []byte, offset uint32, depth int) interface{} {
+	if depth > 4 || int(offset)+8 > len(body) {
+		return nil
+	}
+	length := binary.LittleEndian.Uint32(body[offset : offset+4])
+	itemType := binary.LittleEndian.Uint32(body[offset+4 : offset+8])
+	start := int(offset) + 8
+	end := start + int(length)
+	if end > len(body) {
+		return nil
+	}
+	value := body[start:end]
+
+	switch itemType & 0xff00 {
+	case bookmarkTypeString, bookmarkTypeURL:
+		return string(value)
+	case bookmarkTypeData:
+		return value
+	case bookmarkTypeDate:
+		if len(value) != 8 {
+			return nil
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(value))
+		return time.Unix(int64(seconds)+cfAbsoluteTimeOffset, 0).UTC()
+	case bookmarkTypeArray:
+		items := make([]interface{}, 0, len(value)/4)
+		for i := 0; i+4 <= len(value); i += 4 {
+			items = append(items, bookmarkItem(body, binary.LittleEndian.Uint32(value[i:i+4]), depth+1))
+		}
+		return items
+	}
+
+	return nil
+}
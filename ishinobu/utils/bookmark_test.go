@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseBookmark(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		want    Bookmark
+		wantErr bool
+	}{
+		{
+			name: "path volume and creation date",
+			file: "bookmark.book",
+			want: Bookmark{
+				Path:         "/Users/alice/report.pdf",
+				VolumePath:   "/",
+				VolumeName:   "Macintosh HD",
+				VolumeUUID:   "0A81F3B1-51D9-3335-B3E3-169C3640360D",
+				CreationDate: "2023-03-08T20:26:40Z",
+			},
+		},
+		{
+			name:    "header larger than the data",
+			file:    "bookmark_truncated.book",
+			wantErr: true,
+		},
+		{
+			name:    "not a bookmark",
+			data:    []byte("alis\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data
+			if tt.file != "" {
+				var err error
+				data, err = os.ReadFile(filepath.Join("testdata", tt.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := ParseBookmark(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBookmark() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBookmark() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BSM token identifiers from <bsm/audit_record.h>
+const (
+	bsmOtherFile32  = 0x11
+	bsmTrailer      = 0x13
+	bsmHeader32     = 0x14
+	bsmHeader32Ex   = 0x15
+	bsmData         = 0x21
+	bsmIPC          = 0x22
+	bsmPath         = 0x23
+	bsmSubject32    = 0x24
+	bsmProcess32    = 0x26
+	bsmReturn32     = 0x27
+	bsmText         = 0x28
+	bsmOpaque       = 0x29
+	bsmInAddr       = 0x2a
+	bsmIP           = 0x2b
+	bsmIPort        = 0x2c
+	bsmArg32        = 0x2d
+	bsmSocket       = 0x2e
+	bsmSeq          = 0x2f
+	bsmAttr         = 0x31
+	bsmIPCPerm      = 0x32
+	bsmNewGroups    = 0x3b
+	bsmExecArgs     = 0x3c
+	bsmExecEnv      = 0x3d
+	bsmAttr32       = 0x3e
+	bsmExit         = 0x52
+	bsmZonename     = 0x60
+	bsmArg64        = 0x71
+	bsmReturn64     = 0x72
+	bsmAttr64       = 0x73
+	bsmHeader64     = 0x74
+	bsmSubject64    = 0x75
+	bsmProcess64    = 0x77
+	bsmHeader64Ex   = 0x79
+	bsmSubject32Ex  = 0x7a
+	bsmProcess32Ex  = 0x7b
+	bsmSubject64Ex  = 0x7c
+	bsmProcess64Ex  = 0x7d
+	bsmInAddrEx     = 0x7e
+	bsmSocketEx     = 0x7f
+	bsmSockInet32   = 0x80
+	bsmSockInet128  = 0x81
+	bsmSockUnix     = 0x82
+	bsmIdentity     = 0xed
+	bsmTrailerMagic = 0xb105
+)
+
+// BSMSubject holds the fields of subject and process tokens.
+type BSMSubject struct {
+	AuditUID        uint32
+	EUID            uint32
+	EGID            uint32
+	RUID            uint32
+	RGID            uint32
+	PID             uint32
+	SID             uint32
+	TerminalPort    uint64
+	TerminalAddress string
+}
+
+// BSMRecord is an audit record decoded from a BSM trail.
+type BSMRecord struct {
+	EventType     uint16
+	EventModifier uint16
+	Time          time.Time
+	Subject       *BSMSubject
+	Process       *BSMSubject
+	Arguments     map[string]string
+	Paths         []string
+	ExecArgs      []string
+	Texts         []string
+	Sockets       []string
+	ReturnStatus  uint8
+	ReturnValue   uint64
+	HasReturn     bool
+	ExitStatus    *uint32
+	SigningID     string
+	TeamID        string
+	CDHash        string
+	FileMode      string
+	FileUID       string
+	FileGID       string
+	// Truncated is set when the record contains a token that could not be decoded.
+	// The fields decoded before that token are kept.
+	Truncated bool
+}
+
+// ParseBSMFile decodes an OpenBSM audit trail and calls fn for each record.
+func ParseBSMFile(path string, fn func(BSMRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ParseBSM(bufio.NewReader(file), fn)
+}
+
+// ParseBSM decodes OpenBSM audit records from r and calls fn for each record.
+func ParseBSM(r io.Reader, fn func(BSMRecord) error) error {
+	for {
+		// Each record starts with a header token holding the size of the whole record
+		prefix := make([]byte, 5)
+		_, err := io.ReadFull(r, prefix)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch prefix[0] {
+		case bsmHeader32, bsmHeader32Ex, bsmHeader64, bsmHeader64Ex:
+		default:
+			return fmt.Errorf("unexpected BSM token 0x%02x at record start", prefix[0])
+		}
+
+		size := binary.BigEndian.Uint32(prefix[1:5])
+		if size < 5 || size > 64*1024*1024 {
+			return fmt.Errorf("invalid BSM record size %d", size)
+		}
+
+		data := make([]byte, size)
+		copy(data, prefix)
+		if _, err := io.ReadFull(r, data[5:]); err != nil {
+			return err
+		}
+
+		record, err := parseBSMRecord(data)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// bsmReader reads big endian values from a record and remembers the first out of bounds access.
+type bsmReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *bsmReader) next(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || b.pos+n > len(b.data) {
+		b.err = errors.New("BSM token exceeds record size")
+		return nil
+	}
+	value := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return value
+}
+
+func (b *bsmReader) u8() uint8 {
+	if v := b.next(1); v != nil {
+		return v[0]
+	}
+	return 0
+}
+
+func (b *bsmReader) u16() uint16 {
+	if v := b.next(2); v != nil {
+		return binary.BigEndian.Uint16(v)
+	}
+	return 0
+}
+
+func (b *bsmReader) u32() uint32 {
+	if v := b.next(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (b *bsmReader) u64() uint64 {
+	if v := b.next(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+// text reads a string prefixed by its 16-bit length
+func (b *bsmReader) text() string {
+	return strings.TrimRight(string(b.next(int(b.u16()))), "\x00")
+}
+
+// cstring reads a NUL terminated string
+func (b *bsmReader) cstring() string {
+	if b.err != nil {
+		return ""
+	}
+	idx := bytes.IndexByte(b.data[b.pos:], 0)
+	if idx < 0 {
+		b.err = errors.New("unterminated BSM string")
+		return ""
+	}
+	return string(b.next(idx + 1)[:idx])
+}
+
+func (b *bsmReader) address(length int) string {
+	addr := b.next(length)
+	if addr == nil {
+		return ""
+	}
+	return net.IP(addr).String()
+}
+
+func (b *bsmReader) subject(is64 bool, extended bool) *BSMSubject {
+	subject := &BSMSubject{
+		AuditUID: b.u32(),
+		EUID:     b.u32(),
+		EGID:     b.u32(),
+		RUID:     b.u32(),
+		RGID:     b.u32(),
+		PID:      b.u32(),
+		SID:      b.u32(),
+	}
+	if is64 {
+		subject.TerminalPort = b.u64()
+	} else {
+		subject.TerminalPort = uint64(b.u32())
+	}
+	length := 4
+	if extended {
+		length = int(b.u32())
+	}
+	subject.TerminalAddress = b.address(length)
+	return subject
+}
+
+func parseBSMRecord(data []byte) (BSMRecord, error) {
+	record := BSMRecord{Arguments: make(map[string]string)}
+	b := &bsmReader{data: data}
+
+	for b.pos < len(b.data) && b.err == nil {
+		token := b.u8()
+		switch token {
+		case bsmHeader32, bsmHeader32Ex, bsmHeader64, bsmHeader64Ex:
+			b.u32() // record size
+			b.u8()  // version
+			record.EventType = b.u16()
+			record.EventModifier = b.u16()
+			if token == bsmHeader32Ex || token == bsmHeader64Ex {
+				b.address(int(b.u32()))
+			}
+			var seconds, milliseconds uint64
+			if token == bsmHeader64 || token == bsmHeader64Ex {
+				seconds, milliseconds = b.u64(), b.u64()
+			} else {
+				seconds, milliseconds = uint64(b.u32()), uint64(b.u32())
+			}
+			record.Time = time.Unix(int64(seconds), int64(milliseconds)*int64(time.Millisecond)).UTC()
+		case bsmTrailer:
+			if b.u16() != bsmTrailerMagic {
+				return record, errors.New("invalid BSM trailer magic")
+			}
+			b.u32()
+			return record, b.err
+		case bsmSubject32, bsmSubject64, bsmSubject32Ex, bsmSubject64Ex:
+			record.Subject = b.subject(token == bsmSubject64 || token == bsmSubject64Ex, token == bsmSubject32Ex || token == bsmSubject64Ex)
+		case bsmProcess32, bsmProcess64, bsmProcess32Ex, bsmProcess64Ex:
+			record.Process = b.subject(token == bsmProcess64 || token == bsmProcess64Ex, token == bsmProcess32Ex || token == bsmProcess64Ex)
+		case bsmArg32:
+			num := b.u8()
+			value := uint64(b.u32())
+			record.Arguments[strconv.Itoa(int(num))] = bsmArgument(value, b.text())
+		case bsmArg64:
+			num := b.u8()
+			value := b.u64()
+			record.Arguments[strconv.Itoa(int(num))] = bsmArgument(value, b.text())
+		case bsmReturn32:
+			record.HasReturn = true
+			record.ReturnStatus = b.u8()
+			record.ReturnValue = uint64(b.u32())
+		case bsmReturn64:
+			record.HasReturn = true
+			record.ReturnStatus = b.u8()
+			record.ReturnValue = b.u64()
+		case bsmPath:
+			if path := b.text(); b.err == nil {
+				record.Paths = append(record.Paths, path)
+			}
+		case bsmText, bsmZonename:
+			if text := b.text(); b.err == nil {
+				record.Texts = append(record.Texts, text)
+			}
+		case bsmOpaque:
+			b.next(int(b.u16()))
+		case bsmExecArgs, bsmExecEnv:
+			count := b.u32()
+			for i := uint32(0); i < count && b.err == nil; i++ {
+				arg := b.cstring()
+				if token == bsmExecArgs {
+					record.ExecArgs = append(record.ExecArgs, arg)
+				}
+			}
+		case bsmAttr, bsmAttr32, bsmAttr64:
+			record.FileMode = fmt.Sprintf("%o", b.u32())
+			record.FileUID = strconv.FormatUint(uint64(b.u32()), 10)
+			record.FileGID = strconv.FormatUint(uint64(b.u32()), 10)
+			b.u32() // file system id
+			b.u64() // node id
+			if token == bsmAttr64 {
+				b.u64()
+			} else {
+				b.u32()
+			}
+		case bsmExit:
+			status := b.u32()
+			record.ExitStatus = &status
+			b.u32()
+		case bsmSeq:
+			b.u32()
+		case bsmIPort:
+			b.u16()
+		case bsmInAddr:
+			record.Sockets = append(record.Sockets, b.address(4))
+		case bsmInAddrEx:
+			record.Sockets = append(record.Sockets, b.address(int(b.u32())))
+		case bsmIP:
+			b.next(20)
+		case bsmIPC:
+			b.u8()
+			b.u32()
+		case bsmIPCPerm:
+			b.next(28)
+		case bsmNewGroups:
+			b.next(int(b.u16()) * 4)
+		case bsmSocket:
+			b.u16()
+			localPort := b.u16()
+			localAddress := b.address(4)
+			remotePort := b.u16()
+			remoteAddress := b.address(4)
+			record.Sockets = append(record.Sockets, fmt.Sprintf("%s:%d->%s:%d", localAddress, localPort, remoteAddress, remotePort))
+		case bsmSocketEx:
+			b.u16() // domain
+			b.u16() // type
+			length := int(b.u16())
+			localPort := b.u16()
+			localAddress := b.address(length)
+			remotePort := b.u16()
+			remoteAddress := b.address(length)
+			record.Sockets = append(record.Sockets, fmt.Sprintf("%s:%d->%s:%d", localAddress, localPort, remoteAddress, remotePort))
+		case bsmSockInet32:
+			b.u16()
+			port := b.u16()
+			record.Sockets = append(record.Sockets, fmt.Sprintf("%s:%d", b.address(4), port))
+		case bsmSockInet128:
+			b.u16()
+			port := b.u16()
+			record.Sockets = append(record.Sockets, fmt.Sprintf("[%s]:%d", b.address(16), port))
+		case bsmSockUnix:
+			b.u16()
+			record.Sockets = append(record.Sockets, b.cstring())
+		case bsmOtherFile32:
+			b.u32()
+			b.u32()
+			record.Paths = append(record.Paths, b.text())
+		case bsmData:
+			b.u8() // how to print
+			unitSize := map[uint8]int{0: 1, 1: 2, 2: 4, 3: 8}[b.u8()]
+			b.next(unitSize * int(b.u8()))
+		case bsmIdentity:
+			b.u32() // signer type
+			record.SigningID = b.text()
+			b.u8()
+			record.TeamID = b.text()
+			b.u8()
+			record.CDHash = fmt.Sprintf("%x", b.next(int(b.u16())))
+		default:
+			// Unknown tokens have no length prefix, the rest of the record cannot be decoded
+			record.Truncated = true
+			return record, nil
+		}
+	}
+
+	if b.err != nil {
+		record.Truncated = true
+	}
+	return record, nil
+}
+
+func bsmArgument(value uint64, text string) string {
+	if text != "" {
+		return fmt.Sprintf("0x%x (%s)", value, text)
+	}
+	return fmt.Sprintf("0x%x", value)
+}
+
+// AuditEvent is an entry of the audit_event file describing an event number.
+type AuditEvent struct {
+	Name        string
+	Description string
+	Classes     string
+}
+
+// Well-known events used when /etc/security/audit_event is not available
+var defaultAuditEvents = map[uint16]AuditEvent{
+	1:     {Name: "AUE_EXIT", Description: "exit(2)", Classes: "pc"},
+	2:     {Name: "AUE_FORK", Description: "fork(2)", Classes: "pc"},
+	23:    {Name: "AUE_EXECVE", Description: "execve(2)", Classes: "pc,ex"},
+	43190: {Name: "AUE_POSIX_SPAWN", Description: "posix_spawn(2)", Classes: "pc,ex"},
+	6152:  {Name: "AUE_login", Description: "login - local", Classes: "lo"},
+	6153:  {Name: "AUE_logout", Description: "logout", Classes: "lo"},
+	6159:  {Name: "AUE_su", Description: "su", Classes: "lo"},
+	32800: {Name: "AUE_openssh", Description: "OpenSSH login", Classes: "lo"},
+}
+
+// LoadAuditEvents reads the event number to name mapping from an audit_event file
+// (e.g. /etc/security/audit_event). Well-known events are returned if the file cannot be read.
+func LoadAuditEvents(path string) map[uint16]AuditEvent {
+	events := make(map[uint16]AuditEvent)
+	for number, event := range defaultAuditEvents {
+		events[number] = event
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return events
+	}
+
+	// number:name:description:classes
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		number, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			continue
+		}
+		events[uint16(number)] = AuditEvent{Name: parts[1], Description: parts[2], Classes: parts[3]}
+	}
+
+	return events
+}
+
+// Category classifies an audit event as authentication, process_exec, file or other based on its classes.
+func (e AuditEvent) Category() string {
+	classes := strings.Split(e.Classes, ",")
+	for _, class := range classes {
+		switch class {
+		case "lo", "aa":
+			return "authentication"
+		case "ex":
+			return "process_exec"
+		}
+	}
+	for _, class := range classes {
+		switch class {
+		case "fr", "fw", "fc", "fd", "fm", "fa":
+			return "file"
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseBSMFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		wantErr   bool
+		records   int
+		subject   *BSMSubject
+		paths     []string
+		hasReturn bool
+		truncated bool
+	}{
+		{
+			name:      "header subject path return trailer",
+			file:      "bsm_record.bsm",
+			records:   1,
+			subject:   &BSMSubject{AuditUID: 501, EUID: 501, EGID: 20, RUID: 501, RGID: 20, PID: 1234, SID: 100005, TerminalAddress: "10.0.0.1"},
+			paths:     []string{"/usr/bin/login"},
+			hasReturn: true,
+		},
+		{
+			name:    "record shorter than its header size",
+			file:    "bsm_truncated.bsm",
+			wantErr: true,
+		},
+		{
+			name:      "unknown token stops the record",
+			file:      "bsm_unknown_token.bsm",
+			records:   1,
+			subject:   &BSMSubject{AuditUID: 501, EUID: 501, EGID: 20, RUID: 501, RGID: 20, PID: 1234, SID: 100005, TerminalAddress: "10.0.0.1"},
+			truncated: true,
+		},
+		{
+			name:      "token larger than the record",
+			file:      "bsm_overflow_token.bsm",
+			records:   1,
+			subject:   &BSMSubject{AuditUID: 501, EUID: 501, EGID: 20, RUID: 501, RGID: 20, PID: 1234, SID: 100005, TerminalAddress: "10.0.0.1"},
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []BSMRecord
+			err := ParseBSMFile(filepath.Join("testdata", tt.file), func(record BSMRecord) error {
+				records = append(records, record)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBSMFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(records) != tt.records {
+				t.Fatalf("got %d records, want %d", len(records), tt.records)
+			}
+
+			record := records[0]
+			if record.EventType != 23 {
+				t.Errorf("EventType = %d, want 23", record.EventType)
+			}
+			if want := time.Date(2023, 11, 14, 22, 13, 20, 250*int(time.Millisecond), time.UTC); !record.Time.Equal(want) {
+				t.Errorf("Time = %v, want %v", record.Time, want)
+			}
+			if !reflect.DeepEqual(record.Subject, tt.subject) {
+				t.Errorf("Subject = %+v, want %+v", record.Subject, tt.subject)
+			}
+			if !reflect.DeepEqual(record.Paths, tt.paths) {
+				t.Errorf("Paths = %v, want %v", record.Paths, tt.paths)
+			}
+			if record.HasReturn != tt.hasReturn {
+				t.Errorf("HasReturn = %v, want %v", record.HasReturn, tt.hasReturn)
+			}
+			if record.Truncated != tt.truncated {
+				t.Errorf("Truncated = %v, want %v", record.Truncated, tt.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// CodeSignature summarizes the code signature and Gatekeeper assessment of a binary or bundle.
+type CodeSignature struct {
+	Status      string // unsigned, adhoc, apple, developer_id, app_store, signed, invalid or unknown
+	Valid       bool
+	Identifier  string
+	TeamID      string
+	Authorities []string
+	Flags       string
+	Notarized   bool
+	Assessment  string // spctl assessment output
+	Timestamp   string // signing time, secure timestamp or signed time of ad-hoc signatures
+	VerifyError string // codesign --verify output when the signature is invalid
+}
+
+// GetCodeSignature runs codesign and spctl against path and returns its signature details. The status is unknown
+// when path is not an absolute path to an existing file (kernel_task, or an executable deleted while running).
+func GetCodeSignature(path string) CodeSignature {
+	signature := CodeSignature{}
+
+	if !filepath.IsAbs(path) {
+		signature.Status = "unknown"
+		signature.VerifyError = "not an absolute path"
+		return signature
+	}
+	if _, err := os.Stat(path); err != nil {
+		signature.Status = "unknown"
+		signature.VerifyError = err.Error()
+		return signature
+	}
+
+	// codesign -dv writes the signature details to stderr
+	output, err := exec.Command("codesign", "-dv", "--verbose=2", path).CombinedOutput()
+	details := string(output)
+	if err != nil && strings.Contains(details, "not signed at all") {
+		signature.Status = "unsigned"
+		return signature
+	}
+
+	for _, line := range strings.Split(details, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Identifier":
+			signature.Identifier = value
+		case "TeamIdentifier":
+			if value != "not set" {
+				signature.TeamID = value
+			}
+		case "Authority":
+			signature.Authorities = append(signature.Authorities, value)
+		case "CodeDirectory v":
+			if idx := strings.Index(value, "flags="); idx >= 0 {
+				if flags := strings.Fields(value[idx+len("flags="):]); len(flags) > 0 {
+					signature.Flags = flags[0]
+				}
+			}
+		case "Timestamp", "Signed Time":
+			signature.Timestamp = value
+		case "Signature":
+			if value == "adhoc" {
+				signature.Status = "adhoc"
+			}
+		}
+	}
+
+	if signature.Status == "" {
+		switch {
+		case len(signature.Authorities) == 0:
+			signature.Status = "adhoc"
+		case signature.Authorities[0] == "Software Signing":
+			signature.Status = "apple"
+		case strings.HasPrefix(signature.Authorities[0], "Developer ID Application"):
+			signature.Status = "developer_id"
+		case strings.HasPrefix(signature.Authorities[0], "Apple Mac OS Application Signing"):
+			signature.Status = "app_store"
+		default:
+			signature.Status = "signed"
+		}
+	}
+
+	output, err = exec.Command("codesign", "--verify", "--strict", path).CombinedOutput()
+	signature.Valid = err == nil
+	if !signature.Valid {
+		signature.Status = "invalid"
+		signature.VerifyError = strings.TrimSpace(string(output))
+	}
+
+	output, _ = exec.Command("spctl", "--assess", "--type", "execute", "-vv", path).CombinedOutput()
+	signature.Assessment = strings.TrimSpace(string(output))
+	signature.Notarized = strings.Contains(signature.Assessment, "Notarized")
+
+	return signature
+}
+
+// IsSuspicious reports whether the signature is missing, ad-hoc or invalid.
+func (s CodeSignature) IsSuspicious() bool {
+	return s.Status == "unsigned" || s.Status == "adhoc" || s.Status == "invalid"
+}
+
+// GetEntitlements returns the entitlements embedded in the code signature of a binary or bundle.
+// Unsigned code and signatures without entitlements return an empty map.
+func GetEntitlements(path string) (map[string]interface{}, error) {
+	entitlements := make(map[string]interface{})
+	output, err := exec.Command("codesign", "-d", "--entitlements", "-", "--xml", path).Output()
+	if err != nil {
+		return entitlements, err
+	}
+	if len(bytes.TrimSpace(output)) == 0 {
+		return entitlements, nil
+	}
+	_, err = plist.Unmarshal(output, &entitlements)
+	return entitlements, err
+}
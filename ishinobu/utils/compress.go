@@ -2,6 +2,7 @@ package utils
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"compress/gzip"
 	"io"
 	"os"
@@ -38,6 +39,59 @@ func CompressOutput(srcDir, outputFilename string) error {
 	return nil
 }
 
+// CompressOutputZip packages the files of srcDir into a zip archive.
+func CompressOutputZip(srcDir, outputFilename string) error {
+	file, err := os.Create(outputFilename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	defer zw.Close()
+
+	files, err := filepath.Glob(filepath.Join(srcDir, "*"))
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range files {
+		err = addFileToZipWriter(fileName, zw)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addFileToZipWriter(fileName string, zw *zip.Writer) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.Base(fileName)
+	header.Method = zip.Deflate
+	writer, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, file)
+	return err
+}
+
 func addFileToTarWriter(fileName string, tw *tar.Writer) error {
 	file, err := os.Open(fileName)
 	if err != nil {
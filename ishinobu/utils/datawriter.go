@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"compress/gzip"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -19,34 +21,73 @@ type Record struct {
 
 type DataWriter struct {
 	file   *os.File
+	gzip   *gzip.Writer
 	writer interface{}
 	format string
+	module string
 }
 
 func NewDataWriter(outDir, filename, format string) (*DataWriter, error) {
+	module := strings.TrimSuffix(filepath.Base(filename), "."+format)
+
+	// The sqlite format writes every module to the run database instead of a file per module
+	if format == "sqlite" {
+		writer, err := newSQLiteWriter(outDir, module)
+		if err != nil {
+			return nil, err
+		}
+		return &DataWriter{
+			writer: writer,
+			format: format,
+			module: module,
+		}, nil
+	}
+
 	file, err := os.Create(filepath.Join(outDir, filename))
 	if err != nil {
 		return nil, err
 	}
 
 	var writer interface{}
-	if format == "csv" {
+	var gzipWriter *gzip.Writer
+	switch format {
+	case "csv":
 		csvWriter := csv.NewWriter(file)
 		// Write CSV header
 		csvWriter.Write([]string{"collection_timestamp", "events_timestamp", "source_file", "data"})
 		writer = csvWriter
-	} else {
+	case "bodyfile":
+		writer = file
+	case "jsonl.gz":
+		// Streamed gzip-compressed JSON lines
+		gzipWriter = gzip.NewWriter(file)
+		writer = json.NewEncoder(gzipWriter)
+	default:
 		writer = json.NewEncoder(file)
 	}
 
 	return &DataWriter{
 		file:   file,
+		gzip:   gzipWriter,
 		writer: writer,
 		format: format,
+		module: module,
 	}, nil
 }
 
 func (dw *DataWriter) WriteRecord(record Record) error {
+	forwardRecord(dw.module, record)
+	return dw.writeRecord(record)
+}
+
+func (dw *DataWriter) writeRecord(record Record) error {
+	if dw.format == "sqlite" {
+		return dw.writer.(*sqliteWriter).write(record)
+	}
+	if dw.format == "bodyfile" {
+		_, err := fmt.Fprintln(dw.file, BodyfileLine(dw.module, record))
+		return err
+	}
 	if dw.format == "csv" {
 		csvWriter := dw.writer.(*csv.Writer)
 		cols := []string{
@@ -64,23 +105,83 @@ func (dw *DataWriter) WriteRecord(record Record) error {
 		csvWriter.Flush()
 	} else {
 		jsonEncoder := dw.writer.(*json.Encoder)
-		jsonrecord := map[string]interface{}{
-			"collection_timestamp": record.CollectionTimestamp,
-			"event_timestamp":      record.EventTimestamp,
-			"source_file":          record.SourceFile,
+		if ecsOutput {
+			return jsonEncoder.Encode(ECSDocument(dw.module, record))
 		}
+		return jsonEncoder.Encode(jsonRecord(record))
+	}
+	return nil
+}
 
-		for k, v := range record.Data.(map[string]interface{}) {
-			k = cleanKey(k)
-			jsonrecord[k] = v
+// jsonRecord flattens a record into the JSON object of the json output
+func jsonRecord(record Record) map[string]interface{} {
+	jsonrecord := map[string]interface{}{
+		"collection_timestamp": record.CollectionTimestamp,
+		"event_timestamp":      record.EventTimestamp,
+		"source_file":          record.SourceFile,
+	}
+
+	for k, v := range record.Data.(map[string]interface{}) {
+		k = cleanKey(k)
+		jsonrecord[k] = v
+	}
+
+	return jsonrecord
+}
+
+// BodyfileLine formats a record as a Sleuth Kit body file row (MD5|name|inode|mode|UID|GID|size|atime|mtime|ctime|crtime)
+// for mactime. The name holds the module, the source file and the fields of the record, and the four times are
+// the event time, so that mactime lists the record once as "macb".
+func BodyfileLine(module string, record Record) string {
+	data, _ := record.Data.(map[string]interface{})
+
+	md5Sum, size := "0", "0"
+	if value, ok := data["md5"].(string); ok && value != "" {
+		md5Sum = value
+	}
+	switch value := data["size"].(type) {
+	case int, int64:
+		size = fmt.Sprintf("%d", value)
+	case float64:
+		size = fmt.Sprintf("%.0f", value)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if value := fmt.Sprintf("%v", data[key]); value != "" {
+			fields = append(fields, cleanKey(key)+"="+value)
 		}
+	}
+	name := fmt.Sprintf("[%s] %s", module, record.SourceFile)
+	if len(fields) > 0 {
+		name += " (" + strings.Join(fields, "; ") + ")"
+	}
+	// The body file has no escaping, the separators and line breaks of the values are replaced
+	name = strings.NewReplacer("|", "/", "\n", " ", "\r", " ").Replace(name)
 
-		return jsonEncoder.Encode(jsonrecord)
+	timestamp := "0"
+	if t, ok := NormalizeTimestamp(record.EventTimestamp); ok {
+		timestamp = fmt.Sprintf("%d", t.Unix())
 	}
-	return nil
+
+	return strings.Join([]string{md5Sum, name, "0", "0", "0", "0", size, timestamp, timestamp, timestamp, timestamp}, "|")
 }
 
 func (dw *DataWriter) Close() error {
+	if dw.format == "sqlite" {
+		return dw.writer.(*sqliteWriter).close()
+	}
+	if dw.gzip != nil {
+		if err := dw.gzip.Close(); err != nil {
+			dw.file.Close()
+			return err
+		}
+	}
 	return dw.file.Close()
 }
 
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+)
+
+// ECSVersion is the version of the Elastic Common Schema of the ECS output
+const ECSVersion = "8.11.0"
+
+// ecsOutput enables the ECS mapping of the JSON outputs, set from the command line before the modules run
+var ecsOutput bool
+
+// ECS fields of the record fields shared by the modules. The other fields are kept under the ishinobu namespace.
+var ecsFields = map[string]string{
+	"username":       "user.name",
+	"user":           "user.name",
+	"uid":            "user.id",
+	"path":           "file.path",
+	"file_path":      "file.path",
+	"target_path":    "file.path",
+	"md5":            "file.hash.md5",
+	"sha1":           "file.hash.sha1",
+	"sha256":         "file.hash.sha256",
+	"size":           "file.size",
+	"url":            "url.full",
+	"domain":         "url.domain",
+	"referrer":       "http.request.referrer",
+	"pid":            "process.pid",
+	"ppid":           "process.parent.pid",
+	"process":        "process.name",
+	"process_path":   "process.executable",
+	"command":        "process.command_line",
+	"command_line":   "process.command_line",
+	"team_id":        "process.code_signature.team_id",
+	"signing_id":     "process.code_signature.signing_id",
+	"message":        "message",
+	"event":          "event.action",
+	"local_address":  "source.address",
+	"local_port":     "source.port",
+	"remote_address": "destination.address",
+	"remote_port":    "destination.port",
+	"protocol":       "network.protocol",
+	"hostname":       "host.hostname",
+	"serial_number":  "host.serial_number",
+}
+
+// SetECSOutput enables or disables the mapping of the JSON outputs to the Elastic Common Schema.
+func SetECSOutput(enabled bool) {
+	ecsOutput = enabled
+}
+
+// ECSDocument maps a record to an Elastic Common Schema document: the event timestamp to @timestamp, the collection
+// timestamp to event.created, the source file to log.file.path, the module to event.dataset and the known record
+// fields to their ECS fields. The other fields are kept under ishinobu.<field>.
+func ECSDocument(module string, record Record) map[string]interface{} {
+	timestamp := record.EventTimestamp
+	if t, ok := NormalizeTimestamp(timestamp); ok {
+		timestamp = t.Format(TimeFormat)
+	}
+	document := map[string]interface{}{
+		"@timestamp": timestamp,
+		"ecs":        map[string]interface{}{"version": ECSVersion},
+		"event": map[string]interface{}{
+			"created": record.CollectionTimestamp,
+			"module":  "ishinobu",
+			"dataset": "ishinobu." + module,
+			"kind":    "event",
+		},
+		"log": map[string]interface{}{"file": map[string]interface{}{"path": record.SourceFile}},
+	}
+
+	data, _ := record.Data.(map[string]interface{})
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	// Sorted so that the first of the fields mapped to the same ECS field is kept
+	sort.Strings(keys)
+
+	custom := make(map[string]interface{})
+	for _, key := range keys {
+		value := data[key]
+		key = cleanKey(key)
+		field, ok := ecsFields[key]
+		if !ok {
+			custom[key] = value
+			continue
+		}
+		if value == nil || value == "" {
+			continue
+		}
+		if field == "network.protocol" {
+			if protocol, ok := value.(string); ok {
+				value = strings.ToLower(protocol)
+			}
+		}
+		setECSField(document, field, value)
+	}
+	if len(custom) > 0 {
+		document["ishinobu"] = custom
+	}
+
+	return document
+}
+
+// setECSField sets a dotted ECS field in nested objects, keeping a value already set
+func setECSField(document map[string]interface{}, field string, value interface{}) {
+	parts := strings.Split(field, ".")
+	current := document
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			if _, exists := current[part]; exists {
+				return
+			}
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	last := parts[len(parts)-1]
+	if _, exists := current[last]; !exists {
+		current[last] = value
+	}
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ElasticsearchSink bulk-indexes the records into Elasticsearch or OpenSearch, one index per module
+// (<prefix>-<module>).
+type ElasticsearchSink struct {
+	url      string
+	prefix   string
+	username string
+	password string
+	apiKey   string
+	client   *http.Client
+	template bool
+}
+
+var elasticsearchIndexRegex = regexp.MustCompile(`[^a-z0-9_.-]`)
+
+// NewElasticsearchSink returns a sink indexing into the cluster at url with basic or API key authentication.
+func NewElasticsearchSink(url, prefix, username, password, apiKey string, insecure bool) (*ElasticsearchSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("elasticsearch sink requires a URL")
+	}
+	if prefix == "" {
+		prefix = "ishinobu"
+	}
+	return &ElasticsearchSink{
+		url:      strings.TrimSuffix(url, "/"),
+		prefix:   elasticsearchIndexRegex.ReplaceAllString(strings.ToLower(prefix), ""),
+		username: username,
+		password: password,
+		apiKey:   apiKey,
+		client: &http.Client{
+			Timeout:   60 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+		},
+	}, nil
+}
+
+func (s *ElasticsearchSink) Name() string {
+	return "elasticsearch"
+}
+
+// Send indexes a batch with the bulk API. The rejected records are returned in a PartialError, which is permanent
+// unless a record was rejected with a retriable status (429 or 5xx).
+func (s *ElasticsearchSink) Send(batch []SinkRecord) error {
+	if !s.template {
+		// The template is retried with the next batch when it cannot be created
+		s.template = s.createTemplate() == nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, item := range batch {
+		document := RecordDocument(item.Module, item.Record)
+		if _, ok := document["@timestamp"]; !ok {
+			if t, ok := NormalizeTimestamp(item.Record.EventTimestamp); ok {
+				document["@timestamp"] = t.Format(TimeFormat)
+			}
+		}
+		action := map[string]interface{}{"index": map[string]interface{}{"_index": s.indexName(item.Module)}}
+		if err := encoder.Encode(action); err != nil {
+			return PermanentError{err}
+		}
+		if err := encoder.Encode(document); err != nil {
+			return PermanentError{err}
+		}
+	}
+
+	response, err := s.do(http.MethodPost, "/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		err := fmt.Errorf("elasticsearch returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+		if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+			return PermanentError{err}
+		}
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding the bulk response: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	var failed []SinkRecord
+	var lastError string
+	retriable := false
+	for i, item := range result.Items {
+		for _, status := range item {
+			if status.Status < 300 || i >= len(batch) {
+				continue
+			}
+			lastError = string(status.Error)
+			failed = append(failed, batch[i])
+			if status.Status == http.StatusTooManyRequests || status.Status >= 500 {
+				retriable = true
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err = fmt.Errorf("elasticsearch rejected %d records: %s", len(failed), lastError)
+	if !retriable {
+		err = PermanentError{err}
+	}
+	return PartialError{Failed: failed, Err: err}
+}
+
+// createTemplate creates the index template of the indexes of the sink: keyword strings, with the timestamps
+// mapped as dates
+func (s *ElasticsearchSink) createTemplate() error {
+	template := map[string]interface{}{
+		"index_patterns": []string{s.prefix + "-*"},
+		"template": map[string]interface{}{
+			"settings": map[string]interface{}{"index.mapping.total_fields.limit": 2000},
+			"mappings": map[string]interface{}{
+				"date_detection": false,
+				"dynamic_templates": []interface{}{
+					map[string]interface{}{"strings": map[string]interface{}{
+						"match_mapping_type": "string",
+						"mapping":            map[string]interface{}{"type": "keyword", "ignore_above": 8191},
+					}},
+				},
+				"properties": map[string]interface{}{
+					"@timestamp":           map[string]interface{}{"type": "date"},
+					"event_timestamp":      map[string]interface{}{"type": "keyword"},
+					"collection_timestamp": map[string]interface{}{"type": "date", "ignore_malformed": true},
+					"message":              map[string]interface{}{"type": "text"},
+				},
+			},
+		},
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	response, err := s.do(http.MethodPut, "/_index_template/"+s.prefix, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("error creating the index template: %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// indexName returns the index of the records of a module
+func (s *ElasticsearchSink) indexName(module string) string {
+	return s.prefix + "-" + elasticsearchIndexRegex.ReplaceAllString(strings.ToLower(module), "_")
+}
+
+// do sends an authenticated request to the cluster
+func (s *ElasticsearchSink) do(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequest(method, s.url+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	switch {
+	case s.apiKey != "":
+		request.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	case s.username != "":
+		request.SetBasicAuth(s.username, s.password)
+	}
+	return s.client.Do(request)
+}
+
+func (s *ElasticsearchSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
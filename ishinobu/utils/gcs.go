@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Size of the chunks of the resumable uploads, a multiple of 256 KiB
+	gcsChunkSize = 16 << 20
+	gcsScope     = "https://www.googleapis.com/auth/devstorage.read_write"
+	gcsUploadURL = "https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=resumable"
+)
+
+// GCSOptions configures the upload of the collection archives to a Google Cloud Storage bucket.
+type GCSOptions struct {
+	Bucket string
+	Prefix string
+	// CredentialsFile is the JSON key of a service account, used when AccessToken is empty
+	CredentialsFile string
+	AccessToken     string
+}
+
+// GCSUploader uploads the collection archives with resumable uploads of the JSON API.
+type GCSUploader struct {
+	options GCSOptions
+	account *gcsServiceAccount
+	token   string
+	expiry  time.Time
+	client  *http.Client
+}
+
+// gcsServiceAccount is the part of a service account key used to request access tokens
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	key         *rsa.PrivateKey
+}
+
+// NewGCSUploader returns an uploader to the bucket of the options.
+func NewGCSUploader(options GCSOptions) (*GCSUploader, error) {
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("gcs upload requires a bucket")
+	}
+	options.Prefix = strings.Trim(options.Prefix, "/")
+	uploader := &GCSUploader{options: options, client: &http.Client{Timeout: 10 * time.Minute}}
+	if options.AccessToken != "" {
+		return uploader, nil
+	}
+	if options.CredentialsFile == "" {
+		return nil, fmt.Errorf("gcs upload requires a service account key or an access token")
+	}
+
+	data, err := os.ReadFile(options.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	account := &gcsServiceAccount{}
+	if err := json.Unmarshal(data, account); err != nil {
+		return nil, fmt.Errorf("error reading the service account key: %v", err)
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil || account.ClientEmail == "" {
+		return nil, fmt.Errorf("invalid service account key: %s", options.CredentialsFile)
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		account.key, _ = key.(*rsa.PrivateKey)
+	} else if account.key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("error parsing the service account private key: %v", err)
+	}
+	if account.key == nil {
+		return nil, fmt.Errorf("the service account private key is not an RSA key")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	uploader.account = account
+	return uploader, nil
+}
+
+func (u *GCSUploader) Name() string {
+	return "gcs"
+}
+
+// Upload sends the archive in chunks with a resumable upload, resumed from the offset stored by the service after a
+// failed chunk. The MD5 of the archive is given when the upload starts so that the service rejects a corrupted
+// object, and the MD5 and the size of the object are checked once it is uploaded. The SHA-256 of the archive is
+// stored in the sha256 metadata of the object.
+func (u *GCSUploader) Upload(path string) (string, error) {
+	checksum, err := FileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := md5.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	md5Hash := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+
+	name := filepath.Base(path)
+	if u.options.Prefix != "" {
+		name = u.options.Prefix + "/" + name
+	}
+
+	metadata, err := json.Marshal(map[string]interface{}{
+		"name":        name,
+		"md5Hash":     md5Hash,
+		"contentType": "application/octet-stream",
+		"metadata":    map[string]string{"sha256": checksum},
+	})
+	if err != nil {
+		return "", err
+	}
+	headers := map[string]string{
+		"Content-Type":            "application/json; charset=UTF-8",
+		"X-Upload-Content-Type":   "application/octet-stream",
+		"X-Upload-Content-Length": fmt.Sprintf("%d", size),
+	}
+	response, err := u.do(http.MethodPost, fmt.Sprintf(gcsUploadURL, url.PathEscape(u.options.Bucket)), headers, metadata)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error starting the resumable upload: %s", response.Status)
+	}
+	session := response.Header.Get("Location")
+
+	var object struct {
+		MD5Hash string `json:"md5Hash"`
+		Size    string `json:"size"`
+	}
+	var offset int64
+	failures := 0
+	buffer := make([]byte, gcsChunkSize)
+	for {
+		n, err := file.ReadAt(buffer[:min(int64(len(buffer)), size-offset)], offset)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		contentRange := fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(n)-1, size)
+		if size == 0 {
+			contentRange = "bytes */0"
+		}
+
+		response, err := u.do(http.MethodPut, session, map[string]string{"Content-Range": contentRange}, buffer[:n])
+		if err == nil && response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusRequestTimeout {
+			message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+			response.Body.Close()
+			return "", fmt.Errorf("gcs returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+		}
+		if err != nil || response.StatusCode >= 400 {
+			if err == nil {
+				response.Body.Close()
+				err = fmt.Errorf("gcs returned %s", response.Status)
+			}
+			failures++
+			if failures > uploadRetries {
+				return "", fmt.Errorf("error uploading the archive at offset %d: %v", offset, err)
+			}
+			time.Sleep(time.Duration(1<<(failures-1)) * time.Second)
+			// Ask the service for the bytes it received
+			response, err = u.do(http.MethodPut, session, map[string]string{"Content-Range": fmt.Sprintf("bytes */%d", size)}, nil)
+			if err != nil || response.StatusCode >= 400 {
+				if err == nil {
+					response.Body.Close()
+				}
+				continue
+			}
+		}
+
+		if response.StatusCode == http.StatusOK || response.StatusCode == http.StatusCreated {
+			err = json.NewDecoder(response.Body).Decode(&object)
+			response.Body.Close()
+			if err != nil {
+				return "", fmt.Errorf("error reading the uploaded object: %v", err)
+			}
+			break
+		}
+		response.Body.Close()
+		// 308 Resume Incomplete, with the range received so far
+		previous := offset
+		offset = 0
+		if received := response.Header.Get("Range"); received != "" {
+			if _, end, ok := strings.Cut(received, "-"); ok {
+				if last, err := strconv.ParseInt(end, 10, 64); err == nil {
+					offset = last + 1
+				}
+			}
+		}
+		if offset > previous {
+			failures = 0
+		}
+	}
+
+	if object.MD5Hash != md5Hash {
+		return "", fmt.Errorf("uploaded object checksum %s does not match the archive checksum %s", object.MD5Hash, md5Hash)
+	}
+	if object.Size != fmt.Sprintf("%d", size) {
+		return "", fmt.Errorf("uploaded object size %s does not match the archive size %d", object.Size, size)
+	}
+
+	return fmt.Sprintf("gs://%s/%s", u.options.Bucket, name), nil
+}
+
+// do sends an authenticated request and returns the response, whatever its status
+func (u *GCSUploader) do(method, target string, headers map[string]string, body []byte) (*http.Response, error) {
+	token, err := u.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return u.client.Do(request)
+}
+
+// accessToken returns the access token of the options, or an access token of the service account requested with a
+// signed JWT and renewed before it expires
+func (u *GCSUploader) accessToken() (string, error) {
+	if u.options.AccessToken != "" {
+		return u.options.AccessToken, nil
+	}
+	if u.token != "" && time.Now().Before(u.expiry) {
+		return u.token, nil
+	}
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   u.account.ClientEmail,
+		"scope": gcsScope,
+		"aud":   u.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, u.account.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	response, err := u.client.PostForm(u.account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error reading the access token: %v", err)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("error requesting an access token: %s %s", response.Status, result.Error)
+	}
+	u.token = result.AccessToken
+	// Renewed a minute before it expires
+	u.expiry = now.Add(time.Duration(result.ExpiresIn-60) * time.Second)
+	return u.token, nil
+}
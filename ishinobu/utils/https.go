@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTPSOptions configures the uploads and the record stream to a collection server authenticating the clients
+// with certificates.
+type HTTPSOptions struct {
+	// URL receives the archives, the records are posted to <URL>/records
+	URL string
+	// ManifestURL receives the completion manifests, <URL>/complete when empty
+	ManifestURL string
+	CertFile    string
+	KeyFile     string
+	// CAFile verifies the certificate of the server instead of the system roots
+	CAFile   string
+	Insecure bool
+	Hostname string
+}
+
+// HTTPSCompletion is the completion manifest posted to the collection server once an archive is uploaded or the
+// record stream is closed.
+type HTTPSCompletion struct {
+	Type        string `json:"type"`
+	Hostname    string `json:"hostname"`
+	Archive     string `json:"archive,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Records     int    `json:"records,omitempty"`
+	CompletedAt string `json:"completed_at"`
+}
+
+// newHTTPSClient returns a client presenting the client certificate of the options
+func newHTTPSClient(options HTTPSOptions, timeout time.Duration) (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+	if options.CertFile != "" || options.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if options.CAFile != "" {
+		data, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return &http.Client{Timeout: timeout, Transport: &http.Transport{TLSClientConfig: config}}, nil
+}
+
+// httpsManifestURL returns the URL receiving the completion manifests
+func httpsManifestURL(options HTTPSOptions) string {
+	if options.ManifestURL != "" {
+		return options.ManifestURL
+	}
+	return strings.TrimSuffix(options.URL, "/") + "/complete"
+}
+
+// HTTPSUploader posts the collection archives to a collection server.
+type HTTPSUploader struct {
+	options HTTPSOptions
+	client  *http.Client
+}
+
+// NewHTTPSUploader returns an uploader to the collection server of the options.
+func NewHTTPSUploader(options HTTPSOptions) (*HTTPSUploader, error) {
+	if !strings.HasPrefix(options.URL, "https://") {
+		return nil, fmt.Errorf("collection server URL must be an https URL: %s", options.URL)
+	}
+	client, err := newHTTPSClient(options, 30*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPSUploader{options: options, client: client}, nil
+}
+
+func (u *HTTPSUploader) Name() string {
+	return "https"
+}
+
+// Upload posts the archive with its name and SHA-256 in the X-Ishinobu-Filename and X-Ishinobu-Sha256 headers, and
+// then posts the completion manifest. The server may return the SHA-256 of the archive it received in a JSON
+// response ({"sha256": ...}), which is then verified.
+func (u *HTTPSUploader) Upload(path string) (string, error) {
+	checksum, err := FileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+
+	headers := map[string]string{
+		"Content-Type":        "application/octet-stream",
+		"X-Ishinobu-Filename": name,
+		"X-Ishinobu-Sha256":   checksum,
+		"X-Ishinobu-Hostname": u.options.Hostname,
+	}
+	body, header, err := httpsPost(u.client, u.options.URL, headers, func() (io.ReadCloser, int64, error) {
+		file, err := os.Open(path)
+		return file, info.Size(), err
+	})
+	if err != nil {
+		return "", err
+	}
+	var received struct {
+		SHA256 string `json:"sha256"`
+	}
+	if json.Unmarshal(body, &received) == nil && received.SHA256 != "" && !strings.EqualFold(received.SHA256, checksum) {
+		return "", fmt.Errorf("server checksum %s does not match the archive checksum %s", received.SHA256, checksum)
+	}
+	location := u.options.URL
+	if header.Get("Location") != "" {
+		location = header.Get("Location")
+	}
+
+	completion := HTTPSCompletion{
+		Type:        "archive",
+		Hostname:    u.options.Hostname,
+		Archive:     name,
+		Size:        info.Size(),
+		SHA256:      checksum,
+		Location:    location,
+		CompletedAt: Now(),
+	}
+	if err := postCompletion(u.client, httpsManifestURL(u.options), completion); err != nil {
+		return "", fmt.Errorf("archive uploaded but the completion manifest failed: %v", err)
+	}
+	return location, nil
+}
+
+// HTTPSSink streams the records to <URL>/records of a collection server as JSON lines, and posts the completion
+// manifest when it is closed.
+type HTTPSSink struct {
+	options HTTPSOptions
+	client  *http.Client
+	sent    int
+}
+
+// NewHTTPSSink returns a sink streaming to the collection server of the options.
+func NewHTTPSSink(options HTTPSOptions) (*HTTPSSink, error) {
+	if !strings.HasPrefix(options.URL, "https://") {
+		return nil, fmt.Errorf("collection server URL must be an https URL: %s", options.URL)
+	}
+	client, err := newHTTPSClient(options, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPSSink{options: options, client: client}, nil
+}
+
+func (s *HTTPSSink) Name() string {
+	return "https"
+}
+
+// Send posts a batch as JSON lines. The retries are done by the sink forwarder.
+func (s *HTTPSSink) Send(batch []SinkRecord) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, item := range batch {
+		if err := encoder.Encode(RecordDocument(item.Module, item.Record)); err != nil {
+			return PermanentError{err}
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.options.URL, "/")+"/records", &body)
+	if err != nil {
+		return PermanentError{err}
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	request.Header.Set("X-Ishinobu-Hostname", s.options.Hostname)
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode < 300 {
+		s.sent += len(batch)
+		return nil
+	}
+	err = fmt.Errorf("collection server returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+	if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+		return PermanentError{err}
+	}
+	return err
+}
+
+// Close posts the completion manifest of the stream with the number of records delivered
+func (s *HTTPSSink) Close() error {
+	defer s.client.CloseIdleConnections()
+	completion := HTTPSCompletion{
+		Type:        "records",
+		Hostname:    s.options.Hostname,
+		Records:     s.sent,
+		CompletedAt: Now(),
+	}
+	return postCompletion(s.client, httpsManifestURL(s.options), completion)
+}
+
+// postCompletion posts a completion manifest
+func postCompletion(client *http.Client, url string, completion HTTPSCompletion) error {
+	data, err := json.Marshal(completion)
+	if err != nil {
+		return err
+	}
+	_, _, err = httpsPost(client, url, map[string]string{"Content-Type": "application/json"}, func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+	})
+	return err
+}
+
+// httpsPost posts the body returned by open, retrying the network errors and the server errors with an exponential
+// backoff, and returns the body and the headers of the response
+func httpsPost(client *http.Client, url string, headers map[string]string, open func() (io.ReadCloser, int64, error)) ([]byte, http.Header, error) {
+	var err error
+	backoff := time.Second
+	for attempt := 0; attempt <= uploadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		body, length, openErr := open()
+		if openErr != nil {
+			return nil, nil, openErr
+		}
+		var request *http.Request
+		request, err = http.NewRequest(http.MethodPost, url, body)
+		if err != nil {
+			body.Close()
+			return nil, nil, err
+		}
+		request.ContentLength = length
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+
+		var response *http.Response
+		response, err = client.Do(request)
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+		response.Body.Close()
+		if response.StatusCode < 300 {
+			return data, response.Header, nil
+		}
+		err = fmt.Errorf("collection server returned %s: %s", response.Status, strings.TrimSpace(string(data)))
+		if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
+}
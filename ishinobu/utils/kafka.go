@@ -0,0 +1,579 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kafka API keys and versions of the requests of the producer. The versions are supported from Kafka 1.0 to 4.x.
+const (
+	kafkaProduceKey              = 0
+	kafkaProduceVersion          = 3
+	kafkaMetadataKey             = 3
+	kafkaMetadataVersion         = 4
+	kafkaSaslHandshakeKey        = 17
+	kafkaSaslHandshakeVersion    = 1
+	kafkaSaslAuthenticateKey     = 36
+	kafkaSaslAuthenticateVersion = 0
+	kafkaClientID                = "ishinobu"
+)
+
+// Kafka error codes that clear once the cluster elects a leader or creates the topic
+var kafkaRetriableErrors = map[int16]bool{
+	-1: true, // UNKNOWN_SERVER_ERROR
+	2:  true, // CORRUPT_MESSAGE
+	3:  true, // UNKNOWN_TOPIC_OR_PARTITION
+	5:  true, // LEADER_NOT_AVAILABLE
+	6:  true, // NOT_LEADER_OR_FOLLOWER
+	7:  true, // REQUEST_TIMED_OUT
+	8:  true, // BROKER_NOT_AVAILABLE
+	13: true, // NETWORK_EXCEPTION
+	19: true, // NOT_ENOUGH_REPLICAS
+	20: true, // NOT_ENOUGH_REPLICAS_AFTER_APPEND
+	56: true, // KAFKA_STORAGE_ERROR
+}
+
+var kafkaTopicRegex = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// KafkaSink produces the records to Kafka, in a single topic or in one topic per module (<topic>-<module>). The
+// value of the messages is the JSON document of the record, which has a module field, and the key is the hostname
+// so that the records of a host stay ordered in one partition.
+type KafkaSink struct {
+	brokers        []string
+	topic          string
+	topicPerModule bool
+	hostname       string
+	tlsConfig      *tls.Config
+	username       string
+	password       string
+	conns          map[int32]*kafkaConn
+	addresses      map[int32]string
+	// Leader of each partition of the topics, cleared when a produce request fails
+	leaders map[string][]int32
+}
+
+// NewKafkaSink returns a sink producing to the cluster of the bootstrap brokers (host:port, comma separated). SASL
+// PLAIN authentication is used when username is set, and TLS when tlsConfig is not nil.
+func NewKafkaSink(brokers, topic string, topicPerModule bool, hostname string, tlsConfig *tls.Config, username, password string) (*KafkaSink, error) {
+	var addresses []string
+	for _, broker := range strings.Split(brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			addresses = append(addresses, broker)
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("kafka sink requires at least one broker")
+	}
+	if topic == "" {
+		topic = "ishinobu"
+	}
+	return &KafkaSink{
+		brokers:        addresses,
+		topic:          kafkaTopicRegex.ReplaceAllString(topic, "_"),
+		topicPerModule: topicPerModule,
+		hostname:       hostname,
+		tlsConfig:      tlsConfig,
+		username:       username,
+		password:       password,
+		conns:          make(map[int32]*kafkaConn),
+		addresses:      make(map[int32]string),
+		leaders:        make(map[string][]int32),
+	}, nil
+}
+
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Send produces a batch with one request per partition leader. The records of the partitions that failed are
+// returned in a PartialError.
+func (s *KafkaSink) Send(batch []SinkRecord) error {
+	var missing []string
+	for _, item := range batch {
+		topic := s.topicName(item.Module)
+		if _, ok := s.leaders[topic]; !ok && !containsString(missing, topic) {
+			missing = append(missing, topic)
+		}
+	}
+	if len(missing) > 0 {
+		if err := s.metadata(missing); err != nil {
+			return err
+		}
+	}
+
+	// Records of each partition of each topic, grouped by leader
+	groups := make(map[int32]map[string]map[int32][]int)
+	var failed []SinkRecord
+	for i, item := range batch {
+		topic := s.topicName(item.Module)
+		partitions := s.leaders[topic]
+		if len(partitions) == 0 {
+			failed = append(failed, item)
+			continue
+		}
+		partition := int32(crc32.ChecksumIEEE([]byte(s.hostname)) % uint32(len(partitions)))
+		leader := partitions[partition]
+		if leader < 0 {
+			delete(s.leaders, topic)
+			failed = append(failed, item)
+			continue
+		}
+		if groups[leader] == nil {
+			groups[leader] = make(map[string]map[int32][]int)
+		}
+		if groups[leader][topic] == nil {
+			groups[leader][topic] = make(map[int32][]int)
+		}
+		groups[leader][topic][partition] = append(groups[leader][topic][partition], i)
+	}
+
+	var lastErr error
+	retriable := len(failed) > 0
+	for leader, topics := range groups {
+		errorCodes, err := s.produce(leader, batch, topics)
+		if err != nil {
+			lastErr = err
+			retriable = true
+			for topic, partitions := range topics {
+				delete(s.leaders, topic)
+				for _, indexes := range partitions {
+					for _, i := range indexes {
+						failed = append(failed, batch[i])
+					}
+				}
+			}
+			continue
+		}
+		for topic, partitions := range topics {
+			for partition, indexes := range partitions {
+				code := errorCodes[topic][partition]
+				if code == 0 {
+					continue
+				}
+				lastErr = fmt.Errorf("kafka returned error code %d for %s/%d", code, topic, partition)
+				if kafkaRetriableErrors[code] {
+					retriable = true
+					delete(s.leaders, topic)
+				}
+				for _, i := range indexes {
+					failed = append(failed, batch[i])
+				}
+			}
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no leader available")
+	}
+	err := fmt.Errorf("kafka did not accept %d records: %v", len(failed), lastErr)
+	if !retriable {
+		err = PermanentError{err}
+	}
+	return PartialError{Failed: failed, Err: err}
+}
+
+// topicName returns the topic of the records of a module
+func (s *KafkaSink) topicName(module string) string {
+	if !s.topicPerModule {
+		return s.topic
+	}
+	return s.topic + "-" + kafkaTopicRegex.ReplaceAllString(module, "_")
+}
+
+// metadata refreshes the brokers of the cluster and the partition leaders of the topics from the first broker
+// that answers
+func (s *KafkaSink) metadata(topics []string) error {
+	body := &kafkaEncoder{}
+	body.int32(int32(len(topics)))
+	for _, topic := range topics {
+		body.string(topic)
+	}
+	// Topics are created when the brokers allow it, the producer retries until the leaders are elected
+	body.int8(1)
+
+	candidates := append([]string{}, s.brokers...)
+	for _, address := range s.addresses {
+		candidates = append(candidates, address)
+	}
+
+	var lastErr error
+	for _, address := range candidates {
+		conn, err := s.connect(address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		response, err := conn.request(kafkaMetadataKey, kafkaMetadataVersion, body.Bytes())
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		response.int32() // throttle_time_ms
+		for i, count := int32(0), response.int32(); i < count && response.err == nil; i++ {
+			nodeID := response.int32()
+			host := response.string()
+			port := response.int32()
+			response.string() // rack
+			s.addresses[nodeID] = net.JoinHostPort(host, fmt.Sprintf("%d", port))
+		}
+		response.string() // cluster_id
+		response.int32()  // controller_id
+		for i, count := int32(0), response.int32(); i < count && response.err == nil; i++ {
+			code := response.int16()
+			topic := response.string()
+			response.int8() // is_internal
+			var leaders []int32
+			for j, partitions := int32(0), response.int32(); j < partitions && response.err == nil; j++ {
+				response.int16() // error_code
+				partition := response.int32()
+				leader := response.int32()
+				response.int32Array() // replica_nodes
+				response.int32Array() // isr_nodes
+				for int32(len(leaders)) <= partition {
+					leaders = append(leaders, -1)
+				}
+				leaders[partition] = leader
+			}
+			switch {
+			case code == 29:
+				lastErr = PermanentError{fmt.Errorf("not authorized to produce to topic %s", topic)}
+			case code != 0:
+				lastErr = fmt.Errorf("kafka returned error code %d for topic %s", code, topic)
+			case len(leaders) > 0:
+				s.leaders[topic] = leaders
+			}
+		}
+		if response.err != nil {
+			return fmt.Errorf("error decoding the metadata response: %v", response.err)
+		}
+		for _, topic := range topics {
+			if _, ok := s.leaders[topic]; !ok {
+				return lastErr
+			}
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// produce sends the records of the partitions led by a broker and returns the error code of each partition
+func (s *KafkaSink) produce(leader int32, batch []SinkRecord, topics map[string]map[int32][]int) (map[string]map[int32]int16, error) {
+	conn, ok := s.conns[leader]
+	if !ok {
+		address, known := s.addresses[leader]
+		if !known {
+			return nil, fmt.Errorf("unknown broker %d", leader)
+		}
+		var err error
+		if conn, err = s.connect(address); err != nil {
+			return nil, err
+		}
+		s.conns[leader] = conn
+	}
+
+	body := &kafkaEncoder{}
+	body.int16(-1) // transactional_id
+	body.int16(-1) // acks from all the in-sync replicas
+	body.int32(30000)
+	body.int32(int32(len(topics)))
+	for topic, partitions := range topics {
+		body.string(topic)
+		body.int32(int32(len(partitions)))
+		for partition, indexes := range partitions {
+			records := make([]SinkRecord, 0, len(indexes))
+			for _, i := range indexes {
+				records = append(records, batch[i])
+			}
+			recordBatch, err := s.recordBatch(records, time.Now().UnixMilli())
+			if err != nil {
+				return nil, PermanentError{err}
+			}
+			body.int32(partition)
+			body.bytes(recordBatch)
+		}
+	}
+
+	response, err := conn.request(kafkaProduceKey, kafkaProduceVersion, body.Bytes())
+	if err != nil {
+		conn.Close()
+		delete(s.conns, leader)
+		return nil, err
+	}
+	codes := make(map[string]map[int32]int16)
+	for i, count := int32(0), response.int32(); i < count && response.err == nil; i++ {
+		topic := response.string()
+		codes[topic] = make(map[int32]int16)
+		for j, partitions := int32(0), response.int32(); j < partitions && response.err == nil; j++ {
+			partition := response.int32()
+			codes[topic][partition] = response.int16()
+			response.int64() // base_offset
+			response.int64() // log_append_time_ms
+		}
+	}
+	if response.err != nil {
+		conn.Close()
+		delete(s.conns, leader)
+		return nil, fmt.Errorf("error decoding the produce response: %v", response.err)
+	}
+	return codes, nil
+}
+
+// recordBatch encodes records in a record batch (magic 2) with the timestamp in milliseconds. The timestamp of the
+// messages is the time they are produced, so that old events are not removed right away by the retention of the topic.
+func (s *KafkaSink) recordBatch(records []SinkRecord, timestamp int64) ([]byte, error) {
+	body := &kafkaEncoder{}
+	body.int16(0) // attributes: no compression, create time
+	body.int32(int32(len(records) - 1))
+	body.int64(timestamp)
+	body.int64(timestamp)
+	body.int64(-1) // producer_id
+	body.int16(-1) // producer_epoch
+	body.int32(-1) // base_sequence
+	body.int32(int32(len(records)))
+	for i, item := range records {
+		value, err := json.Marshal(RecordDocument(item.Module, item.Record))
+		if err != nil {
+			return nil, err
+		}
+		record := &kafkaEncoder{}
+		record.int8(0) // attributes
+		record.varint(0)
+		record.varint(int64(i))
+		record.varint(int64(len(s.hostname)))
+		record.Write([]byte(s.hostname))
+		record.varint(int64(len(value)))
+		record.Write(value)
+		record.varint(0) // headers
+		body.varint(int64(record.Len()))
+		body.Write(record.Bytes())
+	}
+
+	batch := &kafkaEncoder{}
+	batch.int64(0)                     // base_offset
+	batch.int32(int32(body.Len() + 9)) // length from the partition leader epoch
+	batch.int32(-1)                    // partition_leader_epoch
+	batch.int8(2)                      // magic
+	batch.int32(int32(crc32.Checksum(body.Bytes(), crc32.MakeTable(crc32.Castagnoli))))
+	batch.Write(body.Bytes())
+	return batch.Bytes(), nil
+}
+
+// connect opens a connection to a broker, authenticated with SASL PLAIN when a username is set
+func (s *KafkaSink) connect(address string) (*kafkaConn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if s.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &kafkaConn{conn: conn}
+	if s.username == "" {
+		return c, nil
+	}
+
+	body := &kafkaEncoder{}
+	body.string("PLAIN")
+	response, err := c.request(kafkaSaslHandshakeKey, kafkaSaslHandshakeVersion, body.Bytes())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if code := response.int16(); code != 0 {
+		c.Close()
+		return nil, PermanentError{fmt.Errorf("kafka broker %s does not support SASL PLAIN (error code %d)", address, code)}
+	}
+
+	body = &kafkaEncoder{}
+	body.bytes([]byte("\x00" + s.username + "\x00" + s.password))
+	response, err = c.request(kafkaSaslAuthenticateKey, kafkaSaslAuthenticateVersion, body.Bytes())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if code := response.int16(); code != 0 {
+		message := response.string()
+		c.Close()
+		return nil, PermanentError{fmt.Errorf("kafka authentication failed (error code %d): %s", code, message)}
+	}
+	return c, nil
+}
+
+func (s *KafkaSink) Close() error {
+	for leader, conn := range s.conns {
+		conn.Close()
+		delete(s.conns, leader)
+	}
+	return nil
+}
+
+// kafkaConn sends requests to a broker and reads their response
+type kafkaConn struct {
+	conn          net.Conn
+	correlationID int32
+}
+
+// request sends a request and returns the decoder of the response body
+func (c *kafkaConn) request(apiKey, apiVersion int16, body []byte) (*kafkaDecoder, error) {
+	c.correlationID++
+	header := &kafkaEncoder{}
+	header.int32(int32(2 + 2 + 4 + 2 + len(kafkaClientID) + len(body)))
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(c.correlationID)
+	header.string(kafkaClientID)
+
+	c.conn.SetDeadline(time.Now().Add(60 * time.Second))
+	if _, err := c.conn.Write(append(header.Bytes(), body...)); err != nil {
+		return nil, err
+	}
+	var size int32
+	if err := binary.Read(c.conn, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, fmt.Errorf("invalid response size %d", size)
+	}
+	response := make([]byte, size)
+	if _, err := io.ReadFull(c.conn, response); err != nil {
+		return nil, err
+	}
+	decoder := &kafkaDecoder{data: response}
+	if correlationID := decoder.int32(); correlationID != c.correlationID {
+		return nil, fmt.Errorf("unexpected correlation id %d", correlationID)
+	}
+	return decoder, nil
+}
+
+func (c *kafkaConn) Close() error {
+	return c.conn.Close()
+}
+
+// kafkaEncoder writes the big-endian primitives of the Kafka protocol
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) varint(v int64) {
+	e.Write(binary.AppendVarint(nil, v))
+}
+
+func (e *kafkaEncoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.WriteString(v)
+}
+
+func (e *kafkaEncoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.Write(v)
+}
+
+// kafkaDecoder reads the primitives of a response, keeping the first error
+type kafkaDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.pos+n > len(d.data) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string, or a nullable string that is returned empty
+func (d *kafkaDecoder) string() string {
+	length := d.int16()
+	if length < 0 {
+		return ""
+	}
+	return string(d.next(int(length)))
+}
+
+func (d *kafkaDecoder) int32Array() []int32 {
+	count := d.int32()
+	var values []int32
+	for i := int32(0); i < count && d.err == nil; i++ {
+		values = append(values, d.int32())
+	}
+	return values
+}
+
+// containsString reports whether a slice contains a string
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKafkaRecordBatch(t *testing.T) {
+	// Reference encoding of the two records below, built from the record batch specification (magic 2)
+	reference, err := os.ReadFile(filepath.Join("testdata", "kafka_record_batch.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []SinkRecord{
+		{Module: "ps", Record: Record{CollectionTimestamp: "2024-01-01T00:00:00Z", EventTimestamp: "2024-01-01T00:00:00Z", SourceFile: "ps", Data: map[string]interface{}{"pid": 1}}},
+		{Module: "ps", Record: Record{CollectionTimestamp: "2024-01-01T00:00:00Z", EventTimestamp: "2024-01-01T00:00:00Z", SourceFile: "ps", Data: map[string]interface{}{"pid": 2}}},
+	}
+	sink := &KafkaSink{hostname: "mac01"}
+	got, err := sink.recordBatch(records, 1700000000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, reference) {
+		t.Errorf("recordBatch() =\n%x\nwant\n%x", got, reference)
+	}
+}
+
+func TestKafkaVarint(t *testing.T) {
+	tests := []struct {
+		value int64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{-1, []byte{0x01}},
+		{1, []byte{0x02}},
+		{63, []byte{0x7e}},
+		{-64, []byte{0x7f}},
+		{64, []byte{0x80, 0x01}},
+		{300, []byte{0xd8, 0x04}},
+	}
+
+	for _, tt := range tests {
+		encoder := &kafkaEncoder{}
+		encoder.varint(tt.value)
+		if !bytes.Equal(encoder.Bytes(), tt.want) {
+			t.Errorf("varint(%d) = %x, want %x", tt.value, encoder.Bytes(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"howett.net/plist"
+)
+
+// Maximum nesting resolved from an archive, protects against reference cycles
+const keyedArchiveMaxDepth = 64
+
+// DecodeKeyedArchive decodes an NSKeyedArchiver plist (used by .sfl2/.sfl3 files among others)
+// and returns its root object with every UID reference resolved.
+// NSDictionary and NSArray objects are returned as map[string]interface{} and []interface{},
+// NSString and NSURL as string, NSDate as time.Time and NSData as []byte.
+// Other objects are returned as maps with their "$class" name.
+func DecodeKeyedArchive(data []byte) (interface{}, error) {
+	var archive map[string]interface{}
+	if _, err := plist.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("error decoding plist: %v", err)
+	}
+
+	if archiver, _ := archive["$archiver"].(string); archiver != "NSKeyedArchiver" {
+		return nil, fmt.Errorf("not an NSKeyedArchiver archive")
+	}
+
+	objects, ok := archive["$objects"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("archive has no $objects")
+	}
+
+	top, ok := archive["$top"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("archive has no $top")
+	}
+
+	root, ok := top["root"]
+	if !ok {
+		for _, value := range top {
+			root = value
+			break
+		}
+	}
+
+	decoder := keyedArchiveDecoder{objects: objects}
+	return decoder.resolve(root, 0), nil
+}
+
+type keyedArchiveDecoder struct {
+	objects []interface{}
+}
+
+func (d keyedArchiveDecoder) resolve(value interface{}, depth int) interface{} {
+	if depth > keyedArchiveMaxDepth {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case plist.UID:
+		if int(v) >= len(d.objects) {
+			return nil
+		}
+		object := d.objects[v]
+		if s, ok := object.(string); ok && s == "$null" {
+			return nil
+		}
+		return d.resolve(object, depth+1)
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, d.resolve(item, depth+1))
+		}
+		return result
+	case map[string]interface{}:
+		return d.resolveObject(v, depth)
+	}
+
+	return value
+}
+
+func (d keyedArchiveDecoder) resolveObject(object map[string]interface{}, depth int) interface{} {
+	keys, hasKeys := object["NS.keys"].([]interface{})
+	values, hasValues := object["NS.objects"].([]interface{})
+
+	switch {
+	case hasKeys && hasValues:
+		result := make(map[string]interface{}, len(keys))
+		for i, key := range keys {
+			if i >= len(values) {
+				break
+			}
+			result[fmt.Sprintf("%v", d.resolve(key, depth+1))] = d.resolve(values[i], depth+1)
+		}
+		return result
+	case hasValues:
+		return d.resolve(values, depth)
+	}
+
+	if s, ok := object["NS.string"]; ok {
+		return d.resolve(s, depth+1)
+	}
+	if relative, ok := object["NS.relative"]; ok {
+		url := fmt.Sprintf("%v", d.resolve(relative, depth+1))
+		if base, ok := d.resolve(object["NS.base"], depth+1).(string); ok && base != "" {
+			url = base + url
+		}
+		return url
+	}
+	if t, ok := object["NS.time"].(float64); ok {
+		return time.Unix(int64(t)+cfAbsoluteTimeOffset, 0).UTC()
+	}
+	if data, ok := object["NS.bytes"]; ok {
+		return d.resolve(data, depth+1)
+	}
+	if data, ok := object["NS.data"]; ok {
+		return d.resolve(data, depth+1)
+	}
+	if uuid, ok := object["NS.uuidbytes"].([]byte); ok && len(uuid) == 16 {
+		return fmt.Sprintf("%X-%X-%X-%X-%X", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+	}
+
+	result := make(map[string]interface{}, len(object))
+	for key, item := range object {
+		if key == "$class" {
+			result[key] = d.className(item)
+			continue
+		}
+		result[key] = d.resolve(item, depth+1)
+	}
+	return result
+}
+
+func (d keyedArchiveDecoder) className(value interface{}) string {
+	uid, ok := value.(plist.UID)
+	if !ok || int(uid) >= len(d.objects) {
+		return ""
+	}
+	class, ok := d.objects[uid].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := class["$classname"].(string)
+	return name
+}
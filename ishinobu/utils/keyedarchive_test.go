@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeKeyedArchive(t *testing.T) {
+	sample, err := os.ReadFile(filepath.Join("testdata", "keyedarchive.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     interface{}
+		maxDepth int
+		wantErr  bool
+	}{
+		{
+			name: "dictionary with URL, date and null",
+			data: sample,
+			want: map[string]interface{}{
+				"URL":     "file:///Users/alice/report.pdf",
+				"visited": time.Date(2023, 3, 8, 20, 26, 40, 0, time.UTC),
+				"missing": nil,
+			},
+		},
+		{
+			name: "reference cycle",
+			data: []byte(`<plist version="1.0"><dict>
+				<key>$archiver</key><string>NSKeyedArchiver</string>
+				<key>$objects</key><array><string>$null</string>
+					<dict><key>NS.objects</key><array><dict><key>CF$UID</key><integer>1</integer></dict></array></dict>
+				</array>
+				<key>$top</key><dict><key>root</key><dict><key>CF$UID</key><integer>1</integer></dict></dict>
+				</dict></plist>`),
+			maxDepth: keyedArchiveMaxDepth,
+		},
+		{
+			name:    "plist that is not an archive",
+			data:    []byte(`<plist version="1.0"><dict><key>name</key><string>value</string></dict></plist>`),
+			wantErr: true,
+		},
+		{
+			name:    "not a plist",
+			data:    []byte("bplist00\x01"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeKeyedArchive(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeKeyedArchive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeKeyedArchive() = %#v, want %#v", got, tt.want)
+			}
+			if tt.maxDepth > 0 {
+				if depth := arrayDepth(got); depth == 0 || depth > tt.maxDepth {
+					t.Errorf("resolved cycle depth = %d, want between 1 and %d", depth, tt.maxDepth)
+				}
+			}
+		})
+	}
+}
+
+// arrayDepth returns the number of nested arrays of a decoded value
+func arrayDepth(value interface{}) int {
+	depth := 0
+	for {
+		items, ok := value.([]interface{})
+		if !ok || len(items) == 0 {
+			return depth
+		}
+		depth++
+		value = items[0]
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// MachOInfo holds the load commands of a Mach-O binary that describe which libraries it loads.
+// For universal binaries the commands of every architecture are merged.
+type MachOInfo struct {
+	CPUs           []string
+	Dylibs         []string // LC_LOAD_DYLIB
+	WeakDylibs     []string // LC_LOAD_WEAK_DYLIB
+	ReexportDylibs []string // LC_REEXPORT_DYLIB
+	Rpaths         []string // LC_RPATH
+}
+
+// Load commands not decoded by debug/macho
+const (
+	machoLoadWeakDylib   = 0x80000018
+	machoRpath           = 0x8000001c
+	machoReexportDylib   = 0x8000001f
+	machoLoadDylib       = 0x0000000c
+	machoLoadUpwardDylib = 0x80000023
+)
+
+// ParseMachO reads the header and load commands of a thin or universal Mach-O file.
+func ParseMachO(path string) (MachOInfo, error) {
+	info := MachOInfo{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+
+	var files []*macho.File
+	if fat, err := macho.NewFatFile(file); err == nil {
+		for _, arch := range fat.Arches {
+			files = append(files, arch.File)
+		}
+	} else {
+		thin, err := macho.NewFile(file)
+		if err != nil {
+			return info, fmt.Errorf("not a Mach-O file: %v", err)
+		}
+		files = append(files, thin)
+	}
+
+	seen := make(map[string]bool)
+	add := func(list *[]string, kind string, value string) {
+		if value == "" || seen[kind+value] {
+			return
+		}
+		seen[kind+value] = true
+		*list = append(*list, value)
+	}
+
+	for _, f := range files {
+		info.CPUs = append(info.CPUs, f.Cpu.String())
+		for _, load := range f.Loads {
+			raw := load.Raw()
+			if len(raw) < 12 {
+				continue
+			}
+			cmd := f.ByteOrder.Uint32(raw[0:4])
+			// dylib_command and rpath_command store the offset of their string at byte 8
+			name := machoLoadString(raw, f.ByteOrder)
+			switch cmd {
+			case machoLoadDylib, machoLoadUpwardDylib:
+				add(&info.Dylibs, "dylib", name)
+			case machoLoadWeakDylib:
+				add(&info.WeakDylibs, "weak", name)
+			case machoReexportDylib:
+				add(&info.ReexportDylibs, "reexport", name)
+			case machoRpath:
+				add(&info.Rpaths, "rpath", name)
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// machoLoadString returns the NUL terminated string referenced by the offset at byte 8 of a load command
+func machoLoadString(raw []byte, byteOrder binary.ByteOrder) string {
+	offset := int(byteOrder.Uint32(raw[8:12]))
+	if offset < 12 || offset >= len(raw) {
+		return ""
+	}
+	value := raw[offset:]
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return string(value)
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMachO(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    MachOInfo
+		wantErr bool
+	}{
+		{
+			name: "thin binary",
+			file: "macho_thin.dylib",
+			want: MachOInfo{
+				CPUs:           []string{"CpuAmd64"},
+				Dylibs:         []string{"/usr/lib/libSystem.B.dylib"},
+				WeakDylibs:     []string{"@rpath/libweak.dylib"},
+				ReexportDylibs: []string{"/usr/lib/libreexport.dylib"},
+				Rpaths:         []string{"@loader_path/../Frameworks"},
+			},
+		},
+		{
+			name: "universal binary merges the architectures",
+			file: "macho_universal.dylib",
+			want: MachOInfo{
+				CPUs:           []string{"CpuAmd64", "CpuArm64"},
+				Dylibs:         []string{"/usr/lib/libSystem.B.dylib", "/tmp/libinjected.dylib"},
+				WeakDylibs:     []string{"@rpath/libweak.dylib"},
+				ReexportDylibs: []string{"/usr/lib/libreexport.dylib"},
+				Rpaths:         []string{"@loader_path/../Frameworks"},
+			},
+		},
+		{
+			name:    "load commands past the end of the file",
+			file:    "macho_truncated.dylib",
+			wantErr: true,
+		},
+		{
+			name:    "not a Mach-O file",
+			file:    "bsm_record.bsm",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMachO(filepath.Join("testdata", tt.file))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMachO() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMachO() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"os/exec"
 	"strings"
 )
@@ -20,3 +21,21 @@ func GetHostname() (string, error) {
 	}
 	return strings.TrimSpace(string(out)), nil
 }
+
+// GetSerialNumber returns the hardware serial number from the IOPlatformExpertDevice registry entry.
+func GetSerialNumber() (string, error) {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, "\"IOPlatformSerialNumber\"") {
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) == 2 {
+				return strings.Trim(strings.TrimSpace(parts[1]), "\""), nil
+			}
+		}
+	}
+	return "", errors.New("serial number not found")
+}
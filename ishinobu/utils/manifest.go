@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+const ManifestFileName = "manifest.json"
+
+// RunManifest describes a collection run and is stored next to the module outputs.
+type RunManifest struct {
+	Hostname            string            `json:"hostname"`
+	SerialNumber        string            `json:"serial_number"`
+	MacOSVersion        string            `json:"macos_version"`
+	CollectionTimestamp string            `json:"collection_timestamp"`
+	EndTimestamp        string            `json:"end_timestamp"`
+	ExportFormat        string            `json:"export_format"`
+	Modules             map[string]string `json:"modules"`
+	Sinks               map[string]string `json:"sinks,omitempty"`
+}
+
+// WriteManifest writes the run manifest as JSON into dir.
+func WriteManifest(dir string, manifest RunManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFileName), data, 0644)
+}
+
+// ReadManifest reads the run manifest stored in dir.
+func ReadManifest(dir string) (RunManifest, error) {
+	var manifest RunManifest
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	return manifest, err
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// OpenPGPKey holds the metadata of a public key or subkey of an OpenPGP keyring.
+// User IDs are the ones following the primary key; subkeys have none.
+type OpenPGPKey struct {
+	Fingerprint string
+	KeyID       string
+	Algorithm   string
+	Bits        int
+	Created     string
+	Subkey      bool
+	PrimaryID   string
+	UserIDs     []string
+}
+
+// OpenPGP packet tags
+const (
+	openPGPTagPublicKey    = 6
+	openPGPTagUserID       = 13
+	openPGPTagPublicSubkey = 14
+)
+
+// OpenPGP public key algorithms
+var openPGPAlgorithms = map[byte]string{
+	1:  "RSA",
+	2:  "RSA",
+	3:  "RSA",
+	16: "Elgamal",
+	17: "DSA",
+	18: "ECDH",
+	19: "ECDSA",
+	22: "EdDSA",
+	25: "X25519",
+	27: "Ed25519",
+}
+
+// ParseOpenPGPKeys returns the public keys and subkeys of an OpenPGP keyring (a sequence of packets,
+// as in pubring.gpg or the keyblocks of a keybox).
+func ParseOpenPGPKeys(data []byte) []OpenPGPKey {
+	var keys []OpenPGPKey
+	primary := -1
+	for len(data) > 0 {
+		tag, body, rest, ok := nextOpenPGPPacket(data)
+		if !ok {
+			break
+		}
+		data = rest
+
+		switch tag {
+		case openPGPTagPublicKey, openPGPTagPublicSubkey:
+			key, ok := parseOpenPGPPublicKey(body)
+			if !ok {
+				continue
+			}
+			key.Subkey = tag == openPGPTagPublicSubkey
+			if key.Subkey && primary >= 0 {
+				key.PrimaryID = keys[primary].KeyID
+			}
+			keys = append(keys, key)
+			if !key.Subkey {
+				primary = len(keys) - 1
+			}
+		case openPGPTagUserID:
+			if primary >= 0 {
+				keys[primary].UserIDs = append(keys[primary].UserIDs, string(body))
+			}
+		}
+	}
+	return keys
+}
+
+// ParseKeybox returns the OpenPGP keyblocks of a GnuPG keybox file (pubring.kbx)
+func ParseKeybox(data []byte) [][]byte {
+	var keyblocks [][]byte
+	for len(data) >= 16 {
+		length := int(binary.BigEndian.Uint32(data[0:4]))
+		if length < 16 || length > len(data) {
+			break
+		}
+		blob := data[:length]
+		data = data[length:]
+
+		// blob type 2 is an OpenPGP keyblock, offset and length are relative to the blob
+		if blob[4] != 2 {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(blob[8:12]))
+		size := int(binary.BigEndian.Uint32(blob[12:16]))
+		if offset+size > len(blob) || offset < 0 || size < 0 {
+			continue
+		}
+		keyblocks = append(keyblocks, blob[offset:offset+size])
+	}
+	return keyblocks
+}
+
+// nextOpenPGPPacket returns the tag and body of the first packet and the remaining data.
+// Partial body lengths are not supported as they are not used by key packets.
+func nextOpenPGPPacket(data []byte) (int, []byte, []byte, bool) {
+	if len(data) < 2 || data[0]&0x80 == 0 {
+		return 0, nil, nil, false
+	}
+
+	var tag, length, header int
+	if data[0]&0x40 != 0 {
+		// new format
+		tag = int(data[0] & 0x3f)
+		switch first := int(data[1]); {
+		case first < 192:
+			length, header = first, 2
+		case first < 224:
+			if len(data) < 3 {
+				return 0, nil, nil, false
+			}
+			length, header = (first-192)<<8+int(data[2])+192, 3
+		case first == 255:
+			if len(data) < 6 {
+				return 0, nil, nil, false
+			}
+			length, header = int(binary.BigEndian.Uint32(data[2:6])), 6
+		default:
+			return 0, nil, nil, false
+		}
+	} else {
+		// old format
+		tag = int(data[0]>>2) & 0x0f
+		switch data[0] & 0x03 {
+		case 0:
+			length, header = int(data[1]), 2
+		case 1:
+			if len(data) < 3 {
+				return 0, nil, nil, false
+			}
+			length, header = int(binary.BigEndian.Uint16(data[1:3])), 3
+		case 2:
+			if len(data) < 5 {
+				return 0, nil, nil, false
+			}
+			length, header = int(binary.BigEndian.Uint32(data[1:5])), 5
+		default:
+			length, header = len(data)-1, 1
+		}
+	}
+	if length < 0 || header+length > len(data) {
+		return 0, nil, nil, false
+	}
+	return tag, data[header : header+length], data[header+length:], true
+}
+
+// parseOpenPGPPublicKey parses a public key packet body: version, creation time, algorithm and key material.
+// The fingerprint and key ID are computed for version 4 keys.
+func parseOpenPGPPublicKey(body []byte) (OpenPGPKey, bool) {
+	if len(body) < 6 {
+		return OpenPGPKey{}, false
+	}
+	key := OpenPGPKey{
+		Created:   ConvertUnixTimestamp(int64(binary.BigEndian.Uint32(body[1:5]))),
+		Algorithm: openPGPAlgorithms[body[5]],
+	}
+
+	material := body[6:]
+	if body[0] != 4 {
+		// version 5 and 6 keys store the length of the key material first
+		if len(material) < 4 {
+			return key, true
+		}
+		material = material[4:]
+	}
+	if key.Algorithm == "RSA" || key.Algorithm == "DSA" || key.Algorithm == "Elgamal" {
+		// the first MPI is the modulus or prime, prefixed by its length in bits
+		if len(material) >= 2 {
+			key.Bits = int(binary.BigEndian.Uint16(material[0:2]))
+		}
+	} else if key.Algorithm == "Ed25519" || key.Algorithm == "X25519" || key.Algorithm == "EdDSA" {
+		// reported as 255 bits like GnuPG does
+		key.Bits = 255
+	}
+
+	if body[0] == 4 {
+		hash := sha1.New()
+		hash.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+		hash.Write(body)
+		fingerprint := strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
+		key.Fingerprint = fingerprint
+		key.KeyID = fingerprint[len(fingerprint)-16:]
+	}
+	return key, true
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseOpenPGPKeys(t *testing.T) {
+	keyring, err := os.ReadFile(filepath.Join("testdata", "openpgp_pubring.gpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keybox, err := os.ReadFile(filepath.Join("testdata", "openpgp_pubring.kbx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary := OpenPGPKey{
+		Fingerprint: "F0C5C25046D00EF403A1DA23993684EC7027284D",
+		KeyID:       "993684EC7027284D",
+		Algorithm:   "EdDSA",
+		Bits:        255,
+		Created:     "2026-10-16T18:08:08Z",
+		UserIDs:     []string{"Test Signer <signer@example.com>", "Test Signer <alt@example.com>"},
+	}
+	subkey := OpenPGPKey{
+		Fingerprint: "BC0360096E596DCF5C6D1C6CA9D2001F1F029E2D",
+		KeyID:       "A9D2001F1F029E2D",
+		Algorithm:   "ECDH",
+		Created:     "2026-10-16T18:08:08Z",
+		Subkey:      true,
+		PrimaryID:   "993684EC7027284D",
+	}
+	primaryOnly := primary
+	primaryOnly.UserIDs = nil
+
+	tests := []struct {
+		name string
+		data []byte
+		want []OpenPGPKey
+	}{
+		{
+			name: "exported keyring",
+			data: keyring,
+			want: []OpenPGPKey{primary, subkey},
+		},
+		{
+			name: "keybox keyblock",
+			data: firstKeyblock(t, keybox),
+			want: []OpenPGPKey{primary, subkey},
+		},
+		{
+			name: "packet cut after the primary key",
+			data: keyring[:60],
+			want: []OpenPGPKey{primaryOnly},
+		},
+		{
+			name: "not an OpenPGP packet",
+			data: []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseOpenPGPKeys(tt.data)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOpenPGPKeys() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// firstKeyblock returns the first OpenPGP keyblock of a keybox
+func firstKeyblock(t *testing.T, keybox []byte) []byte {
+	t.Helper()
+	keyblocks := ParseKeybox(keybox)
+	if len(keyblocks) != 1 {
+		t.Fatalf("ParseKeybox() returned %d keyblocks, want 1", len(keyblocks))
+	}
+	return keyblocks[0]
+}
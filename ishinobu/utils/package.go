@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HashesFileName lists the SHA-256 of the files of a packaged collection, in the format of sha256sum
+const HashesFileName = "hashes.sha256"
+
+// PackageOutput compresses the files of a collection folder and of its subfolders into a tar.gz or zip archive,
+// with the run manifest and a hashes.sha256 file listing the SHA-256 of every file. When the folder has no run
+// manifest, one is written with the modules of the outputs found. It returns the number of files packaged.
+func PackageOutput(dir, output, format string) (int, error) {
+	outputPath, err := filepath.Abs(output)
+	if err != nil {
+		return 0, err
+	}
+	var files []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// The archive can be written in the folder
+		if absolute, _ := filepath.Abs(path); absolute == outputPath {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	file, err := os.Create(output)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var writer packageWriter
+	if format == "zip" {
+		writer = &zipPackageWriter{zw: zip.NewWriter(file)}
+	} else {
+		gw := gzip.NewWriter(file)
+		writer = &tarPackageWriter{gw: gw, tw: tar.NewWriter(gw)}
+	}
+
+	var hashes strings.Builder
+	hasManifest := false
+	count := 0
+	manifest := RunManifest{Modules: make(map[string]string)}
+	for _, path := range files {
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return 0, err
+		}
+		name = filepath.ToSlash(name)
+		if name == HashesFileName {
+			continue
+		}
+		if name == ManifestFileName {
+			hasManifest = true
+		}
+		if module, _, ok := moduleOutputName(name); ok {
+			manifest.Modules[module] = "packaged"
+		}
+		checksum, err := FileSHA256(path)
+		if err != nil {
+			return 0, err
+		}
+		if err := writer.addFile(name, path); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(&hashes, "%s  %s\n", checksum, name)
+		count++
+	}
+
+	if !hasManifest {
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return 0, err
+		}
+		if err := writer.addData(ManifestFileName, data); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err := writer.addData(HashesFileName, []byte(hashes.String())); err != nil {
+		return 0, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return count, file.Close()
+}
+
+// SplitFile splits a file into parts of at most size bytes, named <path>.001, <path>.002, ..., which are joined
+// back with cat. It returns the paths of the parts.
+func SplitFile(path string, size int64) ([]string, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid part size: %d", size)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var parts []string
+	for number := 1; ; number++ {
+		name := fmt.Sprintf("%s.%03d", path, number)
+		part, err := os.Create(name)
+		if err != nil {
+			return parts, err
+		}
+		n, err := io.CopyN(part, file, size)
+		part.Close()
+		if n == 0 {
+			os.Remove(name)
+		} else {
+			parts = append(parts, name)
+		}
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return parts, err
+		}
+	}
+}
+
+// ParseSize parses a size in bytes with an optional K, M or G suffix (powers of 1024).
+func ParseSize(value string) (int64, error) {
+	original := value
+	value = strings.ToUpper(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", original)
+	}
+	return size * multiplier, nil
+}
+
+// packageWriter adds files to an archive
+type packageWriter interface {
+	addFile(name, path string) error
+	addData(name string, data []byte) error
+	Close() error
+}
+
+type tarPackageWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (w *tarPackageWriter) addFile(name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(stat, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(w.tw, file)
+	return err
+}
+
+func (w *tarPackageWriter) addData(name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := w.tw.Write(data)
+	return err
+}
+
+func (w *tarPackageWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gw.Close()
+}
+
+type zipPackageWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipPackageWriter) addFile(name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	writer, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+func (w *zipPackageWriter) addData(name string, data []byte) error {
+	writer, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+func (w *zipPackageWriter) Close() error {
+	return w.zw.Close()
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"time"
 
 	"howett.net/plist"
 )
@@ -19,3 +21,26 @@ func ParseBiPList(data string) (map[string]interface{}, error) {
 
 	return result, nil
 }
+
+// ParsePlistFile decodes a binary, XML or OpenStep plist file into v.
+func ParsePlistFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := plist.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding plist %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// FormatPlistDate formats a decoded plist date in TimeFormat.
+// Returns an empty string if the value is not a date.
+func FormatPlistDate(value interface{}) string {
+	if date, ok := value.(time.Time); ok {
+		return date.UTC().Format(TimeFormat)
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ProtobufField is a field decoded from a protocol buffer message without its schema.
+// Varint and fixed values are stored in Value, length-delimited values in Bytes.
+type ProtobufField struct {
+	Number   uint64
+	WireType uint64
+	Value    uint64
+	Bytes    []byte
+}
+
+// Protocol buffer wire types
+const (
+	protobufVarint  = 0
+	protobufFixed64 = 1
+	protobufBytes   = 2
+	protobufFixed32 = 5
+)
+
+// ParseProtobuf decodes the top level fields of a protocol buffer message.
+func ParseProtobuf(data []byte) ([]ProtobufField, error) {
+	var fields []ProtobufField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fields, fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+
+		field := ProtobufField{Number: key >> 3, WireType: key & 0x7}
+		switch field.WireType {
+		case protobufVarint:
+			value, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fields, fmt.Errorf("invalid varint in field %d", field.Number)
+			}
+			field.Value = value
+			data = data[n:]
+		case protobufFixed64:
+			if len(data) < 8 {
+				return fields, fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Value = binary.LittleEndian.Uint64(data[:8])
+			data = data[8:]
+		case protobufBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return fields, fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Bytes = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case protobufFixed32:
+			if len(data) < 4 {
+				return fields, fmt.Errorf("truncated field %d", field.Number)
+			}
+			field.Value = uint64(binary.LittleEndian.Uint32(data[:4]))
+			data = data[4:]
+		default:
+			return fields, fmt.Errorf("unsupported wire type %d in field %d", field.WireType, field.Number)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// ProtobufBytes follows the path of field numbers through nested messages and returns
+// the bytes of the first matching length-delimited field.
+func ProtobufBytes(data []byte, path ...uint64) ([]byte, bool) {
+	for _, number := range path {
+		fields, _ := ParseProtobuf(data)
+		found := false
+		for _, field := range fields {
+			if field.Number == number && field.WireType == protobufBytes {
+				data = field.Bytes
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return data, true
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProtobuf(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []ProtobufField
+		wantErr bool
+	}{
+		{
+			name: "varint",
+			data: []byte{0x08, 0x96, 0x01},
+			want: []ProtobufField{{Number: 1, WireType: protobufVarint, Value: 150}},
+		},
+		{
+			name: "length delimited",
+			data: []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'},
+			want: []ProtobufField{{Number: 2, WireType: protobufBytes, Bytes: []byte("testing")}},
+		},
+		{
+			name: "fixed32 and fixed64",
+			data: []byte{0x1d, 0x01, 0x00, 0x00, 0x00, 0x21, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			want: []ProtobufField{
+				{Number: 3, WireType: protobufFixed32, Value: 1},
+				{Number: 4, WireType: protobufFixed64, Value: 2},
+			},
+		},
+		{
+			name:    "length larger than the message",
+			data:    []byte{0x08, 0x01, 0x12, 0x10, 'a'},
+			want:    []ProtobufField{{Number: 1, WireType: protobufVarint, Value: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "truncated varint",
+			data:    []byte{0x08, 0x96},
+			wantErr: true,
+		},
+		{
+			name:    "group wire type",
+			data:    []byte{0x0b, 0x0c},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProtobuf(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProtobuf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseProtobuf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtobufBytes(t *testing.T) {
+	// Field 1 holds a message whose field 2 is "inner"
+	message := []byte{0x08, 0x01, 0x0a, 0x07, 0x12, 0x05, 'i', 'n', 'n', 'e', 'r'}
+
+	tests := []struct {
+		name   string
+		path   []uint64
+		want   []byte
+		wantOK bool
+	}{
+		{name: "nested field", path: []uint64{1, 2}, want: []byte("inner"), wantOK: true},
+		{name: "varint field is not bytes", path: []uint64{1, 1}},
+		{name: "missing field", path: []uint64{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ProtobufBytes(message, tt.path...)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProtobufBytes() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Size of the parts of the multipart uploads, the archives up to this size are sent in a single request
+	s3PartSize = 16 << 20
+)
+
+// S3Options configures the upload of the collection archives to S3-compatible storage.
+type S3Options struct {
+	// Endpoint of S3-compatible storage (https://minio:9000), addressed with path-style URLs. Empty for AWS.
+	Endpoint     string
+	Region       string
+	Bucket       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Insecure     bool
+}
+
+// S3Uploader uploads the collection archives to a bucket with requests signed with AWS Signature Version 4.
+type S3Uploader struct {
+	options  S3Options
+	scheme   string
+	host     string
+	basePath string
+	client   *http.Client
+}
+
+// NewS3Uploader returns an uploader to the bucket of the options.
+func NewS3Uploader(options S3Options) (*S3Uploader, error) {
+	if options.Bucket == "" || options.AccessKey == "" || options.SecretKey == "" {
+		return nil, fmt.Errorf("s3 upload requires a bucket, an access key and a secret key")
+	}
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	options.Prefix = strings.Trim(options.Prefix, "/")
+
+	uploader := &S3Uploader{
+		options: options,
+		scheme:  "https",
+		host:    fmt.Sprintf("%s.s3.%s.amazonaws.com", options.Bucket, options.Region),
+		client: &http.Client{
+			Timeout:   10 * time.Minute,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: options.Insecure}},
+		},
+	}
+	if options.Endpoint != "" {
+		endpoint, err := url.Parse(options.Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid s3 endpoint: %s", options.Endpoint)
+		}
+		uploader.scheme = endpoint.Scheme
+		uploader.host = endpoint.Host
+		uploader.basePath = strings.TrimSuffix(endpoint.Path, "/") + "/" + options.Bucket
+	}
+	return uploader, nil
+}
+
+func (u *S3Uploader) Name() string {
+	return "s3"
+}
+
+// Upload sends the archive with a multipart upload when it is larger than a part. Each part is sent with its MD5,
+// which the storage verifies, and the size and the ETag of the object are checked against the archive once it is
+// uploaded. The SHA-256 of the archive is stored in the sha256 metadata of the object.
+func (u *S3Uploader) Upload(path string) (string, error) {
+	checksum, err := FileSHA256(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := filepath.Base(path)
+	if u.options.Prefix != "" {
+		key = u.options.Prefix + "/" + key
+	}
+	metadata := map[string]string{
+		"Content-Type":      "application/octet-stream",
+		"X-Amz-Meta-Sha256": checksum,
+	}
+
+	var expectedETag string
+	if info.Size() <= s3PartSize {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		sum := md5.Sum(data)
+		if _, _, err := u.do(http.MethodPut, key, nil, contentMD5(metadata, sum[:]), data); err != nil {
+			return "", err
+		}
+		expectedETag = hex.EncodeToString(sum[:])
+	} else {
+		if expectedETag, err = u.multipartUpload(path, key, metadata); err != nil {
+			return "", err
+		}
+	}
+
+	_, header, err := u.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("error verifying the upload: %v", err)
+	}
+	if header.Get("Content-Length") != fmt.Sprintf("%d", info.Size()) {
+		return "", fmt.Errorf("uploaded object size %s does not match the archive size %d", header.Get("Content-Length"), info.Size())
+	}
+	// The ETag of objects encrypted with KMS keys is not their MD5
+	etag := strings.Trim(header.Get("ETag"), `"`)
+	if header.Get("X-Amz-Server-Side-Encryption") != "aws:kms" && etag != expectedETag {
+		return "", fmt.Errorf("uploaded object checksum %s does not match the archive checksum %s", etag, expectedETag)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", u.options.Bucket, key), nil
+}
+
+// multipartUpload uploads a file in parts and returns the expected ETag of the object. The upload is aborted when
+// a part cannot be sent.
+func (u *S3Uploader) multipartUpload(path, key string, metadata map[string]string) (string, error) {
+	body, _, err := u.do(http.MethodPost, key, url.Values{"uploads": {""}}, metadata, nil)
+	if err != nil {
+		return "", fmt.Errorf("error starting the multipart upload: %v", err)
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &initiate); err != nil || initiate.UploadID == "" {
+		return "", fmt.Errorf("error reading the multipart upload id: %v", err)
+	}
+	uploadID := initiate.UploadID
+
+	etag, err := u.uploadParts(path, key, uploadID)
+	if err != nil {
+		u.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		return "", err
+	}
+	return etag, nil
+}
+
+// uploadParts sends the parts of a multipart upload and completes it
+func (u *S3Uploader) uploadParts(path, key, uploadID string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []completedPart
+	var sums []byte
+	buffer := make([]byte, s3PartSize)
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(file, buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		sum := md5.Sum(buffer[:n])
+		query := url.Values{"partNumber": {fmt.Sprintf("%d", number)}, "uploadId": {uploadID}}
+		_, header, err := u.do(http.MethodPut, key, query, contentMD5(nil, sum[:]), buffer[:n])
+		if err != nil {
+			return "", fmt.Errorf("error uploading part %d: %v", number, err)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: header.Get("ETag")})
+		sums = append(sums, sum[:]...)
+	}
+
+	complete, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return "", err
+	}
+	body, _, err := u.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, complete)
+	if err != nil {
+		return "", fmt.Errorf("error completing the multipart upload: %v", err)
+	}
+	// The completion can fail after the status is sent, the error is then in the body
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(body, &result) == nil && result.XMLName.Local == "Error" {
+		return "", fmt.Errorf("error completing the multipart upload: %s: %s", result.Code, result.Message)
+	}
+
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(parts)), nil
+}
+
+// do sends a signed request for an object, retrying the network errors and the server errors, and returns the
+// body and the headers of the response
+func (u *S3Uploader) do(method, key string, query url.Values, headers map[string]string, body []byte) ([]byte, http.Header, error) {
+	var segments []string
+	for _, segment := range strings.Split(u.basePath+"/"+key, "/") {
+		segments = append(segments, s3Escape(segment))
+	}
+	escapedPath := strings.Join(segments, "/")
+
+	var queryParts []string
+	for name, values := range query {
+		for _, value := range values {
+			queryParts = append(queryParts, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	sort.Strings(queryParts)
+	rawQuery := strings.Join(queryParts, "&")
+
+	rawURL := u.scheme + "://" + u.host + escapedPath
+	if rawQuery != "" {
+		rawURL += "?" + rawQuery
+	}
+
+	var err error
+	backoff := time.Second
+	for attempt := 0; attempt <= uploadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var request *http.Request
+		request, err = http.NewRequest(method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		u.sign(request, escapedPath, rawQuery, body, time.Now().UTC())
+
+		var response *http.Response
+		response, err = u.client.Do(request)
+		if err != nil {
+			continue
+		}
+		data, readErr := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+		response.Body.Close()
+		if response.StatusCode < 300 {
+			if readErr != nil {
+				err = readErr
+				continue
+			}
+			return data, response.Header, nil
+		}
+		err = fmt.Errorf("s3 returned %s: %s", response.Status, strings.TrimSpace(string(data)))
+		if response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+			return nil, nil, err
+		}
+	}
+	return nil, nil, err
+}
+
+// sign adds the AWS Signature Version 4 of a request sent at now, with the SHA-256 of the payload
+func (u *S3Uploader) sign(request *http.Request, escapedPath, rawQuery string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if u.options.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", u.options.SessionToken)
+	}
+
+	values := map[string]string{"host": request.URL.Host}
+	names := []string{"host"}
+	for name := range request.Header {
+		lower := strings.ToLower(name)
+		values[lower] = strings.TrimSpace(request.Header.Get(name))
+		names = append(names, lower)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		escapedPath,
+		rawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + u.options.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+u.options.SecretKey), date)
+	key = hmacSHA256(key, u.options.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.options.AccessKey, scope, signedHeaders, signature))
+}
+
+// contentMD5 returns the headers with the Content-MD5 of a payload
+func contentMD5(headers map[string]string, sum []byte) map[string]string {
+	result := map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(sum)}
+	for name, value := range headers {
+		result[name] = value
+	}
+	return result
+}
+
+// s3Escape percent-encodes a path segment or a query component, keeping only the unreserved characters
+func s3Escape(value string) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SEGBRecord is a record of a Biome SEGB stream file. Timestamps are CFAbsoluteTime values,
+// Data is the payload (usually a protocol buffer message).
+type SEGBRecord struct {
+	Offset     int
+	State      string
+	Timestamp  float64
+	Timestamp2 float64
+	Data       []byte
+}
+
+// SEGB format constants
+const (
+	segbMagic            = "SEGB"
+	segbV1HeaderLength   = 56
+	segbV1MagicOffset    = 52
+	segbV1RecordHeader   = 32
+	segbV2HeaderLength   = 32
+	segbV2TrailerEntry   = 16
+	segbV2RecordChecksum = 8
+)
+
+// SEGB record states
+var segbStates = map[uint32]string{
+	1: "written",
+	3: "deleted",
+	4: "unknown",
+}
+
+// ParseSEGB parses the records of a Biome SEGB stream file. Both the original format (magic at offset 0x34,
+// records chained from the header) and the version 2 format (magic at offset 0, records indexed by a
+// trailer at the end of the file) are supported.
+func ParseSEGB(data []byte) ([]SEGBRecord, error) {
+	switch {
+	case len(data) >= segbV2HeaderLength && string(data[:4]) == segbMagic:
+		return parseSEGBv2(data)
+	case len(data) >= segbV1HeaderLength && string(data[segbV1MagicOffset:segbV1MagicOffset+4]) == segbMagic:
+		return parseSEGBv1(data)
+	}
+	return nil, fmt.Errorf("not a SEGB file")
+}
+
+// parseSEGBv1 parses the original format, where every record has a 32 bytes header (data length, state,
+// two timestamps, checksum) and is aligned to 8 bytes. The header stores the end of the written data.
+func parseSEGBv1(data []byte) ([]SEGBRecord, error) {
+	end := int(binary.LittleEndian.Uint32(data[:4]))
+	if end <= segbV1HeaderLength || end > len(data) {
+		end = len(data)
+	}
+
+	var records []SEGBRecord
+	offset := segbV1HeaderLength
+	for offset+segbV1RecordHeader <= end {
+		header := data[offset : offset+segbV1RecordHeader]
+		length := int(int32(binary.LittleEndian.Uint32(header[0:4])))
+		if length <= 0 || offset+segbV1RecordHeader+length > end {
+			break
+		}
+		state := binary.LittleEndian.Uint32(header[4:8])
+		record := SEGBRecord{
+			Offset:     offset,
+			State:      segbState(state),
+			Timestamp:  math.Float64frombits(binary.LittleEndian.Uint64(header[8:16])),
+			Timestamp2: math.Float64frombits(binary.LittleEndian.Uint64(header[16:24])),
+			Data:       data[offset+segbV1RecordHeader : offset+segbV1RecordHeader+length],
+		}
+		records = append(records, record)
+
+		offset += segbV1RecordHeader + length
+		if offset%8 != 0 {
+			offset += 8 - offset%8
+		}
+	}
+	return records, nil
+}
+
+// parseSEGBv2 parses the version 2 format. The header holds the number of entries, the trailer one
+// entry per record (end offset relative to the end of the header, state and timestamp). Every record
+// starts with a checksum and is aligned to 4 bytes.
+func parseSEGBv2(data []byte) ([]SEGBRecord, error) {
+	count := int(binary.LittleEndian.Uint32(data[4:8]))
+	trailerStart := len(data) - count*segbV2TrailerEntry
+	if count < 0 || trailerStart < segbV2HeaderLength {
+		return nil, fmt.Errorf("invalid SEGB entry count %d", count)
+	}
+
+	type segbEntry struct {
+		end       int
+		state     uint32
+		timestamp float64
+	}
+	entries := make([]segbEntry, 0, count)
+	for i := 0; i < count; i++ {
+		entry := data[trailerStart+i*segbV2TrailerEntry : trailerStart+(i+1)*segbV2TrailerEntry]
+		entries = append(entries, segbEntry{
+			end:       int(binary.LittleEndian.Uint32(entry[0:4])),
+			state:     binary.LittleEndian.Uint32(entry[4:8]),
+			timestamp: math.Float64frombits(binary.LittleEndian.Uint64(entry[8:16])),
+		})
+	}
+	// Entries are not always stored in the order of the records
+	sort.Slice(entries, func(i, j int) bool { return entries[i].end < entries[j].end })
+
+	var records []SEGBRecord
+	start := 0
+	for _, entry := range entries {
+		offset := segbV2HeaderLength + start
+		end := segbV2HeaderLength + entry.end
+		if end > trailerStart || end < offset+segbV2RecordChecksum {
+			break
+		}
+		records = append(records, SEGBRecord{
+			Offset:    offset,
+			State:     segbState(entry.state),
+			Timestamp: entry.timestamp,
+			Data:      data[offset+segbV2RecordChecksum : end],
+		})
+
+		start = entry.end
+		if start%4 != 0 {
+			start += 4 - start%4
+		}
+	}
+	return records, nil
+}
+
+func segbState(state uint32) string {
+	if name, ok := segbStates[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", state)
+}
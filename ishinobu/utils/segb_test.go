@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSEGB(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		want    []SEGBRecord
+		wantErr bool
+	}{
+		{
+			name: "original format",
+			file: "segb_v1.segb",
+			want: []SEGBRecord{
+				{Offset: 56, State: "written", Timestamp: 700000000, Timestamp2: 700000001.5, Data: []byte("\x0a\x03abc")},
+				{Offset: 96, State: "deleted", Timestamp: 700000100, Timestamp2: 700000101.5, Data: []byte("\x0a\x02de")},
+			},
+		},
+		{
+			name: "original format with a record past the written data",
+			file: "segb_v1_truncated.segb",
+			want: []SEGBRecord{
+				{Offset: 56, State: "written", Timestamp: 700000000, Timestamp2: 700000001.5, Data: []byte("\x0a\x03abc")},
+			},
+		},
+		{
+			name: "version 2 with unordered trailer",
+			file: "segb_v2.segb",
+			want: []SEGBRecord{
+				{Offset: 32, State: "written", Timestamp: 700000200, Data: []byte("\x0a\x03xyz")},
+				{Offset: 48, State: "written", Timestamp: 700000300, Data: []byte("\x0a\x01q")},
+			},
+		},
+		{
+			name:    "version 2 with more entries than the file holds",
+			data:    append([]byte("SEGB\xff\x00\x00\x00"), make([]byte, 24)...),
+			wantErr: true,
+		},
+		{
+			name:    "not a SEGB file",
+			data:    make([]byte, 64),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data
+			if tt.file != "" {
+				var err error
+				data, err = os.ReadFile(filepath.Join("testdata", tt.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := ParseSEGB(data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSEGB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSEGB() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SFTPOptions configures the upload of the collection archives to an SFTP server.
+type SFTPOptions struct {
+	Host string
+	Port int
+	User string
+	// KeyFile is the private key authenticating the user, the SSH agent and the SSH configuration are used when empty
+	KeyFile string
+	// Destination is the remote folder receiving the archives
+	Destination string
+	// KnownHostsFile replaces the known hosts of the user, AcceptNewHostKey trusts the key of an unknown host
+	KnownHostsFile   string
+	AcceptNewHostKey bool
+}
+
+// SFTPUploader uploads the collection archives with the sftp client of the system (OpenSSH) in batch mode.
+type SFTPUploader struct {
+	options SFTPOptions
+}
+
+// NewSFTPUploader returns an uploader to the destination folder of the options.
+func NewSFTPUploader(options SFTPOptions) (*SFTPUploader, error) {
+	if options.Host == "" || options.User == "" {
+		return nil, fmt.Errorf("sftp upload requires a host and a user")
+	}
+	if _, err := exec.LookPath("sftp"); err != nil {
+		return nil, fmt.Errorf("sftp client not found: %v", err)
+	}
+	if options.Port == 0 {
+		options.Port = 22
+	}
+	if options.Destination == "" {
+		options.Destination = "."
+	}
+	return &SFTPUploader{options: options}, nil
+}
+
+func (u *SFTPUploader) Name() string {
+	return "sftp"
+}
+
+// Upload sends the archive to <name>.part, resuming the transfer from the size of the partial file after a failure,
+// and renames it once its size matches the archive, replacing an archive previously uploaded with the same name.
+// The size is the only check done by the upload, as sftp cannot hash a remote file: a <name>.sha256 file is
+// uploaded next to the archive so that its checksum can be verified on the server (sha256sum -c).
+func (u *SFTPUploader) Upload(archive string) (string, error) {
+	checksum, err := FileSHA256(archive)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(archive)
+	remote := path.Join(u.options.Destination, name)
+
+	checksumFile, err := os.CreateTemp("", "ishinobu-*.sha256")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(checksumFile.Name())
+	_, err = fmt.Fprintf(checksumFile, "%s  %s\n", checksum, name)
+	checksumFile.Close()
+	if err != nil {
+		return "", err
+	}
+
+	backoff := time.Second
+	for attempt := 0; attempt <= uploadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		// The first attempt starts the transfer, the others resume it
+		put := "put"
+		if attempt > 0 {
+			put = "reput"
+		}
+		batch := []string{
+			"-mkdir " + sftpQuote(u.options.Destination),
+			put + " " + sftpQuote(archive) + " " + sftpQuote(remote+".part"),
+		}
+		if _, err = u.run(batch); err != nil {
+			continue
+		}
+
+		var output string
+		if output, err = u.run([]string{"ls -ln " + sftpQuote(remote+".part")}); err != nil {
+			continue
+		}
+		if size := sftpFileSize(output); size != info.Size() {
+			err = fmt.Errorf("uploaded file size %d does not match the archive size %d", size, info.Size())
+			continue
+		}
+
+		// The rename fails when the target exists, the - prefix ignores the error when there is none to remove
+		batch = []string{
+			"-rm " + sftpQuote(remote),
+			"rename " + sftpQuote(remote+".part") + " " + sftpQuote(remote),
+			"put " + sftpQuote(checksumFile.Name()) + " " + sftpQuote(remote+".sha256"),
+		}
+		if _, err = u.run(batch); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("sftp://%s@%s:%d/%s", u.options.User, u.options.Host, u.options.Port, strings.TrimPrefix(remote, "/")), nil
+	}
+	return "", err
+}
+
+// run executes sftp commands in batch mode, stopping at the first failed command, and returns the output
+func (u *SFTPUploader) run(commands []string) (string, error) {
+	args := []string{
+		"-b", "-",
+		"-P", fmt.Sprintf("%d", u.options.Port),
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout=30",
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=4",
+	}
+	if u.options.KeyFile != "" {
+		args = append(args, "-i", u.options.KeyFile, "-o", "IdentitiesOnly=yes")
+	}
+	if u.options.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+u.options.KnownHostsFile)
+	}
+	if u.options.AcceptNewHostKey {
+		args = append(args, "-o", "StrictHostKeyChecking=accept-new")
+	} else {
+		args = append(args, "-o", "StrictHostKeyChecking=yes")
+	}
+	args = append(args, u.options.User+"@"+u.options.Host)
+
+	command := exec.Command("sftp", args...)
+	command.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("sftp failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// sftpQuote quotes a path of an sftp batch command
+func sftpQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// sftpFileSize returns the size of a file listed by ls -ln, or -1
+func sftpFileSize(output string) int64 {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		var size int64
+		if _, err := fmt.Sscanf(fields[4], "%d", &size); err == nil {
+			return size
+		}
+	}
+	return -1
+}
@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sink forwards the records of the modules to a remote collector, in addition to the output files.
+type Sink interface {
+	// Name identifies the sink in the run manifest and in the name of its spill file
+	Name() string
+	// Send delivers a batch of records. Errors are retried, then the batch is spilled to disk.
+	Send(batch []SinkRecord) error
+	Close() error
+}
+
+// PermanentError marks a sink error that retrying cannot fix, such as a rejected token.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// PartialError reports the records of a batch that were not delivered, which are the only ones retried. Err is a
+// PermanentError when none of them can be delivered by retrying.
+type PartialError struct {
+	Failed []SinkRecord
+	Err    error
+}
+
+func (e PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PartialError) Unwrap() error {
+	return e.Err
+}
+
+// SinkRecord is a record with the module that produced it.
+type SinkRecord struct {
+	Module string
+	Record Record
+}
+
+// SinkOptions configures the batching of the records forwarded to a sink.
+type SinkOptions struct {
+	BatchSize     int
+	FlushInterval time.Duration
+	Retries       int
+	// SpillDir receives the batches that could not be delivered (<sink name>.spill.jsonl)
+	SpillDir string
+}
+
+// DefaultSinkOptions returns the batching used by the sinks unless configured otherwise.
+func DefaultSinkOptions(spillDir string) SinkOptions {
+	return SinkOptions{BatchSize: 500, FlushInterval: 5 * time.Second, Retries: 3, SpillDir: spillDir}
+}
+
+// sinkQueueSize is the number of full batches waiting for delivery before the writers of the modules are slowed down
+const sinkQueueSize = 4
+
+// sinkForwarder batches the records of a sink and delivers them with retries from its own goroutine, so that a slow
+// or unreachable collector does not hold the locks taken by the writers of the modules
+type sinkForwarder struct {
+	sink    Sink
+	options SinkOptions
+	// mu protects the pending batch, closeMu the queue while it is being closed
+	mu      sync.Mutex
+	closeMu sync.RWMutex
+	batch   []SinkRecord
+	closed  bool
+	queue   chan []SinkRecord
+	wg      sync.WaitGroup
+	// Only updated by the goroutine of the forwarder
+	sent    int
+	spilled int
+	lastErr error
+}
+
+var (
+	sinks   []*sinkForwarder
+	sinksMu sync.Mutex
+)
+
+// AddSink registers a sink receiving every record written by a DataWriter. The records are sent in batches of
+// options.BatchSize and at least every options.FlushInterval.
+func AddSink(sink Sink, options SinkOptions) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 1
+	}
+	forwarder := &sinkForwarder{sink: sink, options: options, queue: make(chan []SinkRecord, sinkQueueSize)}
+	forwarder.wg.Add(1)
+	go forwarder.run()
+
+	sinksMu.Lock()
+	sinks = append(sinks, forwarder)
+	sinksMu.Unlock()
+}
+
+// CloseSinks flushes and closes the sinks and returns the delivery status of each sink.
+func CloseSinks() map[string]string {
+	sinksMu.Lock()
+	forwarders := sinks
+	sinks = nil
+	sinksMu.Unlock()
+
+	status := make(map[string]string)
+	for _, forwarder := range forwarders {
+		forwarder.mu.Lock()
+		forwarder.closed = true
+		batch := forwarder.takeBatch()
+		forwarder.mu.Unlock()
+
+		// Waits for the records being queued by the writers before closing the queue
+		forwarder.closeMu.Lock()
+		if batch != nil {
+			forwarder.queue <- batch
+		}
+		close(forwarder.queue)
+		forwarder.closeMu.Unlock()
+		forwarder.wg.Wait()
+
+		if err := forwarder.sink.Close(); err != nil && forwarder.lastErr == nil {
+			forwarder.lastErr = err
+		}
+
+		status[forwarder.sink.Name()] = fmt.Sprintf("sent %d records, spilled %d", forwarder.sent, forwarder.spilled)
+		if forwarder.lastErr != nil {
+			status[forwarder.sink.Name()] += fmt.Sprintf(" (last error: %v)", forwarder.lastErr)
+		}
+	}
+	return status
+}
+
+// forwardRecord queues a record for every registered sink. A full batch is handed to the goroutine of the sink,
+// waiting only when the queue of the sink is full.
+func forwardRecord(module string, record Record) {
+	sinksMu.Lock()
+	forwarders := sinks
+	sinksMu.Unlock()
+
+	for _, forwarder := range forwarders {
+		forwarder.mu.Lock()
+		if forwarder.closed {
+			forwarder.mu.Unlock()
+			continue
+		}
+		forwarder.batch = append(forwarder.batch, SinkRecord{Module: module, Record: record})
+		var batch []SinkRecord
+		if len(forwarder.batch) >= forwarder.options.BatchSize {
+			batch = forwarder.takeBatch()
+		}
+		forwarder.closeMu.RLock()
+		forwarder.mu.Unlock()
+		if batch != nil {
+			forwarder.queue <- batch
+		}
+		forwarder.closeMu.RUnlock()
+	}
+}
+
+// takeBatch returns the pending batch and starts a new one. The caller holds the lock.
+func (f *sinkForwarder) takeBatch() []SinkRecord {
+	batch := f.batch
+	f.batch = nil
+	return batch
+}
+
+// run delivers the queued batches, and the pending batch every options.FlushInterval, until the queue is closed
+func (f *sinkForwarder) run() {
+	defer f.wg.Done()
+	var tick <-chan time.Time
+	if f.options.FlushInterval > 0 {
+		ticker := time.NewTicker(f.options.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case batch, ok := <-f.queue:
+			if !ok {
+				return
+			}
+			f.deliver(batch)
+		case <-tick:
+			f.mu.Lock()
+			batch := f.takeBatch()
+			f.mu.Unlock()
+			f.deliver(batch)
+		}
+	}
+}
+
+// deliver sends a batch, retrying with an exponential backoff, and spills it to disk when it cannot be delivered.
+// It is only called by the goroutine of the forwarder, without holding any lock.
+func (f *sinkForwarder) deliver(batch []SinkRecord) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	backoff := time.Second
+	for attempt := 0; attempt <= f.options.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = f.sink.Send(batch); err == nil {
+			f.sent += len(batch)
+			return
+		}
+		if partial, ok := err.(PartialError); ok {
+			f.sent += len(batch) - len(partial.Failed)
+			batch = partial.Failed
+		}
+		var permanent PermanentError
+		if errors.As(err, &permanent) {
+			break
+		}
+	}
+	f.lastErr = err
+
+	if spillErr := f.spill(batch); spillErr != nil {
+		f.lastErr = fmt.Errorf("%v, spill failed: %v", err, spillErr)
+		return
+	}
+	f.spilled += len(batch)
+}
+
+// spill appends the records of a batch to the spill file of the sink, one JSON object per line
+func (f *sinkForwarder) spill(batch []SinkRecord) error {
+	if f.options.SpillDir == "" {
+		return fmt.Errorf("no spill directory")
+	}
+	path := filepath.Join(f.options.SpillDir, f.sink.Name()+".spill.jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, item := range batch {
+		document := RecordDocument(item.Module, item.Record)
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordDocument returns the JSON document of a record sent to the sinks: the record fields with the module, or
+// the ECS document when the ECS output is enabled.
+func RecordDocument(module string, record Record) map[string]interface{} {
+	if ecsOutput {
+		return ECSDocument(module, record)
+	}
+	document := jsonRecord(record)
+	document["module"] = module
+	return document
+}
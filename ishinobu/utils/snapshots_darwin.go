@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// getattrlistbulk(2) lists the snapshots of a volume with FSOPT_LIST_SNAPSHOT, as fs_snapshot_list(2) does
+const (
+	sysGetattrlistbulk   = 461
+	fsoptListSnapshot    = 0x00000040
+	attrBitMapCount      = 5
+	attrCmnName          = 0x00000001
+	attrCmnCrtime        = 0x00000200
+	attrCmnReturnedAttrs = 0x80000000
+)
+
+// attrlist is the struct attrlist of getattrlist(2)
+type attrlist struct {
+	bitmapCount uint16
+	reserved    uint16
+	commonAttr  uint32
+	volAttr     uint32
+	dirAttr     uint32
+	fileAttr    uint32
+	forkAttr    uint32
+}
+
+// APFSSnapshotCreationTimes returns the creation time in TimeFormat of the snapshots of the volume mounted at
+// volume, by snapshot name.
+func APFSSnapshotCreationTimes(volume string) (map[string]string, error) {
+	dir, err := os.Open(volume)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	attributes := attrlist{bitmapCount: attrBitMapCount, commonAttr: attrCmnReturnedAttrs | attrCmnName | attrCmnCrtime}
+	buffer := make([]byte, 64*1024)
+	times := make(map[string]string)
+	for {
+		count, _, errno := syscall.Syscall6(sysGetattrlistbulk, dir.Fd(), uintptr(unsafe.Pointer(&attributes)),
+			uintptr(unsafe.Pointer(&buffer[0])), uintptr(len(buffer)), fsoptListSnapshot, 0)
+		if errno != 0 {
+			return times, errno
+		}
+		if count == 0 {
+			return times, nil
+		}
+
+		// Each entry: length, returned attributes (attribute_set_t), name (attrreference_t) and creation time
+		// (struct timespec)
+		entry := buffer
+		for i := 0; i < int(count) && len(entry) >= 48; i++ {
+			length := int(binary.LittleEndian.Uint32(entry[0:4]))
+			if length < 48 || length > len(entry) {
+				break
+			}
+			nameOffset := 24 + int(int32(binary.LittleEndian.Uint32(entry[24:28])))
+			nameLength := int(binary.LittleEndian.Uint32(entry[28:32]))
+			seconds := int64(binary.LittleEndian.Uint64(entry[32:40]))
+			if nameOffset+nameLength <= length {
+				name := strings.TrimRight(string(entry[nameOffset:nameOffset+nameLength]), "\x00")
+				times[name] = time.Unix(seconds, 0).UTC().Format(TimeFormat)
+			}
+			entry = entry[length:]
+		}
+	}
+}
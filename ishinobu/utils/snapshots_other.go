@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package utils
+
+import "fmt"
+
+// APFSSnapshotCreationTimes returns the creation time in TimeFormat of the snapshots of the volume mounted at
+// volume, by snapshot name. Snapshots are only listed on macOS.
+func APFSSnapshotCreationTimes(volume string) (map[string]string, error) {
+	return nil, fmt.Errorf("APFS snapshots are only supported on macOS")
+}
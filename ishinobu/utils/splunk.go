@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SplunkSink posts the records to a Splunk HTTP Event Collector.
+type SplunkSink struct {
+	url      string
+	token    string
+	index    string
+	hostname string
+	client   *http.Client
+}
+
+// NewSplunkSink returns a sink posting to the event endpoint of a HEC (https://splunk:8088). The index is
+// optional and defaults to the index of the token.
+func NewSplunkSink(url, token, index, hostname string, insecure bool) (*SplunkSink, error) {
+	if url == "" || token == "" {
+		return nil, fmt.Errorf("splunk sink requires a URL and a token")
+	}
+	url = strings.TrimSuffix(url, "/")
+	if !strings.Contains(url, "/services/collector") {
+		url += "/services/collector/event"
+	}
+	return &SplunkSink{
+		url:      url,
+		token:    token,
+		index:    index,
+		hostname: hostname,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+		},
+	}, nil
+}
+
+func (s *SplunkSink) Name() string {
+	return "splunk"
+}
+
+// Send posts a batch as concatenated HEC events. The time of each event is its event timestamp.
+func (s *SplunkSink) Send(batch []SinkRecord) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, item := range batch {
+		event := map[string]interface{}{
+			"host":       s.hostname,
+			"source":     "ishinobu:" + item.Module,
+			"sourcetype": "ishinobu",
+			"event":      RecordDocument(item.Module, item.Record),
+		}
+		if t, ok := NormalizeTimestamp(item.Record.EventTimestamp); ok {
+			event["time"] = t.Unix()
+		}
+		if s.index != "" {
+			event["index"] = s.index
+		}
+		if err := encoder.Encode(event); err != nil {
+			return PermanentError{err}
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return PermanentError{err}
+	}
+	request.Header.Set("Authorization", "Splunk "+s.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+	err = fmt.Errorf("splunk HEC returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+	// Rejected tokens, indexes or events are not retried
+	if response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests {
+		return PermanentError{err}
+	}
+	return err
+}
+
+func (s *SplunkSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
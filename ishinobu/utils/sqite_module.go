@@ -2,6 +2,8 @@ package utils
 
 import (
 	"database/sql"
+	"os"
+	"path/filepath"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -20,3 +22,62 @@ func QuerySQLite(dbPath string, query string) (*sql.Rows, error) {
 
 	return rows, nil
 }
+
+// CopyDatabase copies a SQLite database and its -wal/-shm companions to dstDir
+// so it can be queried without locking or modifying the original files.
+// Returns the path of the copied database.
+func CopyDatabase(src, dstDir string) (string, error) {
+	dst := filepath.Join(dstDir, filepath.Base(src))
+	if err := CopyFile(src, dst); err != nil {
+		return "", err
+	}
+
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(src + suffix); err == nil {
+			if err := CopyFile(src+suffix, dst+suffix); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return dst, nil
+}
+
+// QuerySQLiteMaps runs a query and returns every row as a map of column names to values.
+// Text and blob columns are returned as strings.
+func QuerySQLiteMaps(dbPath string, query string) ([]map[string]interface{}, error) {
+	rows, err := QuerySQLite(dbPath, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return results, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if data, ok := values[i].([]byte); ok {
+				row[column] = string(data)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		results = append(results, row)
+	}
+
+	return results, rows.Err()
+}
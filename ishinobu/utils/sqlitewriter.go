@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SQLiteOutputFileName is the database holding the records of every module with the sqlite export format.
+const SQLiteOutputFileName = "ishinobu.sqlite"
+
+// sqliteOutput is a database shared by the writers of the modules running in parallel
+type sqliteOutput struct {
+	db     *sql.DB
+	mu     sync.Mutex
+	refs   int
+	closed bool
+}
+
+// sqliteWriter writes the records of a module to its table and to the unified records table
+type sqliteWriter struct {
+	path    string
+	output  *sqliteOutput
+	table   string
+	columns map[string]bool
+}
+
+var (
+	sqliteOutputs   = make(map[string]*sqliteOutput)
+	sqliteOutputsMu sync.Mutex
+)
+
+const sqliteRecordsSchema = `CREATE TABLE IF NOT EXISTS records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	module TEXT,
+	collection_timestamp TEXT,
+	event_timestamp TEXT,
+	source_file TEXT,
+	data TEXT
+);
+CREATE INDEX IF NOT EXISTS records_event_timestamp ON records (event_timestamp);
+CREATE INDEX IF NOT EXISTS records_module ON records (module);`
+
+// newSQLiteWriter opens the run database of outDir, creating the records table and the table of the module
+func newSQLiteWriter(outDir, module string) (*sqliteWriter, error) {
+	path := filepath.Join(outDir, SQLiteOutputFileName)
+
+	sqliteOutputsMu.Lock()
+	defer sqliteOutputsMu.Unlock()
+	output, ok := sqliteOutputs[path]
+	if !ok {
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			return nil, err
+		}
+		// A single connection serializes the writes of the modules
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec(`PRAGMA synchronous = OFF; ` + sqliteRecordsSchema); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating the records table: %v", err)
+		}
+		output = &sqliteOutput{db: db}
+		sqliteOutputs[path] = output
+	}
+
+	table := strings.ReplaceAll(cleanKey(module), "-", "_")
+	if table == "" || table == "records" {
+		table = "module_" + table
+	}
+	output.mu.Lock()
+	_, err := output.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (collection_timestamp TEXT, event_timestamp TEXT, source_file TEXT)`, table))
+	columns := make(map[string]bool)
+	if err == nil {
+		var rows *sql.Rows
+		rows, err = output.db.Query(fmt.Sprintf(`PRAGMA table_info("%s")`, table))
+		if err == nil {
+			for rows.Next() {
+				var cid, notNull, pk int
+				var name, columnType string
+				var defaultValue interface{}
+				if rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk) == nil {
+					columns[name] = true
+				}
+			}
+			rows.Close()
+		}
+	}
+	output.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("error creating table %s: %v", table, err)
+	}
+
+	output.refs++
+	return &sqliteWriter{path: path, output: output, table: table, columns: columns}, nil
+}
+
+// write inserts a record in the table of the module, adding the missing columns, and in the records table
+func (w *sqliteWriter) write(record Record) error {
+	data, _ := record.Data.(map[string]interface{})
+
+	eventTimestamp := record.EventTimestamp
+	if t, ok := NormalizeTimestamp(eventTimestamp); ok {
+		eventTimestamp = t.Format(TimeFormat)
+	}
+
+	keys := make([]string, 0, len(data))
+	values := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		key = cleanKey(key)
+		if key == "" || key == "collection_timestamp" || key == "event_timestamp" || key == "source_file" {
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = sqliteValue(value)
+	}
+	sort.Strings(keys)
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.output.mu.Lock()
+	defer w.output.mu.Unlock()
+
+	for _, key := range keys {
+		if w.columns[key] {
+			continue
+		}
+		if _, err := w.output.db.Exec(fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s"`, w.table, key)); err != nil {
+			return fmt.Errorf("error adding column %s to %s: %v", key, w.table, err)
+		}
+		w.columns[key] = true
+	}
+
+	columns := []string{`"collection_timestamp"`, `"event_timestamp"`, `"source_file"`}
+	args := []interface{}{record.CollectionTimestamp, eventTimestamp, record.SourceFile}
+	for _, key := range keys {
+		columns = append(columns, `"`+key+`"`)
+		args = append(args, values[key])
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES (%s)`, w.table, strings.Join(columns, ", "), placeholders)
+	if _, err := w.output.db.Exec(query, args...); err != nil {
+		return err
+	}
+
+	_, err = w.output.db.Exec(`INSERT INTO records (module, collection_timestamp, event_timestamp, source_file, data) VALUES (?, ?, ?, ?, ?)`,
+		w.table, record.CollectionTimestamp, eventTimestamp, record.SourceFile, string(dataJSON))
+	return err
+}
+
+// close releases the run database, which is closed once every writer is closed
+func (w *sqliteWriter) close() error {
+	sqliteOutputsMu.Lock()
+	defer sqliteOutputsMu.Unlock()
+	w.output.refs--
+	if w.output.refs > 0 || w.output.closed {
+		return nil
+	}
+	w.output.closed = true
+	delete(sqliteOutputs, w.path)
+	return w.output.db.Close()
+}
+
+// CloseSQLiteOutputs closes the run databases still open at the end of the run, whether or not every module closed
+// its writers.
+func CloseSQLiteOutputs() error {
+	sqliteOutputsMu.Lock()
+	defer sqliteOutputsMu.Unlock()
+	var firstErr error
+	for path, output := range sqliteOutputs {
+		output.mu.Lock()
+		output.closed = true
+		if err := output.db.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error closing %s: %v", path, err)
+		}
+		output.mu.Unlock()
+		delete(sqliteOutputs, path)
+	}
+	return firstErr
+}
+
+// sqliteValue converts a record value to a value stored by the SQLite driver. Nested values are stored as JSON.
+func sqliteValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int32, int64, uint32, float32, float64, []byte:
+		return v
+	case uint64:
+		return fmt.Sprintf("%d", v)
+	case map[string]interface{}, []interface{}, []string, []map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Facility local0 and severity informational
+	syslogPriority = 16*8 + 6
+	cefVersion     = "1.0"
+)
+
+// CEF extension keys of the record fields shared by the modules. The other fields keep their name.
+var cefFields = map[string]string{
+	"username":       "suser",
+	"user":           "suser",
+	"uid":            "suid",
+	"path":           "filePath",
+	"file_path":      "filePath",
+	"target_path":    "filePath",
+	"sha256":         "fileHash",
+	"size":           "fsize",
+	"url":            "request",
+	"referrer":       "requestContext",
+	"pid":            "spid",
+	"process":        "sproc",
+	"command":        "cs1",
+	"command_line":   "cs1",
+	"message":        "msg",
+	"event":          "act",
+	"local_address":  "src",
+	"local_port":     "spt",
+	"remote_address": "dst",
+	"remote_port":    "dpt",
+	"protocol":       "proto",
+}
+
+var (
+	cefKeyRegex    = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	syslogMsgRegex = regexp.MustCompile(`[^!-~]`)
+)
+
+// SyslogSink forwards the records as RFC 5424 syslog messages over TCP or TLS, with the JSON document of the
+// record or a CEF event as message. The messages are framed with octet counting (RFC 6587).
+type SyslogSink struct {
+	address  string
+	useTLS   bool
+	cef      bool
+	hostname string
+	insecure bool
+	conn     net.Conn
+}
+
+// NewSyslogSink returns a sink sending to a collector at address (host:port). The protocol is tcp or tls and the
+// format is rfc5424 or cef.
+func NewSyslogSink(address, protocol, format, hostname string, insecure bool) (*SyslogSink, error) {
+	if address == "" {
+		return nil, fmt.Errorf("syslog sink requires an address")
+	}
+	if protocol != "tcp" && protocol != "tls" {
+		return nil, fmt.Errorf("unsupported syslog protocol: %s", protocol)
+	}
+	if format != "rfc5424" && format != "cef" {
+		return nil, fmt.Errorf("unsupported syslog format: %s", format)
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{
+		address:  address,
+		useTLS:   protocol == "tls",
+		cef:      format == "cef",
+		hostname: hostname,
+		insecure: insecure,
+	}, nil
+}
+
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Send writes a batch on the connection to the collector, which is opened again after a failure.
+func (s *SyslogSink) Send(batch []SinkRecord) error {
+	var buffer bytes.Buffer
+	for _, item := range batch {
+		message := s.message(item)
+		fmt.Fprintf(&buffer, "%d %s", len(message), message)
+	}
+
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := s.conn.Write(buffer.Bytes()); err != nil {
+		// Records partially written are sent again, the collector may receive duplicates
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// dial opens the connection to the collector
+func (s *SyslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if s.useTLS {
+		return tls.DialWithDialer(dialer, "tcp", s.address, &tls.Config{InsecureSkipVerify: s.insecure})
+	}
+	return dialer.Dial("tcp", s.address)
+}
+
+// message returns the syslog message of a record. The timestamp of the message is the event timestamp, or the
+// current time when the record has none.
+func (s *SyslogSink) message(item SinkRecord) string {
+	timestamp, ok := NormalizeTimestamp(item.Record.EventTimestamp)
+	if !ok {
+		timestamp = time.Now().UTC()
+	}
+	msgID := syslogMsgRegex.ReplaceAllString(item.Module, "_")
+	if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+
+	var body string
+	if s.cef {
+		body = cefEvent(item.Module, item.Record, s.hostname)
+	} else {
+		data, err := json.Marshal(RecordDocument(item.Module, item.Record))
+		if err != nil {
+			data = []byte(fmt.Sprintf("%v", item.Record.Data))
+		}
+		body = string(data)
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s ishinobu %d %s - %s", syslogPriority, timestamp.Format(time.RFC3339Nano),
+		syslogMsgRegex.ReplaceAllString(s.hostname, "_"), os.Getpid(), msgID, body)
+}
+
+// cefEvent formats a record as a CEF event: the module is the signature and the name of the event, and the record
+// fields are extensions, under their CEF key when the field is known.
+func cefEvent(module string, record Record, hostname string) string {
+	header := []string{"CEF:0", "gnzdotmx", "ishinobu", cefVersion, module, module, "3"}
+	for i, value := range header {
+		header[i] = strings.NewReplacer(`\`, `\\`, "|", `\|`).Replace(value)
+	}
+
+	extensions := map[string]string{
+		"dvchost": hostname,
+		"fname":   record.SourceFile,
+	}
+	if t, ok := NormalizeTimestamp(record.EventTimestamp); ok {
+		extensions["rt"] = fmt.Sprintf("%d", t.UnixMilli())
+	}
+	if t, ok := NormalizeTimestamp(record.CollectionTimestamp); ok {
+		extensions["start"] = fmt.Sprintf("%d", t.UnixMilli())
+	}
+
+	data, _ := record.Data.(map[string]interface{})
+	for key, value := range data {
+		if value == nil || value == "" {
+			continue
+		}
+		key = cleanKey(key)
+		if field, ok := cefFields[key]; ok {
+			key = field
+		} else {
+			key = cefKeyRegex.ReplaceAllString(key, "_")
+		}
+		if _, exists := extensions[key]; exists {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			extensions[key] = v
+		case map[string]interface{}, []interface{}:
+			encoded, _ := json.Marshal(v)
+			extensions[key] = string(encoded)
+		default:
+			extensions[key] = fmt.Sprintf("%v", v)
+		}
+	}
+	if _, ok := extensions["cs1"]; ok {
+		extensions["cs1Label"] = "command"
+	}
+
+	keys := make([]string, 0, len(extensions))
+	for key := range extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	escape := strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+escape.Replace(extensions[key]))
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(pairs, " ")
+}
+
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
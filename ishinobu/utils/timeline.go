@@ -0,0 +1,312 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimelineEvent is a record of a module output placed on the super-timeline.
+type TimelineEvent struct {
+	Timestamp time.Time
+	Module    string
+	Record    map[string]interface{}
+}
+
+// Layouts of the event timestamps written by the modules, tried in order
+var timelineTimeLayouts = []string{
+	TimeFormat,
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999-0700",
+	"2006-01-02 15:04:05.999999Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// NormalizeTimestamp parses an event timestamp in one of the layouts used by the modules and returns it in UTC.
+func NormalizeTimestamp(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range timelineTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ReadCollection calls fn with the module name, the format and the content of each module output (.json, .jsonl.gz
+// or .csv) of a collection folder or of a collection archive (.tar.gz or .zip). The run manifest is skipped.
+// The records table of the sqlite run database is read as one json output per module. Module outputs in the
+// bodyfile format cannot be read back and return an error.
+func ReadCollection(path string, fn func(module, format string, r io.Reader) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		files, err := filepath.Glob(filepath.Join(path, "*"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			module, format, ok := moduleOutputName(file)
+			if !ok {
+				continue
+			}
+			if format == "sqlite" {
+				if err := readSQLiteOutput(file, fn); err != nil {
+					return err
+				}
+				continue
+			}
+			if format == "bodyfile" {
+				return unreadableOutputError(file)
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			err = fn(module, format, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if strings.HasSuffix(path, ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, entry := range zr.File {
+			module, format, ok := moduleOutputName(entry.Name)
+			if !ok || entry.FileInfo().IsDir() {
+				continue
+			}
+			if format == "bodyfile" {
+				return unreadableOutputError(entry.Name)
+			}
+			f, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			if format == "sqlite" {
+				err = readArchivedSQLiteOutput(f, fn)
+			} else {
+				err = fn(module, format, f)
+			}
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		module, format, ok := moduleOutputName(header.Name)
+		if !ok {
+			continue
+		}
+		switch format {
+		case "bodyfile":
+			return unreadableOutputError(header.Name)
+		case "sqlite":
+			err = readArchivedSQLiteOutput(tr, fn)
+		default:
+			err = fn(module, format, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unreadableOutputError is the error returned for a module output in a format that cannot be read back
+func unreadableOutputError(path string) error {
+	return fmt.Errorf("%s: module outputs in the bodyfile format cannot be read, use a collection in the json, "+
+		"jsonl.gz, csv or sqlite format", filepath.Base(path))
+}
+
+// readArchivedSQLiteOutput extracts the sqlite run database of an archive to a temporary file to read it
+func readArchivedSQLiteOutput(r io.Reader, fn func(module, format string, r io.Reader) error) error {
+	tmpFile, err := os.CreateTemp("", "ishinobu-timeline-*.sqlite")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = io.Copy(tmpFile, r)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return readSQLiteOutput(tmpFile.Name(), fn)
+}
+
+// readSQLiteOutput calls fn with the records of each module of the records table of a sqlite run database, as
+// the JSON lines of the json output of the module.
+func readSQLiteOutput(path string, fn func(module, format string, r io.Reader) error) error {
+	rows, err := QuerySQLiteMaps(path, `SELECT module, collection_timestamp, event_timestamp, source_file, data FROM records ORDER BY module, id`)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	module := ""
+	for i, row := range rows {
+		rowModule := fmt.Sprintf("%v", row["module"])
+		if i > 0 && rowModule != module {
+			if err := fn(module, "json", &buffer); err != nil {
+				return err
+			}
+			buffer.Reset()
+		}
+		module = rowModule
+
+		record := make(map[string]interface{})
+		if data, ok := row["data"].(string); ok {
+			json.Unmarshal([]byte(data), &record)
+		}
+		for _, column := range []string{"collection_timestamp", "event_timestamp", "source_file"} {
+			record[column] = row[column]
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if len(rows) > 0 {
+		return fn(module, "json", &buffer)
+	}
+	return nil
+}
+
+// moduleOutputName returns the module name and the format of a module output file
+func moduleOutputName(path string) (string, string, bool) {
+	name := filepath.Base(path)
+	if name == ManifestFileName {
+		return "", "", false
+	}
+	if name == SQLiteOutputFileName {
+		return "", "sqlite", true
+	}
+	if strings.HasSuffix(name, ".jsonl.gz") {
+		return strings.TrimSuffix(name, ".jsonl.gz"), "jsonl.gz", true
+	}
+	ext := filepath.Ext(name)
+	if ext != ".json" && ext != ".csv" && ext != ".bodyfile" {
+		return "", "", false
+	}
+	return strings.TrimSuffix(name, ext), strings.TrimPrefix(ext, "."), true
+}
+
+// ReadModuleOutput reads the records of a module output written by DataWriter: one JSON object per line (gzip
+// compressed for jsonl.gz), or CSV rows of the timestamps and source file followed by "key: value" columns.
+func ReadModuleOutput(r io.Reader, format string) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+
+	if format == "jsonl.gz" {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	if format == "csv" {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return records, nil
+			}
+			if err != nil {
+				return records, err
+			}
+			if len(row) < 3 || row[1] == "events_timestamp" {
+				continue
+			}
+			record := map[string]interface{}{
+				"collection_timestamp": row[0],
+				"event_timestamp":      row[1],
+				"source_file":          row[2],
+			}
+			for _, column := range row[3:] {
+				key, value, _ := strings.Cut(column, ": ")
+				record[key] = value
+			}
+			records = append(records, record)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// SortTimeline sorts the events by timestamp, keeping the events without a timestamp at the end.
+func SortTimeline(events []TimelineEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Timestamp.IsZero() != events[j].Timestamp.IsZero() {
+			return !events[i].Timestamp.IsZero()
+		}
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+}
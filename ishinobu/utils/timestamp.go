@@ -8,6 +8,9 @@ import (
 
 const TimeFormat = "2006-01-02T15:04:05Z07:00"
 
+// Seconds between the Unix epoch and the Core Foundation epoch (2001-01-01)
+const cfAbsoluteTimeOffset = 978307200
+
 func Now() string {
 	return time.Now().Format(TimeFormat)
 }
@@ -42,8 +45,7 @@ func ConvertCFAbsoluteTimeToDate(cfTimeStr string) (string, error) {
 		return "", fmt.Errorf("failed to parse float from string '%s': %w", cfTimeStr, err)
 	}
 
-	const epochOffset = 978307200
-	unixTimestamp := cfTime + epochOffset
+	unixTimestamp := cfTime + cfAbsoluteTimeOffset
 	seconds := int64(unixTimestamp)
 	nanoseconds := int64((unixTimestamp - float64(seconds)) * 1e9)
 	t := time.Unix(seconds, nanoseconds).UTC()
@@ -74,3 +76,42 @@ func ParseChromeTimestamp(microsecondsStr string) string {
 	// Format the result to ISO 8601 with nanosecond precision and return
 	return timestamp.Format(TimeFormat)
 }
+
+// ConvertCFAbsoluteTime converts a Core Foundation absolute time (seconds since 2001-01-01)
+// stored as a float, as found in most Apple SQLite databases, to TimeFormat.
+func ConvertCFAbsoluteTime(cfTime float64) string {
+	formattedDate, _ := ConvertCFAbsoluteTimeToDate(strconv.FormatFloat(cfTime, 'f', -1, 64))
+	return formattedDate
+}
+
+// ConvertUnixTimestamp converts seconds since the Unix epoch to TimeFormat.
+// Returns an empty string when the timestamp is not set.
+func ConvertUnixTimestamp(seconds int64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return time.Unix(seconds, 0).UTC().Format(TimeFormat)
+}
+
+// LatestTimestamp returns the most recent of the given TimeFormat timestamps, ignoring empty values.
+func LatestTimestamp(timestamps ...string) string {
+	latest := ""
+	var latestTime time.Time
+	for _, timestamp := range timestamps {
+		t, err := time.Parse(TimeFormat, timestamp)
+		if err != nil {
+			continue
+		}
+		if latest == "" || t.After(latestTime) {
+			latest = timestamp
+			latestTime = t
+		}
+	}
+	return latest
+}
+
+// CFAbsoluteTime converts a time to Core Foundation absolute time (seconds since 2001-01-01),
+// to filter Apple databases by date.
+func CFAbsoluteTime(t time.Time) float64 {
+	return float64(t.Unix() - cfAbsoluteTimeOffset)
+}
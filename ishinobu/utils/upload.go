@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// Attempts of the requests of the uploads failing with a network or a server error, with an exponential backoff
+const uploadRetries = 3
+
+// Uploader sends the collection archive to a remote storage once the run is complete.
+type Uploader interface {
+	// Name identifies the uploader in the logs
+	Name() string
+	// Upload sends the archive at path and returns its remote location, once its checksum is verified
+	Upload(path string) (string, error)
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 of a file.
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
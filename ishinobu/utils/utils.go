@@ -13,6 +13,20 @@ func GetOutputFileName(moduleName, format, outputDir string) string {
 	return filepath.Join(outputDir, fileName)
 }
 
+// GlobPaths expands each glob pattern and returns all the matching paths.
+// Invalid patterns are ignored.
+func GlobPaths(patterns ...string) []string {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
 // ListFiles lists all files that match the given glob-like pattern.
 // Example pattern: /path/starts*/*ends/file-*.asl
 func ListFiles(pattern string) ([]string, error) {
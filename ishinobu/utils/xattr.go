@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ListExtendedAttributes returns the names of the extended attributes of a file, as listed by xattr.
+// Symbolic links are not followed.
+func ListExtendedAttributes(path string) ([]string, error) {
+	output, err := exec.Command("xattr", "-s", path).Output()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(output), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// GetExtendedAttribute returns the raw value of an extended attribute of a file.
+// xattr prints the value as hexadecimal bytes which are decoded here.
+func GetExtendedAttribute(path, name string) ([]byte, error) {
+	output, err := exec.Command("xattr", "-s", "-p", "-x", name, path).Output()
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.Join(strings.Fields(string(output)), ""))
+}
+
+// HashFile returns the MD5 and SHA-256 hashes of a file as hexadecimal strings.
+func HashFile(path string) (string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}